@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Accept and commit
+// -----------------
+//
+// Accepting an execution can commit everything the agent changed in one step. The commit
+// message is generated from the task and carries the execution ID as a trailer, so every
+// change can be traced back to the execution (and agent) that produced it.
+
+// Longest commit subject before the task title is cut short
+const commitSubjectMaxLength = 72
+
+var branchNameUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// acceptCommitRequest is the optional body of POST /api/task-executions/{id}/accept
+type acceptCommitRequest struct {
+	Commit       bool   `json:"commit"`        // stage and commit all changes
+	Message      string `json:"message"`       // replaces the generated message
+	CreateBranch bool   `json:"create_branch"` // commit on a branch named after the task
+	Branch       string `json:"branch"`        // branch name, defaults to the task's
+	Push         bool   `json:"push"`
+	Remote       string `json:"remote"`  // defaults to origin
+	Comment      string `json:"comment"` // why the execution was accepted, kept on the task
+}
+
+// acceptCommitResult describes the commit made while accepting
+type acceptCommitResult struct {
+	Committed bool   `json:"committed"` // false when there was nothing to commit
+	SHA       string `json:"sha,omitempty"`
+	Branch    string `json:"branch"`
+	Message   string `json:"message,omitempty"`
+	Pushed    bool   `json:"pushed"`
+	PushError string `json:"push_error,omitempty"`
+}
+
+// taskBranchName derives a branch name like task-12-fix-login-redirect from a task
+func taskBranchName(taskID int64, title string) string {
+	slug := strings.Trim(branchNameUnsafe.ReplaceAllString(strings.ToLower(title), "-"), "-")
+	if len(slug) > 40 {
+		slug = strings.TrimRight(slug[:40], "-")
+	}
+	if slug == "" {
+		return fmt.Sprintf("task-%d", taskID)
+	}
+	return fmt.Sprintf("task-%d-%s", taskID, slug)
+}
+
+// generateCommitMessage builds a commit message from the task, ending in trailers that identify the execution
+func generateCommitMessage(title, description string, executionID int64, agentName string) string {
+	subject := strings.TrimSpace(strings.SplitN(strings.TrimSpace(title), "\n", 2)[0])
+	if subject == "" {
+		subject = fmt.Sprintf("Task execution %d", executionID)
+	}
+	if len(subject) > commitSubjectMaxLength {
+		subject = strings.TrimSpace(subject[:commitSubjectMaxLength-3]) + "..."
+	}
+
+	parts := []string{subject}
+	if description = strings.TrimSpace(description); description != "" {
+		parts = append(parts, description)
+	}
+	trailers := fmt.Sprintf("Task-Execution: %d", executionID)
+	if agentName != "" {
+		trailers += "\nAgent: " + agentName
+	}
+	parts = append(parts, trailers)
+	return strings.Join(parts, "\n\n")
+}
+
+// commitAcceptedExecution stages and commits all changes in the execution's base directory,
+// switching to (or creating) the task branch first if asked to, and pushes if asked to
+func commitAcceptedExecution(ctx context.Context, execution db.GetTaskExecutionWithDetailsRow, req acceptCommitRequest) (*acceptCommitResult, error) {
+	dir := execution.BaseDirectoryPath
+	if out, _, err := runGit(dir, "rev-parse", "--is-inside-work-tree"); err != nil || strings.TrimSpace(out) != "true" {
+		return nil, fmt.Errorf("base directory is not a git repository")
+	}
+
+	result := &acceptCommitResult{}
+	if out, _, err := runGit(dir, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		result.Branch = strings.TrimSpace(out)
+	}
+
+	if req.CreateBranch || req.Branch != "" {
+		branch := req.Branch
+		if branch == "" {
+			branch = taskBranchName(execution.TaskID, execution.TaskTitle)
+		}
+		if out, _, err := runGit(dir, "check-ref-format", "--branch", branch); err != nil {
+			return nil, fmt.Errorf("invalid branch name %q: %s", branch, strings.TrimSpace(out))
+		}
+		if branch != result.Branch {
+			// Uncommitted changes come along to the new branch
+			if out, _, err := runGit(dir, "switch", "-c", branch); err != nil {
+				if out, _, err = runGit(dir, "switch", branch); err != nil {
+					return nil, fmt.Errorf("failed to switch to branch %s: %s", branch, strings.TrimSpace(out))
+				}
+			}
+			result.Branch = branch
+		}
+	}
+
+	if out, _, err := runGit(dir, "add", "-A"); err != nil {
+		return nil, fmt.Errorf("failed to stage changes: %s", strings.TrimSpace(out))
+	}
+
+	// Exit code 1 means there are staged changes
+	if _, code, _ := runGit(dir, "diff", "--cached", "--quiet"); code == 1 {
+		message := strings.TrimSpace(req.Message)
+		if message == "" {
+			message = generateCommitMessage(execution.TaskTitle, execution.TaskDescription, execution.ID, execution.AgentName)
+		}
+
+		args := []string{"commit"}
+		for _, paragraph := range strings.Split(message, "\n\n") {
+			args = append(args, "-m", paragraph)
+		}
+		if out, _, err := runGit(dir, args...); err != nil {
+			return nil, fmt.Errorf("failed to commit: %s", strings.TrimSpace(out))
+		}
+
+		out, _, err := runGit(dir, "rev-parse", "HEAD")
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve commit: %s", strings.TrimSpace(out))
+		}
+		result.Committed = true
+		result.SHA = strings.TrimSpace(out)
+		result.Message = message
+		recordTaskExecutionEvent(ctx, execution.ID, "changes_committed", "Committed changes on "+result.Branch, result.SHA, sql.NullInt64{Valid: false})
+	}
+
+	if req.Push {
+		remote := req.Remote
+		if remote == "" {
+			remote = "origin"
+		}
+		if result.Branch == "" {
+			result.PushError = "HEAD is detached, nothing to push"
+		} else if out, _, err := runGit(dir, "push", "-u", remote, result.Branch); err != nil {
+			// The commit stands even if the push fails
+			result.PushError = strings.TrimSpace(out)
+		} else {
+			result.Pushed = true
+			recordTaskExecutionEvent(ctx, execution.ID, "branch_pushed", "Pushed "+result.Branch+" to "+remote, "", sql.NullInt64{Valid: false})
+		}
+	}
+
+	return result, nil
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -44,8 +45,16 @@ type GitStatus struct {
 }
 
 func runGit(dir string, args ...string) (string, int, error) {
+	return runGitWithEnv(dir, nil, args...)
+}
+
+// runGitWithEnv runs git with extra NAME=value environment entries, e.g. GIT_INDEX_FILE
+func runGitWithEnv(dir string, env []string, args ...string) (string, int, error) {
 	cmd := exec.Command("git", args...)
 	cmd.Dir = dir
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -482,10 +491,8 @@ func handleGitAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, p
 		taskStatus := "skipped"
 		if body.TaskID != 0 {
 			if task, err := queries.GetTask(ctx, body.TaskID); err == nil {
-				if _, err := queries.UpdateTask(ctx, db.UpdateTaskParams{ID: task.ID, Title: task.Title, Description: task.Description, Status: "done"}); err == nil {
+				if moved := applyWorkflowEvent(ctx, task, workflowEventBranchMerged); moved.Status != task.Status {
 					taskStatus = "updated"
-				} else {
-					taskStatus = "failed"
 				}
 			} else {
 				taskStatus = "failed"
@@ -843,12 +850,14 @@ func handleGitAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, p
 }
 
 func handleAPI(w http.ResponseWriter, r *http.Request) {
-	// Set CORS headers with dynamic origin for trycloudflare.com subdomains
-	corsOrigin := getCORSOrigin(r)
-	w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	// Set CORS headers for allowed origins only
+	w.Header().Add("Vary", "Origin")
+	if corsOrigin := getCORSOrigin(r); corsOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", corsOrigin)
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
 	w.Header().Set("Content-Type", "application/json")
 
 	if r.Method == "OPTIONS" {
@@ -894,6 +903,24 @@ func handleAPI(w http.ResponseWriter, r *http.Request) {
 		handleRemotePortsAPI(w, r, ctx, pathParts[1:])
 	case "directory-dev-servers":
 		handleDirectoryDevServersAPI(w, r, ctx, pathParts[1:])
+	case "auto-responders":
+		handleAutoRespondersAPI(w, r, ctx, pathParts[1:])
+	case "environment-variables":
+		handleEnvironmentVariablesAPI(w, r, ctx, pathParts[1:])
+	case "sandbox":
+		handleSandboxAPI(w, r, ctx, pathParts[1:])
+	case "pull-requests":
+		handlePullRequestsAPI(w, r, ctx, pathParts[1:])
+	case "config":
+		handleConfigAPI(w, r, ctx, pathParts[1:])
+	case "users":
+		handleUsersAPI(w, r, ctx, pathParts[1:])
+	case "tokens":
+		handleAPITokensAPI(w, r, ctx, pathParts[1:])
+	case "audit":
+		handleAuditAPI(w, r, ctx, pathParts[1:])
+	case "tls":
+		handleTLSAPI(w, r, ctx, pathParts[1:])
 	default:
 		http.Error(w, "Unknown API endpoint", http.StatusNotFound)
 	}
@@ -919,6 +946,7 @@ type DirectoryDevServerSummary struct {
 	ProjectName     string `json:"project_name"`
 	TmuxSessionID   string `json:"tmux_session_id"`
 	Status          string `json:"status"`
+	ResourceUsage   *ResourceUsage `json:"resource_usage"`
 }
 
 type RemotePortSummary struct {
@@ -942,35 +970,40 @@ func handleDashboardAPI(w http.ResponseWriter, r *http.Request, ctx context.Cont
 	switch r.Method {
 	case "GET":
 		if len(pathParts) > 0 && pathParts[0] == "stats" {
-			// Get dashboard statistics
+			// Get dashboard statistics for the selected root
+			rootID, ok := requestRootID(w, r, ctx)
+			if !ok {
+				return
+			}
 			stats := DashboardStats{
 				GitChangesAwaitingReview: []TaskExecutionSummary{},
 				AgentsWaitingForInput:    []TaskExecutionSummary{},
 			}
 
-			// Count active tmux sessions
-			cmd := exec.Command("tmux", "list-sessions")
-			output, err := cmd.Output()
-			if err == nil {
-				sessions := strings.Split(strings.TrimSpace(string(output)), "\n")
-				if len(sessions) > 0 && sessions[0] != "" {
-					stats.ActiveSessions = len(sessions)
-				}
+			// Count active sessions
+			if sessions, err := sessionManager.List(); err == nil {
+				stats.ActiveSessions = len(sessions)
 			}
 
 			// Count projects
-			projects, err := queries.ListProjects(ctx)
+			projects, err := queries.GetProjectsByRootID(ctx, rootID)
 			if err == nil {
 				stats.Projects = len(projects)
 			}
+			projectIDs := make(map[int64]bool, len(projects))
+			for _, project := range projects {
+				projectIDs[project.ID] = true
+			}
 
 			// Count task executions and populate special lists
 			executions, err := queries.ListTaskExecutions(ctx)
 			if err == nil {
-				stats.TaskExecutions = len(executions)
-
 				// Check each execution for agents waiting for input
 				for _, execution := range executions {
+					if !projectIDs[execution.ProjectID] {
+						continue
+					}
+					stats.TaskExecutions++
 					summary := TaskExecutionSummary{
 						ID:          execution.ID,
 						TaskID:      execution.TaskID,
@@ -1033,7 +1066,7 @@ func handleDashboardAPI(w http.ResponseWriter, r *http.Request, ctx context.Cont
 			}
 
 			// Count agents
-			agents, err := queries.ListAgents(ctx)
+			agents, err := queries.GetAgentsByRootID(ctx, rootID)
 			if err == nil {
 				stats.Agents = len(agents)
 			}
@@ -1186,6 +1219,7 @@ func handleRemotePortsAPI(w http.ResponseWriter, r *http.Request, ctx context.Co
 			http.Error(w, "Failed to delete tunnel record", http.StatusInternalServerError)
 			return
 		}
+		invalidateRelatedOriginURLs()
 
 		json.NewEncoder(w).Encode(map[string]string{"status": "stopped"})
 
@@ -1196,9 +1230,8 @@ func handleRemotePortsAPI(w http.ResponseWriter, r *http.Request, ctx context.Co
 
 // startCloudflaredTunnel starts a cloudflared tunnel in a tmux session and monitors for the external URL
 func startCloudflaredTunnel(ctx context.Context, portID int64, port int, sessionName string) {
-	// Create tmux session and run cloudflared
-	tmuxCmd := exec.Command("tmux", "new-session", "-d", "-s", sessionName)
-	if err := tmuxCmd.Run(); err != nil {
+	// Create session and run cloudflared
+	if err := sessionManager.Create(sessionName, SessionOptions{}); err != nil {
 		log.Printf("Failed to create tmux session for cloudflared: %v", err)
 		queries.UpdateRemotePortStatus(ctx, db.UpdateRemotePortStatusParams{
 			ID:     portID,
@@ -1209,8 +1242,7 @@ func startCloudflaredTunnel(ctx context.Context, portID int64, port int, session
 
 	// Send cloudflared command to the session
 	cloudflaredCommand := fmt.Sprintf("cloudflared tunnel --url http://localhost:%d 2>&1 | tee /tmp/cloudflared_%s.log", port, sessionName)
-	sendCmd := exec.Command("tmux", "send-keys", "-t", sessionName, cloudflaredCommand, "Enter")
-	if err := sendCmd.Run(); err != nil {
+	if err := sessionManager.SendKeys(sessionName, cloudflaredCommand, "Enter"); err != nil {
 		log.Printf("Failed to start cloudflared: %v", err)
 		queries.UpdateRemotePortStatus(ctx, db.UpdateRemotePortStatusParams{
 			ID:     portID,
@@ -1276,6 +1308,7 @@ func monitorCloudflaredOutput(portID int64, sessionName string) {
 			ID:     portID,
 			Status: "connected",
 		})
+		invalidateRelatedOriginURLs()
 		log.Printf("Cloudflared tunnel connected: %s", url)
 		return
 	}
@@ -1286,20 +1319,19 @@ func monitorCloudflaredOutput(portID int64, sessionName string) {
 		ID:     portID,
 		Status: "error",
 	})
+	invalidateRelatedOriginURLs()
 }
 
 // stopCloudflaredTunnel stops a cloudflared tunnel by killing its tmux session
 func stopCloudflaredTunnel(sessionName string) {
 	// Send Ctrl-C to gracefully stop cloudflared
-	ctrlCCmd := exec.Command("tmux", "send-keys", "-t", sessionName, "C-c")
-	ctrlCCmd.Run()
+	sessionManager.SendKeys(sessionName, "C-c")
 
 	// Wait a moment for graceful shutdown
 	time.Sleep(500 * time.Millisecond)
 
-	// Kill the tmux session
-	killCmd := exec.Command("tmux", "kill-session", "-t", sessionName)
-	if err := killCmd.Run(); err != nil {
+	// Kill the session
+	if err := sessionManager.Kill(sessionName); err != nil {
 		log.Printf("Warning: failed to kill tmux session %s: %v", sessionName, err)
 	}
 
@@ -1308,68 +1340,6 @@ func stopCloudflaredTunnel(sessionName string) {
 	os.Remove(logFile)
 }
 
-func handleRootsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
-	switch r.Method {
-	case "GET":
-		if len(pathParts) == 0 {
-			// List all roots - for now just return empty array
-			json.NewEncoder(w).Encode([]Root{})
-		} else {
-			// Get specific root
-			id, err := strconv.ParseInt(pathParts[0], 10, 64)
-			if err != nil {
-				http.Error(w, "Invalid root ID", http.StatusBadRequest)
-				return
-			}
-
-			root, err := queries.GetRoot(ctx, id)
-			if err != nil {
-				http.Error(w, "Root not found", http.StatusNotFound)
-				return
-			}
-
-			// Get associated agents
-			agents, err := queries.GetAgentsByRootID(ctx, id)
-			if err != nil {
-				http.Error(w, "Failed to get agents", http.StatusInternalServerError)
-				return
-			}
-
-			// Get associated projects (simplified for now)
-			projects := []Project{}
-
-			result := dbRootToRoot(root, agents, projects)
-			json.NewEncoder(w).Encode(result)
-		}
-
-	case "POST":
-		var createReq struct {
-			LocalPort   string  `json:"local_port"`
-			ExternalUrl *string `json:"external_url"`
-		}
-
-		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
-			return
-		}
-
-		root, err := queries.CreateRoot(ctx, db.CreateRootParams{
-			LocalPort:   createReq.LocalPort,
-			ExternalUrl: stringToNullString(createReq.ExternalUrl),
-		})
-		if err != nil {
-			http.Error(w, "Failed to create root", http.StatusInternalServerError)
-			return
-		}
-
-		result := dbRootToRoot(root, []db.Agent{}, []Project{})
-		json.NewEncoder(w).Encode(result)
-
-	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	}
-}
-
 func handleTmuxSessionsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
 	switch r.Method {
 	case "GET":
@@ -1437,11 +1407,10 @@ func determineTaskExecutionStatus(sessionName string) string {
 
 // cleanupOrphanedSessionStates removes state entries for sessions that no longer exist
 func cleanupOrphanedSessionStates() {
-	// Get current tmux sessions to clean up orphaned states
-	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}")
-	output, err := cmd.Output()
+	// Get current sessions to clean up orphaned states
+	sessions, err := sessionManager.List()
 	if err != nil {
-		// If tmux isn't running or has no sessions, clear all states
+		// If sessions can't be listed, clear all states
 		sessionStatesMutex.Lock()
 		sessionStates = make(map[string]*SessionState)
 		sessionStatesMutex.Unlock()
@@ -1449,11 +1418,8 @@ func cleanupOrphanedSessionStates() {
 	}
 
 	currentSessionNames := make(map[string]bool)
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	for _, line := range lines {
-		if line != "" {
-			currentSessionNames[line] = true
-		}
+	for _, session := range sessions {
+		currentSessionNames[session.Name] = true
 	}
 
 	// Remove states for sessions that no longer exist
@@ -1471,20 +1437,17 @@ func captureSessionState(sessionName string) (*SessionState, error) {
 	now := time.Now()
 
 	// Capture the session content
-	contentCmd := exec.Command("tmux", "capture-pane", "-t", sessionName, "-e", "-p")
-	contentOutput, err := contentCmd.Output()
+	contentOutput, err := sessionManager.Capture(sessionName, CaptureOptions{Escapes: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to capture session content: %v", err)
 	}
-	content := strings.TrimSpace(string(contentOutput))
+	content := strings.TrimSpace(contentOutput)
 
 	// Capture cursor position for more precise state detection
-	cursorCmd := exec.Command("tmux", "display-message", "-t", sessionName, "-p", "#{cursor_x},#{cursor_y}")
-	cursorOutput, err := cursorCmd.Output()
+	cursorPos, err := sessionManager.Cursor(sessionName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to capture cursor position: %v", err)
 	}
-	cursorPos := strings.TrimSpace(string(cursorOutput))
 
 	return &SessionState{
 		Name:           sessionName,
@@ -1538,34 +1501,22 @@ func compareSessionStates(sessionName string, currentState *SessionState) string
 }
 
 func getTmuxSessions() ([]TmuxSession, error) {
-	// Get list of tmux sessions
-	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}|#{session_created}")
-	output, err := cmd.Output()
+	// Get list of sessions
+	sessionInfos, err := sessionManager.List()
 	if err != nil {
 		return nil, err
 	}
 
 	var sessions []TmuxSession
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 
-	for _, line := range lines {
-		if line == "" {
-			continue
-		}
-
-		parts := strings.Split(line, "|")
-		if len(parts) != 2 {
-			continue
-		}
-
-		sessionName := parts[0]
-		created := parts[1]
+	for _, info := range sessionInfos {
+		sessionName := info.Name
+		created := info.Created
 
 		// Get preview of the session with colors - capture more lines for scrollable view
 		preview := ""
-		previewCmd := exec.Command("tmux", "capture-pane", "-t", sessionName, "-e", "-p", "-S", "-20")
-		if previewOutput, err := previewCmd.Output(); err == nil {
-			rawPreview := strings.TrimSpace(string(previewOutput))
+		if previewOutput, err := sessionManager.Capture(sessionName, CaptureOptions{Escapes: true, History: 20}); err == nil {
+			rawPreview := strings.TrimSpace(previewOutput)
 			// Convert ANSI to HTML
 			preview = string(ansihtml.ConvertToHTML([]byte(rawPreview)))
 		}
@@ -1632,14 +1583,54 @@ func handleProjectsAPI(w http.ResponseWriter, r *http.Request, ctx context.Conte
 		return
 	}
 
+	// Handle auto-responders sub-resource: /api/projects/{id}/auto-responders
+	if len(pathParts) >= 2 && pathParts[1] == "auto-responders" {
+		handleProjectAutoRespondersAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle environment sub-resource: /api/projects/{id}/environment
+	if len(pathParts) >= 2 && pathParts[1] == "environment" {
+		handleProjectEnvironmentAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle sandbox sub-resource: /api/projects/{id}/sandbox
+	if len(pathParts) >= 2 && pathParts[1] == "sandbox" {
+		handleProjectSandboxAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle resource-limits sub-resource: /api/projects/{id}/resource-limits
+	if len(pathParts) >= 2 && pathParts[1] == "resource-limits" {
+		handleProjectResourceLimitsAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle workflow sub-resource: /api/projects/{id}/workflow
+	if len(pathParts) >= 2 && pathParts[1] == "workflow" {
+		handleProjectWorkflowAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle pull-requests sub-resource: /api/projects/{id}/pull-requests
+	if len(pathParts) >= 2 && pathParts[1] == "pull-requests" {
+		handleProjectPullRequestsAPI(w, r, ctx, pathParts)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		if len(pathParts) == 0 {
-			// List all projects
-			dbProjects, err := queries.GetProjectsByRootID(ctx, 1) // Use default root_id for now
+			// List the projects of the selected root
+			rootID, ok := requestRootID(w, r, ctx)
+			if !ok {
+				return
+			}
+			dbProjects, err := queries.GetProjectsByRootID(ctx, rootID)
 			if err != nil {
 				// If root doesn't exist, return empty array instead of error
-				log.Printf("No projects found for root_id 1: %v", err)
+				log.Printf("No projects found for root_id %d: %v", rootID, err)
 				json.NewEncoder(w).Encode([]Project{})
 				return
 			}
@@ -1725,11 +1716,17 @@ func handleProjectsAPI(w http.ResponseWriter, r *http.Request, ctx context.Conte
 				tasks = []Task{}
 			}
 
+			workflow, err := loadWorkflow(ctx, id)
+			if err != nil {
+				log.Printf("Failed to load workflow for project %d: %v", id, err)
+			}
+
 			result := Project{
 				ID:              project.ID,
 				Name:            project.Name,
 				BaseDirectories: baseDirs,
 				Tasks:           tasks,
+				Workflow:        &workflow,
 			}
 			json.NewEncoder(w).Encode(result)
 		}
@@ -1745,8 +1742,14 @@ func handleProjectsAPI(w http.ResponseWriter, r *http.Request, ctx context.Conte
 			return
 		}
 
+		rootID, err := resolveRootID(ctx, createReq.RootId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		project, err := queries.CreateProject(ctx, db.CreateProjectParams{
-			RootID: createReq.RootId,
+			RootID: rootID,
 			Name:   createReq.Name,
 		})
 		if err != nil {
@@ -1790,7 +1793,14 @@ func handleProjectsAPI(w http.ResponseWriter, r *http.Request, ctx context.Conte
 					}
 				}
 
-				// Delete the task
+				// Delete the task with its attachments, comments and labels
+				deleteTaskAttachments(ctx, task.ID)
+				if err := queries.DeleteTaskCommentsByTaskID(ctx, task.ID); err != nil {
+					log.Printf("Warning: failed to delete comments of task %d: %v", task.ID, err)
+				}
+				if err := queries.DeleteTaskLabels(ctx, task.ID); err != nil {
+					log.Printf("Warning: failed to delete labels of task %d: %v", task.ID, err)
+				}
 				err = queries.DeleteTask(ctx, task.ID)
 				if err != nil {
 					log.Printf("Warning: failed to delete task %d: %v", task.ID, err)
@@ -1802,6 +1812,7 @@ func handleProjectsAPI(w http.ResponseWriter, r *http.Request, ctx context.Conte
 		baseDirs, err := queries.GetBaseDirectoriesByProjectID(ctx, projectID)
 		if err == nil {
 			for _, baseDir := range baseDirs {
+				deletePullRequestsForBaseDirectory(ctx, baseDir.ID)
 				err = queries.DeleteBaseDirectory(ctx, baseDir.ID)
 				if err != nil {
 					log.Printf("Warning: failed to delete base directory %d: %v", baseDir.ID, err)
@@ -1809,6 +1820,32 @@ func handleProjectsAPI(w http.ResponseWriter, r *http.Request, ctx context.Conte
 			}
 		}
 
+		// Delete auto-responder rules for this project
+		err = queries.DeleteAutoResponseRulesByProjectID(ctx, projectID)
+		if err != nil {
+			log.Printf("Warning: failed to delete auto-responder rules for project %d: %v", projectID, err)
+		}
+
+		// Delete environment variables for this project
+		err = queries.DeleteEnvironmentVariablesByProjectID(ctx, projectID)
+		if err != nil {
+			log.Printf("Warning: failed to delete environment variables for project %d: %v", projectID, err)
+		}
+
+		// Delete the project's sandbox policy
+		err = queries.DeleteSandboxPolicyByProjectID(ctx, sql.NullInt64{Int64: projectID, Valid: true})
+		if err != nil {
+			log.Printf("Warning: failed to delete sandbox policy for project %d: %v", projectID, err)
+		}
+
+		// Delete the project's default resource limits
+		deleteResourceLimits(ctx, resourceTargetProject, projectID)
+
+		// Delete the project's board
+		if err := deleteWorkflow(ctx, projectID); err != nil {
+			log.Printf("Warning: failed to delete workflow for project %d: %v", projectID, err)
+		}
+
 		// Finally delete the project
 		err = queries.DeleteProject(ctx, projectID)
 		if err != nil {
@@ -1840,8 +1877,12 @@ func handleAgentsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context
 			return
 		}
 
-		// List all agents for default root (assuming root_id = 1 for now)
-		dbAgents, err := queries.GetAgentsByRootID(ctx, 1)
+		// List the agents of the selected root
+		rootID, ok := requestRootID(w, r, ctx)
+		if !ok {
+			return
+		}
+		dbAgents, err := queries.GetAgentsByRootID(ctx, rootID)
 		if err != nil {
 			log.Printf("Failed to get agents: %v", err)
 			json.NewEncoder(w).Encode([]Agent{})
@@ -1874,8 +1915,14 @@ func handleAgentsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context
 			return
 		}
 
+		rootID, err := resolveRootID(ctx, createReq.RootId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		agent, err := queries.CreateAgent(ctx, db.CreateAgentParams{
-			RootID:  createReq.RootId,
+			RootID:  rootID,
 			Name:    createReq.Name,
 			Command: createReq.Command,
 			Params:  createReq.Params,
@@ -1946,6 +1993,12 @@ func handleSingleAgentAPI(w http.ResponseWriter, r *http.Request, ctx context.Co
 		return
 	}
 
+	// Handle sandbox sub-resource: /api/agents/{id}/sandbox
+	if len(pathParts) >= 2 && pathParts[1] == "sandbox" {
+		handleAgentSandboxAPI(w, r, ctx, agentID)
+		return
+	}
+
 	switch r.Method {
 	case "PUT":
 		// Update agent
@@ -1981,6 +2034,21 @@ func handleSingleAgentAPI(w http.ResponseWriter, r *http.Request, ctx context.Co
 		json.NewEncoder(w).Encode(result)
 
 	case "DELETE":
+		// Delete agent-specific environment overrides
+		if err := queries.DeleteEnvironmentVariablesByAgentID(ctx, sql.NullInt64{Int64: agentID, Valid: true}); err != nil {
+			log.Printf("Warning: failed to delete environment variables for agent %d: %v", agentID, err)
+		}
+
+		// Delete the agent's sandbox policy
+		if err := queries.DeleteSandboxPolicyByAgentID(ctx, sql.NullInt64{Int64: agentID, Valid: true}); err != nil {
+			log.Printf("Warning: failed to delete sandbox policy for agent %d: %v", agentID, err)
+		}
+
+		// Tasks that preferred the agent fall back to choosing one when started
+		if err := queries.ClearPreferredAgent(ctx, sql.NullInt64{Int64: agentID, Valid: true}); err != nil {
+			log.Printf("Warning: failed to clear preferred agent %d from tasks: %v", agentID, err)
+		}
+
 		// Delete agent
 		err := queries.DeleteAgent(ctx, agentID)
 		if err != nil {
@@ -2015,6 +2083,24 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 		return
 	}
 
+	// Handle sub-endpoints like /api/task-executions/{id}/events
+	if len(pathParts) >= 2 && pathParts[1] == "events" {
+		handleTaskExecutionEventsAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle sub-endpoints like /api/task-executions/{id}/checkpoints
+	if len(pathParts) >= 2 && pathParts[1] == "checkpoints" {
+		handleTaskExecutionCheckpointsAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle sub-endpoints like /api/task-executions/{id}/resource-limits
+	if len(pathParts) >= 2 && pathParts[1] == "resource-limits" {
+		handleTaskExecutionResourceLimitsAPI(w, r, ctx, pathParts)
+		return
+	}
+
 	// Handle sub-endpoints like /api/task-executions/{id}/dev-server
 	if len(pathParts) >= 2 && pathParts[1] == "dev-server" {
 		executionID, err := strconv.ParseInt(pathParts[0], 10, 64)
@@ -2103,7 +2189,26 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 				}
 			}
 
-			json.NewEncoder(w).Encode(execution)
+			// Surface sandbox violations alongside the status
+			violations, err := queries.CountTaskExecutionEventsByType(ctx, db.CountTaskExecutionEventsByTypeParams{
+				TaskExecutionID: executionID,
+				EventType:       "sandbox_violation",
+			})
+			if err != nil {
+				log.Printf("Failed to count sandbox violations: %v", err)
+			}
+
+			// Live cgroup usage of the agent and dev server sessions (nil when unlimited)
+			resourceUsage := map[string]*ResourceUsage{
+				"agent":      readResourceUsage(ctx, execution.ProjectID, resourceTargetTaskExecution, executionID),
+				"dev_server": readResourceUsage(ctx, execution.ProjectID, resourceTargetExecutionDevServer, executionID),
+			}
+
+			json.NewEncoder(w).Encode(struct {
+				db.GetTaskExecutionWithDetailsRow
+				SandboxViolations int64                     `json:"sandbox_violations"`
+				ResourceUsage     map[string]*ResourceUsage `json:"resource_usage"`
+			}{execution, violations, resourceUsage})
 			return
 		}
 
@@ -2147,9 +2252,19 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 			return
 		}
 
-		// Get all task executions
+		// Get the task executions of the selected root
+		rootID, ok := requestRootID(w, r, ctx)
+		if !ok {
+			return
+		}
+		projectIDs, err := rootProjectIDs(ctx, rootID)
+		if err != nil {
+			log.Printf("Failed to list projects of root %d: %v", rootID, err)
+			http.Error(w, "Failed to list task executions", http.StatusInternalServerError)
+			return
+		}
 		queries := db.New(database)
-		executions, err := queries.ListTaskExecutions(ctx)
+		allExecutions, err := queries.ListTaskExecutions(ctx)
 		if err != nil {
 			log.Printf("Failed to list task executions: %v", err)
 			http.Error(w, "Failed to list task executions", http.StatusInternalServerError)
@@ -2157,8 +2272,11 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 		}
 
 		// Ensure we return empty array instead of null
-		if executions == nil {
-			executions = []db.ListTaskExecutionsRow{}
+		executions := []db.ListTaskExecutionsRow{}
+		for _, execution := range allExecutions {
+			if projectIDs[execution.ProjectID] {
+				executions = append(executions, execution)
+			}
 		}
 
 		// Clean up orphaned session states periodically
@@ -2180,8 +2298,11 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 	case "POST":
 		// Create and start a new task execution
 		var createReq struct {
-			TaskId  int64 `json:"task_id"`
-			AgentId int64 `json:"agent_id"`
+			TaskId                    int64           `json:"task_id"`
+			AgentId                   int64           `json:"agent_id"`
+			ResourceLimits            *ResourceLimits `json:"resource_limits"`
+			CheckpointIntervalMinutes int64           `json:"checkpoint_interval_minutes"` // 0 disables checkpoints
+			AttachmentsInWorkdir      bool            `json:"attachments_in_workdir"`      // copy attachments into the base directory
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
@@ -2197,6 +2318,15 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 			return
 		}
 
+		// Without an agent the task's preferred one runs it
+		if createReq.AgentId == 0 {
+			if !dbTask.PreferredAgentID.Valid {
+				http.Error(w, "Agent ID is required, the task has no preferred agent", http.StatusBadRequest)
+				return
+			}
+			createReq.AgentId = dbTask.PreferredAgentID.Int64
+		}
+
 		// Get the agent details
 		dbAgent, err := queries.GetAgent(ctx, createReq.AgentId)
 		if err != nil {
@@ -2216,6 +2346,17 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 			return
 		}
 
+		if createReq.ResourceLimits != nil {
+			if err := createReq.ResourceLimits.validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if createReq.CheckpointIntervalMinutes < 0 {
+			http.Error(w, "checkpoint_interval_minutes must not be negative", http.StatusBadRequest)
+			return
+		}
+
 		// Create the task execution record (no worktree - runs directly in base directory)
 		dbTaskExecution, err := queries.CreateTaskExecution(ctx, db.CreateTaskExecutionParams{
 			TaskID:          createReq.TaskId,
@@ -2223,6 +2364,7 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 			Status:          "starting",
 			AgentTmuxID:     sql.NullString{Valid: false},
 			DevServerTmuxID: sql.NullString{Valid: false},
+			StartedByUserID: requestUserID(r),
 		})
 		if err != nil {
 			log.Printf("Failed to create task execution: %v", err)
@@ -2230,21 +2372,38 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 			return
 		}
 
-		// Update task status to "in_progress" if it's not already
-		if dbTask.Status != "in_progress" {
-			_, err = queries.UpdateTask(ctx, db.UpdateTaskParams{
-				ID:          dbTask.ID,
-				Title:       dbTask.Title,
-				Description: dbTask.Description,
-				Status:      "in_progress",
+		// Move the task as the project's workflow says (to in_progress by default)
+		dbTask = applyWorkflowEvent(ctx, dbTask, workflowEventExecutionStarted)
+
+		// Per-execution limits override the project defaults
+		if createReq.ResourceLimits != nil {
+			_, err = queries.UpsertResourceLimit(ctx, db.UpsertResourceLimitParams{
+				TargetType: resourceTargetTaskExecution,
+				TargetID:   dbTaskExecution.ID,
+				CpuPercent: createReq.ResourceLimits.CPUPercent,
+				MemoryMb:   createReq.ResourceLimits.MemoryMB,
+				PidsMax:    createReq.ResourceLimits.PidsMax,
 			})
 			if err != nil {
-				log.Printf("Failed to update task status: %v", err)
+				log.Printf("Failed to save resource limits for task execution: %v", err)
 			}
 		}
 
+		if createReq.CheckpointIntervalMinutes > 0 {
+			_, err = queries.UpdateTaskExecutionCheckpointInterval(ctx, db.UpdateTaskExecutionCheckpointIntervalParams{
+				ID:                        dbTaskExecution.ID,
+				CheckpointIntervalMinutes: createReq.CheckpointIntervalMinutes,
+			})
+			if err != nil {
+				log.Printf("Failed to save checkpoint interval for task execution: %v", err)
+			}
+		}
+
+		addTaskComment(ctx, dbTask.ID, sql.NullInt64{Int64: dbTaskExecution.ID, Valid: true}, commentAuthorSystem, "", "start",
+			fmt.Sprintf("Execution #%d started with %s", dbTaskExecution.ID, dbAgent.Name))
+
 		// Start the execution in the background
-		go startTaskExecutionProcess(dbTaskExecution.ID, dbTask, dbAgent, dbBaseDir)
+		go startTaskExecutionProcess(dbTaskExecution.ID, dbTask, dbAgent, dbBaseDir, createReq.AttachmentsInWorkdir)
 
 		// Return the task execution details
 		result := map[string]interface{}{
@@ -2261,23 +2420,46 @@ func handleTaskExecutionsAPI(w http.ResponseWriter, r *http.Request, ctx context
 	}
 }
 
-func startTaskExecutionProcess(executionID int64, task db.Task, agent db.Agent, baseDir db.BaseDirectory) {
+// Pauses while an agent session starts up; tests shorten them
+var (
+	sessionCommandDelay = 2 * time.Second
+	agentStartupDelay   = 3 * time.Second
+)
+
+func startTaskExecutionProcess(executionID int64, task db.Task, agent db.Agent, baseDir db.BaseDirectory, attachmentsInWorkdir bool) {
 	ctx := context.Background()
 
 	log.Printf("Starting task execution %d: Task '%s' with agent '%s' in %s", executionID, task.Title, agent.Name, baseDir.Path)
 
+	// Give the agent its own copy of the task's attachments
+	attachmentsWorkdir := ""
+	if attachmentsInWorkdir {
+		attachmentsWorkdir = baseDir.Path
+	}
+	attachmentPaths, err := materializeTaskAttachments(ctx, executionID, task.ID, attachmentsWorkdir)
+	if err != nil {
+		log.Printf("Failed to materialize attachments for task execution %d: %v", executionID, err)
+		recordTaskExecutionEvent(ctx, executionID, "attachments_error", "Some attachments are missing", err.Error(), sql.NullInt64{Valid: false})
+	}
+	recordAttachmentsEvent(ctx, executionID, attachmentPaths)
+
 	// Generate a unique tmux session name
 	sessionName := fmt.Sprintf("task_%d_agent_%d", task.ID, agent.ID)
 
-	// Start tmux session in the base directory
-	tmuxCmd := exec.Command("tmux", "new-session", "-d", "-s", sessionName, "-c", baseDir.Path)
-	err := tmuxCmd.Run()
+	// Start session in the base directory with the project's environment
+	err = sessionManager.Create(sessionName, SessionOptions{
+		Dir: baseDir.Path,
+		Env: sessionEnvironment(ctx, task.ProjectID, baseDir.ID, agent.ID),
+	})
 	if err != nil {
 		log.Printf("Failed to start tmux session: %v", err)
 		updateTaskExecutionStatus(ctx, executionID, "failed")
 		return
 	}
 
+	// Confine the session to its cgroup before anything runs in it
+	applySessionResourceLimits(ctx, sessionName, task.ProjectID, resourceTargetTaskExecution, executionID)
+
 	// Update task execution with tmux session info
 	_, err = queries.UpdateTaskExecutionTmux(ctx, db.UpdateTaskExecutionTmuxParams{
 		ID:              executionID,
@@ -2291,14 +2473,13 @@ func startTaskExecutionProcess(executionID int64, task db.Task, agent db.Agent,
 	// Function to send command and wait
 	sendCommandAndWait := func(command string, description string) error {
 		log.Printf("Executing %s: %s", description, command)
-		cmd := exec.Command("tmux", "send-keys", "-t", sessionName, command, "Enter")
-		err := cmd.Run()
+		err := sessionManager.SendKeys(sessionName, command, "Enter")
 		if err != nil {
 			return fmt.Errorf("failed to send %s command: %v", description, err)
 		}
 
 		// Wait a moment for command to execute
-		time.Sleep(2 * time.Second)
+		time.Sleep(sessionCommandDelay)
 		return nil
 	}
 
@@ -2309,8 +2490,29 @@ func startTaskExecutionProcess(executionID int64, task db.Task, agent db.Agent,
 		}
 	}
 
-	// Start the agent command
+	// Start the agent command, wrapped in the sandbox if the project or agent requires one
 	agentCommand := fmt.Sprintf("%s %s", agent.Command, agent.Params)
+	var sandboxReadonly []string
+	if len(attachmentPaths) > 0 && !attachmentsInWorkdir {
+		sandboxReadonly = append(sandboxReadonly, filepath.Dir(attachmentPaths[0]))
+	}
+	agentCommand, sandboxBackend, err := sandboxAgentCommand(ctx, task.ProjectID, agent.ID, baseDir.Path, agentCommand, sandboxReadonly...)
+	if err != nil {
+		log.Printf("Failed to sandbox agent: %v", err)
+		recordTaskExecutionEvent(ctx, executionID, "sandbox_error", "Agent not started", err.Error(), sql.NullInt64{Valid: false})
+		updateTaskExecutionStatus(ctx, executionID, "failed")
+		return
+	}
+	if sandboxBackend != "" {
+		_, err = queries.UpdateTaskExecutionSandbox(ctx, db.UpdateTaskExecutionSandboxParams{
+			ID:      executionID,
+			Sandbox: sandboxBackend,
+		})
+		if err != nil {
+			log.Printf("Failed to record sandbox for task execution: %v", err)
+		}
+		recordTaskExecutionEvent(ctx, executionID, "sandbox_started", "Agent started in "+sandboxBackend+" sandbox", "", sql.NullInt64{Valid: false})
+	}
 	if err := sendCommandAndWait(agentCommand, "agent command"); err != nil {
 		log.Printf("Failed to start agent: %v", err)
 		updateTaskExecutionStatus(ctx, executionID, "failed")
@@ -2320,19 +2522,18 @@ func startTaskExecutionProcess(executionID int64, task db.Task, agent db.Agent,
 	// Update status to running
 	updateTaskExecutionStatus(ctx, executionID, "running")
 
-	// Wait 3 seconds for the agent to start, then send the task title and description
+	// Wait for the agent to start, then send the task title and description
 	go func() {
-		time.Sleep(3 * time.Second)
+		time.Sleep(agentStartupDelay)
 
 		// Create the task prompt to send to the agent
-		taskPrompt := fmt.Sprintf("Task: %s\n\nDescription: %s", task.Title, task.Description)
+		taskPrompt := buildTaskPrompt(task, attachmentPaths)
 
 		// Send the task prompt to the agent session with agent-specific handling
 		log.Printf("Sending initial task prompt to agent session: %s", taskPrompt)
 
 		// Send the text first
-		cmd := exec.Command("tmux", "send-keys", "-t", sessionName, taskPrompt)
-		err := cmd.Run()
+		err := sessionManager.SendKeys(sessionName, taskPrompt)
 		if err != nil {
 			log.Printf("Warning: Failed to send task prompt: %v", err)
 			return
@@ -2340,8 +2541,7 @@ func startTaskExecutionProcess(executionID int64, task db.Task, agent db.Agent,
 
 		// Small delay for agent debouncing, then send Enter
 		time.Sleep(100 * time.Millisecond)
-		enterCmd := exec.Command("tmux", "send-keys", "-t", sessionName, "Enter")
-		err = enterCmd.Run()
+		err = sessionManager.SendKeys(sessionName, "Enter")
 		if err != nil {
 			log.Printf("Warning: Failed to send Enter for task prompt: %v", err)
 		}
@@ -2412,8 +2612,7 @@ func handleSendInputToSession(w http.ResponseWriter, r *http.Request, ctx contex
 	log.Printf("Sending input to session %s: %s", sessionName, inputReq.Input)
 
 	// Send the text first
-	cmd := exec.Command("tmux", "send-keys", "-t", sessionName, inputReq.Input)
-	err = cmd.Run()
+	err = sessionManager.SendKeys(sessionName, inputReq.Input)
 	if err != nil {
 		log.Printf("Failed to send input to tmux session: %v", err)
 		http.Error(w, "Failed to send input to session", http.StatusInternalServerError)
@@ -2422,14 +2621,16 @@ func handleSendInputToSession(w http.ResponseWriter, r *http.Request, ctx contex
 
 	// Small delay for agent debouncing, then send Enter
 	time.Sleep(100 * time.Millisecond)
-	enterCmd := exec.Command("tmux", "send-keys", "-t", sessionName, "Enter")
-	err = enterCmd.Run()
+	err = sessionManager.SendKeys(sessionName, "Enter")
 	if err != nil {
 		log.Printf("Failed to send Enter to tmux session: %v", err)
 		http.Error(w, "Failed to send Enter to session", http.StatusInternalServerError)
 		return
 	}
 
+	// Keep the feedback in the task's comment thread
+	addTaskComment(ctx, execution.TaskID, sql.NullInt64{Int64: executionID, Valid: true}, commentAuthorHuman, "", "feedback", inputReq.Input)
+
 	// Return success response
 	response := map[string]interface{}{
 		"success": true,
@@ -2480,14 +2681,13 @@ func handleResendTaskToSession(w http.ResponseWriter, r *http.Request, ctx conte
 	sessionName := execution.AgentTmuxID.String
 
 	// Create the task prompt to send to the agent
-	taskPrompt := fmt.Sprintf("Task: %s\n\nDescription: %s", task.Title, task.Description)
+	taskPrompt := buildTaskPrompt(task, executionAttachmentPaths(execution))
 
 	// Send the task prompt to the tmux session
 	log.Printf("Re-sending task prompt to session %s", sessionName)
 
 	// Send the text first
-	cmd := exec.Command("tmux", "send-keys", "-t", sessionName, taskPrompt)
-	err = cmd.Run()
+	err = sessionManager.SendKeys(sessionName, taskPrompt)
 	if err != nil {
 		log.Printf("Failed to send task prompt to tmux session: %v", err)
 		http.Error(w, "Failed to send task prompt to session", http.StatusInternalServerError)
@@ -2496,14 +2696,16 @@ func handleResendTaskToSession(w http.ResponseWriter, r *http.Request, ctx conte
 
 	// Small delay for agent debouncing, then send Enter
 	time.Sleep(100 * time.Millisecond)
-	enterCmd := exec.Command("tmux", "send-keys", "-t", sessionName, "Enter")
-	err = enterCmd.Run()
+	err = sessionManager.SendKeys(sessionName, "Enter")
 	if err != nil {
 		log.Printf("Failed to send Enter to tmux session: %v", err)
 		http.Error(w, "Failed to send Enter to session", http.StatusInternalServerError)
 		return
 	}
 
+	addTaskComment(ctx, task.ID, sql.NullInt64{Int64: executionID, Valid: true}, commentAuthorSystem, "", "rerun",
+		fmt.Sprintf("Task prompt re-sent to execution #%d", executionID))
+
 	// Return success response
 	response := map[string]interface{}{
 		"success":          true,
@@ -2550,6 +2752,24 @@ func handleAcceptTaskExecution(w http.ResponseWriter, r *http.Request, ctx conte
 		return
 	}
 
+	// The body is optional; without one the changes are left uncommitted
+	var acceptReq acceptCommitRequest
+	if err := json.NewDecoder(r.Body).Decode(&acceptReq); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Commit before the sessions and teardown commands are gone, so a failure leaves everything as it was
+	var commitResult *acceptCommitResult
+	if acceptReq.Commit {
+		commitResult, err = commitAcceptedExecution(ctx, execution, acceptReq)
+		if err != nil {
+			log.Printf("Failed to commit task execution %d: %v", executionID, err)
+			http.Error(w, "Failed to commit changes: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	// Clean up tmux sessions
 	cleanupTmuxSessionsFromExecution(execution)
 
@@ -2582,17 +2802,20 @@ func handleAcceptTaskExecution(w http.ResponseWriter, r *http.Request, ctx conte
 		return
 	}
 
-	// Update the TASK status to "to_verify"
+	// Record the accept, and the reviewer's reasoning if they gave any
+	acceptedExecution := sql.NullInt64{Int64: executionID, Valid: true}
+	if comment := strings.TrimSpace(acceptReq.Comment); comment != "" {
+		addTaskComment(ctx, execution.TaskID, acceptedExecution, commentAuthorHuman, "", "accept", comment)
+	}
+	acceptNote := fmt.Sprintf("Execution #%d by %s accepted", executionID, execution.AgentName)
+	if commitResult != nil && commitResult.Committed {
+		acceptNote += fmt.Sprintf("; committed %s on %s", commitResult.SHA, commitResult.Branch)
+	}
+	addTaskComment(ctx, execution.TaskID, acceptedExecution, commentAuthorSystem, "", "accept", acceptNote)
+
+	// Move the task as the project's workflow says (to to_verify by default)
 	if task.ID != 0 {
-		_, err = queries.UpdateTask(ctx, db.UpdateTaskParams{
-			ID:          task.ID,
-			Title:       task.Title,
-			Description: task.Description,
-			Status:      "to_verify",
-		})
-		if err != nil {
-			log.Printf("Warning: failed to update task status to to_verify: %v", err)
-		}
+		applyWorkflowEvent(ctx, task, workflowEventExecutionAccepted)
 	}
 
 	// Return success response with project_id for redirect
@@ -2602,16 +2825,28 @@ func handleAcceptTaskExecution(w http.ResponseWriter, r *http.Request, ctx conte
 		"status":     "completed",
 		"project_id": task.ProjectID,
 	}
+	if commitResult != nil {
+		response["commit"] = commitResult
+	}
 	json.NewEncoder(w).Encode(response)
 }
 
 func handleBaseDirectoriesAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	// Handle resource-limits sub-resource: /api/base-directories/{id}/resource-limits
+	if len(pathParts) >= 2 && pathParts[1] == "resource-limits" {
+		handleBaseDirectoryResourceLimitsAPI(w, r, ctx, pathParts)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		if len(pathParts) == 0 {
-			// List all base directories
-			// For now, get them via projects
-			projects, err := queries.ListProjects(ctx)
+			// List the base directories of the selected root, via its projects
+			rootID, ok := requestRootID(w, r, ctx)
+			if !ok {
+				return
+			}
+			projects, err := queries.GetProjectsByRootID(ctx, rootID)
 			if err != nil {
 				http.Error(w, "Failed to list projects", http.StatusInternalServerError)
 				return
@@ -2718,33 +2953,39 @@ func startDevServerForExecution(ctx context.Context, queries *db.Queries, execut
 	// Create dev server session name
 	devSessionName := fmt.Sprintf("dev_%d", executionID)
 
-	// Start tmux session for dev server in the base directory
-	tmuxCmd := exec.Command("tmux", "new-session", "-d", "-s", devSessionName, "-c", execution.BaseDirectoryPath)
-	err = tmuxCmd.Run()
+	// Start tmux session for dev server in the base directory with the same environment as the agent
+	opts := SessionOptions{Dir: execution.BaseDirectoryPath}
+	baseDir, err := queries.GetBaseDirectoryByProjectAndID(ctx, db.GetBaseDirectoryByProjectAndIDParams{
+		ProjectID:       execution.ProjectID,
+		BaseDirectoryID: execution.BaseDirectoryID,
+	})
+	if err == nil {
+		opts.Env = sessionEnvironment(ctx, execution.ProjectID, baseDir.ID, execution.AgentID)
+	}
+	err = sessionManager.Create(devSessionName, opts)
 	if err != nil {
 		return fmt.Errorf("failed to create dev server tmux session: %v", err)
 	}
 
+	// Confine the dev server to its cgroup
+	applySessionResourceLimits(ctx, devSessionName, execution.ProjectID, resourceTargetExecutionDevServer, executionID)
+
 	// If there are dev server setup commands, execute them in the session
 	if taskWithBaseDir.DevServerSetupCommands != "" {
 		// Execute the dev server setup commands
-		setupCmd := exec.Command("tmux", "send-keys", "-t", devSessionName, taskWithBaseDir.DevServerSetupCommands, "Enter")
-		err = setupCmd.Run()
+		err = sessionManager.SendKeys(devSessionName, taskWithBaseDir.DevServerSetupCommands, "Enter")
 		if err != nil {
 			log.Printf("Failed to send dev server setup commands: %v", err)
 			// Don't return error here, session is still created
 		}
 
 		// Add info message
-		echoCmd := exec.Command("tmux", "send-keys", "-t", devSessionName, "echo 'Dev server started. Session: "+devSessionName+"'", "Enter")
-		echoCmd.Run()
+		sessionManager.SendKeys(devSessionName, "echo 'Dev server started. Session: "+devSessionName+"'", "Enter")
 	} else {
 		// No setup commands, just show info
-		echoCmd := exec.Command("tmux", "send-keys", "-t", devSessionName, "echo 'Dev server session created. No setup commands configured.'", "Enter")
-		echoCmd.Run()
+		sessionManager.SendKeys(devSessionName, "echo 'Dev server session created. No setup commands configured.'", "Enter")
 
-		bashCmd := exec.Command("tmux", "send-keys", "-t", devSessionName, "bash", "Enter")
-		bashCmd.Run()
+		sessionManager.SendKeys(devSessionName, "bash", "Enter")
 	}
 
 	// Update task execution with dev server session info
@@ -2766,8 +3007,8 @@ func stopDevServerForExecution(ctx context.Context, queries *db.Queries, executi
 
 	if execution.DevServerTmuxID.Valid {
 		// Kill the tmux session
-		tmuxCmd := exec.Command("tmux", "kill-session", "-t", execution.DevServerTmuxID.String)
-		_ = tmuxCmd.Run() // Ignore error if session doesn't exist
+		_ = sessionManager.Kill(execution.DevServerTmuxID.String) // Ignore error if session doesn't exist
+		removeSessionCgroup(resourceTargetExecutionDevServer, executionID)
 	}
 
 	// Update task execution to remove dev server session info
@@ -2860,6 +3101,7 @@ func handleDirectoryDevServersAPI(w http.ResponseWriter, r *http.Request, ctx co
 				ProjectName:     dds.ProjectName,
 				TmuxSessionID:   dds.TmuxSessionID,
 				Status:          dds.Status,
+				ResourceUsage:   readResourceUsage(ctx, dds.ProjectID, resourceTargetBaseDirectory, dds.BaseDirectoryID),
 			}
 		}
 		json.NewEncoder(w).Encode(result)
@@ -2913,27 +3155,29 @@ func startDevServerForDirectory(ctx context.Context, queries *db.Queries, direct
 	// Create session name
 	sessionName := fmt.Sprintf("dev_dir_%d", directoryID)
 
-	// Start tmux session in the directory
-	tmuxCmd := exec.Command("tmux", "new-session", "-d", "-s", sessionName, "-c", dir.Path)
-	err = tmuxCmd.Run()
+	// Start session in the directory with the directory's environment
+	err = sessionManager.Create(sessionName, SessionOptions{
+		Dir: dir.Path,
+		Env: sessionEnvironment(ctx, dir.ProjectID, dir.ID, 0),
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create tmux session: %v", err)
 	}
 
+	// Confine the dev server to its cgroup
+	applySessionResourceLimits(ctx, sessionName, dir.ProjectID, resourceTargetBaseDirectory, dir.ID)
+
 	// Execute dev server setup commands if present
 	if dir.DevServerSetupCommands != "" {
-		setupCmd := exec.Command("tmux", "send-keys", "-t", sessionName, dir.DevServerSetupCommands, "Enter")
-		err = setupCmd.Run()
+		err = sessionManager.SendKeys(sessionName, dir.DevServerSetupCommands, "Enter")
 		if err != nil {
 			log.Printf("Failed to send dev server setup commands: %v", err)
 		}
 	} else {
 		// No setup commands, just show info
-		echoCmd := exec.Command("tmux", "send-keys", "-t", sessionName, "echo 'Dev server session created. No setup commands configured.'", "Enter")
-		echoCmd.Run()
+		sessionManager.SendKeys(sessionName, "echo 'Dev server session created. No setup commands configured.'", "Enter")
 
-		bashCmd := exec.Command("tmux", "send-keys", "-t", sessionName, "bash", "Enter")
-		bashCmd.Run()
+		sessionManager.SendKeys(sessionName, "bash", "Enter")
 	}
 
 	// Create database record
@@ -2944,7 +3188,7 @@ func startDevServerForDirectory(ctx context.Context, queries *db.Queries, direct
 	})
 	if err != nil {
 		// Try to clean up the tmux session
-		exec.Command("tmux", "kill-session", "-t", sessionName).Run()
+		sessionManager.Kill(sessionName)
 		return fmt.Errorf("failed to create dev server record: %v", err)
 	}
 
@@ -2962,22 +3206,20 @@ func stopDevServerForDirectory(ctx context.Context, queries *db.Queries, directo
 	dir, err := queries.GetBaseDirectory(ctx, directoryID)
 	if err == nil && dir.DevServerTeardownCommands != "" {
 		// Send teardown commands
-		teardownCmd := exec.Command("tmux", "send-keys", "-t", devServer.TmuxSessionID, dir.DevServerTeardownCommands, "Enter")
-		teardownCmd.Run()
+		sessionManager.SendKeys(devServer.TmuxSessionID, dir.DevServerTeardownCommands, "Enter")
 		// Wait briefly for teardown
 		time.Sleep(500 * time.Millisecond)
 	}
 
 	// Send Ctrl-C to stop any running process
-	ctrlCCmd := exec.Command("tmux", "send-keys", "-t", devServer.TmuxSessionID, "C-c")
-	ctrlCCmd.Run()
+	sessionManager.SendKeys(devServer.TmuxSessionID, "C-c")
 
 	// Wait briefly
 	time.Sleep(500 * time.Millisecond)
 
 	// Kill the tmux session
-	killCmd := exec.Command("tmux", "kill-session", "-t", devServer.TmuxSessionID)
-	killCmd.Run() // Ignore error if session doesn't exist
+	sessionManager.Kill(devServer.TmuxSessionID) // Ignore error if session doesn't exist
+	removeSessionCgroup(resourceTargetBaseDirectory, directoryID)
 
 	// Delete database record
 	err = queries.DeleteDirectoryDevServerByDirectoryID(ctx, directoryID)
@@ -2989,6 +3231,24 @@ func stopDevServerForDirectory(ctx context.Context, queries *db.Queries, directo
 }
 
 func handleTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	// Handle attachments sub-resource: /api/tasks/{id}/attachments
+	if len(pathParts) >= 2 && pathParts[1] == "attachments" {
+		handleTaskAttachmentsAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle comments sub-resource: /api/tasks/{id}/comments
+	if len(pathParts) >= 2 && pathParts[1] == "comments" {
+		handleTaskCommentsAPI(w, r, ctx, pathParts)
+		return
+	}
+
+	// Handle move action: /api/tasks/{id}/move
+	if len(pathParts) >= 2 && pathParts[1] == "move" {
+		handleTaskMoveAPI(w, r, ctx, pathParts)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		if len(pathParts) > 0 {
@@ -3005,10 +3265,9 @@ func handleTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 				return
 			}
 
-			json.NewEncoder(w).Encode(task)
+			json.NewEncoder(w).Encode(taskResponse(ctx, task))
 		} else {
-			// List all tasks - for now return empty array as we primarily use project tasks
-			json.NewEncoder(w).Encode([]db.Task{})
+			handleTaskSearch(w, r, ctx)
 		}
 
 	case "PUT":
@@ -3027,6 +3286,7 @@ func handleTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 			Title       string `json:"title"`
 			Description string `json:"description"`
 			Status      string `json:"status"`
+			taskMetadataRequest
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
@@ -3034,11 +3294,29 @@ func handleTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 			return
 		}
 
+		existingTask, err := queries.GetTask(ctx, taskID)
+		if err != nil {
+			http.Error(w, "Task not found", http.StatusNotFound)
+			return
+		}
+		if updateReq.Status == "" {
+			updateReq.Status = existingTask.Status
+		}
+		if _, err := validateTaskStatus(ctx, existingTask.ProjectID, updateReq.Status, existingTask.Status); err != nil {
+			writeTaskStatusError(w, err)
+			return
+		}
+		metadata, err := updateReq.resolve(ctx, existingTask)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		updatedTask, err := queries.UpdateTask(ctx, db.UpdateTaskParams{
 			ID:          taskID,
 			Title:       updateReq.Title,
 			Description: updateReq.Description,
-			Status:      updateReq.Status,
+			Status:      existingTask.Status,
 		})
 		if err != nil {
 			log.Printf("Failed to update task: %v", err)
@@ -3046,7 +3324,24 @@ func handleTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 			return
 		}
 
-		json.NewEncoder(w).Encode(updatedTask)
+		updatedTask, err = saveTaskMetadata(ctx, taskID, metadata)
+		if err != nil {
+			log.Printf("Failed to update task metadata: %v", err)
+			http.Error(w, "Failed to update task", http.StatusInternalServerError)
+			return
+		}
+
+		// A new status puts the task at the end of its new column
+		if updateReq.Status != existingTask.Status {
+			updatedTask, err = moveTask(ctx, updatedTask, updateReq.Status, -1)
+			if err != nil {
+				log.Printf("Failed to move task: %v", err)
+				http.Error(w, "Failed to update task", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(taskResponse(ctx, updatedTask))
 
 	case "DELETE":
 		if len(pathParts) == 0 {
@@ -3072,6 +3367,20 @@ func handleTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 			}
 		}
 
+		// Pull requests outlive the task, they only lose the link
+		if err := queries.UnlinkPullRequestsFromTask(ctx, sql.NullInt64{Int64: taskID, Valid: true}); err != nil {
+			log.Printf("Warning: failed to unlink pull requests from task %d: %v", taskID, err)
+		}
+
+		// Delete the task's attachments, comments and labels
+		deleteTaskAttachments(ctx, taskID)
+		if err := queries.DeleteTaskCommentsByTaskID(ctx, taskID); err != nil {
+			log.Printf("Warning: failed to delete comments of task %d: %v", taskID, err)
+		}
+		if err := queries.DeleteTaskLabels(ctx, taskID); err != nil {
+			log.Printf("Warning: failed to delete labels of task %d: %v", taskID, err)
+		}
+
 		// Delete the task
 		err = queries.DeleteTask(ctx, taskID)
 		if err != nil {
@@ -3099,6 +3408,12 @@ func handleProjectTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.C
 		return
 	}
 
+	// Handle bulk import: /api/projects/{id}/tasks/import
+	if len(pathParts) >= 3 && pathParts[2] == "import" {
+		handleProjectTaskImportAPI(w, r, ctx, projectID)
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		// Get tasks for project - for now return empty array as tasks aren't fully implemented
@@ -3111,6 +3426,7 @@ func handleProjectTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.C
 			Description     string `json:"description"`
 			Status          string `json:"status"`
 			BaseDirectoryId string `json:"baseDirectoryId"`
+			taskMetadataRequest
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
@@ -3123,6 +3439,22 @@ func handleProjectTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.C
 			return
 		}
 
+		// New tasks go into the first column unless told otherwise
+		if createReq.Status == "" {
+			if workflow, err := loadWorkflow(ctx, projectID); err == nil {
+				createReq.Status = workflow.Columns[0].Key
+			}
+		}
+		if _, err := validateTaskStatus(ctx, projectID, createReq.Status, ""); err != nil {
+			writeTaskStatusError(w, err)
+			return
+		}
+		metadata, err := createReq.resolve(ctx, db.Task{})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
 		// Create the task (no worktree creation needed)
 		dbTask, err := queries.CreateTask(ctx, db.CreateTaskParams{
 			ProjectID:       projectID,
@@ -3136,6 +3468,16 @@ func handleProjectTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.C
 			http.Error(w, "Failed to create task", http.StatusInternalServerError)
 			return
 		}
+		if dbTask, err = saveTaskMetadata(ctx, dbTask.ID, metadata); err != nil {
+			log.Printf("Failed to save metadata of task %d: %v", dbTask.ID, err)
+			http.Error(w, "Failed to create task", http.StatusInternalServerError)
+			return
+		}
+		if positioned, err := moveTask(ctx, dbTask, dbTask.Status, -1); err == nil {
+			dbTask = positioned
+		} else {
+			log.Printf("Failed to position task %d: %v", dbTask.ID, err)
+		}
 
 		// Get the base directory info to include in response
 		dbBaseDirs, err := queries.GetBaseDirectoriesByProjectID(ctx, projectID)
@@ -3153,7 +3495,7 @@ func handleProjectTasksAPI(w http.ResponseWriter, r *http.Request, ctx context.C
 		}
 
 		// Convert to API model
-		task := dbTaskToTask(dbTask, baseDirectory)
+		task := dbTaskToTask(dbTask, baseDirectory, metadata.labels)
 		json.NewEncoder(w).Encode(task)
 
 	default:
@@ -3262,6 +3604,7 @@ func loadTasksForProject(ctx context.Context, projectID int64, baseDirs []BaseDi
 	for _, dir := range baseDirs {
 		baseDirMap[dir.BaseDirectoryId] = dir
 	}
+	labels := taskLabelsByProject(ctx, projectID)
 
 	var tasks []Task
 	for _, dbTask := range dbTasks {
@@ -3270,7 +3613,7 @@ func loadTasksForProject(ctx context.Context, projectID int64, baseDirs []BaseDi
 			// Skip tasks with missing base directories
 			continue
 		}
-		tasks = append(tasks, dbTaskToTask(dbTask, baseDir))
+		tasks = append(tasks, dbTaskToTask(dbTask, baseDir, labels[dbTask.ID]))
 	}
 
 	return tasks, nil
@@ -3354,6 +3697,17 @@ func handleSingleBaseDirectoryAPI(w http.ResponseWriter, r *http.Request, ctx co
 			return
 		}
 
+		// Delete the directory dev server's resource limits
+		deleteResourceLimits(ctx, resourceTargetBaseDirectory, directoryToDelete.ID)
+
+		// Delete directory-specific environment variables
+		if err := queries.DeleteEnvironmentVariablesByBaseDirectoryID(ctx, sql.NullInt64{Int64: directoryToDelete.ID, Valid: true}); err != nil {
+			log.Printf("Warning: failed to delete environment variables for base directory %d: %v", directoryToDelete.ID, err)
+		}
+
+		// Delete the directory's pull requests
+		deletePullRequestsForBaseDirectory(ctx, directoryToDelete.ID)
+
 		// Delete the directory
 		err = queries.DeleteBaseDirectory(ctx, directoryToDelete.ID)
 		if err != nil {
@@ -3399,6 +3753,29 @@ func deleteTaskExecutionWithCleanup(ctx context.Context, executionID int64) erro
 		}
 	}
 
+	// Remove cgroups and limits of the agent and dev server sessions
+	removeSessionCgroup(resourceTargetTaskExecution, executionID)
+	removeSessionCgroup(resourceTargetExecutionDevServer, executionID)
+	deleteResourceLimits(ctx, resourceTargetTaskExecution, executionID)
+	deleteResourceLimits(ctx, resourceTargetExecutionDevServer, executionID)
+
+	// Delete the execution's checkpoint refs
+	deleteExecutionCheckpoints(ctx, executionID, execution.BaseDirectoryPath)
+
+	// Remove the execution's copies of the task attachments
+	removeExecutionAttachments(executionID, execution.AttachmentsDir)
+
+	// Unlink the execution from pull requests
+	if err := queries.DeletePullRequestExecutionsByExecutionID(ctx, executionID); err != nil {
+		log.Printf("Warning: failed to unlink task execution %d from pull requests: %v", executionID, err)
+	}
+
+	// Delete the execution's event history
+	err = queries.DeleteTaskExecutionEventsByExecutionID(ctx, executionID)
+	if err != nil {
+		log.Printf("Warning: failed to delete events for task execution %d: %v", executionID, err)
+	}
+
 	// Delete task execution record from database
 	err = queries.DeleteTaskExecution(ctx, executionID)
 	if err != nil {
@@ -3413,8 +3790,7 @@ func cleanupTmuxSessionsFromExecution(execution db.GetTaskExecutionWithDetailsRo
 	// Kill agent tmux session if it exists
 	if execution.AgentTmuxID.Valid && execution.AgentTmuxID.String != "" {
 		log.Printf("Killing agent tmux session: %s", execution.AgentTmuxID.String)
-		cmd := exec.Command("tmux", "kill-session", "-t", execution.AgentTmuxID.String)
-		err := cmd.Run()
+		err := sessionManager.Kill(execution.AgentTmuxID.String)
 		if err != nil {
 			log.Printf("Warning: failed to kill agent tmux session %s: %v", execution.AgentTmuxID.String, err)
 		}
@@ -3423,8 +3799,7 @@ func cleanupTmuxSessionsFromExecution(execution db.GetTaskExecutionWithDetailsRo
 	// Kill dev server tmux session if it exists
 	if execution.DevServerTmuxID.Valid && execution.DevServerTmuxID.String != "" {
 		log.Printf("Killing dev server tmux session: %s", execution.DevServerTmuxID.String)
-		cmd := exec.Command("tmux", "kill-session", "-t", execution.DevServerTmuxID.String)
-		err := cmd.Run()
+		err := sessionManager.Kill(execution.DevServerTmuxID.String)
 		if err != nil {
 			log.Printf("Warning: failed to kill dev server tmux session %s: %v", execution.DevServerTmuxID.String, err)
 		}
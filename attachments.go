@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Task attachments
+// -----------------
+//
+// Screenshots, logs and specs attached to a task are kept under the data directory, with
+// their metadata in sqlite. When an execution starts they are copied into a context
+// directory of its own (or into the working directory if asked to), and the task prompt
+// lists their paths so the agent can open them.
+
+// Largest attachment accepted in one upload
+const maxAttachmentSize = 25 << 20
+
+// Directory inside a working directory that holds materialized attachments; kept out of git
+const workdirAttachmentsDir = ".remote-code-attachments"
+
+// dataDir holds files that don't belong in the database, like attachment content
+var dataDir = defaultDataDir()
+
+func defaultDataDir() string {
+	if dir := os.Getenv("REMOTE_CODE_DATA_DIR"); dir != "" {
+		return dir
+	}
+	return "data"
+}
+
+// sanitizeAttachmentName keeps the base name of an uploaded file and drops anything a
+// shell or a path could trip over
+func sanitizeAttachmentName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimLeft(strings.TrimSpace(name), ".")
+	if name == "" {
+		return "attachment"
+	}
+	return name
+}
+
+// saveTaskAttachment stores an uploaded file under the data directory and records it
+func saveTaskAttachment(ctx context.Context, taskID int64, filename, contentType string, content io.Reader) (db.TaskAttachment, error) {
+	token := make([]byte, 8)
+	if _, err := rand.Read(token); err != nil {
+		return db.TaskAttachment{}, err
+	}
+	storagePath := filepath.Join("attachments", strconv.FormatInt(taskID, 10), hex.EncodeToString(token))
+	fullPath := filepath.Join(dataDir, storagePath)
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+		return db.TaskAttachment{}, err
+	}
+
+	file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return db.TaskAttachment{}, err
+	}
+	size, err := io.Copy(file, io.LimitReader(content, maxAttachmentSize+1))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size > maxAttachmentSize {
+		err = fmt.Errorf("attachment exceeds %d MB", maxAttachmentSize>>20)
+	}
+	if err != nil {
+		os.Remove(fullPath)
+		return db.TaskAttachment{}, err
+	}
+
+	filename = sanitizeAttachmentName(filename)
+	if contentType == "" || contentType == "application/octet-stream" {
+		if byExtension := mime.TypeByExtension(filepath.Ext(filename)); byExtension != "" {
+			contentType = byExtension
+		} else {
+			contentType = "application/octet-stream"
+		}
+	}
+
+	attachment, err := queries.CreateTaskAttachment(ctx, db.CreateTaskAttachmentParams{
+		TaskID:      taskID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+		StoragePath: storagePath,
+	})
+	if err != nil {
+		os.Remove(fullPath)
+		return db.TaskAttachment{}, err
+	}
+	return attachment, nil
+}
+
+// deleteTaskAttachments removes every attachment of a task being deleted
+func deleteTaskAttachments(ctx context.Context, taskID int64) {
+	attachments, err := queries.GetTaskAttachmentsByTaskID(ctx, taskID)
+	if err != nil {
+		log.Printf("Warning: failed to get attachments of task %d: %v", taskID, err)
+		return
+	}
+	for _, attachment := range attachments {
+		os.Remove(filepath.Join(dataDir, attachment.StoragePath))
+	}
+	os.Remove(filepath.Join(dataDir, "attachments", strconv.FormatInt(taskID, 10)))
+	if err := queries.DeleteTaskAttachmentsByTaskID(ctx, taskID); err != nil {
+		log.Printf("Warning: failed to delete attachments of task %d: %v", taskID, err)
+	}
+}
+
+// executionAttachmentsDir is where an execution's attachments are materialized: a context
+// directory under the data directory, or a git-ignored directory in the working directory
+func executionAttachmentsDir(executionID int64, workdir string) (string, error) {
+	if workdir != "" {
+		return filepath.Join(workdir, workdirAttachmentsDir, fmt.Sprintf("execution-%d", executionID)), nil
+	}
+	return filepath.Abs(filepath.Join(dataDir, "context", fmt.Sprintf("execution-%d", executionID)))
+}
+
+// excludeFromGit adds a pattern to the repository's info/exclude unless it is there already
+func excludeFromGit(dir, pattern string) {
+	out, _, err := runGit(dir, "rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return
+	}
+	excludePath := strings.TrimSpace(out)
+	if !filepath.IsAbs(excludePath) {
+		excludePath = filepath.Join(dir, excludePath)
+	}
+
+	existing, _ := os.ReadFile(excludePath)
+	for _, line := range strings.Split(string(existing), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(excludePath), 0755); err != nil {
+		return
+	}
+	file, err := os.OpenFile(excludePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		file.WriteString("\n")
+	}
+	file.WriteString(pattern + "\n")
+}
+
+// materializeTaskAttachments copies a task's attachments for an execution and returns
+// their paths, in upload order. workdir is empty unless they go into the working directory.
+func materializeTaskAttachments(ctx context.Context, executionID, taskID int64, workdir string) ([]string, error) {
+	attachments, err := queries.GetTaskAttachmentsByTaskID(ctx, taskID)
+	if err != nil || len(attachments) == 0 {
+		return nil, err
+	}
+
+	dir, err := executionAttachmentsDir(executionID, workdir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if workdir != "" {
+		excludeFromGit(workdir, "/"+workdirAttachmentsDir+"/")
+	}
+
+	_, err = queries.UpdateTaskExecutionAttachmentsDir(ctx, db.UpdateTaskExecutionAttachmentsDirParams{
+		ID:             executionID,
+		AttachmentsDir: dir,
+	})
+	if err != nil {
+		log.Printf("Failed to record attachments directory of task execution %d: %v", executionID, err)
+	}
+
+	paths := []string{}
+	used := map[string]bool{}
+	for _, attachment := range attachments {
+		// Two attachments with the same name both have to survive
+		name := attachment.Filename
+		if used[name] {
+			name = fmt.Sprintf("%d-%s", attachment.ID, name)
+		}
+		used[name] = true
+
+		path := filepath.Join(dir, name)
+		if err := copyFile(filepath.Join(dataDir, attachment.StoragePath), path); err != nil {
+			return paths, fmt.Errorf("failed to copy %s: %v", attachment.Filename, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// removeExecutionAttachments deletes the copies made for an execution
+func removeExecutionAttachments(executionID int64, dir string) {
+	if dir == "" {
+		return
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Warning: failed to remove attachments of task execution %d: %v", executionID, err)
+	}
+	// Drop the working directory's attachments directory once it is empty
+	parent := filepath.Dir(dir)
+	if filepath.Base(parent) == workdirAttachmentsDir {
+		os.Remove(parent)
+	}
+}
+
+// buildTaskPrompt is the prompt an agent receives, listing the task's attachments if any
+func buildTaskPrompt(task db.Task, attachmentPaths []string) string {
+	prompt := fmt.Sprintf("Task: %s\n\nDescription: %s", task.Title, task.Description)
+	if len(attachmentPaths) > 0 {
+		prompt += "\n\nAttachments:"
+		for _, path := range attachmentPaths {
+			prompt += "\n- " + path
+		}
+	}
+	return prompt
+}
+
+// executionAttachmentPaths lists the files already materialized for an execution
+func executionAttachmentPaths(execution db.TaskExecution) []string {
+	if execution.AttachmentsDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(execution.AttachmentsDir)
+	if err != nil {
+		return nil
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			paths = append(paths, filepath.Join(execution.AttachmentsDir, entry.Name()))
+		}
+	}
+	return paths
+}
+
+// handleTaskAttachmentsAPI handles /api/tasks/{id}/attachments[/{attachment id}]
+func handleTaskAttachmentsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	taskID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := queries.GetTask(ctx, taskID); err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	if len(pathParts) >= 3 && pathParts[2] != "" {
+		attachmentID, err := strconv.ParseInt(pathParts[2], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			return
+		}
+		attachment, err := queries.GetTaskAttachment(ctx, attachmentID)
+		if err != nil || attachment.TaskID != taskID {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		handleTaskAttachment(w, r, ctx, attachment)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbAttachments, err := queries.GetTaskAttachmentsByTaskID(ctx, taskID)
+		if err != nil {
+			log.Printf("Failed to get attachments of task %d: %v", taskID, err)
+			http.Error(w, "Failed to get attachments", http.StatusInternalServerError)
+			return
+		}
+
+		attachments := make([]TaskAttachment, len(dbAttachments))
+		for i, dbAttachment := range dbAttachments {
+			attachments[i] = dbTaskAttachmentToTaskAttachment(dbAttachment)
+		}
+		json.NewEncoder(w).Encode(attachments)
+
+	case "POST":
+		// multipart/form-data with one or more "file" parts
+		r.Body = http.MaxBytesReader(w, r.Body, 4*maxAttachmentSize)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "Expected a multipart/form-data upload", http.StatusBadRequest)
+			return
+		}
+
+		attachments := []TaskAttachment{}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != "file" || part.FileName() == "" {
+				part.Close()
+				continue
+			}
+
+			attachment, err := saveTaskAttachment(ctx, taskID, part.FileName(), part.Header.Get("Content-Type"), part)
+			part.Close()
+			if err != nil {
+				log.Printf("Failed to save attachment of task %d: %v", taskID, err)
+				http.Error(w, "Failed to save attachment: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			attachments = append(attachments, dbTaskAttachmentToTaskAttachment(attachment))
+		}
+
+		if len(attachments) == 0 {
+			http.Error(w, "No file uploaded", http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(attachments)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Attachment types shown in the browser rather than downloaded
+var inlineAttachmentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func handleTaskAttachment(w http.ResponseWriter, r *http.Request, ctx context.Context, attachment db.TaskAttachment) {
+	switch r.Method {
+	case "GET":
+		file, err := os.Open(filepath.Join(dataDir, attachment.StoragePath))
+		if err != nil {
+			log.Printf("Failed to open attachment %d: %v", attachment.ID, err)
+			http.Error(w, "Attachment content missing", http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		// Inline only for raster images, judged by their content since the uploader picks the
+		// content type. Everything else, SVG included as it can carry scripts, downloads.
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(file, head)
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			log.Printf("Failed to read attachment %d: %v", attachment.ID, err)
+			http.Error(w, "Failed to read attachment", http.StatusInternalServerError)
+			return
+		}
+		disposition, contentType := "attachment", attachment.ContentType
+		if sniffed := http.DetectContentType(head[:n]); inlineAttachmentTypes[sniffed] && r.URL.Query().Get("download") == "" {
+			disposition, contentType = "inline", sniffed
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "sandbox")
+		http.ServeContent(w, r, attachment.Filename, attachment.CreatedAt.Time, file)
+
+	case "DELETE":
+		if err := queries.DeleteTaskAttachment(ctx, attachment.ID); err != nil {
+			log.Printf("Failed to delete attachment %d: %v", attachment.ID, err)
+			http.Error(w, "Failed to delete attachment", http.StatusInternalServerError)
+			return
+		}
+		os.Remove(filepath.Join(dataDir, attachment.StoragePath))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// recordAttachmentsEvent notes on the execution where its attachments were put
+func recordAttachmentsEvent(ctx context.Context, executionID int64, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	recordTaskExecutionEvent(ctx, executionID, "attachments_materialized",
+		fmt.Sprintf("%d attachment(s) copied to %s", len(paths), filepath.Dir(paths[0])),
+		strings.Join(paths, "\n"), sql.NullInt64{Valid: false})
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Audit log
+// -----------------
+//
+// Every API call that changes something, and every terminal attach, is recorded with who made
+// it, what it did, the IDs it touched, a summary of the request and the response status.
+// Secrets and long values (file contents, uploads) are left out of summaries. Entries can only
+// be added; those older than the retention setting are deleted daily.
+
+const (
+	auditRetentionSetting     = "audit_retention_days"
+	defaultAuditRetentionDays = 90
+	maxAuditRetentionDays     = 3650
+	auditCleanupInterval      = 24 * time.Hour
+)
+
+// Request bodies larger than this are summarized by size only
+const maxAuditBodySize = 64 * 1024
+
+// Longest string value kept in a summary, and longest summary
+const (
+	maxAuditValueLength   = 200
+	maxAuditSummaryLength = 2000
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Request fields never written to the audit log
+var auditSecretFields = map[string]bool{
+	"token": true, "secret": true, "password": true, "code": true,
+	"invite": true, "pairing": true, "private_key": true,
+}
+
+// auditedRequest reports whether a request is recorded: everything but reads, plus terminals
+func auditedRequest(r *http.Request) bool {
+	if r.URL.Path == "/ws" {
+		return true
+	}
+	return r.Method != "GET" && r.Method != "HEAD" && r.Method != "OPTIONS"
+}
+
+// auditMiddleware records audited requests once they are answered. It runs before the auth
+// and origin checks, so refused requests are recorded too, by the user that signed in or
+// anonymous. Terminal attaches are recorded as soon as the WebSocket is established, since the
+// handler runs until it closes.
+func auditMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auditedRequest(r) {
+			next(w, r)
+			return
+		}
+
+		actor := &auditActor{}
+		r = r.WithContext(context.WithValue(r.Context(), auditActorContextKey{}, actor))
+		entry := newAuditEntry(r)
+		recorder := &auditResponseRecorder{ResponseWriter: w}
+		recorder.onHijack = func() {
+			actor.describe(&entry)
+			entry.Status = http.StatusSwitchingProtocols
+			recordAuditEntry(entry)
+		}
+		next(recorder, r)
+
+		if !recorder.hijacked {
+			actor.describe(&entry)
+			entry.Status = int64(recorder.statusCode())
+			recordAuditEntry(entry)
+		}
+	}
+}
+
+type auditActorContextKey struct{}
+
+// auditActor is who made an audited request, filled in as the request is signed in
+type auditActor struct {
+	user     db.User
+	hasUser  bool
+	token    db.ApiToken
+	hasToken bool
+}
+
+// noteAuditUser records the user a request was made by, if it is audited
+func noteAuditUser(r *http.Request, user db.User) {
+	if actor, ok := r.Context().Value(auditActorContextKey{}).(*auditActor); ok {
+		actor.user, actor.hasUser = user, true
+	}
+}
+
+// noteAuditAPIToken records the API token a request was made with, if it is audited
+func noteAuditAPIToken(r *http.Request, token db.ApiToken) {
+	if actor, ok := r.Context().Value(auditActorContextKey{}).(*auditActor); ok {
+		actor.token, actor.hasToken = token, true
+	}
+}
+
+// describe sets the actor of an entry; requests nobody signed in for stay anonymous
+func (a *auditActor) describe(entry *db.CreateAuditLogEntryParams) {
+	if a.hasUser {
+		entry.UserID = sql.NullInt64{Int64: a.user.ID, Valid: true}
+		entry.Actor = a.user.Name
+	}
+	if a.hasToken {
+		entry.ApiTokenID = sql.NullInt64{Int64: a.token.ID, Valid: true}
+	}
+}
+
+// auditResponseRecorder remembers the status of a response, and lets WebSockets hijack it
+type auditResponseRecorder struct {
+	http.ResponseWriter
+	status   int
+	hijacked bool
+	onHijack func()
+}
+
+func (r *auditResponseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *auditResponseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *auditResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil {
+		r.hijacked = true
+		r.onHijack()
+	}
+	return conn, rw, err
+}
+
+func (r *auditResponseRecorder) statusCode() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// newAuditEntry describes a request, before it is handled; the actor is set once it is
+func newAuditEntry(r *http.Request) db.CreateAuditLogEntryParams {
+	entry := db.CreateAuditLogEntryParams{
+		Actor:     "anonymous",
+		IpAddress: clientIP(r),
+	}
+
+	if r.URL.Path == "/ws" {
+		entry.Resource = "terminal"
+		entry.Action = "ATTACH /ws"
+		session := r.URL.Query().Get("session")
+		if session == "" {
+			session = defaultTerminalSession
+		}
+		entry.TargetIds = "{}"
+		entry.Summary = "session=" + session
+		return entry
+	}
+
+	pathParts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/"), "/"), "/")
+	entry.Resource = pathParts[0]
+	action, targets := auditActionAndTargets(pathParts)
+	entry.Action = r.Method + " /api/" + action
+	targetJSON, _ := json.Marshal(targets)
+	entry.TargetIds = string(targetJSON)
+	entry.Summary = auditRequestSummary(r, entry.Resource)
+	return entry
+}
+
+// auditActionAndTargets replaces numeric IDs in an API path with {id}, returning the IDs by
+// the collection they follow: projects/3/tasks/9 gives projects/{id}/tasks/{id} and
+// {"projects": 3, "tasks": 9}.
+func auditActionAndTargets(pathParts []string) (string, map[string]int64) {
+	targets := map[string]int64{}
+	action := make([]string, len(pathParts))
+	for i, part := range pathParts {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err == nil && i > 0 {
+			targets[pathParts[i-1]] = id
+			action[i] = "{id}"
+		} else {
+			action[i] = part
+		}
+	}
+	return strings.Join(action, "/"), targets
+}
+
+// auditRequestSummary describes the query and body of a request, leaving out secrets and long
+// values. The body is put back for the handler.
+func auditRequestSummary(r *http.Request, resource string) string {
+	var parts []string
+	if query := r.URL.Query(); len(query) > 0 {
+		for key := range query {
+			if auditSecretFields[key] {
+				query.Set(key, "[redacted]")
+			}
+		}
+		parts = append(parts, "query: "+query.Encode())
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		prefix, err := io.ReadAll(io.LimitReader(r.Body, maxAuditBodySize+1))
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(prefix), r.Body), r.Body}
+
+		contentType := r.Header.Get("Content-Type")
+		switch {
+		case err != nil:
+		case len(prefix) == 0:
+		case len(prefix) > maxAuditBodySize || !strings.Contains(contentType, "json"):
+			size := r.ContentLength
+			if size < 0 {
+				size = int64(len(prefix))
+			}
+			parts = append(parts, fmt.Sprintf("body: <%s, %d bytes>", contentType, size))
+		default:
+			var body interface{}
+			if json.Unmarshal(prefix, &body) != nil {
+				parts = append(parts, fmt.Sprintf("body: <invalid JSON, %d bytes>", len(prefix)))
+				break
+			}
+			// Environment variable values are secrets
+			secretValue := resource == "environment-variables" || strings.Contains(r.URL.Path, "/environment")
+			var summary bytes.Buffer
+			encoder := json.NewEncoder(&summary)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(redactAuditValue(body, "", secretValue))
+			parts = append(parts, "body: "+strings.TrimSpace(summary.String()))
+		}
+	}
+
+	summary := strings.Join(parts, "; ")
+	if len(summary) > maxAuditSummaryLength {
+		summary = summary[:maxAuditSummaryLength] + "…"
+	}
+	return summary
+}
+
+// redactAuditValue replaces secret fields and long strings in a decoded JSON value
+func redactAuditValue(value interface{}, key string, secretValue bool) interface{} {
+	if auditSecretFields[key] || (secretValue && key == "value") {
+		return "[redacted]"
+	}
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxAuditValueLength {
+			return fmt.Sprintf("<%d bytes>", len(v))
+		}
+		return v
+	case map[string]interface{}:
+		for field, fieldValue := range v {
+			v[field] = redactAuditValue(fieldValue, field, secretValue)
+		}
+		return v
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactAuditValue(item, key, secretValue)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func recordAuditEntry(entry db.CreateAuditLogEntryParams) {
+	if _, err := queries.CreateAuditLogEntry(context.Background(), entry); err != nil {
+		log.Printf("Failed to record audit log entry %s by %s: %v", entry.Action, entry.Actor, err)
+	}
+}
+
+// auditRetentionDays returns how many days entries are kept; 0 keeps them forever
+func auditRetentionDays(ctx context.Context) int64 {
+	setting, err := queries.GetAppSetting(ctx, auditRetentionSetting)
+	if err != nil {
+		return defaultAuditRetentionDays
+	}
+	days, err := strconv.ParseInt(setting.Value, 10, 64)
+	if err != nil || days < 0 {
+		return defaultAuditRetentionDays
+	}
+	return days
+}
+
+// runAuditLogCleanup deletes entries past the retention period daily
+func runAuditLogCleanup() {
+	ticker := time.NewTicker(auditCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleteExpiredAuditLogEntries(context.Background())
+	}
+}
+
+func deleteExpiredAuditLogEntries(ctx context.Context) {
+	days := auditRetentionDays(ctx)
+	if days == 0 {
+		return
+	}
+	deleted, err := queries.DeleteAuditLogEntriesOlderThan(ctx, days)
+	if err != nil {
+		log.Printf("Audit log cleanup: failed to delete old entries: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Audit log cleanup: deleted %d entries older than %d days", deleted, days)
+	}
+}
+
+// AuditLogEntry is an audit log entry as returned by the API
+type AuditLogEntry struct {
+	ID         int64            `json:"id"`
+	UserID     *int64           `json:"user_id,omitempty"`
+	Actor      string           `json:"actor"`
+	APITokenID *int64           `json:"api_token_id,omitempty"`
+	Action     string           `json:"action"`
+	Resource   string           `json:"resource"`
+	TargetIDs  map[string]int64 `json:"target_ids"`
+	Summary    string           `json:"summary"`
+	Status     int64            `json:"status"`
+	IPAddress  string           `json:"ip_address"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+func dbAuditLogToAuditLogEntry(entry db.AuditLog) AuditLogEntry {
+	result := AuditLogEntry{
+		ID:        entry.ID,
+		Actor:     entry.Actor,
+		Action:    entry.Action,
+		Resource:  entry.Resource,
+		TargetIDs: map[string]int64{},
+		Summary:   entry.Summary,
+		Status:    entry.Status,
+		IPAddress: entry.IpAddress,
+	}
+	if entry.UserID.Valid {
+		result.UserID = &entry.UserID.Int64
+	}
+	if entry.ApiTokenID.Valid {
+		result.APITokenID = &entry.ApiTokenID.Int64
+	}
+	json.Unmarshal([]byte(entry.TargetIds), &result.TargetIDs)
+	if entry.CreatedAt.Valid {
+		result.CreatedAt = entry.CreatedAt.Time
+	}
+	return result
+}
+
+// handleAuditAPI handles /api/audit (admins only). GET lists entries, newest first, filtered by
+// ?actor=, ?resource=, ?action= (part of it), ?target_id=, ?failed=true, ?since= and ?until=
+// (dates or RFC 3339 times), with ?limit= and ?before_id= for paging. /api/audit/settings
+// reads and changes the retention period.
+func handleAuditAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) > 0 && pathParts[0] == "settings" {
+		handleAuditSettings(w, r, ctx)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params, err := auditListParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	dbEntries, err := queries.ListAuditLogEntries(ctx, params)
+	if err != nil {
+		log.Printf("Failed to list audit log entries: %v", err)
+		http.Error(w, "Failed to list audit log entries", http.StatusInternalServerError)
+		return
+	}
+	entries := make([]AuditLogEntry, 0, len(dbEntries))
+	for _, entry := range dbEntries {
+		entries = append(entries, dbAuditLogToAuditLogEntry(entry))
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// auditListParams turns the filters of an audit log request into query parameters
+func auditListParams(query url.Values) (db.ListAuditLogEntriesParams, error) {
+	params := db.ListAuditLogEntriesParams{MaxEntries: defaultAuditLimit}
+	if value := strings.TrimSpace(query.Get("actor")); value != "" {
+		params.Actor = value
+	}
+	if value := strings.TrimSpace(query.Get("resource")); value != "" {
+		params.Resource = value
+	}
+	if value := strings.TrimSpace(query.Get("action")); value != "" {
+		params.Action = value
+	}
+	if value := query.Get("target_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return params, fmt.Errorf("Invalid target_id")
+		}
+		params.TargetID = id
+	}
+	if query.Get("failed") == "true" {
+		params.MinStatus = int64(http.StatusBadRequest)
+	}
+	for _, name := range []string{"since", "until"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			if t, err = time.Parse("2006-01-02", value); err != nil {
+				return params, fmt.Errorf("Invalid %s, expected YYYY-MM-DD or an RFC 3339 time", name)
+			}
+		}
+		// Entries are stamped with SQLite's CURRENT_TIMESTAMP, in UTC
+		formatted := t.UTC().Format("2006-01-02 15:04:05")
+		if name == "since" {
+			params.Since = formatted
+		} else {
+			params.Until = formatted
+		}
+	}
+	if value := query.Get("before_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return params, fmt.Errorf("Invalid before_id")
+		}
+		params.BeforeID = id
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			return params, fmt.Errorf("Invalid limit, expected 1 to %d", maxAuditLimit)
+		}
+		params.MaxEntries = limit
+	}
+	return params, nil
+}
+
+// handleAuditSettings handles /api/audit/settings, the retention period in days (0 keeps
+// entries forever)
+func handleAuditSettings(w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var settingsReq struct {
+			RetentionDays int64 `json:"retention_days"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&settingsReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if settingsReq.RetentionDays < 0 || settingsReq.RetentionDays > maxAuditRetentionDays {
+			http.Error(w, fmt.Sprintf("Retention must be 0 to %d days", maxAuditRetentionDays), http.StatusBadRequest)
+			return
+		}
+		_, err := queries.SetAppSetting(ctx, db.SetAppSettingParams{
+			Key:   auditRetentionSetting,
+			Value: strconv.FormatInt(settingsReq.RetentionDays, 10),
+		})
+		if err != nil {
+			log.Printf("Failed to update audit retention: %v", err)
+			http.Error(w, "Failed to update audit retention", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]int64{"retention_days": auditRetentionDays(ctx)})
+}
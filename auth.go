@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -29,21 +30,31 @@ var (
 	challengeStoreTTL  = 5 * time.Minute
 )
 
-// WebAuthnUser implements webauthn.User interface for a single-user system
+// loginHandle identifies the login ceremony, which offers the passkeys of every user; the
+// passkey used decides who signs in
+const loginHandle = "remote-code-login"
+
+// WebAuthnUser implements webauthn.User interface for a user
 type WebAuthnUser struct {
+	handle      string
+	name        string
+	displayName string
 	credentials []webauthn.Credential
 }
 
 func (u *WebAuthnUser) WebAuthnID() []byte {
-	return []byte("single-user")
+	return []byte(u.handle)
 }
 
 func (u *WebAuthnUser) WebAuthnName() string {
-	return "admin"
+	return u.name
 }
 
 func (u *WebAuthnUser) WebAuthnDisplayName() string {
-	return "Administrator"
+	if u.displayName == "" {
+		return u.name
+	}
+	return u.displayName
 }
 
 func (u *WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
@@ -88,7 +99,8 @@ func getOriginFromRequest(r *http.Request) string {
 	return fmt.Sprintf("%s://%s", proto, host)
 }
 
-// getRPID determines the Relying Party ID based on the host
+// getRPID determines the Relying Party ID: the canonical RP ID where configured and allowed,
+// otherwise the host
 func getRPID(r *http.Request) string {
 	host := r.Header.Get("X-Forwarded-Host")
 	if host == "" {
@@ -100,6 +112,10 @@ func getRPID(r *http.Request) string {
 		host = host[:idx]
 	}
 
+	if rpID := canonicalRPID(); rpID != "" && usesCanonicalRPID(r, host, rpID) {
+		return rpID
+	}
+
 	// Note: trycloudflare.com is on the Public Suffix List, so we cannot use
 	// it as an RP ID. Each subdomain must use its full hostname.
 	// This means credentials are specific to each tunnel subdomain.
@@ -107,17 +123,40 @@ func getRPID(r *http.Request) string {
 	return host
 }
 
-// loadUserCredentials loads WebAuthn credentials from the database for a specific RP ID
+// loadUserCredentials loads the WebAuthn credentials of every user for a specific RP ID
 func loadUserCredentials(ctx context.Context, rpID string) (*WebAuthnUser, error) {
 	creds, err := queries.ListWebAuthnCredentialsByRpID(ctx, rpID)
 	if err != nil {
 		return nil, err
 	}
 
-	user := &WebAuthnUser{
-		credentials: make([]webauthn.Credential, len(creds)),
+	return &WebAuthnUser{
+		handle:      loginHandle,
+		name:        "remote-code",
+		credentials: dbCredentialsToCredentials(creds),
+	}, nil
+}
+
+// loadWebAuthnUser loads a user and their WebAuthn credentials for a specific RP ID
+func loadWebAuthnUser(ctx context.Context, user db.User, rpID string) (*WebAuthnUser, error) {
+	creds, err := queries.ListWebAuthnCredentialsByUserID(ctx, db.ListWebAuthnCredentialsByUserIDParams{
+		UserID: user.ID,
+		RpID:   rpID,
+	})
+	if err != nil {
+		return nil, err
 	}
 
+	return &WebAuthnUser{
+		handle:      user.WebauthnHandle,
+		name:        user.Name,
+		displayName: user.DisplayName,
+		credentials: dbCredentialsToCredentials(creds),
+	}, nil
+}
+
+func dbCredentialsToCredentials(creds []db.WebauthnCredential) []webauthn.Credential {
+	credentials := make([]webauthn.Credential, len(creds))
 	for i, c := range creds {
 		var transports []protocol.AuthenticatorTransport
 		if c.Transport.Valid && c.Transport.String != "" {
@@ -126,7 +165,7 @@ func loadUserCredentials(ctx context.Context, rpID string) (*WebAuthnUser, error
 			}
 		}
 
-		user.credentials[i] = webauthn.Credential{
+		credentials[i] = webauthn.Credential{
 			ID:              []byte(c.ID),
 			PublicKey:       c.PublicKey,
 			AttestationType: c.AttestationType,
@@ -137,8 +176,7 @@ func loadUserCredentials(ctx context.Context, rpID string) (*WebAuthnUser, error
 			},
 		}
 	}
-
-	return user, nil
+	return credentials
 }
 
 // generateSessionToken creates a cryptographically secure session token
@@ -152,10 +190,71 @@ func generateSessionToken() (string, error) {
 
 // validateSession checks if a session token is valid
 func validateSession(ctx context.Context, token string) bool {
-	_, err := queries.GetSession(ctx, token)
+	_, err := sessionUser(ctx, token)
 	return err == nil
 }
 
+// sessionUser returns the user a valid session token belongs to
+func sessionUser(ctx context.Context, token string) (db.User, error) {
+	session, err := queries.GetSession(ctx, token)
+	if err != nil {
+		return db.User{}, err
+	}
+	return queries.GetUser(ctx, session.UserID)
+}
+
+// cookieUser returns the user signed in with the request's session cookie
+func cookieUser(ctx context.Context, r *http.Request) (db.User, bool) {
+	cookie, err := r.Cookie("session")
+	if err != nil || cookie.Value == "" {
+		return db.User{}, false
+	}
+	user, err := sessionUser(ctx, cookie.Value)
+	if err != nil {
+		return db.User{}, false
+	}
+	if err := queries.TouchSession(ctx, db.TouchSessionParams{Token: cookie.Value, IpAddress: clientIP(r)}); err != nil {
+		log.Printf("Warning: failed to record session activity: %v", err)
+	}
+	return user, true
+}
+
+// startSession creates a session for a user and sets its cookie
+func startSession(w http.ResponseWriter, r *http.Request, ctx context.Context, userID int64) error {
+	token, err := generateSessionToken()
+	if err != nil {
+		return err
+	}
+	publicID, err := newSessionPublicID()
+	if err != nil {
+		return err
+	}
+
+	_, err = queries.CreateSession(ctx, db.CreateSessionParams{
+		Token:     token,
+		UserID:    userID,
+		PublicID:  publicID,
+		UserAgent: requestUserAgent(r),
+		IpAddress: clientIP(r),
+		ExpiresAt: time.Now().Add(sessionDuration),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Set the session cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteStrictMode,
+		MaxAge:   int(sessionDuration.Seconds()),
+	})
+	return nil
+}
+
 // handleAuthAPI routes auth-related requests
 func handleAuthAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
 	if len(pathParts) == 0 {
@@ -194,6 +293,14 @@ func handleAuthAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 		}
 	case "logout":
 		handleLogout(w, r, ctx)
+	case "sessions":
+		handleAuthSessions(w, r, ctx, pathParts[1:])
+	case "passkeys":
+		handleAuthPasskeys(w, r, ctx, pathParts[1:])
+	case "pairing":
+		handleAuthPairing(w, r, ctx)
+	case "totp":
+		handleAuthTOTP(w, r, ctx, pathParts[1:])
 	default:
 		http.Error(w, "Unknown auth endpoint", http.StatusNotFound)
 	}
@@ -201,8 +308,10 @@ func handleAuthAPI(w http.ResponseWriter, r *http.Request, ctx context.Context,
 
 // AuthStatus represents the authentication status response
 type AuthStatus struct {
-	Authenticated  bool `json:"authenticated"`
-	HasCredentials bool `json:"hasCredentials"`
+	Authenticated  bool  `json:"authenticated"`
+	HasCredentials bool  `json:"hasCredentials"`
+	SetupMode      bool  `json:"setupMode"`
+	User           *User `json:"user,omitempty"`
 }
 
 // handleAuthStatus returns the current authentication status
@@ -223,11 +332,17 @@ func handleAuthStatus(w http.ResponseWriter, r *http.Request, ctx context.Contex
 		return
 	}
 	status.HasCredentials = count > 0
+	if status.SetupMode, err = setupModeActive(ctx, rpID); err != nil {
+		log.Printf("Error checking setup mode: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	// Check if user is authenticated
-	cookie, err := r.Cookie("session")
-	if err == nil && cookie.Value != "" {
-		status.Authenticated = validateSession(ctx, cookie.Value)
+	if user, ok := cookieUser(ctx, r); ok {
+		status.Authenticated = true
+		apiUser := dbUserToUser(user)
+		status.User = &apiUser
 	}
 
 	json.NewEncoder(w).Encode(status)
@@ -247,9 +362,19 @@ func handleRegisterBegin(w http.ResponseWriter, r *http.Request, ctx context.Con
 		return
 	}
 
-	// Load existing credentials to exclude them
+	// Find who the passkey is for
 	rpID := getRPID(r)
-	user, err := loadUserCredentials(ctx, rpID)
+	dbUser, status, err := registrationUser(r, ctx, rpID)
+	if err != nil {
+		if status == http.StatusInternalServerError {
+			log.Printf("Error finding user to register: %v", err)
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	// Load existing credentials to exclude them
+	user, err := loadWebAuthnUser(ctx, dbUser, rpID)
 	if err != nil {
 		log.Printf("Error loading credentials: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -309,9 +434,14 @@ func handleRegisterFinish(w http.ResponseWriter, r *http.Request, ctx context.Co
 		return
 	}
 
-	// Load user to verify against
+	// Load the user the registration was started for
 	rpID := getRPID(r)
-	user, err := loadUserCredentials(ctx, rpID)
+	dbUser, err := queries.GetUserByWebAuthnHandle(ctx, string(session.UserID))
+	if err != nil {
+		http.Error(w, "User not found", http.StatusBadRequest)
+		return
+	}
+	user, err := loadWebAuthnUser(ctx, dbUser, rpID)
 	if err != nil {
 		log.Printf("Error loading credentials: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -335,6 +465,8 @@ func handleRegisterFinish(w http.ResponseWriter, r *http.Request, ctx context.Co
 	_, err = queries.CreateWebAuthnCredential(ctx, db.CreateWebAuthnCredentialParams{
 		ID:              string(credential.ID),
 		RpID:            rpID,
+		UserID:          dbUser.ID,
+		Name:            authenticatorName(credential.Authenticator.AAGUID),
 		PublicKey:       credential.PublicKey,
 		AttestationType: credential.AttestationType,
 		Transport: sql.NullString{
@@ -351,41 +483,95 @@ func handleRegisterFinish(w http.ResponseWriter, r *http.Request, ctx context.Co
 		return
 	}
 
-	// Clean up the challenge
+	// Clean up the challenge, and the invite the passkey may have been registered with
 	challengeStoreMu.Lock()
 	delete(challengeStore, challengeID)
 	challengeStoreMu.Unlock()
+	if err := queries.ClearUserInvite(ctx, dbUser.ID); err != nil {
+		log.Printf("Error clearing invite: %v", err)
+	}
 
 	// Create a session for the newly registered user
-	token, err := generateSessionToken()
-	if err != nil {
-		log.Printf("Error generating session token: %v", err)
+	if err := startSession(w, r, ctx, dbUser.ID); err != nil {
+		log.Printf("Error creating session: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	_, err = queries.CreateSession(ctx, db.CreateSessionParams{
-		Token:     token,
-		ExpiresAt: time.Now().Add(sessionDuration),
-	})
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// registrationUser decides whose passkey is being registered: the signed in user's, an
+// invited user's, the user who created a pairing code, or in setup mode the first admin's.
+// The first admin is created on first use.
+func registrationUser(r *http.Request, ctx context.Context, rpID string) (db.User, int, error) {
+	if user, ok := cookieUser(ctx, r); ok {
+		return user, http.StatusOK, nil
+	}
+
+	var registerReq struct {
+		Invite      string `json:"invite"`
+		Pairing     string `json:"pairing"`
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&registerReq); err != nil && err != io.EOF {
+		return db.User{}, http.StatusBadRequest, fmt.Errorf("Invalid JSON")
+	}
+
+	if registerReq.Invite != "" {
+		user, err := queries.GetUserByInviteTokenHash(ctx, sql.NullString{String: hashToken(registerReq.Invite), Valid: true})
+		if err != nil {
+			return db.User{}, http.StatusUnauthorized, fmt.Errorf("Invite not found or expired")
+		}
+		return user, http.StatusOK, nil
+	}
+
+	if registerReq.Pairing != "" {
+		user, err := usePairingCode(ctx, registerReq.Pairing)
+		if err != nil {
+			return db.User{}, http.StatusUnauthorized, fmt.Errorf("Pairing code not found, used or expired")
+		}
+		return user, http.StatusOK, nil
+	}
+
+	setupMode, err := setupModeActive(ctx, rpID)
 	if err != nil {
-		log.Printf("Error creating session: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+		return db.User{}, http.StatusInternalServerError, err
+	}
+	if !setupMode {
+		return db.User{}, http.StatusUnauthorized, fmt.Errorf("Sign in, or use an invite or a pairing code from a signed in device, to register a passkey")
 	}
 
-	// Set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   int(sessionDuration.Seconds()),
-	})
+	admin, err := queries.GetFirstAdmin(ctx)
+	if err == nil {
+		return admin, http.StatusOK, nil
+	}
+	if err != sql.ErrNoRows {
+		return db.User{}, http.StatusInternalServerError, err
+	}
 
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	name := strings.ToLower(strings.TrimSpace(registerReq.Name))
+	if name == "" {
+		name = "admin"
+	}
+	if !userNamePattern.MatchString(name) {
+		return db.User{}, http.StatusBadRequest, fmt.Errorf("User name must be 1-32 lowercase letters, digits, '.', '_' or '-'")
+	}
+	handle, err := newWebAuthnHandle()
+	if err != nil {
+		return db.User{}, http.StatusInternalServerError, err
+	}
+	admin, err = queries.CreateUser(ctx, db.CreateUserParams{
+		Name:           name,
+		DisplayName:    strings.TrimSpace(registerReq.DisplayName),
+		Role:           roleAdmin,
+		WebauthnHandle: handle,
+	})
+	if err != nil {
+		return db.User{}, http.StatusInternalServerError, err
+	}
+	return admin, http.StatusOK, nil
 }
 
 // handleLoginBegin starts the WebAuthn authentication process
@@ -469,17 +655,33 @@ func handleLoginFinish(w http.ResponseWriter, r *http.Request, ctx context.Conte
 		return
 	}
 
-	// Load user to verify against
+	// The passkey used decides who signs in
 	rpID := getRPID(r)
+	dbCredential, err := queries.GetWebAuthnCredential(ctx, string(response.RawID))
+	if err != nil || dbCredential.RpID != rpID {
+		http.Error(w, "Login verification failed", http.StatusUnauthorized)
+		return
+	}
+	dbUser, err := queries.GetUser(ctx, dbCredential.UserID)
+	if err != nil {
+		http.Error(w, "Login verification failed", http.StatusUnauthorized)
+		return
+	}
+
+	// Verify against every passkey offered, as the user whose passkey it is
 	user, err := loadUserCredentials(ctx, rpID)
 	if err != nil {
 		log.Printf("Error loading credentials: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	user.handle = dbUser.WebauthnHandle
+	user.name = dbUser.Name
+	loginSession := *session
+	loginSession.UserID = user.WebAuthnID()
 
 	// Verify the assertion
-	credential, err := webAuthn.ValidateLogin(user, *session, response)
+	credential, err := webAuthn.ValidateLogin(user, loginSession, response)
 	if err != nil {
 		log.Printf("Error validating login: %v", err)
 		http.Error(w, "Login verification failed", http.StatusUnauthorized)
@@ -502,34 +704,12 @@ func handleLoginFinish(w http.ResponseWriter, r *http.Request, ctx context.Conte
 	challengeStoreMu.Unlock()
 
 	// Create a new session
-	token, err := generateSessionToken()
-	if err != nil {
-		log.Printf("Error generating session token: %v", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
-	}
-
-	_, err = queries.CreateSession(ctx, db.CreateSessionParams{
-		Token:     token,
-		ExpiresAt: time.Now().Add(sessionDuration),
-	})
-	if err != nil {
+	if err := startSession(w, r, ctx, dbUser.ID); err != nil {
 		log.Printf("Error creating session: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    token,
-		Path:     "/",
-		HttpOnly: true,
-		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
-		SameSite: http.SameSiteStrictMode,
-		MaxAge:   int(sessionDuration.Seconds()),
-	})
-
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
@@ -545,7 +725,13 @@ func handleLogout(w http.ResponseWriter, r *http.Request, ctx context.Context) {
 		queries.DeleteSession(ctx, cookie.Value)
 	}
 
-	// Clear the session cookie
+	clearSessionCookie(w, r)
+
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// clearSessionCookie removes the session cookie from the browser
+func clearSessionCookie(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session",
 		Value:    "",
@@ -555,8 +741,6 @@ func handleLogout(w http.ResponseWriter, r *http.Request, ctx context.Context) {
 		SameSite: http.SameSiteStrictMode,
 		MaxAge:   -1,
 	})
-
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
 // cleanupOldChallenges removes expired challenges from memory
@@ -572,56 +756,71 @@ func cleanupOldChallenges() {
 	}
 }
 
-// authMiddleware checks for valid session before allowing access
+// authMiddleware checks for a valid session or API token, and a role that allows the request,
+// before allowing access
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.Background()
 		rpID := getRPID(r)
 
-		// Check if any credentials are registered for this RP ID (domain)
-		// If not, skip auth (allow first-time setup for this domain)
-		count, err := queries.CountWebAuthnCredentialsByRpID(ctx, rpID)
+		// Before the first passkey is registered, allow access (setup mode). Other domains
+		// without passkeys need a device paired with a code.
+		setupMode, err := setupModeActive(ctx, rpID)
 		if err != nil {
-			log.Printf("Error counting credentials in middleware: %v", err)
+			log.Printf("Error checking setup mode in middleware: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
-
-		// If no credentials registered for this domain, allow access (setup mode)
-		if count == 0 {
+		if setupMode {
 			next(w, r)
 			return
 		}
 
-		// Check for valid session
-		cookie, err := r.Cookie("session")
-		if err != nil || cookie.Value == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		// Check for a valid API token or session
+		if value, ok := bearerToken(r); ok {
+			user, token, err := apiTokenUser(ctx, value)
+			if err != nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			noteAuditUser(r, user)
+			noteAuditAPIToken(r, token)
+			if !roleAllows(user.Role, requiredRole(r)) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			ctx := context.WithValue(withUser(r.Context(), user), apiTokenContextKey{}, token)
+			next(w, r.WithContext(ctx))
 			return
 		}
 
-		if !validateSession(ctx, cookie.Value) {
+		user, ok := cookieUser(ctx, r)
+		if !ok {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
+		noteAuditUser(r, user)
 
-		next(w, r)
+		// Check the user's role allows the request
+		if !roleAllows(user.Role, requiredRole(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(withUser(r.Context(), user)))
 	}
 }
 
-// getCORSOrigin returns the appropriate CORS origin for the request
+// getCORSOrigin returns the CORS origin to allow for the request: its Origin if that is
+// allowed, "" (no cross-origin access) if not. Requests without an Origin are not
+// cross-origin browser requests and get "*".
 func getCORSOrigin(r *http.Request) string {
 	origin := r.Header.Get("Origin")
 	if origin == "" {
 		return "*"
 	}
-
-	// Parse the origin to check if it's a trycloudflare.com subdomain
-	if strings.Contains(origin, ".trycloudflare.com") ||
-	   strings.Contains(origin, "localhost") ||
-	   strings.Contains(origin, "127.0.0.1") {
-		return origin
+	if !originAllowed(r, origin) {
+		return ""
 	}
-
-	return "*"
+	return origin
 }
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// -----------------
+// Canonical RP ID
+// -----------------
+//
+// Passkeys are bound to an RP ID, which by default is the host a request came in on. Quick
+// tunnels get a new host every time, so passkeys registered yesterday don't work today.
+// REMOTE_CODE_RP_ID sets one canonical RP ID (a domain you control) for its own host, its
+// subdomains and the related origins: those in REMOTE_CODE_RELATED_ORIGINS (comma separated),
+// the external URLs of roots and the URLs of active tunnels to this server, which keep working
+// as quick tunnels rotate. Tunnels to other ports serve other programs, such as an agent's dev
+// server, and are left out. Browsers that support related origin requests check them at
+// https://<RP ID>/.well-known/webauthn, so the canonical domain should reach this server.
+// Other hosts keep their own RP ID and fall back to pairing codes or authenticator codes.
+
+// canonicalRPID returns the configured RP ID, or "" to use each request's host
+func canonicalRPID() string {
+	return strings.ToLower(strings.TrimSpace(os.Getenv("REMOTE_CODE_RP_ID")))
+}
+
+// External URLs of roots and tunnels, loaded on first use and again after either changes, since
+// every authenticated request may check them
+var relatedOriginURLs []string
+var relatedOriginURLsLoaded bool
+var relatedOriginURLsMutex sync.Mutex
+
+// loadRelatedOriginURLs returns the external URLs of all roots and of the active tunnels to
+// this server's port or a root's local port
+func loadRelatedOriginURLs(ctx context.Context) []string {
+	relatedOriginURLsMutex.Lock()
+	defer relatedOriginURLsMutex.Unlock()
+
+	if relatedOriginURLsLoaded {
+		return relatedOriginURLs
+	}
+
+	roots, err := queries.ListRoots(ctx)
+	if err != nil {
+		log.Printf("Failed to list roots for related origins: %v", err)
+		return nil
+	}
+	tunnels, err := queries.ListActiveRemotePorts(ctx)
+	if err != nil {
+		log.Printf("Failed to list tunnels for related origins: %v", err)
+		return nil
+	}
+
+	urls := []string{}
+	serverPorts := map[string]bool{listenPort(): true}
+	for _, root := range roots {
+		if root.ExternalUrl.Valid {
+			urls = append(urls, root.ExternalUrl.String)
+		}
+		serverPorts[root.LocalPort] = true
+	}
+	for _, tunnel := range tunnels {
+		if tunnel.ExternalUrl.Valid && serverPorts[strconv.FormatInt(tunnel.Port, 10)] {
+			urls = append(urls, tunnel.ExternalUrl.String)
+		}
+	}
+
+	relatedOriginURLs = urls
+	relatedOriginURLsLoaded = true
+	return urls
+}
+
+// invalidateRelatedOriginURLs makes the next check reload the external URLs of roots and tunnels
+func invalidateRelatedOriginURLs() {
+	relatedOriginURLsMutex.Lock()
+	defer relatedOriginURLsMutex.Unlock()
+	relatedOriginURLs = nil
+	relatedOriginURLsLoaded = false
+}
+
+// relatedOrigins returns the origins, besides the RP ID's own, allowed to use the canonical
+// RP ID
+func relatedOrigins(ctx context.Context) []string {
+	var origins []string
+	seen := map[string]bool{}
+	add := func(value string) {
+		parsed, err := url.Parse(strings.TrimSpace(value))
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return
+		}
+		origin := parsed.Scheme + "://" + strings.ToLower(parsed.Host)
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+
+	for _, value := range strings.Split(os.Getenv("REMOTE_CODE_RELATED_ORIGINS"), ",") {
+		add(value)
+	}
+	for _, value := range loadRelatedOriginURLs(ctx) {
+		add(value)
+	}
+	return origins
+}
+
+// usesCanonicalRPID reports whether a request from host may use the canonical rpID: the RP ID
+// itself, its subdomains and related origins
+func usesCanonicalRPID(r *http.Request, host, rpID string) bool {
+	host = strings.ToLower(host)
+	if host == rpID || strings.HasSuffix(host, "."+rpID) {
+		return true
+	}
+	origin := strings.ToLower(getOriginFromRequest(r))
+	for _, related := range relatedOrigins(r.Context()) {
+		if related == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// handleWebAuthnWellKnown serves /.well-known/webauthn, the origins browsers allow to use the
+// canonical RP ID
+func handleWebAuthnWellKnown(w http.ResponseWriter, r *http.Request) {
+	if canonicalRPID() == "" {
+		http.NotFound(w, r)
+		return
+	}
+	origins := relatedOrigins(r.Context())
+	if origins == nil {
+		origins = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	json.NewEncoder(w).Encode(map[string][]string{"origins": origins})
+}
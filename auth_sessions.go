@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Login sessions
+// -----------------
+//
+// Each passkey login is a session. Sessions remember the browser and address they were used
+// from, so a user can review where they are signed in and sign out a lost device. Expired
+// sessions are deleted periodically.
+
+const sessionCleanupInterval = time.Hour
+
+// Longest user agent kept for a session
+const maxUserAgentLength = 512
+
+// runSessionCleanup deletes expired sessions periodically
+func runSessionCleanup() {
+	ticker := time.NewTicker(sessionCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleteExpiredSessions(context.Background())
+		deleteExpiredPairingCodes(context.Background())
+	}
+}
+
+func deleteExpiredSessions(ctx context.Context) {
+	deleted, err := queries.DeleteExpiredSessions(ctx)
+	if err != nil {
+		log.Printf("Session cleanup: failed to delete expired sessions: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Session cleanup: deleted %d expired sessions", deleted)
+	}
+}
+
+// newSessionPublicID returns the ID a session is shown and revoked by
+func newSessionPublicID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// clientIP returns the address a request came from, as forwarded by a tunnel or proxy
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+func requestUserAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent
+}
+
+// LoginSession is a signed in session as listed; the token itself is never returned
+type LoginSession struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	Current    bool       `json:"current"`
+}
+
+func dbSessionToLoginSession(session db.Session, currentToken string) LoginSession {
+	result := LoginSession{
+		ID:        session.PublicID,
+		UserAgent: session.UserAgent,
+		IPAddress: session.IpAddress,
+		ExpiresAt: session.ExpiresAt,
+		Current:   session.Token == currentToken,
+	}
+	if session.CreatedAt.Valid {
+		result.CreatedAt = session.CreatedAt.Time
+	}
+	if session.LastSeenAt.Valid {
+		result.LastSeenAt = &session.LastSeenAt.Time
+	}
+	return result
+}
+
+// handleAuthSessions handles /api/auth/sessions: GET lists the signed in user's sessions,
+// DELETE /api/auth/sessions/{id} signs one out and DELETE /api/auth/sessions signs out every
+// other session
+func handleAuthSessions(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	user, ok := cookieUser(ctx, r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	cookie, _ := r.Cookie("session")
+	currentToken := cookie.Value
+
+	if len(pathParts) > 0 && pathParts[0] != "" {
+		if r.Method != "DELETE" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		sessions, err := queries.ListSessionsByUserID(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to list sessions of user %d: %v", user.ID, err)
+			http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+			return
+		}
+		for _, session := range sessions {
+			if session.PublicID != pathParts[0] {
+				continue
+			}
+			if err := queries.DeleteSessionByPublicID(ctx, db.DeleteSessionByPublicIDParams{UserID: user.ID, PublicID: session.PublicID}); err != nil {
+				log.Printf("Failed to delete session: %v", err)
+				http.Error(w, "Failed to sign out session", http.StatusInternalServerError)
+				return
+			}
+			if session.Token == currentToken {
+				clearSessionCookie(w, r)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		sessions, err := queries.ListSessionsByUserID(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to list sessions of user %d: %v", user.ID, err)
+			http.Error(w, "Failed to list sessions", http.StatusInternalServerError)
+			return
+		}
+		result := make([]LoginSession, 0, len(sessions))
+		for _, session := range sessions {
+			result = append(result, dbSessionToLoginSession(session, currentToken))
+		}
+		json.NewEncoder(w).Encode(result)
+
+	case "DELETE":
+		if err := queries.DeleteOtherSessions(ctx, db.DeleteOtherSessionsParams{UserID: user.ID, Token: currentToken}); err != nil {
+			log.Printf("Failed to delete sessions of user %d: %v", user.ID, err)
+			http.Error(w, "Failed to sign out sessions", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
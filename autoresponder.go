@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Auto-responder
+// -----------------
+//
+// Agents regularly stop at prompts like "Allow this command? (y/n)". Each project can
+// define rules that recognise such a prompt in the agent pane, check the command or
+// path being asked about against an allow or deny list, and send the configured keys.
+// Every automatic answer is recorded in the execution's event history.
+
+// Setting key for the global kill switch
+const autoResponderEnabledSetting = "auto_responder_enabled"
+
+// How often running agent sessions are checked for prompts
+const autoResponderInterval = 2 * time.Second
+
+// Only the last lines of the pane are considered, so prompts already scrolled away are ignored
+const autoResponderTailLines = 15
+
+// Pane content that was last answered, per tmux session, so a prompt is never answered twice
+var autoRespondedContent = make(map[string]string)
+var autoRespondedContentMutex sync.Mutex
+
+// autoResponseMatch describes the outcome of evaluating rules against a pane
+type autoResponseMatch struct {
+	Rule    db.AutoResponseRule
+	Prompt  string
+	Subject string
+	Respond bool
+}
+
+func handleAutoRespondersAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) == 0 || pathParts[0] == "" {
+		http.Error(w, "Auto-responder rule ID required", http.StatusBadRequest)
+		return
+	}
+
+	// Global kill switch: /api/auto-responders/settings
+	if pathParts[0] == "settings" {
+		handleAutoResponderSettings(w, r, ctx)
+		return
+	}
+
+	ruleID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid auto-responder rule ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := queries.GetAutoResponseRule(ctx, ruleID)
+	if err != nil {
+		http.Error(w, "Auto-responder rule not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(dbAutoResponseRuleToAutoResponseRule(existing))
+
+	case "PUT":
+		var updateReq autoResponseRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := updateReq.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		updated, err := queries.UpdateAutoResponseRule(ctx, db.UpdateAutoResponseRuleParams{
+			ID:            ruleID,
+			Name:          updateReq.Name,
+			PromptPattern: updateReq.PromptPattern,
+			SubjectType:   updateReq.SubjectType,
+			ListMode:      updateReq.ListMode,
+			Subjects:      strings.Join(updateReq.Subjects, "\n"),
+			ResponseKeys:  updateReq.ResponseKeys,
+			Enabled:       updateReq.Enabled == nil || *updateReq.Enabled,
+		})
+		if err != nil {
+			log.Printf("Failed to update auto-responder rule %d: %v", ruleID, err)
+			http.Error(w, "Failed to update auto-responder rule", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(dbAutoResponseRuleToAutoResponseRule(updated))
+
+	case "DELETE":
+		if err := queries.DeleteAutoResponseRule(ctx, ruleID); err != nil {
+			log.Printf("Failed to delete auto-responder rule %d: %v", ruleID, err)
+			http.Error(w, "Failed to delete auto-responder rule", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProjectAutoRespondersAPI handles /api/projects/{id}/auto-responders
+func handleProjectAutoRespondersAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	projectID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbRules, err := queries.GetAutoResponseRulesByProjectID(ctx, projectID)
+		if err != nil {
+			log.Printf("Failed to get auto-responder rules for project %d: %v", projectID, err)
+			http.Error(w, "Failed to get auto-responder rules", http.StatusInternalServerError)
+			return
+		}
+
+		rules := make([]AutoResponseRule, 0)
+		for _, dbRule := range dbRules {
+			rules = append(rules, dbAutoResponseRuleToAutoResponseRule(dbRule))
+		}
+
+		json.NewEncoder(w).Encode(rules)
+
+	case "POST":
+		if _, err := queries.GetProject(ctx, projectID); err != nil {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+
+		var createReq autoResponseRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := createReq.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		rule, err := queries.CreateAutoResponseRule(ctx, db.CreateAutoResponseRuleParams{
+			ProjectID:     projectID,
+			Name:          createReq.Name,
+			PromptPattern: createReq.PromptPattern,
+			SubjectType:   createReq.SubjectType,
+			ListMode:      createReq.ListMode,
+			Subjects:      strings.Join(createReq.Subjects, "\n"),
+			ResponseKeys:  createReq.ResponseKeys,
+			Enabled:       createReq.Enabled == nil || *createReq.Enabled,
+		})
+		if err != nil {
+			log.Printf("Failed to create auto-responder rule: %v", err)
+			http.Error(w, "Failed to create auto-responder rule", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(dbAutoResponseRuleToAutoResponseRule(rule))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// autoResponseRuleRequest is the create/update payload for a rule
+type autoResponseRuleRequest struct {
+	Name          string   `json:"name"`
+	PromptPattern string   `json:"prompt_pattern"`
+	SubjectType   string   `json:"subject_type"`
+	ListMode      string   `json:"list_mode"`
+	Subjects      []string `json:"subjects"`
+	ResponseKeys  string   `json:"response_keys"`
+	Enabled       *bool    `json:"enabled"`
+}
+
+// validate checks the payload and fills in defaults
+func (req *autoResponseRuleRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.ResponseKeys = strings.TrimSpace(req.ResponseKeys)
+	if req.SubjectType == "" {
+		req.SubjectType = "command"
+	}
+	if req.ListMode == "" {
+		req.ListMode = "allow"
+	}
+
+	if req.Name == "" {
+		return fmt.Errorf("Name is required")
+	}
+	if req.PromptPattern == "" {
+		return fmt.Errorf("Prompt pattern is required")
+	}
+	re, err := regexp.Compile(req.PromptPattern)
+	if err != nil {
+		return fmt.Errorf("Invalid prompt pattern: %v", err)
+	}
+	if req.SubjectType != "command" && req.SubjectType != "path" {
+		return fmt.Errorf("Subject type must be 'command' or 'path'")
+	}
+	if req.ListMode != "allow" && req.ListMode != "deny" {
+		return fmt.Errorf("List mode must be 'allow' or 'deny'")
+	}
+	// Without a subject there is nothing to check against the list, and a deny list
+	// would answer every prompt
+	if re.NumSubexp() == 0 {
+		return fmt.Errorf("Prompt pattern needs a capture group for the %s being asked about", req.SubjectType)
+	}
+	if req.ResponseKeys == "" {
+		return fmt.Errorf("Response keys are required")
+	}
+
+	subjects := []string{}
+	for _, subject := range req.Subjects {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+	req.Subjects = subjects
+	return nil
+}
+
+// handleAutoResponderSettings exposes the global kill switch
+func handleAutoResponderSettings(w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(map[string]bool{"enabled": isAutoResponderEnabled(ctx)})
+
+	case "PUT":
+		var settingsReq struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&settingsReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		_, err := queries.SetAppSetting(ctx, db.SetAppSettingParams{
+			Key:   autoResponderEnabledSetting,
+			Value: strconv.FormatBool(settingsReq.Enabled),
+		})
+		if err != nil {
+			log.Printf("Failed to update auto-responder setting: %v", err)
+			http.Error(w, "Failed to update auto-responder setting", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Auto-responder globally enabled: %v", settingsReq.Enabled)
+		json.NewEncoder(w).Encode(map[string]bool{"enabled": settingsReq.Enabled})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTaskExecutionEventsAPI returns the event history of an execution (/api/task-executions/{id}/events)
+func handleTaskExecutionEventsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	executionID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid execution ID", http.StatusBadRequest)
+		return
+	}
+
+	events, err := queries.GetTaskExecutionEvents(ctx, executionID)
+	if err != nil {
+		log.Printf("Failed to get task execution events: %v", err)
+		http.Error(w, "Failed to get task execution events", http.StatusInternalServerError)
+		return
+	}
+
+	// Ensure we return empty array instead of null
+	if events == nil {
+		events = []db.TaskExecutionEvent{}
+	}
+
+	json.NewEncoder(w).Encode(events)
+}
+
+// isAutoResponderEnabled reports whether the global kill switch allows auto-responses
+func isAutoResponderEnabled(ctx context.Context) bool {
+	setting, err := queries.GetAppSetting(ctx, autoResponderEnabledSetting)
+	if err != nil {
+		// Enabled unless explicitly switched off
+		return true
+	}
+	enabled, err := strconv.ParseBool(setting.Value)
+	return err != nil || enabled
+}
+
+// recordTaskExecutionEvent appends an entry to an execution's history
+func recordTaskExecutionEvent(ctx context.Context, executionID int64, eventType, message, detail string, ruleID sql.NullInt64) {
+	_, err := queries.CreateTaskExecutionEvent(ctx, db.CreateTaskExecutionEventParams{
+		TaskExecutionID: executionID,
+		EventType:       eventType,
+		Message:         message,
+		Detail:          detail,
+		RuleID:          ruleID,
+	})
+	if err != nil {
+		log.Printf("Failed to record %s event for task execution %d: %v", eventType, executionID, err)
+	}
+}
+
+// runAutoResponder periodically answers prompts in running agent sessions
+func runAutoResponder() {
+	ticker := time.NewTicker(autoResponderInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		autoRespondToRunningExecutions(context.Background())
+	}
+}
+
+func autoRespondToRunningExecutions(ctx context.Context) {
+	if !isAutoResponderEnabled(ctx) {
+		return
+	}
+
+	executions, err := queries.ListTaskExecutions(ctx)
+	if err != nil {
+		log.Printf("Auto-responder: failed to list task executions: %v", err)
+		return
+	}
+
+	rulesByProject := make(map[int64][]db.AutoResponseRule)
+	activeSessions := make(map[string]bool)
+
+	for _, execution := range executions {
+		status := strings.ToLower(execution.Status)
+		if (status != "running" && status != "waiting") || !execution.AgentTmuxID.Valid {
+			continue
+		}
+		sessionName := execution.AgentTmuxID.String
+		activeSessions[sessionName] = true
+
+		rules, loaded := rulesByProject[execution.ProjectID]
+		if !loaded {
+			rules, err = queries.GetEnabledAutoResponseRulesByProjectID(ctx, execution.ProjectID)
+			if err != nil {
+				log.Printf("Auto-responder: failed to load rules for project %d: %v", execution.ProjectID, err)
+			}
+			rulesByProject[execution.ProjectID] = rules
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		// Plain capture (no escape sequences) of the visible pane
+		output, err := sessionManager.Capture(sessionName, CaptureOptions{})
+		if err != nil {
+			continue
+		}
+		autoRespondToPane(ctx, execution.ID, sessionName, output, rules)
+	}
+
+	// Forget sessions that are no longer running
+	autoRespondedContentMutex.Lock()
+	for sessionName := range autoRespondedContent {
+		if !activeSessions[sessionName] {
+			delete(autoRespondedContent, sessionName)
+		}
+	}
+	autoRespondedContentMutex.Unlock()
+}
+
+// autoRespondToPane evaluates rules against a captured pane and sends keys if one applies
+func autoRespondToPane(ctx context.Context, executionID int64, sessionName, content string, rules []db.AutoResponseRule) {
+	tail := paneTail(content, autoResponderTailLines)
+	if tail == "" {
+		return
+	}
+
+	autoRespondedContentMutex.Lock()
+	alreadyAnswered := autoRespondedContent[sessionName] == tail
+	autoRespondedContentMutex.Unlock()
+	if alreadyAnswered {
+		return
+	}
+
+	match := evaluateAutoResponseRules(tail, rules)
+	if match == nil || !match.Respond {
+		return
+	}
+
+	keys := strings.Fields(match.Rule.ResponseKeys)
+	if err := sessionManager.SendKeys(sessionName, keys...); err != nil {
+		log.Printf("Auto-responder: failed to send keys to session %s: %v", sessionName, err)
+		return
+	}
+
+	autoRespondedContentMutex.Lock()
+	autoRespondedContent[sessionName] = tail
+	autoRespondedContentMutex.Unlock()
+
+	message := fmt.Sprintf("Rule %q answered with %q", match.Rule.Name, match.Rule.ResponseKeys)
+	if match.Subject != "" {
+		message = fmt.Sprintf("Rule %q answered %s %q with %q", match.Rule.Name, match.Rule.SubjectType, match.Subject, match.Rule.ResponseKeys)
+	}
+	log.Printf("Auto-responder: task execution %d: %s", executionID, message)
+	recordTaskExecutionEvent(ctx, executionID, "auto_response", message, match.Prompt, sql.NullInt64{Int64: match.Rule.ID, Valid: true})
+}
+
+// evaluateAutoResponseRules returns the first rule whose prompt pattern matches the pane.
+// Allow-mode rules respond only when the subject is listed; deny-mode rules respond
+// unless it is listed. A matching rule that declines, or that captured no subject,
+// leaves the prompt for a human, as does a command that runs more than one program, since a
+// pattern like "npm test*" would also cover "npm test; curl ... | sh".
+func evaluateAutoResponseRules(content string, rules []db.AutoResponseRule) *autoResponseMatch {
+	for _, rule := range rules {
+		re, err := regexp.Compile(rule.PromptPattern)
+		if err != nil {
+			continue
+		}
+
+		// The most recent occurrence is the one the agent is waiting on
+		found := re.FindAllStringSubmatch(content, -1)
+		if len(found) == 0 {
+			continue
+		}
+		last := found[len(found)-1]
+
+		match := &autoResponseMatch{Rule: rule, Prompt: last[0]}
+		if len(last) > 1 {
+			match.Subject = strings.TrimSpace(last[1])
+		}
+		if match.Subject == "" || (rule.SubjectType == "command" && chainsShellCommands(match.Subject)) {
+			return match
+		}
+
+		listed := false
+		for _, pattern := range strings.Split(rule.Subjects, "\n") {
+			pattern = strings.TrimSpace(pattern)
+			if pattern != "" && subjectMatchesPattern(rule.SubjectType, pattern, match.Subject) {
+				listed = true
+				break
+			}
+		}
+
+		if rule.ListMode == "deny" {
+			match.Respond = !listed
+		} else {
+			match.Respond = listed
+		}
+		return match
+	}
+	return nil
+}
+
+// chainsShellCommands reports whether a command holds shell syntax that runs or feeds other
+// commands: separators, pipes, substitutions, redirections or more than one line
+func chainsShellCommands(command string) bool {
+	return strings.ContainsAny(command, ";&|`<>\n\r") || strings.Contains(command, "$(")
+}
+
+// subjectMatchesPattern matches a command or path against a glob pattern.
+// For commands '*' matches anything. For paths '*' stays within one path segment,
+// '**' crosses segments and a trailing '/' matches everything below a directory.
+func subjectMatchesPattern(subjectType, pattern, subject string) bool {
+	if subject == "" {
+		return false
+	}
+
+	if subjectType == "path" && strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(subject, pattern)
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == '*' && subjectType == "path" && i+1 < len(pattern) && pattern[i+1] == '*':
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*' && subjectType == "path":
+			expr.WriteString("[^/]*")
+		case pattern[i] == '*':
+			expr.WriteString(".*")
+		case pattern[i] == '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+		}
+	}
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(subject)
+}
+
+// paneTail returns the last n non-empty lines of captured pane content
+func paneTail(content string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, strings.TrimRight(line, " \t\r"))
+		}
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Execution checkpoints
+// -----------------
+//
+// While an execution runs, its working tree can be snapshotted every N minutes and whenever
+// the agent goes idle. A checkpoint is a commit of every non-ignored file, built in a
+// temporary index so the user's index and HEAD are never touched, and kept under a hidden
+// ref (refs/remote-code/exec/<id>/<n>) so it doesn't show up in branches or the log.
+
+// How often running executions are checked for due checkpoints
+const checkpointMonitorInterval = 30 * time.Second
+
+// Committer of checkpoint commits, so they work without a configured git identity
+var checkpointGitIdentity = []string{
+	"GIT_AUTHOR_NAME=remote-code",
+	"GIT_AUTHOR_EMAIL=remote-code@localhost",
+	"GIT_COMMITTER_NAME=remote-code",
+	"GIT_COMMITTER_EMAIL=remote-code@localhost",
+}
+
+// Serializes checkpoints so the monitor and the API don't number two of them the same
+var checkpointMutex sync.Mutex
+
+// Executions whose agent was idle at the last check, to take one idle checkpoint per pause
+var checkpointIdleExecutions = make(map[int64]bool)
+
+func checkpointRef(executionID, sequence int64) string {
+	return fmt.Sprintf("refs/remote-code/exec/%d/%d", executionID, sequence)
+}
+
+// snapshotWorkingTree writes the working tree, untracked files included, as a git tree.
+// It returns the repository root, the tree and the current HEAD commit (empty on an unborn branch).
+func snapshotWorkingTree(dir string) (root, tree, head string, err error) {
+	out, _, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", "", "", fmt.Errorf("not a git repository: %s", dir)
+	}
+	root = strings.TrimSpace(out)
+
+	if out, _, err := runGit(root, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err == nil {
+		head = strings.TrimSpace(out)
+	}
+
+	index, err := os.CreateTemp("", "remote-code-index-")
+	if err != nil {
+		return "", "", "", err
+	}
+	indexPath := index.Name()
+	index.Close()
+	defer os.Remove(indexPath)
+
+	// Start from a copy of the real index so unchanged files needn't be hashed again
+	out, _, err = runGit(root, "rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to locate index: %v", err)
+	}
+	realIndex := strings.TrimSpace(out)
+	if !filepath.IsAbs(realIndex) {
+		realIndex = filepath.Join(root, realIndex)
+	}
+	if data, err := os.ReadFile(realIndex); err == nil {
+		if err := os.WriteFile(indexPath, data, 0600); err != nil {
+			return "", "", "", err
+		}
+	} else {
+		// git refuses an empty index file but creates a missing one
+		os.Remove(indexPath)
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + indexPath}
+	if out, _, err := runGitWithEnv(root, env, "add", "-A"); err != nil {
+		return "", "", "", fmt.Errorf("failed to stage working tree: %v: %s", err, out)
+	}
+	out, _, err = runGitWithEnv(root, env, "write-tree")
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to write tree: %v: %s", err, out)
+	}
+	return root, strings.TrimSpace(out), head, nil
+}
+
+// createExecutionCheckpoint snapshots the working tree in dir. It returns nil when nothing
+// changed since the previous checkpoint (or since HEAD for the first one).
+func createExecutionCheckpoint(ctx context.Context, executionID int64, dir, reason string) (*db.ExecutionCheckpoint, error) {
+	checkpointMutex.Lock()
+	defer checkpointMutex.Unlock()
+
+	root, tree, head, err := snapshotWorkingTree(dir)
+	if err != nil {
+		return nil, err
+	}
+	return saveExecutionCheckpoint(ctx, executionID, root, tree, head, reason)
+}
+
+// saveExecutionCheckpoint commits a snapshot tree under the execution's next checkpoint ref;
+// the caller holds checkpointMutex
+func saveExecutionCheckpoint(ctx context.Context, executionID int64, root, tree, head, reason string) (*db.ExecutionCheckpoint, error) {
+	sequence := int64(1)
+	previousTree := ""
+	if latest, err := queries.GetLatestExecutionCheckpoint(ctx, executionID); err == nil {
+		sequence = latest.Sequence + 1
+		previousTree = latest.TreeSha
+	} else if head != "" {
+		if out, _, err := runGit(root, "rev-parse", head+"^{tree}"); err == nil {
+			previousTree = strings.TrimSpace(out)
+		}
+	}
+	if tree == previousTree {
+		return nil, nil
+	}
+
+	args := []string{"commit-tree", tree, "-m", fmt.Sprintf("Checkpoint %d of task execution %d (%s)", sequence, executionID, reason)}
+	if head != "" {
+		args = append(args, "-p", head)
+	}
+	out, _, err := runGitWithEnv(root, checkpointGitIdentity, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit checkpoint: %v: %s", err, out)
+	}
+	commit := strings.TrimSpace(out)
+
+	ref := checkpointRef(executionID, sequence)
+	if out, _, err := runGit(root, "update-ref", ref, commit); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v: %s", ref, err, out)
+	}
+
+	checkpoint, err := queries.CreateExecutionCheckpoint(ctx, db.CreateExecutionCheckpointParams{
+		TaskExecutionID: executionID,
+		Sequence:        sequence,
+		RefName:         ref,
+		CommitSha:       commit,
+		TreeSha:         tree,
+		Reason:          reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordTaskExecutionEvent(ctx, executionID, "checkpoint_created", fmt.Sprintf("Checkpoint %d (%s)", sequence, reason), commit, sql.NullInt64{Valid: false})
+	return &checkpoint, nil
+}
+
+// restoreExecutionCheckpoint makes the working tree match a checkpoint. The current state is
+// checkpointed first so a restore can itself be undone. The user's index is left alone.
+func restoreExecutionCheckpoint(ctx context.Context, executionID int64, dir string, checkpoint db.ExecutionCheckpoint) error {
+	checkpointMutex.Lock()
+	defer checkpointMutex.Unlock()
+
+	root, tree, head, err := snapshotWorkingTree(dir)
+	if err != nil {
+		return err
+	}
+	if _, err := saveExecutionCheckpoint(ctx, executionID, root, tree, head, "before_restore"); err != nil {
+		return fmt.Errorf("failed to checkpoint current state: %v", err)
+	}
+
+	// Remove files that didn't exist at the checkpoint
+	out, _, err := runGit(root, "diff-tree", "-r", "-z", "--name-only", "--no-renames", "--diff-filter=D", tree, checkpoint.TreeSha)
+	if err != nil {
+		return fmt.Errorf("failed to compare with checkpoint: %v: %s", err, out)
+	}
+	for _, path := range strings.Split(out, "\x00") {
+		if path == "" {
+			continue
+		}
+		if err := os.Remove(filepath.Join(root, path)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+	}
+
+	// Write the checkpoint's files through a scratch index
+	index, err := os.CreateTemp("", "remote-code-index-")
+	if err != nil {
+		return err
+	}
+	indexPath := index.Name()
+	index.Close()
+	os.Remove(indexPath)
+	defer os.Remove(indexPath)
+
+	env := []string{"GIT_INDEX_FILE=" + indexPath}
+	if out, _, err := runGitWithEnv(root, env, "read-tree", checkpoint.CommitSha); err != nil {
+		return fmt.Errorf("failed to read checkpoint: %v: %s", err, out)
+	}
+	if out, _, err := runGitWithEnv(root, env, "checkout-index", "-a", "-f"); err != nil {
+		return fmt.Errorf("failed to restore files: %v: %s", err, out)
+	}
+
+	recordTaskExecutionEvent(ctx, executionID, "checkpoint_restored", fmt.Sprintf("Restored checkpoint %d", checkpoint.Sequence), checkpoint.CommitSha, sql.NullInt64{Valid: false})
+	return nil
+}
+
+// deleteExecutionCheckpoints removes an execution's checkpoint refs and records
+func deleteExecutionCheckpoints(ctx context.Context, executionID int64, dir string) {
+	checkpoints, err := queries.GetExecutionCheckpointsByExecutionID(ctx, executionID)
+	if err != nil {
+		log.Printf("Warning: failed to get checkpoints for task execution %d: %v", executionID, err)
+	}
+	for _, checkpoint := range checkpoints {
+		if out, _, err := runGit(dir, "update-ref", "-d", checkpoint.RefName); err != nil {
+			log.Printf("Warning: failed to delete %s: %v: %s", checkpoint.RefName, err, out)
+		}
+	}
+
+	err = queries.DeleteExecutionCheckpointsByExecutionID(ctx, executionID)
+	if err != nil {
+		log.Printf("Warning: failed to delete checkpoints for task execution %d: %v", executionID, err)
+	}
+
+	checkpointMutex.Lock()
+	delete(checkpointIdleExecutions, executionID)
+	checkpointMutex.Unlock()
+}
+
+// runCheckpointMonitor periodically checkpoints executions that have checkpoints enabled
+func runCheckpointMonitor() {
+	ticker := time.NewTicker(checkpointMonitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkpointRunningExecutions(context.Background())
+	}
+}
+
+func checkpointRunningExecutions(ctx context.Context) {
+	executions, err := queries.ListTaskExecutions(ctx)
+	if err != nil {
+		log.Printf("Checkpoint monitor: failed to list task executions: %v", err)
+		return
+	}
+
+	for _, execution := range executions {
+		if execution.CheckpointIntervalMinutes <= 0 || !strings.EqualFold(execution.Status, "running") {
+			continue
+		}
+
+		details, err := queries.GetTaskExecutionWithDetails(ctx, execution.ID)
+		if err != nil {
+			continue
+		}
+
+		reason := ""
+
+		// Once per pause, when the agent starts waiting for input
+		idle := execution.AgentTmuxID.Valid && determineTaskExecutionStatus(execution.AgentTmuxID.String) == "Waiting"
+		checkpointMutex.Lock()
+		if idle && !checkpointIdleExecutions[execution.ID] {
+			reason = "idle"
+		}
+		checkpointIdleExecutions[execution.ID] = idle
+		checkpointMutex.Unlock()
+
+		if reason == "" {
+			last := execution.CreatedAt.Time
+			if latest, err := queries.GetLatestExecutionCheckpoint(ctx, execution.ID); err == nil {
+				last = latest.CreatedAt.Time
+			}
+			if time.Since(last) >= time.Duration(execution.CheckpointIntervalMinutes)*time.Minute {
+				reason = "interval"
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		if _, err := createExecutionCheckpoint(ctx, execution.ID, details.BaseDirectoryPath, reason); err != nil {
+			log.Printf("Checkpoint monitor: failed to checkpoint task execution %d: %v", execution.ID, err)
+		}
+	}
+}
+
+// handleTaskExecutionCheckpointsAPI handles /api/task-executions/{id}/checkpoints[/{n}[/diff|/restore]]
+func handleTaskExecutionCheckpointsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	executionID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid execution ID", http.StatusBadRequest)
+		return
+	}
+
+	execution, err := queries.GetTaskExecutionWithDetails(ctx, executionID)
+	if err != nil {
+		http.Error(w, "Task execution not found", http.StatusNotFound)
+		return
+	}
+
+	if len(pathParts) == 2 || pathParts[2] == "" {
+		switch r.Method {
+		case "GET":
+			dbCheckpoints, err := queries.GetExecutionCheckpointsByExecutionID(ctx, executionID)
+			if err != nil {
+				log.Printf("Failed to get checkpoints: %v", err)
+				http.Error(w, "Failed to get checkpoints", http.StatusInternalServerError)
+				return
+			}
+
+			checkpoints := make([]ExecutionCheckpoint, 0, len(dbCheckpoints))
+			for _, dbCheckpoint := range dbCheckpoints {
+				checkpoints = append(checkpoints, dbExecutionCheckpointToExecutionCheckpoint(dbCheckpoint))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"interval_minutes": execution.CheckpointIntervalMinutes,
+				"checkpoints":      checkpoints,
+			})
+
+		case "POST":
+			// Take a checkpoint now
+			checkpoint, err := createExecutionCheckpoint(ctx, executionID, execution.BaseDirectoryPath, "manual")
+			if err != nil {
+				log.Printf("Failed to create checkpoint: %v", err)
+				http.Error(w, "Failed to create checkpoint: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if checkpoint == nil {
+				json.NewEncoder(w).Encode(map[string]interface{}{"created": false, "reason": "No changes since the last checkpoint"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"created":    true,
+				"checkpoint": dbExecutionCheckpointToExecutionCheckpoint(*checkpoint),
+			})
+
+		case "PUT":
+			var updateReq struct {
+				IntervalMinutes int64 `json:"interval_minutes"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+			if updateReq.IntervalMinutes < 0 {
+				http.Error(w, "interval_minutes must not be negative", http.StatusBadRequest)
+				return
+			}
+			_, err := queries.UpdateTaskExecutionCheckpointInterval(ctx, db.UpdateTaskExecutionCheckpointIntervalParams{
+				ID:                        executionID,
+				CheckpointIntervalMinutes: updateReq.IntervalMinutes,
+			})
+			if err != nil {
+				log.Printf("Failed to update checkpoint interval: %v", err)
+				http.Error(w, "Failed to update checkpoint interval", http.StatusInternalServerError)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"interval_minutes": updateReq.IntervalMinutes})
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	sequence, err := strconv.ParseInt(pathParts[2], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid checkpoint number", http.StatusBadRequest)
+		return
+	}
+	checkpoint, err := queries.GetExecutionCheckpoint(ctx, db.GetExecutionCheckpointParams{
+		TaskExecutionID: executionID,
+		Sequence:        sequence,
+	})
+	if err != nil {
+		http.Error(w, "Checkpoint not found", http.StatusNotFound)
+		return
+	}
+
+	action := ""
+	if len(pathParts) > 3 {
+		action = pathParts[3]
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		json.NewEncoder(w).Encode(dbExecutionCheckpointToExecutionCheckpoint(checkpoint))
+
+	case action == "diff" && r.Method == "GET":
+		// against=previous (default) compares with the checkpoint before it, base with the
+		// commit it was taken on and current with the working tree as it is now
+		from, to := "", checkpoint.CommitSha
+		switch r.URL.Query().Get("against") {
+		case "", "previous":
+			if previous, err := queries.GetExecutionCheckpoint(ctx, db.GetExecutionCheckpointParams{
+				TaskExecutionID: executionID,
+				Sequence:        sequence - 1,
+			}); err == nil {
+				from = previous.CommitSha
+			} else {
+				from = checkpoint.CommitSha + "^"
+			}
+		case "base":
+			from = checkpoint.CommitSha + "^"
+		case "current":
+			checkpointMutex.Lock()
+			_, tree, _, err := snapshotWorkingTree(execution.BaseDirectoryPath)
+			checkpointMutex.Unlock()
+			if err != nil {
+				http.Error(w, "Failed to read working tree: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			from, to = checkpoint.CommitSha, tree
+		default:
+			http.Error(w, "against must be previous, base or current", http.StatusBadRequest)
+			return
+		}
+
+		args := []string{"diff", from, to}
+		if file := r.URL.Query().Get("file"); file != "" {
+			args = append(args, "--", file)
+		}
+		out, _, err := runGit(execution.BaseDirectoryPath, args...)
+		if err != nil {
+			// The first checkpoint on an unborn branch has no parent to compare with
+			out, _, err = runGit(execution.BaseDirectoryPath, "show", "--format=", checkpoint.CommitSha)
+		}
+		if err != nil {
+			http.Error(w, "Failed to diff checkpoint: "+out, http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"diff": out})
+
+	case action == "restore" && r.Method == "POST":
+		if err := restoreExecutionCheckpoint(ctx, executionID, execution.BaseDirectoryPath, checkpoint); err != nil {
+			log.Printf("Failed to restore checkpoint %d of task execution %d: %v", sequence, executionID, err)
+			http.Error(w, "Failed to restore checkpoint: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+
+	case action == "" || action == "diff" || action == "restore":
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Task comments
+// -----------------
+//
+// Every task keeps a thread of comments: notes written by people, feedback they sent to
+// an agent, and entries the system adds when an execution starts, is re-prompted or is
+// accepted. A comment may be about one execution, but belongs to the task, so the
+// reasoning survives once executions are cleaned up.
+
+const (
+	commentAuthorHuman  = "human"
+	commentAuthorSystem = "system"
+)
+
+// Longest comment accepted, feedback pasted from logs included
+const maxCommentLength = 64 * 1024
+
+// addTaskComment records a comment; failures are logged, a missing comment never fails the
+// action it describes
+func addTaskComment(ctx context.Context, taskID int64, executionID sql.NullInt64, authorType, author, kind, body string) {
+	_, err := queries.CreateTaskComment(ctx, db.CreateTaskCommentParams{
+		TaskID:          taskID,
+		TaskExecutionID: executionID,
+		AuthorType:      authorType,
+		Author:          author,
+		Kind:            kind,
+		Body:            body,
+	})
+	if err != nil {
+		log.Printf("Failed to record %s comment on task %d: %v", kind, taskID, err)
+	}
+}
+
+// handleTaskCommentsAPI handles /api/tasks/{id}/comments[/{comment id}]
+func handleTaskCommentsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	taskID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := queries.GetTask(ctx, taskID); err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	if len(pathParts) >= 3 && pathParts[2] != "" {
+		commentID, err := strconv.ParseInt(pathParts[2], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+			return
+		}
+		comment, err := queries.GetTaskComment(ctx, commentID)
+		if err != nil || comment.TaskID != taskID {
+			http.Error(w, "Comment not found", http.StatusNotFound)
+			return
+		}
+		handleTaskComment(w, r, ctx, comment)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		// ?execution_id= narrows the thread to one execution
+		var dbComments []db.TaskComment
+		if executionParam := r.URL.Query().Get("execution_id"); executionParam != "" {
+			executionID, err := strconv.ParseInt(executionParam, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid execution ID", http.StatusBadRequest)
+				return
+			}
+			dbComments, err = queries.GetTaskCommentsByExecutionID(ctx, sql.NullInt64{Int64: executionID, Valid: true})
+		} else {
+			dbComments, err = queries.GetTaskCommentsByTaskID(ctx, taskID)
+		}
+		if err != nil {
+			log.Printf("Failed to get comments of task %d: %v", taskID, err)
+			http.Error(w, "Failed to get comments", http.StatusInternalServerError)
+			return
+		}
+
+		comments := make([]TaskComment, 0, len(dbComments))
+		for _, dbComment := range dbComments {
+			if dbComment.TaskID == taskID {
+				comments = append(comments, dbTaskCommentToTaskComment(dbComment))
+			}
+		}
+		json.NewEncoder(w).Encode(comments)
+
+	case "POST":
+		var createReq struct {
+			Body            string `json:"body"`
+			TaskExecutionID *int64 `json:"task_execution_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		body := strings.TrimSpace(createReq.Body)
+		if body == "" {
+			http.Error(w, "Comment cannot be empty", http.StatusBadRequest)
+			return
+		}
+		if len(body) > maxCommentLength {
+			http.Error(w, "Comment is too long", http.StatusBadRequest)
+			return
+		}
+		if createReq.TaskExecutionID != nil {
+			execution, err := queries.GetTaskExecution(ctx, *createReq.TaskExecutionID)
+			if err != nil || execution.TaskID != taskID {
+				http.Error(w, "Task execution not found for this task", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Comments posted through the API are always from a person; the system writes its own
+		var author string
+		if user, ok := requestUser(r); ok {
+			author = user.Name
+		}
+		comment, err := queries.CreateTaskComment(ctx, db.CreateTaskCommentParams{
+			TaskID:          taskID,
+			TaskExecutionID: int64PtrToNullInt64(createReq.TaskExecutionID),
+			AuthorType:      commentAuthorHuman,
+			Author:          author,
+			Kind:            "comment",
+			Body:            body,
+		})
+		if err != nil {
+			log.Printf("Failed to create comment on task %d: %v", taskID, err)
+			http.Error(w, "Failed to create comment", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(dbTaskCommentToTaskComment(comment))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleTaskComment(w http.ResponseWriter, r *http.Request, ctx context.Context, comment db.TaskComment) {
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(dbTaskCommentToTaskComment(comment))
+
+	case "PUT":
+		// The history the system keeps is not editable
+		if comment.AuthorType != commentAuthorHuman {
+			http.Error(w, "System comments cannot be edited", http.StatusForbidden)
+			return
+		}
+
+		var updateReq struct {
+			Body string `json:"body"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		body := strings.TrimSpace(updateReq.Body)
+		if body == "" || len(body) > maxCommentLength {
+			http.Error(w, "Comment must be between 1 and 65536 characters", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := queries.UpdateTaskComment(ctx, db.UpdateTaskCommentParams{ID: comment.ID, Body: body})
+		if err != nil {
+			log.Printf("Failed to update comment %d: %v", comment.ID, err)
+			http.Error(w, "Failed to update comment", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(dbTaskCommentToTaskComment(updated))
+
+	case "DELETE":
+		if comment.AuthorType != commentAuthorHuman {
+			http.Error(w, "System comments cannot be deleted", http.StatusForbidden)
+			return
+		}
+		if err := queries.DeleteTaskComment(ctx, comment.ID); err != nil {
+			log.Printf("Failed to delete comment %d: %v", comment.ID, err)
+			http.Error(w, "Failed to delete comment", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
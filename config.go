@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Configuration as code
+// -----------------
+//
+// remote-code.yaml describes agents, projects and their base directories. It is applied at
+// startup and through PUT /api/config, and GET /api/config exports the current setup in
+// the same format, so a setup can live in version control and be reproduced elsewhere.
+// Agents and projects are matched by name, base directories by base_directory_id (or by
+// path when it is left out). Applying a file creates and updates; it never deletes. The
+// file describes the default root; the API takes ?root_id= to export or apply another.
+
+const defaultConfigPath = "remote-code.yaml"
+
+// Largest configuration accepted through the API
+const maxConfigSize = 1024 * 1024
+
+// configPath is the file applied at startup, REMOTE_CODE_CONFIG or remote-code.yaml
+func configPath() string {
+	if path := os.Getenv("REMOTE_CODE_CONFIG"); path != "" {
+		return path
+	}
+	return defaultConfigPath
+}
+
+// ConfigChange is what applying a configuration did, or would do, to one item
+type ConfigChange struct {
+	Kind   string `json:"kind"` // agent, project, base_directory or root
+	Name   string `json:"name"`
+	Action string `json:"action"` // create, update or unchanged
+}
+
+// ConfigResult reports an applied configuration
+type ConfigResult struct {
+	DryRun    bool           `json:"dry_run"`
+	Created   int            `json:"created"`
+	Updated   int            `json:"updated"`
+	Unchanged int            `json:"unchanged"`
+	Changes   []ConfigChange `json:"changes"`
+}
+
+func (result *ConfigResult) record(kind, name, action string) {
+	switch action {
+	case "create":
+		result.Created++
+	case "update":
+		result.Updated++
+	default:
+		result.Unchanged++
+	}
+	result.Changes = append(result.Changes, ConfigChange{Kind: kind, Name: name, Action: action})
+}
+
+// parseConfig reads and validates a configuration. Unknown keys are errors, so typos don't
+// go unnoticed.
+func parseConfig(data []byte) (Root, error) {
+	var config Root
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return config, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	agents := make(map[string]bool)
+	for _, agent := range config.AvailableAgents {
+		if strings.TrimSpace(agent.Name) == "" || strings.TrimSpace(agent.Command) == "" {
+			return config, fmt.Errorf("every agent needs a name and a command")
+		}
+		if agents[agent.Name] {
+			return config, fmt.Errorf("agent %q is defined twice", agent.Name)
+		}
+		agents[agent.Name] = true
+	}
+
+	projects := make(map[string]bool)
+	for _, project := range config.Projects {
+		if strings.TrimSpace(project.Name) == "" {
+			return config, fmt.Errorf("every project needs a name")
+		}
+		if projects[project.Name] {
+			return config, fmt.Errorf("project %q is defined twice", project.Name)
+		}
+		projects[project.Name] = true
+		if len(project.Tasks) > 0 {
+			return config, fmt.Errorf("project %q: tasks are not part of the configuration, import them instead", project.Name)
+		}
+
+		dirs := make(map[string]bool)
+		for _, dir := range project.BaseDirectories {
+			if strings.TrimSpace(dir.Path) == "" {
+				return config, fmt.Errorf("project %q: every base directory needs a path", project.Name)
+			}
+			key := dir.BaseDirectoryId
+			if key == "" {
+				key = "path:" + dir.Path
+			}
+			if dirs[key] {
+				return config, fmt.Errorf("project %q: base directory %s is defined twice", project.Name, dir.Path)
+			}
+			dirs[key] = true
+		}
+	}
+	return config, nil
+}
+
+// reconcileConfig creates and updates agents, projects and base directories to match a
+// configuration in a root. The changes are made in one transaction, so a failure leaves the
+// configuration as it was.
+func reconcileConfig(ctx context.Context, rootID int64, config Root, dryRun bool) (ConfigResult, error) {
+	result := ConfigResult{DryRun: dryRun, Changes: []ConfigChange{}}
+
+	tx, err := database.BeginTx(ctx, nil)
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+	q := queries.WithTx(tx)
+
+	root, err := q.GetRoot(ctx, rootID)
+	if err == sql.ErrNoRows {
+		return result, fmt.Errorf("root %d does not exist: %w", rootID, err)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	existingAgents, err := q.GetAgentsByRootID(ctx, rootID)
+	if err != nil {
+		return result, err
+	}
+	for _, agent := range config.AvailableAgents {
+		var current *db.Agent
+		for i := range existingAgents {
+			if existingAgents[i].Name == agent.Name {
+				current = &existingAgents[i]
+				break
+			}
+		}
+
+		switch {
+		case current == nil:
+			result.record("agent", agent.Name, "create")
+			if !dryRun {
+				if _, err := q.CreateAgent(ctx, db.CreateAgentParams{RootID: rootID, Name: agent.Name, Command: agent.Command, Params: agent.Params}); err != nil {
+					return result, fmt.Errorf("failed to create agent %q: %v", agent.Name, err)
+				}
+			}
+		case current.Command != agent.Command || current.Params != agent.Params:
+			result.record("agent", agent.Name, "update")
+			if !dryRun {
+				if _, err := q.UpdateAgent(ctx, db.UpdateAgentParams{ID: current.ID, Name: agent.Name, Command: agent.Command, Params: agent.Params}); err != nil {
+					return result, fmt.Errorf("failed to update agent %q: %v", agent.Name, err)
+				}
+			}
+		default:
+			result.record("agent", agent.Name, "unchanged")
+		}
+	}
+
+	existingProjects, err := q.GetProjectsByRootID(ctx, rootID)
+	if err != nil {
+		return result, err
+	}
+	for _, project := range config.Projects {
+		var projectID int64
+		for _, existing := range existingProjects {
+			if existing.Name == project.Name {
+				projectID = existing.ID
+				break
+			}
+		}
+		if projectID == 0 {
+			result.record("project", project.Name, "create")
+			if !dryRun {
+				created, err := q.CreateProject(ctx, db.CreateProjectParams{RootID: rootID, Name: project.Name})
+				if err != nil {
+					return result, fmt.Errorf("failed to create project %q: %v", project.Name, err)
+				}
+				projectID = created.ID
+			}
+		} else {
+			result.record("project", project.Name, "unchanged")
+		}
+
+		if err := reconcileBaseDirectories(ctx, q, projectID, project, dryRun, &result); err != nil {
+			return result, err
+		}
+	}
+
+	if config.LocalPort != "" {
+		if root.LocalPort != config.LocalPort {
+			result.record("root", "local_port", "update")
+			if !dryRun {
+				if _, err := q.UpdateRoot(ctx, db.UpdateRootParams{ID: root.ID, Name: root.Name, LocalPort: config.LocalPort, ExternalUrl: root.ExternalUrl}); err != nil {
+					return result, fmt.Errorf("failed to update root: %v", err)
+				}
+			}
+		} else {
+			result.record("root", "local_port", "unchanged")
+		}
+	}
+
+	if dryRun {
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to save configuration: %v", err)
+	}
+	return result, nil
+}
+
+func reconcileBaseDirectories(ctx context.Context, q *db.Queries, projectID int64, project Project, dryRun bool, result *ConfigResult) error {
+	var existingDirs []db.BaseDirectory
+	if projectID != 0 {
+		var err error
+		if existingDirs, err = q.GetBaseDirectoriesByProjectID(ctx, projectID); err != nil {
+			return err
+		}
+	}
+
+	for i, dir := range project.BaseDirectories {
+		name := project.Name + ": " + dir.Path
+		var current *db.BaseDirectory
+		for j := range existingDirs {
+			if (dir.BaseDirectoryId != "" && existingDirs[j].BaseDirectoryID == dir.BaseDirectoryId) ||
+				(dir.BaseDirectoryId == "" && existingDirs[j].Path == dir.Path) {
+				current = &existingDirs[j]
+				break
+			}
+		}
+
+		if current == nil {
+			result.record("base_directory", name, "create")
+			if dryRun {
+				continue
+			}
+			baseDirectoryID := dir.BaseDirectoryId
+			if baseDirectoryID == "" {
+				baseDirectoryID = fmt.Sprintf("bd_%d_%d_%d", projectID, time.Now().Unix(), i)
+			}
+			if _, err := q.CreateBaseDirectory(ctx, db.CreateBaseDirectoryParams{
+				ProjectID:                 projectID,
+				BaseDirectoryID:           baseDirectoryID,
+				Path:                      dir.Path,
+				GitInitialized:            dir.GitInitialized,
+				SetupCommands:             dir.SetupCommands,
+				TeardownCommands:          dir.TeardownCommands,
+				DevServerSetupCommands:    dir.DevServerSetupCommands,
+				DevServerTeardownCommands: dir.DevServerTeardownCommands,
+			}); err != nil {
+				return fmt.Errorf("failed to create base directory %s: %v", name, err)
+			}
+			continue
+		}
+
+		if current.Path == dir.Path &&
+			current.GitInitialized == dir.GitInitialized &&
+			current.SetupCommands == dir.SetupCommands &&
+			current.TeardownCommands == dir.TeardownCommands &&
+			current.DevServerSetupCommands == dir.DevServerSetupCommands &&
+			current.DevServerTeardownCommands == dir.DevServerTeardownCommands {
+			result.record("base_directory", name, "unchanged")
+			continue
+		}
+		result.record("base_directory", name, "update")
+		if dryRun {
+			continue
+		}
+		if _, err := q.UpdateBaseDirectory(ctx, db.UpdateBaseDirectoryParams{
+			ID:                        current.ID,
+			Path:                      dir.Path,
+			GitInitialized:            dir.GitInitialized,
+			SetupCommands:             dir.SetupCommands,
+			TeardownCommands:          dir.TeardownCommands,
+			DevServerSetupCommands:    dir.DevServerSetupCommands,
+			DevServerTeardownCommands: dir.DevServerTeardownCommands,
+		}); err != nil {
+			return fmt.Errorf("failed to update base directory %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// exportConfig describes a root's agents, projects and base directories as a configuration
+func exportConfig(ctx context.Context, rootID int64) (Root, error) {
+	config := Root{AvailableAgents: []Agent{}, Projects: []Project{}}
+	if root, err := queries.GetRoot(ctx, rootID); err == nil {
+		config.LocalPort = root.LocalPort
+	}
+
+	agents, err := queries.GetAgentsByRootID(ctx, rootID)
+	if err != nil {
+		return config, err
+	}
+	for _, agent := range agents {
+		config.AvailableAgents = append(config.AvailableAgents, Agent{Name: agent.Name, Command: agent.Command, Params: agent.Params})
+	}
+
+	projects, err := queries.GetProjectsByRootID(ctx, rootID)
+	if err != nil {
+		return config, err
+	}
+	for _, project := range projects {
+		dirs, err := queries.GetBaseDirectoriesByProjectID(ctx, project.ID)
+		if err != nil {
+			return config, err
+		}
+		exported := Project{Name: project.Name, BaseDirectories: []BaseDirectory{}}
+		for _, dir := range dirs {
+			exported.BaseDirectories = append(exported.BaseDirectories, dbBaseDirectoryToBaseDirectory(dir))
+		}
+		config.Projects = append(config.Projects, exported)
+	}
+	return config, nil
+}
+
+// applyConfigFile applies the configuration file if there is one
+func applyConfigFile(ctx context.Context) (ConfigResult, bool, error) {
+	path := configPath()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ConfigResult{}, false, nil
+	}
+	if err != nil {
+		return ConfigResult{}, true, err
+	}
+	config, err := parseConfig(data)
+	if err != nil {
+		return ConfigResult{}, true, fmt.Errorf("%s: %v", path, err)
+	}
+	result, err := reconcileConfig(ctx, defaultRootID, config, false)
+	return result, true, err
+}
+
+// handleConfigAPI handles /api/config: GET exports, PUT applies the YAML in the body
+// (?dry_run=true previews) and POST /api/config/reload applies the file on disk again
+func handleConfigAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) >= 1 && pathParts[0] == "reload" {
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		result, found, err := applyConfigFile(ctx)
+		if !found {
+			http.Error(w, fmt.Sprintf("No configuration file at %s", configPath()), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to apply configuration file: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	rootID, ok := requestRootID(w, r, ctx)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		config, err := exportConfig(ctx, rootID)
+		if err != nil {
+			log.Printf("Failed to export configuration: %v", err)
+			http.Error(w, "Failed to export configuration", http.StatusInternalServerError)
+			return
+		}
+		var data bytes.Buffer
+		encoder := yaml.NewEncoder(&data)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(config); err != nil {
+			log.Printf("Failed to encode configuration: %v", err)
+			http.Error(w, "Failed to export configuration", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Header().Set("Content-Disposition", `attachment; filename="remote-code.yaml"`)
+		w.Write(data.Bytes())
+
+	case "PUT":
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigSize))
+		if err != nil {
+			http.Error(w, "Configuration is too large", http.StatusBadRequest)
+			return
+		}
+		config, err := parseConfig(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		result, err := reconcileConfig(ctx, rootID, config, r.URL.Query().Get("dry_run") == "true")
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to apply configuration: %v", err)
+			http.Error(w, "Failed to apply configuration", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -14,6 +14,9 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// databasePath is the file of the open database, hidden from sandboxed agents
+var databasePath string
+
 func initDatabase() (*sql.DB, *db.Queries) {
 	database, queries, _ := initDatabaseWithPathAndReturn("remote-code.db")
 	return database, queries
@@ -35,8 +38,9 @@ func initDatabaseWithPathAndReturn(dbPath string) (*sql.DB, *db.Queries, string)
 		}
 	}
 
-	// Open database connection
-	database, err := sql.Open("sqlite", dbPath)
+	// Open database connection; writers from background goroutines wait for each other
+	// instead of failing with SQLITE_BUSY
+	database, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -52,6 +56,7 @@ func initDatabaseWithPathAndReturn(dbPath string) (*sql.DB, *db.Queries, string)
 	}
 
 	queries := db.New(database)
+	databasePath = dbPath
 	return database, queries, dbPath
 }
 
@@ -117,6 +122,26 @@ func applyMigrations(database *sql.DB) error {
 		"db/migrations/004_remote_ports.sql",
 		"db/migrations/005_webauthn.sql",
 		"db/migrations/006_webauthn_add_rp_id.sql",
+		"db/migrations/007_directory_dev_servers.sql",
+		"db/migrations/008_auto_responders.sql",
+		"db/migrations/009_environment_variables.sql",
+		"db/migrations/010_sandbox.sql",
+		"db/migrations/011_resource_limits.sql",
+		"db/migrations/012_checkpoints.sql",
+		"db/migrations/013_pull_requests.sql",
+		"db/migrations/014_task_attachments.sql",
+		"db/migrations/015_task_comments.sql",
+		"db/migrations/016_workflows.sql",
+		"db/migrations/017_task_metadata.sql",
+		"db/migrations/018_task_external_ids.sql",
+		"db/migrations/019_root_workspaces.sql",
+		"db/migrations/020_users.sql",
+		"db/migrations/021_api_tokens.sql",
+		"db/migrations/022_session_details.sql",
+		"db/migrations/023_passkey_names.sql",
+		"db/migrations/024_pairing_codes.sql",
+		"db/migrations/025_user_totp.sql",
+		"db/migrations/026_audit_log.sql",
 	}
 
 	for _, migrationPath := range migrations {
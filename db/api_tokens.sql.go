@@ -0,0 +1,162 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: api_tokens.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createAPIToken = `-- name: CreateAPIToken :one
+INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scope, expires_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, user_id, name, token_hash, token_prefix, scope, expires_at, last_used_at, created_at
+`
+
+type CreateAPITokenParams struct {
+	UserID      int64        `db:"user_id" json:"user_id"`
+	Name        string       `db:"name" json:"name"`
+	TokenHash   string       `db:"token_hash" json:"token_hash"`
+	TokenPrefix string       `db:"token_prefix" json:"token_prefix"`
+	Scope       string       `db:"scope" json:"scope"`
+	ExpiresAt   sql.NullTime `db:"expires_at" json:"expires_at"`
+}
+
+func (q *Queries) CreateAPIToken(ctx context.Context, arg CreateAPITokenParams) (ApiToken, error) {
+	row := q.db.QueryRowContext(ctx, createAPIToken,
+		arg.UserID,
+		arg.Name,
+		arg.TokenHash,
+		arg.TokenPrefix,
+		arg.Scope,
+		arg.ExpiresAt,
+	)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.TokenPrefix,
+		&i.Scope,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAPIToken = `-- name: DeleteAPIToken :exec
+DELETE FROM api_tokens WHERE id = ?
+`
+
+func (q *Queries) DeleteAPIToken(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAPIToken, id)
+	return err
+}
+
+const deleteAPITokensByUserID = `-- name: DeleteAPITokensByUserID :exec
+DELETE FROM api_tokens WHERE user_id = ?
+`
+
+func (q *Queries) DeleteAPITokensByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAPITokensByUserID, userID)
+	return err
+}
+
+const getAPIToken = `-- name: GetAPIToken :one
+SELECT id, user_id, name, token_hash, token_prefix, scope, expires_at, last_used_at, created_at FROM api_tokens
+WHERE id = ?
+`
+
+func (q *Queries) GetAPIToken(ctx context.Context, id int64) (ApiToken, error) {
+	row := q.db.QueryRowContext(ctx, getAPIToken, id)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.TokenPrefix,
+		&i.Scope,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getAPITokenByHash = `-- name: GetAPITokenByHash :one
+SELECT id, user_id, name, token_hash, token_prefix, scope, expires_at, last_used_at, created_at FROM api_tokens
+WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+`
+
+func (q *Queries) GetAPITokenByHash(ctx context.Context, tokenHash string) (ApiToken, error) {
+	row := q.db.QueryRowContext(ctx, getAPITokenByHash, tokenHash)
+	var i ApiToken
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Name,
+		&i.TokenHash,
+		&i.TokenPrefix,
+		&i.Scope,
+		&i.ExpiresAt,
+		&i.LastUsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listAPITokensByUserID = `-- name: ListAPITokensByUserID :many
+SELECT id, user_id, name, token_hash, token_prefix, scope, expires_at, last_used_at, created_at FROM api_tokens
+WHERE user_id = ?
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) ListAPITokensByUserID(ctx context.Context, userID int64) ([]ApiToken, error) {
+	rows, err := q.db.QueryContext(ctx, listAPITokensByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiToken
+	for rows.Next() {
+		var i ApiToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Name,
+			&i.TokenHash,
+			&i.TokenPrefix,
+			&i.Scope,
+			&i.ExpiresAt,
+			&i.LastUsedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const touchAPIToken = `-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+func (q *Queries) TouchAPIToken(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, touchAPIToken, id)
+	return err
+}
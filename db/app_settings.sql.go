@@ -0,0 +1,41 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: app_settings.sql
+
+package db
+
+import (
+	"context"
+)
+
+const getAppSetting = `-- name: GetAppSetting :one
+SELECT "key", value, updated_at FROM app_settings
+WHERE key = ?
+`
+
+func (q *Queries) GetAppSetting(ctx context.Context, key string) (AppSetting, error) {
+	row := q.db.QueryRowContext(ctx, getAppSetting, key)
+	var i AppSetting
+	err := row.Scan(&i.Key, &i.Value, &i.UpdatedAt)
+	return i, err
+}
+
+const setAppSetting = `-- name: SetAppSetting :one
+INSERT INTO app_settings (key, value)
+VALUES (?, ?)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+RETURNING "key", value, updated_at
+`
+
+type SetAppSettingParams struct {
+	Key   string `db:"key" json:"key"`
+	Value string `db:"value" json:"value"`
+}
+
+func (q *Queries) SetAppSetting(ctx context.Context, arg SetAppSettingParams) (AppSetting, error) {
+	row := q.db.QueryRowContext(ctx, setAppSetting, arg.Key, arg.Value)
+	var i AppSetting
+	err := row.Scan(&i.Key, &i.Value, &i.UpdatedAt)
+	return i, err
+}
@@ -0,0 +1,142 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: audit_log.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createAuditLogEntry = `-- name: CreateAuditLogEntry :one
+INSERT INTO audit_log (user_id, actor, api_token_id, action, resource, target_ids, summary, status, ip_address)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, user_id, actor, api_token_id, "action", resource, target_ids, summary, status, ip_address, created_at
+`
+
+type CreateAuditLogEntryParams struct {
+	UserID     sql.NullInt64 `db:"user_id" json:"user_id"`
+	Actor      string        `db:"actor" json:"actor"`
+	ApiTokenID sql.NullInt64 `db:"api_token_id" json:"api_token_id"`
+	Action     string        `db:"action" json:"action"`
+	Resource   string        `db:"resource" json:"resource"`
+	TargetIds  string        `db:"target_ids" json:"target_ids"`
+	Summary    string        `db:"summary" json:"summary"`
+	Status     int64         `db:"status" json:"status"`
+	IpAddress  string        `db:"ip_address" json:"ip_address"`
+}
+
+func (q *Queries) CreateAuditLogEntry(ctx context.Context, arg CreateAuditLogEntryParams) (AuditLog, error) {
+	row := q.db.QueryRowContext(ctx, createAuditLogEntry,
+		arg.UserID,
+		arg.Actor,
+		arg.ApiTokenID,
+		arg.Action,
+		arg.Resource,
+		arg.TargetIds,
+		arg.Summary,
+		arg.Status,
+		arg.IpAddress,
+	)
+	var i AuditLog
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Actor,
+		&i.ApiTokenID,
+		&i.Action,
+		&i.Resource,
+		&i.TargetIds,
+		&i.Summary,
+		&i.Status,
+		&i.IpAddress,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteAuditLogEntriesOlderThan = `-- name: DeleteAuditLogEntriesOlderThan :execrows
+DELETE FROM audit_log
+WHERE created_at < datetime('now', '-' || CAST(?1 AS INTEGER) || ' days')
+`
+
+func (q *Queries) DeleteAuditLogEntriesOlderThan(ctx context.Context, days int64) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAuditLogEntriesOlderThan, days)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const listAuditLogEntries = `-- name: ListAuditLogEntries :many
+SELECT id, user_id, actor, api_token_id, "action", resource, target_ids, summary, status, ip_address, created_at FROM audit_log
+WHERE (?1 IS NULL OR actor = ?1)
+  AND (?2 IS NULL OR resource = ?2)
+  AND (?3 IS NULL OR action LIKE '%' || ?3 || '%')
+  AND (?4 IS NULL OR EXISTS (SELECT 1 FROM json_each(audit_log.target_ids) WHERE json_each.value = ?4))
+  AND (?5 IS NULL OR status >= ?5)
+  AND (?6 IS NULL OR created_at >= ?6)
+  AND (?7 IS NULL OR created_at < ?7)
+  AND (?8 IS NULL OR id < ?8)
+ORDER BY id DESC
+LIMIT ?9
+`
+
+type ListAuditLogEntriesParams struct {
+	Actor      interface{} `db:"actor" json:"actor"`
+	Resource   interface{} `db:"resource" json:"resource"`
+	Action     interface{} `db:"action" json:"action"`
+	TargetID   interface{} `db:"target_id" json:"target_id"`
+	MinStatus  interface{} `db:"min_status" json:"min_status"`
+	Since      interface{} `db:"since" json:"since"`
+	Until      interface{} `db:"until" json:"until"`
+	BeforeID   interface{} `db:"before_id" json:"before_id"`
+	MaxEntries int64       `db:"max_entries" json:"max_entries"`
+}
+
+func (q *Queries) ListAuditLogEntries(ctx context.Context, arg ListAuditLogEntriesParams) ([]AuditLog, error) {
+	rows, err := q.db.QueryContext(ctx, listAuditLogEntries,
+		arg.Actor,
+		arg.Resource,
+		arg.Action,
+		arg.TargetID,
+		arg.MinStatus,
+		arg.Since,
+		arg.Until,
+		arg.BeforeID,
+		arg.MaxEntries,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Actor,
+			&i.ApiTokenID,
+			&i.Action,
+			&i.Resource,
+			&i.TargetIds,
+			&i.Summary,
+			&i.Status,
+			&i.IpAddress,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
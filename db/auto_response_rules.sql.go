@@ -0,0 +1,242 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: auto_response_rules.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createAutoResponseRule = `-- name: CreateAutoResponseRule :one
+INSERT INTO auto_response_rules (
+    project_id,
+    name,
+    prompt_pattern,
+    subject_type,
+    list_mode,
+    subjects,
+    response_keys,
+    enabled
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, project_id, name, prompt_pattern, subject_type, list_mode, subjects, response_keys, enabled, created_at, updated_at
+`
+
+type CreateAutoResponseRuleParams struct {
+	ProjectID     int64  `db:"project_id" json:"project_id"`
+	Name          string `db:"name" json:"name"`
+	PromptPattern string `db:"prompt_pattern" json:"prompt_pattern"`
+	SubjectType   string `db:"subject_type" json:"subject_type"`
+	ListMode      string `db:"list_mode" json:"list_mode"`
+	Subjects      string `db:"subjects" json:"subjects"`
+	ResponseKeys  string `db:"response_keys" json:"response_keys"`
+	Enabled       bool   `db:"enabled" json:"enabled"`
+}
+
+func (q *Queries) CreateAutoResponseRule(ctx context.Context, arg CreateAutoResponseRuleParams) (AutoResponseRule, error) {
+	row := q.db.QueryRowContext(ctx, createAutoResponseRule,
+		arg.ProjectID,
+		arg.Name,
+		arg.PromptPattern,
+		arg.SubjectType,
+		arg.ListMode,
+		arg.Subjects,
+		arg.ResponseKeys,
+		arg.Enabled,
+	)
+	var i AutoResponseRule
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.PromptPattern,
+		&i.SubjectType,
+		&i.ListMode,
+		&i.Subjects,
+		&i.ResponseKeys,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteAutoResponseRule = `-- name: DeleteAutoResponseRule :exec
+DELETE FROM auto_response_rules WHERE id = ?
+`
+
+func (q *Queries) DeleteAutoResponseRule(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAutoResponseRule, id)
+	return err
+}
+
+const deleteAutoResponseRulesByProjectID = `-- name: DeleteAutoResponseRulesByProjectID :exec
+DELETE FROM auto_response_rules WHERE project_id = ?
+`
+
+func (q *Queries) DeleteAutoResponseRulesByProjectID(ctx context.Context, projectID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteAutoResponseRulesByProjectID, projectID)
+	return err
+}
+
+const getAutoResponseRule = `-- name: GetAutoResponseRule :one
+SELECT id, project_id, name, prompt_pattern, subject_type, list_mode, subjects, response_keys, enabled, created_at, updated_at FROM auto_response_rules
+WHERE id = ?
+`
+
+func (q *Queries) GetAutoResponseRule(ctx context.Context, id int64) (AutoResponseRule, error) {
+	row := q.db.QueryRowContext(ctx, getAutoResponseRule, id)
+	var i AutoResponseRule
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.PromptPattern,
+		&i.SubjectType,
+		&i.ListMode,
+		&i.Subjects,
+		&i.ResponseKeys,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getAutoResponseRulesByProjectID = `-- name: GetAutoResponseRulesByProjectID :many
+SELECT id, project_id, name, prompt_pattern, subject_type, list_mode, subjects, response_keys, enabled, created_at, updated_at FROM auto_response_rules
+WHERE project_id = ?
+ORDER BY id
+`
+
+func (q *Queries) GetAutoResponseRulesByProjectID(ctx context.Context, projectID int64) ([]AutoResponseRule, error) {
+	rows, err := q.db.QueryContext(ctx, getAutoResponseRulesByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AutoResponseRule
+	for rows.Next() {
+		var i AutoResponseRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.Name,
+			&i.PromptPattern,
+			&i.SubjectType,
+			&i.ListMode,
+			&i.Subjects,
+			&i.ResponseKeys,
+			&i.Enabled,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEnabledAutoResponseRulesByProjectID = `-- name: GetEnabledAutoResponseRulesByProjectID :many
+SELECT id, project_id, name, prompt_pattern, subject_type, list_mode, subjects, response_keys, enabled, created_at, updated_at FROM auto_response_rules
+WHERE project_id = ? AND enabled = TRUE
+ORDER BY id
+`
+
+func (q *Queries) GetEnabledAutoResponseRulesByProjectID(ctx context.Context, projectID int64) ([]AutoResponseRule, error) {
+	rows, err := q.db.QueryContext(ctx, getEnabledAutoResponseRulesByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AutoResponseRule
+	for rows.Next() {
+		var i AutoResponseRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.Name,
+			&i.PromptPattern,
+			&i.SubjectType,
+			&i.ListMode,
+			&i.Subjects,
+			&i.ResponseKeys,
+			&i.Enabled,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateAutoResponseRule = `-- name: UpdateAutoResponseRule :one
+UPDATE auto_response_rules
+SET
+    name = ?,
+    prompt_pattern = ?,
+    subject_type = ?,
+    list_mode = ?,
+    subjects = ?,
+    response_keys = ?,
+    enabled = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, name, prompt_pattern, subject_type, list_mode, subjects, response_keys, enabled, created_at, updated_at
+`
+
+type UpdateAutoResponseRuleParams struct {
+	Name          string `db:"name" json:"name"`
+	PromptPattern string `db:"prompt_pattern" json:"prompt_pattern"`
+	SubjectType   string `db:"subject_type" json:"subject_type"`
+	ListMode      string `db:"list_mode" json:"list_mode"`
+	Subjects      string `db:"subjects" json:"subjects"`
+	ResponseKeys  string `db:"response_keys" json:"response_keys"`
+	Enabled       bool   `db:"enabled" json:"enabled"`
+	ID            int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateAutoResponseRule(ctx context.Context, arg UpdateAutoResponseRuleParams) (AutoResponseRule, error) {
+	row := q.db.QueryRowContext(ctx, updateAutoResponseRule,
+		arg.Name,
+		arg.PromptPattern,
+		arg.SubjectType,
+		arg.ListMode,
+		arg.Subjects,
+		arg.ResponseKeys,
+		arg.Enabled,
+		arg.ID,
+	)
+	var i AutoResponseRule
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Name,
+		&i.PromptPattern,
+		&i.SubjectType,
+		&i.ListMode,
+		&i.Subjects,
+		&i.ResponseKeys,
+		&i.Enabled,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
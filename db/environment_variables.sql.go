@@ -0,0 +1,251 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: environment_variables.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const countSealedSecrets = `-- name: CountSealedSecrets :one
+SELECT
+    (SELECT COUNT(*) FROM environment_variables) +
+    (SELECT COUNT(*) FROM users WHERE totp_secret != '') AS count
+`
+
+func (q *Queries) CountSealedSecrets(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countSealedSecrets)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createEnvironmentVariable = `-- name: CreateEnvironmentVariable :one
+INSERT INTO environment_variables (
+    project_id,
+    base_directory_id,
+    agent_id,
+    name,
+    encrypted_value,
+    is_secret
+)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, project_id, base_directory_id, agent_id, name, encrypted_value, is_secret, created_at, updated_at
+`
+
+type CreateEnvironmentVariableParams struct {
+	ProjectID       int64         `db:"project_id" json:"project_id"`
+	BaseDirectoryID sql.NullInt64 `db:"base_directory_id" json:"base_directory_id"`
+	AgentID         sql.NullInt64 `db:"agent_id" json:"agent_id"`
+	Name            string        `db:"name" json:"name"`
+	EncryptedValue  string        `db:"encrypted_value" json:"encrypted_value"`
+	IsSecret        bool          `db:"is_secret" json:"is_secret"`
+}
+
+func (q *Queries) CreateEnvironmentVariable(ctx context.Context, arg CreateEnvironmentVariableParams) (EnvironmentVariable, error) {
+	row := q.db.QueryRowContext(ctx, createEnvironmentVariable,
+		arg.ProjectID,
+		arg.BaseDirectoryID,
+		arg.AgentID,
+		arg.Name,
+		arg.EncryptedValue,
+		arg.IsSecret,
+	)
+	var i EnvironmentVariable
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.AgentID,
+		&i.Name,
+		&i.EncryptedValue,
+		&i.IsSecret,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteEnvironmentVariable = `-- name: DeleteEnvironmentVariable :exec
+DELETE FROM environment_variables WHERE id = ?
+`
+
+func (q *Queries) DeleteEnvironmentVariable(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteEnvironmentVariable, id)
+	return err
+}
+
+const deleteEnvironmentVariablesByAgentID = `-- name: DeleteEnvironmentVariablesByAgentID :exec
+DELETE FROM environment_variables WHERE agent_id = ?
+`
+
+func (q *Queries) DeleteEnvironmentVariablesByAgentID(ctx context.Context, agentID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteEnvironmentVariablesByAgentID, agentID)
+	return err
+}
+
+const deleteEnvironmentVariablesByBaseDirectoryID = `-- name: DeleteEnvironmentVariablesByBaseDirectoryID :exec
+DELETE FROM environment_variables WHERE base_directory_id = ?
+`
+
+func (q *Queries) DeleteEnvironmentVariablesByBaseDirectoryID(ctx context.Context, baseDirectoryID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteEnvironmentVariablesByBaseDirectoryID, baseDirectoryID)
+	return err
+}
+
+const deleteEnvironmentVariablesByProjectID = `-- name: DeleteEnvironmentVariablesByProjectID :exec
+DELETE FROM environment_variables WHERE project_id = ?
+`
+
+func (q *Queries) DeleteEnvironmentVariablesByProjectID(ctx context.Context, projectID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteEnvironmentVariablesByProjectID, projectID)
+	return err
+}
+
+const getEnvironmentVariable = `-- name: GetEnvironmentVariable :one
+SELECT id, project_id, base_directory_id, agent_id, name, encrypted_value, is_secret, created_at, updated_at FROM environment_variables
+WHERE id = ?
+`
+
+func (q *Queries) GetEnvironmentVariable(ctx context.Context, id int64) (EnvironmentVariable, error) {
+	row := q.db.QueryRowContext(ctx, getEnvironmentVariable, id)
+	var i EnvironmentVariable
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.AgentID,
+		&i.Name,
+		&i.EncryptedValue,
+		&i.IsSecret,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getEnvironmentVariablesByProjectID = `-- name: GetEnvironmentVariablesByProjectID :many
+SELECT id, project_id, base_directory_id, agent_id, name, encrypted_value, is_secret, created_at, updated_at FROM environment_variables
+WHERE project_id = ?
+ORDER BY name, id
+`
+
+func (q *Queries) GetEnvironmentVariablesByProjectID(ctx context.Context, projectID int64) ([]EnvironmentVariable, error) {
+	rows, err := q.db.QueryContext(ctx, getEnvironmentVariablesByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EnvironmentVariable
+	for rows.Next() {
+		var i EnvironmentVariable
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.BaseDirectoryID,
+			&i.AgentID,
+			&i.Name,
+			&i.EncryptedValue,
+			&i.IsSecret,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSecretEnvironmentVariables = `-- name: GetSecretEnvironmentVariables :many
+SELECT id, project_id, base_directory_id, agent_id, name, encrypted_value, is_secret, created_at, updated_at FROM environment_variables
+WHERE is_secret = TRUE
+`
+
+func (q *Queries) GetSecretEnvironmentVariables(ctx context.Context) ([]EnvironmentVariable, error) {
+	rows, err := q.db.QueryContext(ctx, getSecretEnvironmentVariables)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EnvironmentVariable
+	for rows.Next() {
+		var i EnvironmentVariable
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.BaseDirectoryID,
+			&i.AgentID,
+			&i.Name,
+			&i.EncryptedValue,
+			&i.IsSecret,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateEnvironmentVariable = `-- name: UpdateEnvironmentVariable :one
+UPDATE environment_variables
+SET
+    base_directory_id = ?,
+    agent_id = ?,
+    name = ?,
+    encrypted_value = ?,
+    is_secret = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, base_directory_id, agent_id, name, encrypted_value, is_secret, created_at, updated_at
+`
+
+type UpdateEnvironmentVariableParams struct {
+	BaseDirectoryID sql.NullInt64 `db:"base_directory_id" json:"base_directory_id"`
+	AgentID         sql.NullInt64 `db:"agent_id" json:"agent_id"`
+	Name            string        `db:"name" json:"name"`
+	EncryptedValue  string        `db:"encrypted_value" json:"encrypted_value"`
+	IsSecret        bool          `db:"is_secret" json:"is_secret"`
+	ID              int64         `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateEnvironmentVariable(ctx context.Context, arg UpdateEnvironmentVariableParams) (EnvironmentVariable, error) {
+	row := q.db.QueryRowContext(ctx, updateEnvironmentVariable,
+		arg.BaseDirectoryID,
+		arg.AgentID,
+		arg.Name,
+		arg.EncryptedValue,
+		arg.IsSecret,
+		arg.ID,
+	)
+	var i EnvironmentVariable
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.AgentID,
+		&i.Name,
+		&i.EncryptedValue,
+		&i.IsSecret,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
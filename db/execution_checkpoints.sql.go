@@ -0,0 +1,144 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: execution_checkpoints.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createExecutionCheckpoint = `-- name: CreateExecutionCheckpoint :one
+INSERT INTO execution_checkpoints (task_execution_id, sequence, ref_name, commit_sha, tree_sha, reason)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, task_execution_id, sequence, ref_name, commit_sha, tree_sha, reason, created_at
+`
+
+type CreateExecutionCheckpointParams struct {
+	TaskExecutionID int64  `db:"task_execution_id" json:"task_execution_id"`
+	Sequence        int64  `db:"sequence" json:"sequence"`
+	RefName         string `db:"ref_name" json:"ref_name"`
+	CommitSha       string `db:"commit_sha" json:"commit_sha"`
+	TreeSha         string `db:"tree_sha" json:"tree_sha"`
+	Reason          string `db:"reason" json:"reason"`
+}
+
+func (q *Queries) CreateExecutionCheckpoint(ctx context.Context, arg CreateExecutionCheckpointParams) (ExecutionCheckpoint, error) {
+	row := q.db.QueryRowContext(ctx, createExecutionCheckpoint,
+		arg.TaskExecutionID,
+		arg.Sequence,
+		arg.RefName,
+		arg.CommitSha,
+		arg.TreeSha,
+		arg.Reason,
+	)
+	var i ExecutionCheckpoint
+	err := row.Scan(
+		&i.ID,
+		&i.TaskExecutionID,
+		&i.Sequence,
+		&i.RefName,
+		&i.CommitSha,
+		&i.TreeSha,
+		&i.Reason,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteExecutionCheckpointsByExecutionID = `-- name: DeleteExecutionCheckpointsByExecutionID :exec
+DELETE FROM execution_checkpoints WHERE task_execution_id = ?
+`
+
+func (q *Queries) DeleteExecutionCheckpointsByExecutionID(ctx context.Context, taskExecutionID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteExecutionCheckpointsByExecutionID, taskExecutionID)
+	return err
+}
+
+const getExecutionCheckpoint = `-- name: GetExecutionCheckpoint :one
+SELECT id, task_execution_id, sequence, ref_name, commit_sha, tree_sha, reason, created_at FROM execution_checkpoints
+WHERE task_execution_id = ? AND sequence = ?
+`
+
+type GetExecutionCheckpointParams struct {
+	TaskExecutionID int64 `db:"task_execution_id" json:"task_execution_id"`
+	Sequence        int64 `db:"sequence" json:"sequence"`
+}
+
+func (q *Queries) GetExecutionCheckpoint(ctx context.Context, arg GetExecutionCheckpointParams) (ExecutionCheckpoint, error) {
+	row := q.db.QueryRowContext(ctx, getExecutionCheckpoint, arg.TaskExecutionID, arg.Sequence)
+	var i ExecutionCheckpoint
+	err := row.Scan(
+		&i.ID,
+		&i.TaskExecutionID,
+		&i.Sequence,
+		&i.RefName,
+		&i.CommitSha,
+		&i.TreeSha,
+		&i.Reason,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getExecutionCheckpointsByExecutionID = `-- name: GetExecutionCheckpointsByExecutionID :many
+SELECT id, task_execution_id, sequence, ref_name, commit_sha, tree_sha, reason, created_at FROM execution_checkpoints
+WHERE task_execution_id = ?
+ORDER BY sequence
+`
+
+func (q *Queries) GetExecutionCheckpointsByExecutionID(ctx context.Context, taskExecutionID int64) ([]ExecutionCheckpoint, error) {
+	rows, err := q.db.QueryContext(ctx, getExecutionCheckpointsByExecutionID, taskExecutionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ExecutionCheckpoint
+	for rows.Next() {
+		var i ExecutionCheckpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskExecutionID,
+			&i.Sequence,
+			&i.RefName,
+			&i.CommitSha,
+			&i.TreeSha,
+			&i.Reason,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestExecutionCheckpoint = `-- name: GetLatestExecutionCheckpoint :one
+SELECT id, task_execution_id, sequence, ref_name, commit_sha, tree_sha, reason, created_at FROM execution_checkpoints
+WHERE task_execution_id = ?
+ORDER BY sequence DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestExecutionCheckpoint(ctx context.Context, taskExecutionID int64) (ExecutionCheckpoint, error) {
+	row := q.db.QueryRowContext(ctx, getLatestExecutionCheckpoint, taskExecutionID)
+	var i ExecutionCheckpoint
+	err := row.Scan(
+		&i.ID,
+		&i.TaskExecutionID,
+		&i.Sequence,
+		&i.RefName,
+		&i.CommitSha,
+		&i.TreeSha,
+		&i.Reason,
+		&i.CreatedAt,
+	)
+	return i, err
+}
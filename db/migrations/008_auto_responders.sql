@@ -0,0 +1,41 @@
+-- Auto-responder rules answer routine agent prompts such as "Allow this command? (y/n)"
+CREATE TABLE IF NOT EXISTS auto_response_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    -- Regular expression matched against the tail of the agent pane.
+    -- The first capture group (if any) is the command or path being asked about.
+    prompt_pattern TEXT NOT NULL,
+    subject_type TEXT NOT NULL DEFAULT 'command', -- 'command' or 'path'
+    list_mode TEXT NOT NULL DEFAULT 'allow',      -- 'allow' or 'deny'
+    subjects TEXT NOT NULL DEFAULT '',            -- newline separated glob patterns
+    response_keys TEXT NOT NULL,                  -- tmux key names, space separated (e.g. "y Enter")
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_auto_response_rules_project_id ON auto_response_rules(project_id);
+
+-- History of notable things that happened during a task execution
+CREATE TABLE IF NOT EXISTS task_execution_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_execution_id INTEGER NOT NULL,
+    event_type TEXT NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    detail TEXT NOT NULL DEFAULT '',
+    rule_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_execution_id) REFERENCES task_executions(id) ON DELETE CASCADE,
+    FOREIGN KEY (rule_id) REFERENCES auto_response_rules(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_execution_events_execution_id ON task_execution_events(task_execution_id);
+
+-- Global key/value settings (e.g. the auto-responder kill switch)
+CREATE TABLE IF NOT EXISTS app_settings (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,19 @@
+-- Environment variables injected into agent and dev server sessions.
+-- Variables belong to a project and may be narrowed to a base directory and/or an agent;
+-- the most specific definition of a name wins when a session starts.
+CREATE TABLE IF NOT EXISTS environment_variables (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    base_directory_id INTEGER,           -- NULL applies to every base directory of the project
+    agent_id INTEGER,                    -- NULL applies to every agent
+    name TEXT NOT NULL,
+    encrypted_value TEXT NOT NULL,       -- AES-GCM sealed, base64 encoded
+    is_secret BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (base_directory_id) REFERENCES base_directories(id) ON DELETE CASCADE,
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_environment_variables_project_id ON environment_variables(project_id);
@@ -0,0 +1,21 @@
+-- Sandbox policies wrap agent commands in Linux namespaces.
+-- A policy belongs either to a project (agent_id NULL) or to an agent (project_id NULL).
+CREATE TABLE IF NOT EXISTS sandbox_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER,
+    agent_id INTEGER,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    allow_network BOOLEAN NOT NULL DEFAULT TRUE,
+    readonly_paths TEXT NOT NULL DEFAULT '',  -- newline separated, in addition to the default toolchains
+    writable_paths TEXT NOT NULL DEFAULT '',  -- newline separated, in addition to the base directory
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (agent_id) REFERENCES agents(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sandbox_policies_project_id ON sandbox_policies(project_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sandbox_policies_agent_id ON sandbox_policies(agent_id);
+
+-- Sandbox backend an execution was started with ('bwrap' or 'unshare'), empty when unsandboxed
+ALTER TABLE task_executions ADD COLUMN sandbox TEXT NOT NULL DEFAULT '';
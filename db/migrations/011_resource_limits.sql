@@ -0,0 +1,31 @@
+-- cgroup v2 limits for agent and dev server sessions.
+-- target_type is one of:
+--   'project'              defaults for every session of the project
+--   'task_execution'       the agent session of an execution
+--   'execution_dev_server' the dev server of an execution
+--   'base_directory'       the directory dev server of a base directory
+-- A value of 0 means "no limit" (or "use the project default" for non-project targets).
+CREATE TABLE IF NOT EXISTS resource_limits (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    cpu_percent INTEGER NOT NULL DEFAULT 0,   -- 100 = one full CPU
+    memory_mb INTEGER NOT NULL DEFAULT 0,
+    pids_max INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (target_type, target_id)
+);
+
+-- Throttling and kills observed in a session's cgroup
+CREATE TABLE IF NOT EXISTS resource_limit_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    cgroup TEXT NOT NULL,
+    event_type TEXT NOT NULL,   -- 'cpu_throttled', 'memory_high', 'oom_kill', 'pids_limit'
+    detail TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_resource_limit_events_target ON resource_limit_events(target_type, target_id);
@@ -0,0 +1,17 @@
+-- Git checkpoints taken while an execution runs. Each one is a commit of the whole working
+-- tree (untracked files included) stored under refs/remote-code/exec/<execution id>/<sequence>.
+CREATE TABLE IF NOT EXISTS execution_checkpoints (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_execution_id INTEGER NOT NULL,
+    sequence INTEGER NOT NULL,
+    ref_name TEXT NOT NULL,
+    commit_sha TEXT NOT NULL,
+    tree_sha TEXT NOT NULL,
+    reason TEXT NOT NULL,   -- 'interval', 'idle', 'manual' or 'before_restore'
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_execution_id) REFERENCES task_executions(id) ON DELETE CASCADE,
+    UNIQUE (task_execution_id, sequence)
+);
+
+-- Minutes between periodic checkpoints of an execution, 0 disables them
+ALTER TABLE task_executions ADD COLUMN checkpoint_interval_minutes INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,35 @@
+-- Local pull requests: a review unit between a task branch and its target branch,
+-- merged with git directly in the base directory's repository.
+CREATE TABLE IF NOT EXISTS pull_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    base_directory_id INTEGER NOT NULL,
+    task_id INTEGER,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    source_branch TEXT NOT NULL,
+    target_branch TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'open',   -- 'open', 'merged' or 'closed'
+    merge_strategy TEXT NOT NULL DEFAULT '',   -- 'ff', 'squash' or 'merge' once merged
+    merge_commit_sha TEXT NOT NULL DEFAULT '',
+    merged_base_sha TEXT NOT NULL DEFAULT '',   -- merge base and source head when merged, so the diff stays viewable
+    merged_head_sha TEXT NOT NULL DEFAULT '',
+    merged_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    FOREIGN KEY (base_directory_id) REFERENCES base_directories(id) ON DELETE CASCADE,
+    FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_pull_requests_project_id ON pull_requests(project_id);
+CREATE INDEX IF NOT EXISTS idx_pull_requests_task_id ON pull_requests(task_id);
+
+-- Executions whose work a pull request contains
+CREATE TABLE IF NOT EXISTS pull_request_executions (
+    pull_request_id INTEGER NOT NULL,
+    task_execution_id INTEGER NOT NULL,
+    PRIMARY KEY (pull_request_id, task_execution_id),
+    FOREIGN KEY (pull_request_id) REFERENCES pull_requests(id) ON DELETE CASCADE,
+    FOREIGN KEY (task_execution_id) REFERENCES task_executions(id) ON DELETE CASCADE
+);
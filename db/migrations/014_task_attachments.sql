@@ -0,0 +1,17 @@
+-- Files attached to a task. The content lives under the data directory at storage_path
+-- (relative to it); executions get a copy when they start.
+CREATE TABLE IF NOT EXISTS task_attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    storage_path TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_attachments_task_id ON task_attachments(task_id);
+
+-- Where an execution's attachments were materialized, empty when it had none
+ALTER TABLE task_executions ADD COLUMN attachments_dir TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- Discussion and review history of a task. Comments may be about one execution; they stay
+-- with the task when that execution is deleted.
+CREATE TABLE IF NOT EXISTS task_comments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    task_id INTEGER NOT NULL,
+    task_execution_id INTEGER,
+    author_type TEXT NOT NULL,          -- 'human' or 'system'
+    author TEXT NOT NULL DEFAULT '',
+    kind TEXT NOT NULL DEFAULT 'comment', -- 'comment', 'feedback', 'accept', 'rerun' or 'start'
+    body TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_comments_task_id ON task_comments(task_id);
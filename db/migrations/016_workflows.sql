@@ -0,0 +1,34 @@
+-- Kanban columns of a project, in board order. A task's status is the status_key of its
+-- column. Projects without columns use the built-in todo/in_progress/to_verify/done board.
+CREATE TABLE IF NOT EXISTS workflow_columns (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    status_key TEXT NOT NULL,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    wip_limit INTEGER NOT NULL DEFAULT 0, -- 0 means unlimited
+    color TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    UNIQUE (project_id, status_key)
+);
+
+-- Automation: when event happens to a task, move it to target_status
+CREATE TABLE IF NOT EXISTS workflow_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    project_id INTEGER NOT NULL,
+    event TEXT NOT NULL, -- 'execution_started', 'execution_accepted', 'branch_merged' or 'pull_request_merged'
+    target_status TEXT NOT NULL,
+    FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE CASCADE,
+    UNIQUE (project_id, event)
+);
+
+-- Position of a task within its column
+ALTER TABLE tasks ADD COLUMN sort_order INTEGER NOT NULL DEFAULT 0;
+
+-- Keep the order boards showed so far, alphabetical within each column
+UPDATE tasks SET sort_order = (
+    SELECT COUNT(*) FROM tasks t2
+    WHERE t2.project_id = tasks.project_id
+      AND t2.status = tasks.status
+      AND (t2.title < tasks.title OR (t2.title = tasks.title AND t2.id <= tasks.id))
+);
@@ -0,0 +1,14 @@
+-- Planning metadata on tasks
+ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 0; -- 0 none, 1 low, 2 medium, 3 high, 4 urgent
+ALTER TABLE tasks ADD COLUMN preferred_agent_id INTEGER REFERENCES agents(id) ON DELETE SET NULL;
+ALTER TABLE tasks ADD COLUMN due_date TEXT NOT NULL DEFAULT ''; -- YYYY-MM-DD, empty when there is none
+
+-- Free-form labels, stored lowercase
+CREATE TABLE IF NOT EXISTS task_labels (
+    task_id INTEGER NOT NULL,
+    label TEXT NOT NULL,
+    PRIMARY KEY (task_id, label),
+    FOREIGN KEY (task_id) REFERENCES tasks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_labels_label ON task_labels(label);
@@ -0,0 +1,5 @@
+-- Where an imported task came from, e.g. 'github:owner/repo#12'. Re-importing the same
+-- source updates the task instead of creating another one.
+ALTER TABLE tasks ADD COLUMN external_id TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tasks_external_id ON tasks(project_id, external_id) WHERE external_id != '';
@@ -0,0 +1,19 @@
+-- Roots are workspaces: each has its own agents, projects and settings
+ALTER TABLE roots ADD COLUMN name TEXT NOT NULL DEFAULT '';
+
+-- Everything created before roots were selectable belongs to root 1, the default workspace
+INSERT INTO roots (id, name, local_port)
+SELECT 1, 'Default', '8080'
+WHERE NOT EXISTS (SELECT 1 FROM roots WHERE id = 1);
+
+UPDATE roots SET name = CASE WHEN id = 1 THEN 'Default' ELSE 'Workspace ' || id END
+WHERE name = '';
+
+CREATE TABLE IF NOT EXISTS root_settings (
+    root_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (root_id, key),
+    FOREIGN KEY (root_id) REFERENCES roots(id) ON DELETE CASCADE
+);
@@ -0,0 +1,30 @@
+-- Users own passkeys and sessions. role is 'admin', 'operator' (runs agents and terminals)
+-- or 'viewer' (read-only dashboards and transcripts).
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    display_name TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT 'viewer',
+    webauthn_handle TEXT NOT NULL UNIQUE, -- WebAuthn user handle, stable for the user's passkeys
+    invite_token_hash TEXT,               -- SHA-256 of a pending invite to register a passkey
+    invite_expires_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE webauthn_credentials ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN user_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE task_executions ADD COLUMN started_by_user_id INTEGER;
+
+-- Passkeys registered before users existed belonged to one implicit administrator. It keeps
+-- the user handle those passkeys were registered with.
+INSERT INTO users (id, name, display_name, role, webauthn_handle)
+SELECT 1, 'admin', 'Administrator', 'admin', 'single-user'
+WHERE EXISTS (SELECT 1 FROM webauthn_credentials)
+  AND NOT EXISTS (SELECT 1 FROM users);
+
+UPDATE webauthn_credentials SET user_id = 1 WHERE user_id = 0 AND EXISTS (SELECT 1 FROM users WHERE id = 1);
+UPDATE sessions SET user_id = 1 WHERE user_id = 0 AND EXISTS (SELECT 1 FROM users WHERE id = 1);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
+CREATE INDEX IF NOT EXISTS idx_users_invite_token_hash ON users(invite_token_hash);
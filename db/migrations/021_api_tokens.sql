@@ -0,0 +1,17 @@
+-- Personal access tokens for scripts and CLIs, sent as "Authorization: Bearer <token>".
+-- Only a SHA-256 of the token is stored. scope caps what the token may do below its owner's
+-- role: 'read', 'write' or 'admin'; '' means everything the owner may do.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,          -- first characters of the token, to recognise it
+    scope TEXT NOT NULL DEFAULT '',
+    expires_at DATETIME,                 -- NULL never expires
+    last_used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
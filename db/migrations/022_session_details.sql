@@ -0,0 +1,12 @@
+-- Where sessions were signed in from and when they were last used, so logins on other
+-- devices can be reviewed and revoked. public_id names a session without revealing its token.
+ALTER TABLE sessions ADD COLUMN public_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+
+UPDATE sessions SET public_id = lower(hex(randomblob(8))) WHERE public_id = '';
+UPDATE sessions SET last_seen_at = created_at WHERE last_seen_at IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_public_id ON sessions(public_id);
@@ -0,0 +1,3 @@
+-- Passkeys get a name to tell them apart, and the time they were last used to sign in
+ALTER TABLE webauthn_credentials ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE webauthn_credentials ADD COLUMN last_used_at DATETIME;
@@ -0,0 +1,14 @@
+-- One-time codes a signed in device hands to a new device, so the new device can register a
+-- passkey on a domain it reaches us through (such as a fresh tunnel URL). Only a SHA-256 of
+-- the code is stored; a code is used once and expires after a few minutes.
+CREATE TABLE IF NOT EXISTS pairing_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,            -- whose passkey the new device registers
+    code_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_pairing_codes_user_id ON pairing_codes(user_id);
@@ -0,0 +1,7 @@
+-- Authenticator app (TOTP) secrets, a fallback sign-in for domains without the user's passkeys,
+-- such as a tunnel URL that changed overnight. totp_secret is sealed like environment secrets;
+-- it is pending until totp_enabled_at is set by confirming a code. totp_last_step is the last
+-- time step signed in with, so a code cannot be replayed.
+ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN totp_enabled_at DATETIME;
+ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,28 @@
+-- Append-only record of every change made through the API and every terminal attach: who
+-- (actor), what (action with IDs replaced by {id}), on which objects (target_ids, a JSON object
+-- of resource to ID), a summary of the request with secrets and long values left out, and the
+-- resulting HTTP status. Entries are never updated; old ones are deleted after the retention
+-- period.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,                     -- NULL before sign-in and in setup mode
+    actor TEXT NOT NULL,                 -- user name at the time, or 'anonymous'
+    api_token_id INTEGER,                -- set when the request used an API token
+    action TEXT NOT NULL,                -- e.g. 'POST /api/task-executions/{id}/input'
+    resource TEXT NOT NULL,              -- e.g. 'task-executions', or 'terminal'
+    target_ids TEXT NOT NULL DEFAULT '{}',
+    summary TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL,
+    ip_address TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user_id ON audit_log(user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_resource ON audit_log(resource);
+
+CREATE TRIGGER IF NOT EXISTS audit_log_append_only
+BEFORE UPDATE ON audit_log
+BEGIN
+    SELECT RAISE(ABORT, 'audit log entries cannot be changed');
+END;
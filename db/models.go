@@ -57,6 +57,52 @@ type AgentLeaderboard struct {
 	EloRank        interface{}     `db:"elo_rank" json:"elo_rank"`
 }
 
+type ApiToken struct {
+	ID          int64        `db:"id" json:"id"`
+	UserID      int64        `db:"user_id" json:"user_id"`
+	Name        string       `db:"name" json:"name"`
+	TokenHash   string       `db:"token_hash" json:"token_hash"`
+	TokenPrefix string       `db:"token_prefix" json:"token_prefix"`
+	Scope       string       `db:"scope" json:"scope"`
+	ExpiresAt   sql.NullTime `db:"expires_at" json:"expires_at"`
+	LastUsedAt  sql.NullTime `db:"last_used_at" json:"last_used_at"`
+	CreatedAt   sql.NullTime `db:"created_at" json:"created_at"`
+}
+
+type AppSetting struct {
+	Key       string       `db:"key" json:"key"`
+	Value     string       `db:"value" json:"value"`
+	UpdatedAt sql.NullTime `db:"updated_at" json:"updated_at"`
+}
+
+type AuditLog struct {
+	ID         int64         `db:"id" json:"id"`
+	UserID     sql.NullInt64 `db:"user_id" json:"user_id"`
+	Actor      string        `db:"actor" json:"actor"`
+	ApiTokenID sql.NullInt64 `db:"api_token_id" json:"api_token_id"`
+	Action     string        `db:"action" json:"action"`
+	Resource   string        `db:"resource" json:"resource"`
+	TargetIds  string        `db:"target_ids" json:"target_ids"`
+	Summary    string        `db:"summary" json:"summary"`
+	Status     int64         `db:"status" json:"status"`
+	IpAddress  string        `db:"ip_address" json:"ip_address"`
+	CreatedAt  sql.NullTime  `db:"created_at" json:"created_at"`
+}
+
+type AutoResponseRule struct {
+	ID            int64        `db:"id" json:"id"`
+	ProjectID     int64        `db:"project_id" json:"project_id"`
+	Name          string       `db:"name" json:"name"`
+	PromptPattern string       `db:"prompt_pattern" json:"prompt_pattern"`
+	SubjectType   string       `db:"subject_type" json:"subject_type"`
+	ListMode      string       `db:"list_mode" json:"list_mode"`
+	Subjects      string       `db:"subjects" json:"subjects"`
+	ResponseKeys  string       `db:"response_keys" json:"response_keys"`
+	Enabled       bool         `db:"enabled" json:"enabled"`
+	CreatedAt     sql.NullTime `db:"created_at" json:"created_at"`
+	UpdatedAt     sql.NullTime `db:"updated_at" json:"updated_at"`
+}
+
 type BaseDirectory struct {
 	ID                        int64        `db:"id" json:"id"`
 	ProjectID                 int64        `db:"project_id" json:"project_id"`
@@ -101,6 +147,38 @@ type DirectoryDevServer struct {
 	UpdatedAt       sql.NullTime `db:"updated_at" json:"updated_at"`
 }
 
+type EnvironmentVariable struct {
+	ID              int64         `db:"id" json:"id"`
+	ProjectID       int64         `db:"project_id" json:"project_id"`
+	BaseDirectoryID sql.NullInt64 `db:"base_directory_id" json:"base_directory_id"`
+	AgentID         sql.NullInt64 `db:"agent_id" json:"agent_id"`
+	Name            string        `db:"name" json:"name"`
+	EncryptedValue  string        `db:"encrypted_value" json:"encrypted_value"`
+	IsSecret        bool          `db:"is_secret" json:"is_secret"`
+	CreatedAt       sql.NullTime  `db:"created_at" json:"created_at"`
+	UpdatedAt       sql.NullTime  `db:"updated_at" json:"updated_at"`
+}
+
+type ExecutionCheckpoint struct {
+	ID              int64        `db:"id" json:"id"`
+	TaskExecutionID int64        `db:"task_execution_id" json:"task_execution_id"`
+	Sequence        int64        `db:"sequence" json:"sequence"`
+	RefName         string       `db:"ref_name" json:"ref_name"`
+	CommitSha       string       `db:"commit_sha" json:"commit_sha"`
+	TreeSha         string       `db:"tree_sha" json:"tree_sha"`
+	Reason          string       `db:"reason" json:"reason"`
+	CreatedAt       sql.NullTime `db:"created_at" json:"created_at"`
+}
+
+type PairingCode struct {
+	ID        int64        `db:"id" json:"id"`
+	UserID    int64        `db:"user_id" json:"user_id"`
+	CodeHash  string       `db:"code_hash" json:"code_hash"`
+	ExpiresAt time.Time    `db:"expires_at" json:"expires_at"`
+	UsedAt    sql.NullTime `db:"used_at" json:"used_at"`
+	CreatedAt sql.NullTime `db:"created_at" json:"created_at"`
+}
+
 type Project struct {
 	ID        int64        `db:"id" json:"id"`
 	RootID    int64        `db:"root_id" json:"root_id"`
@@ -109,6 +187,30 @@ type Project struct {
 	UpdatedAt sql.NullTime `db:"updated_at" json:"updated_at"`
 }
 
+type PullRequest struct {
+	ID              int64         `db:"id" json:"id"`
+	ProjectID       int64         `db:"project_id" json:"project_id"`
+	BaseDirectoryID int64         `db:"base_directory_id" json:"base_directory_id"`
+	TaskID          sql.NullInt64 `db:"task_id" json:"task_id"`
+	Title           string        `db:"title" json:"title"`
+	Description     string        `db:"description" json:"description"`
+	SourceBranch    string        `db:"source_branch" json:"source_branch"`
+	TargetBranch    string        `db:"target_branch" json:"target_branch"`
+	Status          string        `db:"status" json:"status"`
+	MergeStrategy   string        `db:"merge_strategy" json:"merge_strategy"`
+	MergeCommitSha  string        `db:"merge_commit_sha" json:"merge_commit_sha"`
+	MergedBaseSha   string        `db:"merged_base_sha" json:"merged_base_sha"`
+	MergedHeadSha   string        `db:"merged_head_sha" json:"merged_head_sha"`
+	MergedAt        sql.NullTime  `db:"merged_at" json:"merged_at"`
+	CreatedAt       sql.NullTime  `db:"created_at" json:"created_at"`
+	UpdatedAt       sql.NullTime  `db:"updated_at" json:"updated_at"`
+}
+
+type PullRequestExecution struct {
+	PullRequestID   int64 `db:"pull_request_id" json:"pull_request_id"`
+	TaskExecutionID int64 `db:"task_execution_id" json:"task_execution_id"`
+}
+
 type RemotePort struct {
 	ID            int64          `db:"id" json:"id"`
 	Port          int64          `db:"port" json:"port"`
@@ -119,40 +221,147 @@ type RemotePort struct {
 	UpdatedAt     sql.NullTime   `db:"updated_at" json:"updated_at"`
 }
 
+type ResourceLimit struct {
+	ID         int64        `db:"id" json:"id"`
+	TargetType string       `db:"target_type" json:"target_type"`
+	TargetID   int64        `db:"target_id" json:"target_id"`
+	CpuPercent int64        `db:"cpu_percent" json:"cpu_percent"`
+	MemoryMb   int64        `db:"memory_mb" json:"memory_mb"`
+	PidsMax    int64        `db:"pids_max" json:"pids_max"`
+	CreatedAt  sql.NullTime `db:"created_at" json:"created_at"`
+	UpdatedAt  sql.NullTime `db:"updated_at" json:"updated_at"`
+}
+
+type ResourceLimitEvent struct {
+	ID         int64        `db:"id" json:"id"`
+	TargetType string       `db:"target_type" json:"target_type"`
+	TargetID   int64        `db:"target_id" json:"target_id"`
+	Cgroup     string       `db:"cgroup" json:"cgroup"`
+	EventType  string       `db:"event_type" json:"event_type"`
+	Detail     string       `db:"detail" json:"detail"`
+	CreatedAt  sql.NullTime `db:"created_at" json:"created_at"`
+}
+
 type Root struct {
 	ID          int64          `db:"id" json:"id"`
 	LocalPort   string         `db:"local_port" json:"local_port"`
 	ExternalUrl sql.NullString `db:"external_url" json:"external_url"`
 	CreatedAt   sql.NullTime   `db:"created_at" json:"created_at"`
 	UpdatedAt   sql.NullTime   `db:"updated_at" json:"updated_at"`
+	Name        string         `db:"name" json:"name"`
+}
+
+type RootSetting struct {
+	RootID    int64        `db:"root_id" json:"root_id"`
+	Key       string       `db:"key" json:"key"`
+	Value     string       `db:"value" json:"value"`
+	UpdatedAt sql.NullTime `db:"updated_at" json:"updated_at"`
+}
+
+type SandboxPolicy struct {
+	ID            int64         `db:"id" json:"id"`
+	ProjectID     sql.NullInt64 `db:"project_id" json:"project_id"`
+	AgentID       sql.NullInt64 `db:"agent_id" json:"agent_id"`
+	Enabled       bool          `db:"enabled" json:"enabled"`
+	AllowNetwork  bool          `db:"allow_network" json:"allow_network"`
+	ReadonlyPaths string        `db:"readonly_paths" json:"readonly_paths"`
+	WritablePaths string        `db:"writable_paths" json:"writable_paths"`
+	CreatedAt     sql.NullTime  `db:"created_at" json:"created_at"`
+	UpdatedAt     sql.NullTime  `db:"updated_at" json:"updated_at"`
 }
 
 type Session struct {
-	Token     string       `db:"token" json:"token"`
-	ExpiresAt time.Time    `db:"expires_at" json:"expires_at"`
-	CreatedAt sql.NullTime `db:"created_at" json:"created_at"`
+	Token      string       `db:"token" json:"token"`
+	ExpiresAt  time.Time    `db:"expires_at" json:"expires_at"`
+	CreatedAt  sql.NullTime `db:"created_at" json:"created_at"`
+	UserID     int64        `db:"user_id" json:"user_id"`
+	PublicID   string       `db:"public_id" json:"public_id"`
+	UserAgent  string       `db:"user_agent" json:"user_agent"`
+	IpAddress  string       `db:"ip_address" json:"ip_address"`
+	LastSeenAt sql.NullTime `db:"last_seen_at" json:"last_seen_at"`
 }
 
 type Task struct {
-	ID              int64        `db:"id" json:"id"`
-	ProjectID       int64        `db:"project_id" json:"project_id"`
-	BaseDirectoryID string       `db:"base_directory_id" json:"base_directory_id"`
-	Title           string       `db:"title" json:"title"`
-	Description     string       `db:"description" json:"description"`
-	Status          string       `db:"status" json:"status"`
-	CreatedAt       sql.NullTime `db:"created_at" json:"created_at"`
-	UpdatedAt       sql.NullTime `db:"updated_at" json:"updated_at"`
+	ID               int64         `db:"id" json:"id"`
+	ProjectID        int64         `db:"project_id" json:"project_id"`
+	BaseDirectoryID  string        `db:"base_directory_id" json:"base_directory_id"`
+	Title            string        `db:"title" json:"title"`
+	Description      string        `db:"description" json:"description"`
+	Status           string        `db:"status" json:"status"`
+	CreatedAt        sql.NullTime  `db:"created_at" json:"created_at"`
+	UpdatedAt        sql.NullTime  `db:"updated_at" json:"updated_at"`
+	SortOrder        int64         `db:"sort_order" json:"sort_order"`
+	Priority         int64         `db:"priority" json:"priority"`
+	PreferredAgentID sql.NullInt64 `db:"preferred_agent_id" json:"preferred_agent_id"`
+	DueDate          string        `db:"due_date" json:"due_date"`
+	ExternalID       string        `db:"external_id" json:"external_id"`
+}
+
+type TaskAttachment struct {
+	ID          int64        `db:"id" json:"id"`
+	TaskID      int64        `db:"task_id" json:"task_id"`
+	Filename    string       `db:"filename" json:"filename"`
+	ContentType string       `db:"content_type" json:"content_type"`
+	Size        int64        `db:"size" json:"size"`
+	StoragePath string       `db:"storage_path" json:"storage_path"`
+	CreatedAt   sql.NullTime `db:"created_at" json:"created_at"`
+}
+
+type TaskComment struct {
+	ID              int64         `db:"id" json:"id"`
+	TaskID          int64         `db:"task_id" json:"task_id"`
+	TaskExecutionID sql.NullInt64 `db:"task_execution_id" json:"task_execution_id"`
+	AuthorType      string        `db:"author_type" json:"author_type"`
+	Author          string        `db:"author" json:"author"`
+	Kind            string        `db:"kind" json:"kind"`
+	Body            string        `db:"body" json:"body"`
+	CreatedAt       sql.NullTime  `db:"created_at" json:"created_at"`
+	UpdatedAt       sql.NullTime  `db:"updated_at" json:"updated_at"`
 }
 
 type TaskExecution struct {
+	ID                        int64          `db:"id" json:"id"`
+	TaskID                    int64          `db:"task_id" json:"task_id"`
+	AgentID                   int64          `db:"agent_id" json:"agent_id"`
+	Status                    string         `db:"status" json:"status"`
+	AgentTmuxID               sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
+	DevServerTmuxID           sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
+	CreatedAt                 sql.NullTime   `db:"created_at" json:"created_at"`
+	UpdatedAt                 sql.NullTime   `db:"updated_at" json:"updated_at"`
+	Sandbox                   string         `db:"sandbox" json:"sandbox"`
+	CheckpointIntervalMinutes int64          `db:"checkpoint_interval_minutes" json:"checkpoint_interval_minutes"`
+	AttachmentsDir            string         `db:"attachments_dir" json:"attachments_dir"`
+	StartedByUserID           sql.NullInt64  `db:"started_by_user_id" json:"started_by_user_id"`
+}
+
+type TaskExecutionEvent struct {
+	ID              int64         `db:"id" json:"id"`
+	TaskExecutionID int64         `db:"task_execution_id" json:"task_execution_id"`
+	EventType       string        `db:"event_type" json:"event_type"`
+	Message         string        `db:"message" json:"message"`
+	Detail          string        `db:"detail" json:"detail"`
+	RuleID          sql.NullInt64 `db:"rule_id" json:"rule_id"`
+	CreatedAt       sql.NullTime  `db:"created_at" json:"created_at"`
+}
+
+type TaskLabel struct {
+	TaskID int64  `db:"task_id" json:"task_id"`
+	Label  string `db:"label" json:"label"`
+}
+
+type User struct {
 	ID              int64          `db:"id" json:"id"`
-	TaskID          int64          `db:"task_id" json:"task_id"`
-	AgentID         int64          `db:"agent_id" json:"agent_id"`
-	Status          string         `db:"status" json:"status"`
-	AgentTmuxID     sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
-	DevServerTmuxID sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
+	Name            string         `db:"name" json:"name"`
+	DisplayName     string         `db:"display_name" json:"display_name"`
+	Role            string         `db:"role" json:"role"`
+	WebauthnHandle  string         `db:"webauthn_handle" json:"webauthn_handle"`
+	InviteTokenHash sql.NullString `db:"invite_token_hash" json:"invite_token_hash"`
+	InviteExpiresAt sql.NullTime   `db:"invite_expires_at" json:"invite_expires_at"`
 	CreatedAt       sql.NullTime   `db:"created_at" json:"created_at"`
 	UpdatedAt       sql.NullTime   `db:"updated_at" json:"updated_at"`
+	TotpSecret      string         `db:"totp_secret" json:"totp_secret"`
+	TotpEnabledAt   sql.NullTime   `db:"totp_enabled_at" json:"totp_enabled_at"`
+	TotpLastStep    int64          `db:"totp_last_step" json:"totp_last_step"`
 }
 
 type WebauthnCredential struct {
@@ -164,4 +373,24 @@ type WebauthnCredential struct {
 	Aaguid          []byte         `db:"aaguid" json:"aaguid"`
 	SignCount       int64          `db:"sign_count" json:"sign_count"`
 	CreatedAt       sql.NullTime   `db:"created_at" json:"created_at"`
+	UserID          int64          `db:"user_id" json:"user_id"`
+	Name            string         `db:"name" json:"name"`
+	LastUsedAt      sql.NullTime   `db:"last_used_at" json:"last_used_at"`
+}
+
+type WorkflowColumn struct {
+	ID        int64  `db:"id" json:"id"`
+	ProjectID int64  `db:"project_id" json:"project_id"`
+	StatusKey string `db:"status_key" json:"status_key"`
+	Name      string `db:"name" json:"name"`
+	Position  int64  `db:"position" json:"position"`
+	WipLimit  int64  `db:"wip_limit" json:"wip_limit"`
+	Color     string `db:"color" json:"color"`
+}
+
+type WorkflowRule struct {
+	ID           int64  `db:"id" json:"id"`
+	ProjectID    int64  `db:"project_id" json:"project_id"`
+	Event        string `db:"event" json:"event"`
+	TargetStatus string `db:"target_status" json:"target_status"`
 }
@@ -0,0 +1,79 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: pairing_codes.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createPairingCode = `-- name: CreatePairingCode :one
+INSERT INTO pairing_codes (user_id, code_hash, expires_at)
+VALUES (?, ?, ?)
+RETURNING id, user_id, code_hash, expires_at, used_at, created_at
+`
+
+type CreatePairingCodeParams struct {
+	UserID    int64     `db:"user_id" json:"user_id"`
+	CodeHash  string    `db:"code_hash" json:"code_hash"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+func (q *Queries) CreatePairingCode(ctx context.Context, arg CreatePairingCodeParams) (PairingCode, error) {
+	row := q.db.QueryRowContext(ctx, createPairingCode, arg.UserID, arg.CodeHash, arg.ExpiresAt)
+	var i PairingCode
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CodeHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteExpiredPairingCodes = `-- name: DeleteExpiredPairingCodes :execrows
+DELETE FROM pairing_codes WHERE expires_at <= CURRENT_TIMESTAMP OR used_at IS NOT NULL
+`
+
+func (q *Queries) DeleteExpiredPairingCodes(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredPairingCodes)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deletePairingCodesByUserID = `-- name: DeletePairingCodesByUserID :exec
+DELETE FROM pairing_codes WHERE user_id = ?
+`
+
+func (q *Queries) DeletePairingCodesByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePairingCodesByUserID, userID)
+	return err
+}
+
+const usePairingCode = `-- name: UsePairingCode :one
+UPDATE pairing_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE code_hash = ? AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING id, user_id, code_hash, expires_at, used_at, created_at
+`
+
+func (q *Queries) UsePairingCode(ctx context.Context, codeHash string) (PairingCode, error) {
+	row := q.db.QueryRowContext(ctx, usePairingCode, codeHash)
+	var i PairingCode
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.CodeHash,
+		&i.ExpiresAt,
+		&i.UsedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
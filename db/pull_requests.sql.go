@@ -0,0 +1,383 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: pull_requests.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const addPullRequestExecution = `-- name: AddPullRequestExecution :exec
+INSERT OR IGNORE INTO pull_request_executions (pull_request_id, task_execution_id)
+VALUES (?, ?)
+`
+
+type AddPullRequestExecutionParams struct {
+	PullRequestID   int64 `db:"pull_request_id" json:"pull_request_id"`
+	TaskExecutionID int64 `db:"task_execution_id" json:"task_execution_id"`
+}
+
+func (q *Queries) AddPullRequestExecution(ctx context.Context, arg AddPullRequestExecutionParams) error {
+	_, err := q.db.ExecContext(ctx, addPullRequestExecution, arg.PullRequestID, arg.TaskExecutionID)
+	return err
+}
+
+const createPullRequest = `-- name: CreatePullRequest :one
+INSERT INTO pull_requests (project_id, base_directory_id, task_id, title, description, source_branch, target_branch)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING id, project_id, base_directory_id, task_id, title, description, source_branch, target_branch, status, merge_strategy, merge_commit_sha, merged_base_sha, merged_head_sha, merged_at, created_at, updated_at
+`
+
+type CreatePullRequestParams struct {
+	ProjectID       int64         `db:"project_id" json:"project_id"`
+	BaseDirectoryID int64         `db:"base_directory_id" json:"base_directory_id"`
+	TaskID          sql.NullInt64 `db:"task_id" json:"task_id"`
+	Title           string        `db:"title" json:"title"`
+	Description     string        `db:"description" json:"description"`
+	SourceBranch    string        `db:"source_branch" json:"source_branch"`
+	TargetBranch    string        `db:"target_branch" json:"target_branch"`
+}
+
+func (q *Queries) CreatePullRequest(ctx context.Context, arg CreatePullRequestParams) (PullRequest, error) {
+	row := q.db.QueryRowContext(ctx, createPullRequest,
+		arg.ProjectID,
+		arg.BaseDirectoryID,
+		arg.TaskID,
+		arg.Title,
+		arg.Description,
+		arg.SourceBranch,
+		arg.TargetBranch,
+	)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.TaskID,
+		&i.Title,
+		&i.Description,
+		&i.SourceBranch,
+		&i.TargetBranch,
+		&i.Status,
+		&i.MergeStrategy,
+		&i.MergeCommitSha,
+		&i.MergedBaseSha,
+		&i.MergedHeadSha,
+		&i.MergedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deletePullRequest = `-- name: DeletePullRequest :exec
+DELETE FROM pull_requests WHERE id = ?
+`
+
+func (q *Queries) DeletePullRequest(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deletePullRequest, id)
+	return err
+}
+
+const deletePullRequestExecutions = `-- name: DeletePullRequestExecutions :exec
+DELETE FROM pull_request_executions WHERE pull_request_id = ?
+`
+
+func (q *Queries) DeletePullRequestExecutions(ctx context.Context, pullRequestID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePullRequestExecutions, pullRequestID)
+	return err
+}
+
+const deletePullRequestExecutionsByBaseDirectoryID = `-- name: DeletePullRequestExecutionsByBaseDirectoryID :exec
+DELETE FROM pull_request_executions
+WHERE pull_request_id IN (SELECT id FROM pull_requests WHERE base_directory_id = ?)
+`
+
+func (q *Queries) DeletePullRequestExecutionsByBaseDirectoryID(ctx context.Context, baseDirectoryID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePullRequestExecutionsByBaseDirectoryID, baseDirectoryID)
+	return err
+}
+
+const deletePullRequestExecutionsByExecutionID = `-- name: DeletePullRequestExecutionsByExecutionID :exec
+DELETE FROM pull_request_executions WHERE task_execution_id = ?
+`
+
+func (q *Queries) DeletePullRequestExecutionsByExecutionID(ctx context.Context, taskExecutionID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePullRequestExecutionsByExecutionID, taskExecutionID)
+	return err
+}
+
+const deletePullRequestsByBaseDirectoryID = `-- name: DeletePullRequestsByBaseDirectoryID :exec
+DELETE FROM pull_requests WHERE base_directory_id = ?
+`
+
+func (q *Queries) DeletePullRequestsByBaseDirectoryID(ctx context.Context, baseDirectoryID int64) error {
+	_, err := q.db.ExecContext(ctx, deletePullRequestsByBaseDirectoryID, baseDirectoryID)
+	return err
+}
+
+const getPullRequest = `-- name: GetPullRequest :one
+SELECT id, project_id, base_directory_id, task_id, title, description, source_branch, target_branch, status, merge_strategy, merge_commit_sha, merged_base_sha, merged_head_sha, merged_at, created_at, updated_at FROM pull_requests
+WHERE id = ?
+`
+
+func (q *Queries) GetPullRequest(ctx context.Context, id int64) (PullRequest, error) {
+	row := q.db.QueryRowContext(ctx, getPullRequest, id)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.TaskID,
+		&i.Title,
+		&i.Description,
+		&i.SourceBranch,
+		&i.TargetBranch,
+		&i.Status,
+		&i.MergeStrategy,
+		&i.MergeCommitSha,
+		&i.MergedBaseSha,
+		&i.MergedHeadSha,
+		&i.MergedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getPullRequestExecutionIDs = `-- name: GetPullRequestExecutionIDs :many
+SELECT task_execution_id FROM pull_request_executions
+WHERE pull_request_id = ?
+ORDER BY task_execution_id
+`
+
+func (q *Queries) GetPullRequestExecutionIDs(ctx context.Context, pullRequestID int64) ([]int64, error) {
+	rows, err := q.db.QueryContext(ctx, getPullRequestExecutionIDs, pullRequestID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var task_execution_id int64
+		if err := rows.Scan(&task_execution_id); err != nil {
+			return nil, err
+		}
+		items = append(items, task_execution_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPullRequestsByProjectID = `-- name: GetPullRequestsByProjectID :many
+SELECT id, project_id, base_directory_id, task_id, title, description, source_branch, target_branch, status, merge_strategy, merge_commit_sha, merged_base_sha, merged_head_sha, merged_at, created_at, updated_at FROM pull_requests
+WHERE project_id = ?
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) GetPullRequestsByProjectID(ctx context.Context, projectID int64) ([]PullRequest, error) {
+	rows, err := q.db.QueryContext(ctx, getPullRequestsByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PullRequest
+	for rows.Next() {
+		var i PullRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.BaseDirectoryID,
+			&i.TaskID,
+			&i.Title,
+			&i.Description,
+			&i.SourceBranch,
+			&i.TargetBranch,
+			&i.Status,
+			&i.MergeStrategy,
+			&i.MergeCommitSha,
+			&i.MergedBaseSha,
+			&i.MergedHeadSha,
+			&i.MergedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getPullRequestsByTaskID = `-- name: GetPullRequestsByTaskID :many
+SELECT id, project_id, base_directory_id, task_id, title, description, source_branch, target_branch, status, merge_strategy, merge_commit_sha, merged_base_sha, merged_head_sha, merged_at, created_at, updated_at FROM pull_requests
+WHERE task_id = ?
+ORDER BY created_at DESC, id DESC
+`
+
+func (q *Queries) GetPullRequestsByTaskID(ctx context.Context, taskID sql.NullInt64) ([]PullRequest, error) {
+	rows, err := q.db.QueryContext(ctx, getPullRequestsByTaskID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []PullRequest
+	for rows.Next() {
+		var i PullRequest
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.BaseDirectoryID,
+			&i.TaskID,
+			&i.Title,
+			&i.Description,
+			&i.SourceBranch,
+			&i.TargetBranch,
+			&i.Status,
+			&i.MergeStrategy,
+			&i.MergeCommitSha,
+			&i.MergedBaseSha,
+			&i.MergedHeadSha,
+			&i.MergedAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markPullRequestMerged = `-- name: MarkPullRequestMerged :one
+UPDATE pull_requests
+SET
+    status = 'merged',
+    merge_strategy = ?,
+    merge_commit_sha = ?,
+    merged_base_sha = ?,
+    merged_head_sha = ?,
+    merged_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, base_directory_id, task_id, title, description, source_branch, target_branch, status, merge_strategy, merge_commit_sha, merged_base_sha, merged_head_sha, merged_at, created_at, updated_at
+`
+
+type MarkPullRequestMergedParams struct {
+	MergeStrategy  string `db:"merge_strategy" json:"merge_strategy"`
+	MergeCommitSha string `db:"merge_commit_sha" json:"merge_commit_sha"`
+	MergedBaseSha  string `db:"merged_base_sha" json:"merged_base_sha"`
+	MergedHeadSha  string `db:"merged_head_sha" json:"merged_head_sha"`
+	ID             int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) MarkPullRequestMerged(ctx context.Context, arg MarkPullRequestMergedParams) (PullRequest, error) {
+	row := q.db.QueryRowContext(ctx, markPullRequestMerged,
+		arg.MergeStrategy,
+		arg.MergeCommitSha,
+		arg.MergedBaseSha,
+		arg.MergedHeadSha,
+		arg.ID,
+	)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.TaskID,
+		&i.Title,
+		&i.Description,
+		&i.SourceBranch,
+		&i.TargetBranch,
+		&i.Status,
+		&i.MergeStrategy,
+		&i.MergeCommitSha,
+		&i.MergedBaseSha,
+		&i.MergedHeadSha,
+		&i.MergedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const unlinkPullRequestsFromTask = `-- name: UnlinkPullRequestsFromTask :exec
+UPDATE pull_requests
+SET task_id = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE task_id = ?
+`
+
+func (q *Queries) UnlinkPullRequestsFromTask(ctx context.Context, taskID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, unlinkPullRequestsFromTask, taskID)
+	return err
+}
+
+const updatePullRequest = `-- name: UpdatePullRequest :one
+UPDATE pull_requests
+SET
+    title = ?,
+    description = ?,
+    target_branch = ?,
+    status = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, base_directory_id, task_id, title, description, source_branch, target_branch, status, merge_strategy, merge_commit_sha, merged_base_sha, merged_head_sha, merged_at, created_at, updated_at
+`
+
+type UpdatePullRequestParams struct {
+	Title        string `db:"title" json:"title"`
+	Description  string `db:"description" json:"description"`
+	TargetBranch string `db:"target_branch" json:"target_branch"`
+	Status       string `db:"status" json:"status"`
+	ID           int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdatePullRequest(ctx context.Context, arg UpdatePullRequestParams) (PullRequest, error) {
+	row := q.db.QueryRowContext(ctx, updatePullRequest,
+		arg.Title,
+		arg.Description,
+		arg.TargetBranch,
+		arg.Status,
+		arg.ID,
+	)
+	var i PullRequest
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.TaskID,
+		&i.Title,
+		&i.Description,
+		&i.SourceBranch,
+		&i.TargetBranch,
+		&i.Status,
+		&i.MergeStrategy,
+		&i.MergeCommitSha,
+		&i.MergedBaseSha,
+		&i.MergedHeadSha,
+		&i.MergedAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
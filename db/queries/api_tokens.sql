@@ -0,0 +1,28 @@
+-- name: CreateAPIToken :one
+INSERT INTO api_tokens (user_id, name, token_hash, token_prefix, scope, expires_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetAPIToken :one
+SELECT * FROM api_tokens
+WHERE id = ?;
+
+-- name: GetAPITokenByHash :one
+SELECT * FROM api_tokens
+WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP);
+
+-- name: ListAPITokensByUserID :many
+SELECT * FROM api_tokens
+WHERE user_id = ?
+ORDER BY created_at DESC, id DESC;
+
+-- name: TouchAPIToken :exec
+UPDATE api_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: DeleteAPIToken :exec
+DELETE FROM api_tokens WHERE id = ?;
+
+-- name: DeleteAPITokensByUserID :exec
+DELETE FROM api_tokens WHERE user_id = ?;
@@ -0,0 +1,9 @@
+-- name: GetAppSetting :one
+SELECT * FROM app_settings
+WHERE key = ?;
+
+-- name: SetAppSetting :one
+INSERT INTO app_settings (key, value)
+VALUES (?, ?)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+RETURNING *;
@@ -0,0 +1,21 @@
+-- name: CreateAuditLogEntry :one
+INSERT INTO audit_log (user_id, actor, api_token_id, action, resource, target_ids, summary, status, ip_address)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListAuditLogEntries :many
+SELECT * FROM audit_log
+WHERE (sqlc.narg(actor) IS NULL OR actor = sqlc.narg(actor))
+  AND (sqlc.narg(resource) IS NULL OR resource = sqlc.narg(resource))
+  AND (sqlc.narg(action) IS NULL OR action LIKE '%' || sqlc.narg(action) || '%')
+  AND (sqlc.narg(target_id) IS NULL OR EXISTS (SELECT 1 FROM json_each(audit_log.target_ids) WHERE json_each.value = sqlc.narg(target_id)))
+  AND (sqlc.narg(min_status) IS NULL OR status >= sqlc.narg(min_status))
+  AND (sqlc.narg(since) IS NULL OR created_at >= sqlc.narg(since))
+  AND (sqlc.narg(until) IS NULL OR created_at < sqlc.narg(until))
+  AND (sqlc.narg(before_id) IS NULL OR id < sqlc.narg(before_id))
+ORDER BY id DESC
+LIMIT sqlc.arg(max_entries);
+
+-- name: DeleteAuditLogEntriesOlderThan :execrows
+DELETE FROM audit_log
+WHERE created_at < datetime('now', '-' || CAST(sqlc.arg(days) AS INTEGER) || ' days');
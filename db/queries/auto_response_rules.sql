@@ -0,0 +1,47 @@
+-- name: CreateAutoResponseRule :one
+INSERT INTO auto_response_rules (
+    project_id,
+    name,
+    prompt_pattern,
+    subject_type,
+    list_mode,
+    subjects,
+    response_keys,
+    enabled
+)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetAutoResponseRule :one
+SELECT * FROM auto_response_rules
+WHERE id = ?;
+
+-- name: GetAutoResponseRulesByProjectID :many
+SELECT * FROM auto_response_rules
+WHERE project_id = ?
+ORDER BY id;
+
+-- name: GetEnabledAutoResponseRulesByProjectID :many
+SELECT * FROM auto_response_rules
+WHERE project_id = ? AND enabled = TRUE
+ORDER BY id;
+
+-- name: UpdateAutoResponseRule :one
+UPDATE auto_response_rules
+SET
+    name = ?,
+    prompt_pattern = ?,
+    subject_type = ?,
+    list_mode = ?,
+    subjects = ?,
+    response_keys = ?,
+    enabled = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteAutoResponseRule :exec
+DELETE FROM auto_response_rules WHERE id = ?;
+
+-- name: DeleteAutoResponseRulesByProjectID :exec
+DELETE FROM auto_response_rules WHERE project_id = ?;
@@ -0,0 +1,53 @@
+-- name: CreateEnvironmentVariable :one
+INSERT INTO environment_variables (
+    project_id,
+    base_directory_id,
+    agent_id,
+    name,
+    encrypted_value,
+    is_secret
+)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetEnvironmentVariable :one
+SELECT * FROM environment_variables
+WHERE id = ?;
+
+-- name: GetEnvironmentVariablesByProjectID :many
+SELECT * FROM environment_variables
+WHERE project_id = ?
+ORDER BY name, id;
+
+-- name: GetSecretEnvironmentVariables :many
+SELECT * FROM environment_variables
+WHERE is_secret = TRUE;
+
+-- name: UpdateEnvironmentVariable :one
+UPDATE environment_variables
+SET
+    base_directory_id = ?,
+    agent_id = ?,
+    name = ?,
+    encrypted_value = ?,
+    is_secret = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteEnvironmentVariable :exec
+DELETE FROM environment_variables WHERE id = ?;
+
+-- name: DeleteEnvironmentVariablesByProjectID :exec
+DELETE FROM environment_variables WHERE project_id = ?;
+
+-- name: DeleteEnvironmentVariablesByBaseDirectoryID :exec
+DELETE FROM environment_variables WHERE base_directory_id = ?;
+
+-- name: DeleteEnvironmentVariablesByAgentID :exec
+DELETE FROM environment_variables WHERE agent_id = ?;
+
+-- name: CountSealedSecrets :one
+SELECT
+    (SELECT COUNT(*) FROM environment_variables) +
+    (SELECT COUNT(*) FROM users WHERE totp_secret != '') AS count;
@@ -0,0 +1,22 @@
+-- name: CreateExecutionCheckpoint :one
+INSERT INTO execution_checkpoints (task_execution_id, sequence, ref_name, commit_sha, tree_sha, reason)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetExecutionCheckpoint :one
+SELECT * FROM execution_checkpoints
+WHERE task_execution_id = ? AND sequence = ?;
+
+-- name: GetExecutionCheckpointsByExecutionID :many
+SELECT * FROM execution_checkpoints
+WHERE task_execution_id = ?
+ORDER BY sequence;
+
+-- name: GetLatestExecutionCheckpoint :one
+SELECT * FROM execution_checkpoints
+WHERE task_execution_id = ?
+ORDER BY sequence DESC
+LIMIT 1;
+
+-- name: DeleteExecutionCheckpointsByExecutionID :exec
+DELETE FROM execution_checkpoints WHERE task_execution_id = ?;
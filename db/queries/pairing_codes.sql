@@ -0,0 +1,16 @@
+-- name: CreatePairingCode :one
+INSERT INTO pairing_codes (user_id, code_hash, expires_at)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: UsePairingCode :one
+UPDATE pairing_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE code_hash = ? AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeletePairingCodesByUserID :exec
+DELETE FROM pairing_codes WHERE user_id = ?;
+
+-- name: DeleteExpiredPairingCodes :execrows
+DELETE FROM pairing_codes WHERE expires_at <= CURRENT_TIMESTAMP OR used_at IS NOT NULL;
@@ -0,0 +1,72 @@
+-- name: CreatePullRequest :one
+INSERT INTO pull_requests (project_id, base_directory_id, task_id, title, description, source_branch, target_branch)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetPullRequest :one
+SELECT * FROM pull_requests
+WHERE id = ?;
+
+-- name: GetPullRequestsByProjectID :many
+SELECT * FROM pull_requests
+WHERE project_id = ?
+ORDER BY created_at DESC, id DESC;
+
+-- name: GetPullRequestsByTaskID :many
+SELECT * FROM pull_requests
+WHERE task_id = ?
+ORDER BY created_at DESC, id DESC;
+
+-- name: UpdatePullRequest :one
+UPDATE pull_requests
+SET
+    title = ?,
+    description = ?,
+    target_branch = ?,
+    status = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: MarkPullRequestMerged :one
+UPDATE pull_requests
+SET
+    status = 'merged',
+    merge_strategy = ?,
+    merge_commit_sha = ?,
+    merged_base_sha = ?,
+    merged_head_sha = ?,
+    merged_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: UnlinkPullRequestsFromTask :exec
+UPDATE pull_requests
+SET task_id = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE task_id = ?;
+
+-- name: DeletePullRequest :exec
+DELETE FROM pull_requests WHERE id = ?;
+
+-- name: DeletePullRequestsByBaseDirectoryID :exec
+DELETE FROM pull_requests WHERE base_directory_id = ?;
+
+-- name: AddPullRequestExecution :exec
+INSERT OR IGNORE INTO pull_request_executions (pull_request_id, task_execution_id)
+VALUES (?, ?);
+
+-- name: GetPullRequestExecutionIDs :many
+SELECT task_execution_id FROM pull_request_executions
+WHERE pull_request_id = ?
+ORDER BY task_execution_id;
+
+-- name: DeletePullRequestExecutions :exec
+DELETE FROM pull_request_executions WHERE pull_request_id = ?;
+
+-- name: DeletePullRequestExecutionsByExecutionID :exec
+DELETE FROM pull_request_executions WHERE task_execution_id = ?;
+
+-- name: DeletePullRequestExecutionsByBaseDirectoryID :exec
+DELETE FROM pull_request_executions
+WHERE pull_request_id IN (SELECT id FROM pull_requests WHERE base_directory_id = ?);
@@ -0,0 +1,32 @@
+-- name: GetResourceLimit :one
+SELECT * FROM resource_limits
+WHERE target_type = ? AND target_id = ?;
+
+-- name: UpsertResourceLimit :one
+INSERT INTO resource_limits (target_type, target_id, cpu_percent, memory_mb, pids_max)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (target_type, target_id) DO UPDATE SET
+    cpu_percent = excluded.cpu_percent,
+    memory_mb = excluded.memory_mb,
+    pids_max = excluded.pids_max,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING *;
+
+-- name: DeleteResourceLimit :exec
+DELETE FROM resource_limits
+WHERE target_type = ? AND target_id = ?;
+
+-- name: CreateResourceLimitEvent :one
+INSERT INTO resource_limit_events (target_type, target_id, cgroup, event_type, detail)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetRecentResourceLimitEvents :many
+SELECT * FROM resource_limit_events
+WHERE target_type = ? AND target_id = ?
+ORDER BY created_at DESC, id DESC
+LIMIT ?;
+
+-- name: DeleteResourceLimitEvents :exec
+DELETE FROM resource_limit_events
+WHERE target_type = ? AND target_id = ?;
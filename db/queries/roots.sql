@@ -1,6 +1,6 @@
 -- name: CreateRoot :one
-INSERT INTO roots (local_port, external_url)
-VALUES (?, ?)
+INSERT INTO roots (local_port, external_url, name)
+VALUES (?, ?, ?)
 RETURNING *;
 
 -- name: GetRoot :one
@@ -19,7 +19,7 @@ WHERE r.id = ?;
 
 -- name: UpdateRoot :one
 UPDATE roots
-SET local_port = ?, external_url = ?, updated_at = CURRENT_TIMESTAMP
+SET local_port = ?, external_url = ?, name = ?, updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
 RETURNING *;
 
@@ -28,4 +28,28 @@ DELETE FROM roots WHERE id = ?;
 
 -- name: ListRoots :many
 SELECT * FROM roots
-ORDER BY created_at DESC;
\ No newline at end of file
+ORDER BY id;
+
+-- name: CountProjectsByRootID :one
+SELECT COUNT(*) FROM projects
+WHERE root_id = ?;
+
+-- name: CountAgentsByRootID :one
+SELECT COUNT(*) FROM agents
+WHERE root_id = ?;
+
+-- name: GetRootSettings :many
+SELECT * FROM root_settings
+WHERE root_id = ?
+ORDER BY key;
+
+-- name: SetRootSetting :exec
+INSERT INTO root_settings (root_id, key, value)
+VALUES (?, ?, ?)
+ON CONFLICT (root_id, key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP;
+
+-- name: DeleteRootSetting :exec
+DELETE FROM root_settings WHERE root_id = ? AND key = ?;
+
+-- name: DeleteRootSettings :exec
+DELETE FROM root_settings WHERE root_id = ?;
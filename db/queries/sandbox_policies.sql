@@ -0,0 +1,39 @@
+-- name: GetSandboxPolicyByProjectID :one
+SELECT * FROM sandbox_policies
+WHERE project_id = ?;
+
+-- name: GetSandboxPolicyByAgentID :one
+SELECT * FROM sandbox_policies
+WHERE agent_id = ?;
+
+-- name: CreateSandboxPolicy :one
+INSERT INTO sandbox_policies (
+    project_id,
+    agent_id,
+    enabled,
+    allow_network,
+    readonly_paths,
+    writable_paths
+)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: UpdateSandboxPolicy :one
+UPDATE sandbox_policies
+SET
+    enabled = ?,
+    allow_network = ?,
+    readonly_paths = ?,
+    writable_paths = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteSandboxPolicy :exec
+DELETE FROM sandbox_policies WHERE id = ?;
+
+-- name: DeleteSandboxPolicyByProjectID :exec
+DELETE FROM sandbox_policies WHERE project_id = ?;
+
+-- name: DeleteSandboxPolicyByAgentID :exec
+DELETE FROM sandbox_policies WHERE agent_id = ?;
@@ -0,0 +1,19 @@
+-- name: CreateTaskAttachment :one
+INSERT INTO task_attachments (task_id, filename, content_type, size, storage_path)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetTaskAttachment :one
+SELECT * FROM task_attachments
+WHERE id = ?;
+
+-- name: GetTaskAttachmentsByTaskID :many
+SELECT * FROM task_attachments
+WHERE task_id = ?
+ORDER BY id;
+
+-- name: DeleteTaskAttachment :exec
+DELETE FROM task_attachments WHERE id = ?;
+
+-- name: DeleteTaskAttachmentsByTaskID :exec
+DELETE FROM task_attachments WHERE task_id = ?;
@@ -0,0 +1,32 @@
+-- name: CreateTaskComment :one
+INSERT INTO task_comments (task_id, task_execution_id, author_type, author, kind, body)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetTaskComment :one
+SELECT * FROM task_comments
+WHERE id = ?;
+
+-- name: GetTaskCommentsByTaskID :many
+SELECT * FROM task_comments
+WHERE task_id = ?
+ORDER BY created_at, id;
+
+-- name: GetTaskCommentsByExecutionID :many
+SELECT * FROM task_comments
+WHERE task_execution_id = ?
+ORDER BY created_at, id;
+
+-- name: UpdateTaskComment :one
+UPDATE task_comments
+SET
+    body = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteTaskComment :exec
+DELETE FROM task_comments WHERE id = ?;
+
+-- name: DeleteTaskCommentsByTaskID :exec
+DELETE FROM task_comments WHERE task_id = ?;
@@ -0,0 +1,16 @@
+-- name: CreateTaskExecutionEvent :one
+INSERT INTO task_execution_events (task_execution_id, event_type, message, detail, rule_id)
+VALUES (?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetTaskExecutionEvents :many
+SELECT * FROM task_execution_events
+WHERE task_execution_id = ?
+ORDER BY created_at, id;
+
+-- name: DeleteTaskExecutionEventsByExecutionID :exec
+DELETE FROM task_execution_events WHERE task_execution_id = ?;
+
+-- name: CountTaskExecutionEventsByType :one
+SELECT COUNT(*) FROM task_execution_events
+WHERE task_execution_id = ? AND event_type = ?;
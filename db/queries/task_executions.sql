@@ -1,6 +1,6 @@
 -- name: CreateTaskExecution :one
-INSERT INTO task_executions (task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id)
-VALUES (?, ?, ?, ?, ?)
+INSERT INTO task_executions (task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, started_by_user_id)
+VALUES (?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: GetTaskExecution :one
@@ -62,11 +62,13 @@ SELECT
     t.title as task_title,
     a.name as agent_name,
     p.id as project_id,
-    p.name as project_name
+    p.name as project_name,
+    u.name as started_by
 FROM task_executions te
 JOIN tasks t ON te.task_id = t.id
 JOIN agents a ON te.agent_id = a.id
 JOIN projects p ON t.project_id = p.id
+LEFT JOIN users u ON te.started_by_user_id = u.id
 ORDER BY te.created_at DESC;
 
 -- name: DeleteTaskExecution :exec
@@ -76,3 +78,27 @@ DELETE FROM task_executions WHERE id = ?;
 SELECT * FROM task_executions
 WHERE task_id = ?
 ORDER BY created_at;
+
+-- name: UpdateTaskExecutionSandbox :one
+UPDATE task_executions
+SET
+    sandbox = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdateTaskExecutionCheckpointInterval :one
+UPDATE task_executions
+SET
+    checkpoint_interval_minutes = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdateTaskExecutionAttachmentsDir :one
+UPDATE task_executions
+SET
+    attachments_dir = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
@@ -0,0 +1,21 @@
+-- name: AddTaskLabel :exec
+INSERT OR IGNORE INTO task_labels (task_id, label)
+VALUES (?, ?);
+
+-- name: GetTaskLabels :many
+SELECT label FROM task_labels
+WHERE task_id = ?
+ORDER BY label;
+
+-- name: GetTaskLabelsByProjectID :many
+SELECT tl.task_id, tl.label FROM task_labels tl
+JOIN tasks t ON t.id = tl.task_id
+WHERE t.project_id = ?
+ORDER BY tl.task_id, tl.label;
+
+-- name: GetAllTaskLabels :many
+SELECT task_id, label FROM task_labels
+ORDER BY task_id, label;
+
+-- name: DeleteTaskLabels :exec
+DELETE FROM task_labels WHERE task_id = ?;
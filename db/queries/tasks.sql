@@ -10,7 +10,16 @@ WHERE id = ?;
 -- name: GetTasksByProjectID :many
 SELECT * FROM tasks
 WHERE project_id = ?
-ORDER BY title;
+ORDER BY sort_order, id;
+
+-- name: GetTasksByProjectAndStatus :many
+SELECT * FROM tasks
+WHERE project_id = ? AND status = ?
+ORDER BY sort_order, id;
+
+-- name: CountTasksByProjectAndStatus :one
+SELECT COUNT(*) FROM tasks
+WHERE project_id = ? AND status = ?;
 
 -- name: GetTaskWithBaseDirectory :one
 SELECT
@@ -42,3 +51,54 @@ DELETE FROM tasks WHERE id = ?;
 SELECT * FROM tasks
 WHERE base_directory_id = ?
 ORDER BY created_at DESC;
+
+-- name: UpdateTaskPosition :one
+UPDATE tasks
+SET
+    status = ?,
+    sort_order = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdateTaskStatusByProjectAndStatus :exec
+UPDATE tasks
+SET
+    status = sqlc.arg(new_status),
+    updated_at = CURRENT_TIMESTAMP
+WHERE project_id = sqlc.arg(project_id) AND status = sqlc.arg(old_status);
+
+-- name: UpdateTaskMetadata :one
+UPDATE tasks
+SET
+    priority = ?,
+    preferred_agent_id = ?,
+    due_date = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: GetTaskByExternalID :one
+SELECT * FROM tasks
+WHERE project_id = ? AND external_id = ?;
+
+-- name: SetTaskExternalID :one
+UPDATE tasks SET external_id = ? WHERE id = ?
+RETURNING *;
+
+-- name: ClearPreferredAgent :exec
+UPDATE tasks SET preferred_agent_id = NULL WHERE preferred_agent_id = ?;
+
+-- Filters left NULL match every task; labels, ordering and paging are applied by the caller
+-- name: SearchTasks :many
+SELECT * FROM tasks
+WHERE (sqlc.narg(project_id) IS NULL OR project_id = sqlc.narg(project_id))
+  AND (sqlc.narg(root_id) IS NULL OR project_id IN (SELECT id FROM projects WHERE root_id = sqlc.narg(root_id)))
+  AND (sqlc.narg(status) IS NULL OR status = sqlc.narg(status))
+  AND (sqlc.narg(base_directory_id) IS NULL OR base_directory_id = sqlc.narg(base_directory_id))
+  AND (sqlc.narg(min_priority) IS NULL OR priority >= sqlc.narg(min_priority))
+  AND (sqlc.narg(preferred_agent_id) IS NULL OR preferred_agent_id = sqlc.narg(preferred_agent_id))
+  AND (sqlc.narg(due_before) IS NULL OR (due_date != '' AND due_date <= sqlc.narg(due_before)))
+  AND (sqlc.narg(due_after) IS NULL OR (due_date != '' AND due_date >= sqlc.narg(due_after)))
+  AND (sqlc.narg(text) IS NULL OR title LIKE '%' || sqlc.narg(text) || '%' OR description LIKE '%' || sqlc.narg(text) || '%')
+ORDER BY id;
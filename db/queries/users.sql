@@ -0,0 +1,76 @@
+-- name: CreateUser :one
+INSERT INTO users (name, display_name, role, webauthn_handle)
+VALUES (?, ?, ?, ?)
+RETURNING *;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = ?;
+
+-- name: GetUserByName :one
+SELECT * FROM users
+WHERE name = ?;
+
+-- name: GetUserByWebAuthnHandle :one
+SELECT * FROM users
+WHERE webauthn_handle = ?;
+
+-- name: GetUserByInviteTokenHash :one
+SELECT * FROM users
+WHERE invite_token_hash = ? AND invite_expires_at > CURRENT_TIMESTAMP;
+
+-- name: ListUsers :many
+SELECT * FROM users
+ORDER BY id;
+
+-- name: CountUsers :one
+SELECT COUNT(*) FROM users;
+
+-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = ?;
+
+-- name: GetFirstAdmin :one
+SELECT * FROM users
+WHERE role = 'admin'
+ORDER BY id
+LIMIT 1;
+
+-- name: UpdateUser :one
+UPDATE users
+SET display_name = ?, role = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: SetUserInvite :exec
+UPDATE users
+SET invite_token_hash = ?, invite_expires_at = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: ClearUserInvite :exec
+UPDATE users
+SET invite_token_hash = NULL, invite_expires_at = NULL
+WHERE id = ?;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = ?;
+
+-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = ?, totp_enabled_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = sqlc.arg(step)
+WHERE id = sqlc.arg(id) AND totp_last_step < sqlc.arg(step);
+
+-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
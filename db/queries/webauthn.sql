@@ -1,6 +1,6 @@
 -- name: CreateWebAuthnCredential :one
-INSERT INTO webauthn_credentials (id, rp_id, public_key, attestation_type, transport, aaguid, sign_count)
-VALUES (?, ?, ?, ?, ?, ?, ?)
+INSERT INTO webauthn_credentials (id, rp_id, user_id, name, public_key, attestation_type, transport, aaguid, sign_count)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 RETURNING *;
 
 -- name: GetWebAuthnCredential :one
@@ -16,9 +16,27 @@ SELECT * FROM webauthn_credentials
 WHERE rp_id = ?
 ORDER BY created_at;
 
+-- name: ListWebAuthnCredentialsByUserID :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = ? AND rp_id = ?
+ORDER BY created_at;
+
+-- name: ListWebAuthnCredentialsByUser :many
+SELECT * FROM webauthn_credentials
+WHERE user_id = ?
+ORDER BY rp_id, created_at;
+
+-- name: RenameWebAuthnCredential :exec
+UPDATE webauthn_credentials
+SET name = ?
+WHERE id = ?;
+
+-- name: DeleteWebAuthnCredentialsByUserID :exec
+DELETE FROM webauthn_credentials WHERE user_id = ?;
+
 -- name: UpdateWebAuthnCredentialSignCount :exec
 UPDATE webauthn_credentials
-SET sign_count = ?
+SET sign_count = ?, last_used_at = CURRENT_TIMESTAMP
 WHERE id = ?;
 
 -- name: DeleteWebAuthnCredential :exec
@@ -32,16 +50,36 @@ SELECT COUNT(*) FROM webauthn_credentials
 WHERE rp_id = ?;
 
 -- name: CreateSession :one
-INSERT INTO sessions (token, expires_at)
-VALUES (?, ?)
+INSERT INTO sessions (token, user_id, public_id, user_agent, ip_address, expires_at, last_seen_at)
+VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
 RETURNING *;
 
 -- name: GetSession :one
 SELECT * FROM sessions
 WHERE token = ? AND expires_at > CURRENT_TIMESTAMP;
 
+-- name: ListSessionsByUserID :many
+SELECT * FROM sessions
+WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
+ORDER BY last_seen_at DESC;
+
+-- name: TouchSession :exec
+-- Recorded at most once a minute, so every request doesn't write
+UPDATE sessions
+SET last_seen_at = CURRENT_TIMESTAMP, ip_address = ?
+WHERE token = ? AND (last_seen_at IS NULL OR last_seen_at < datetime('now', '-1 minute'));
+
+-- name: DeleteSessionByPublicID :exec
+DELETE FROM sessions WHERE user_id = ? AND public_id = ?;
+
+-- name: DeleteOtherSessions :exec
+DELETE FROM sessions WHERE user_id = ? AND token != ?;
+
 -- name: DeleteSession :exec
 DELETE FROM sessions WHERE token = ?;
 
--- name: DeleteExpiredSessions :exec
+-- name: DeleteSessionsByUserID :exec
+DELETE FROM sessions WHERE user_id = ?;
+
+-- name: DeleteExpiredSessions :execrows
 DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP;
@@ -0,0 +1,25 @@
+-- name: GetWorkflowColumnsByProjectID :many
+SELECT * FROM workflow_columns
+WHERE project_id = ?
+ORDER BY position;
+
+-- name: CreateWorkflowColumn :one
+INSERT INTO workflow_columns (project_id, status_key, name, position, wip_limit, color)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: DeleteWorkflowColumnsByProjectID :exec
+DELETE FROM workflow_columns WHERE project_id = ?;
+
+-- name: GetWorkflowRulesByProjectID :many
+SELECT * FROM workflow_rules
+WHERE project_id = ?
+ORDER BY id;
+
+-- name: CreateWorkflowRule :one
+INSERT INTO workflow_rules (project_id, event, target_status)
+VALUES (?, ?, ?)
+RETURNING *;
+
+-- name: DeleteWorkflowRulesByProjectID :exec
+DELETE FROM workflow_rules WHERE project_id = ?;
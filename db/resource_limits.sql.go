@@ -0,0 +1,186 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: resource_limits.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createResourceLimitEvent = `-- name: CreateResourceLimitEvent :one
+INSERT INTO resource_limit_events (target_type, target_id, cgroup, event_type, detail)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, target_type, target_id, cgroup, event_type, detail, created_at
+`
+
+type CreateResourceLimitEventParams struct {
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   int64  `db:"target_id" json:"target_id"`
+	Cgroup     string `db:"cgroup" json:"cgroup"`
+	EventType  string `db:"event_type" json:"event_type"`
+	Detail     string `db:"detail" json:"detail"`
+}
+
+func (q *Queries) CreateResourceLimitEvent(ctx context.Context, arg CreateResourceLimitEventParams) (ResourceLimitEvent, error) {
+	row := q.db.QueryRowContext(ctx, createResourceLimitEvent,
+		arg.TargetType,
+		arg.TargetID,
+		arg.Cgroup,
+		arg.EventType,
+		arg.Detail,
+	)
+	var i ResourceLimitEvent
+	err := row.Scan(
+		&i.ID,
+		&i.TargetType,
+		&i.TargetID,
+		&i.Cgroup,
+		&i.EventType,
+		&i.Detail,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteResourceLimit = `-- name: DeleteResourceLimit :exec
+DELETE FROM resource_limits
+WHERE target_type = ? AND target_id = ?
+`
+
+type DeleteResourceLimitParams struct {
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   int64  `db:"target_id" json:"target_id"`
+}
+
+func (q *Queries) DeleteResourceLimit(ctx context.Context, arg DeleteResourceLimitParams) error {
+	_, err := q.db.ExecContext(ctx, deleteResourceLimit, arg.TargetType, arg.TargetID)
+	return err
+}
+
+const deleteResourceLimitEvents = `-- name: DeleteResourceLimitEvents :exec
+DELETE FROM resource_limit_events
+WHERE target_type = ? AND target_id = ?
+`
+
+type DeleteResourceLimitEventsParams struct {
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   int64  `db:"target_id" json:"target_id"`
+}
+
+func (q *Queries) DeleteResourceLimitEvents(ctx context.Context, arg DeleteResourceLimitEventsParams) error {
+	_, err := q.db.ExecContext(ctx, deleteResourceLimitEvents, arg.TargetType, arg.TargetID)
+	return err
+}
+
+const getRecentResourceLimitEvents = `-- name: GetRecentResourceLimitEvents :many
+SELECT id, target_type, target_id, cgroup, event_type, detail, created_at FROM resource_limit_events
+WHERE target_type = ? AND target_id = ?
+ORDER BY created_at DESC, id DESC
+LIMIT ?
+`
+
+type GetRecentResourceLimitEventsParams struct {
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   int64  `db:"target_id" json:"target_id"`
+	Limit      int64  `db:"limit" json:"limit"`
+}
+
+func (q *Queries) GetRecentResourceLimitEvents(ctx context.Context, arg GetRecentResourceLimitEventsParams) ([]ResourceLimitEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentResourceLimitEvents, arg.TargetType, arg.TargetID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ResourceLimitEvent
+	for rows.Next() {
+		var i ResourceLimitEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.TargetType,
+			&i.TargetID,
+			&i.Cgroup,
+			&i.EventType,
+			&i.Detail,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getResourceLimit = `-- name: GetResourceLimit :one
+SELECT id, target_type, target_id, cpu_percent, memory_mb, pids_max, created_at, updated_at FROM resource_limits
+WHERE target_type = ? AND target_id = ?
+`
+
+type GetResourceLimitParams struct {
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   int64  `db:"target_id" json:"target_id"`
+}
+
+func (q *Queries) GetResourceLimit(ctx context.Context, arg GetResourceLimitParams) (ResourceLimit, error) {
+	row := q.db.QueryRowContext(ctx, getResourceLimit, arg.TargetType, arg.TargetID)
+	var i ResourceLimit
+	err := row.Scan(
+		&i.ID,
+		&i.TargetType,
+		&i.TargetID,
+		&i.CpuPercent,
+		&i.MemoryMb,
+		&i.PidsMax,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const upsertResourceLimit = `-- name: UpsertResourceLimit :one
+INSERT INTO resource_limits (target_type, target_id, cpu_percent, memory_mb, pids_max)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (target_type, target_id) DO UPDATE SET
+    cpu_percent = excluded.cpu_percent,
+    memory_mb = excluded.memory_mb,
+    pids_max = excluded.pids_max,
+    updated_at = CURRENT_TIMESTAMP
+RETURNING id, target_type, target_id, cpu_percent, memory_mb, pids_max, created_at, updated_at
+`
+
+type UpsertResourceLimitParams struct {
+	TargetType string `db:"target_type" json:"target_type"`
+	TargetID   int64  `db:"target_id" json:"target_id"`
+	CpuPercent int64  `db:"cpu_percent" json:"cpu_percent"`
+	MemoryMb   int64  `db:"memory_mb" json:"memory_mb"`
+	PidsMax    int64  `db:"pids_max" json:"pids_max"`
+}
+
+func (q *Queries) UpsertResourceLimit(ctx context.Context, arg UpsertResourceLimitParams) (ResourceLimit, error) {
+	row := q.db.QueryRowContext(ctx, upsertResourceLimit,
+		arg.TargetType,
+		arg.TargetID,
+		arg.CpuPercent,
+		arg.MemoryMb,
+		arg.PidsMax,
+	)
+	var i ResourceLimit
+	err := row.Scan(
+		&i.ID,
+		&i.TargetType,
+		&i.TargetID,
+		&i.CpuPercent,
+		&i.MemoryMb,
+		&i.PidsMax,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
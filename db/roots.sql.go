@@ -10,19 +10,44 @@ import (
 	"database/sql"
 )
 
+const countAgentsByRootID = `-- name: CountAgentsByRootID :one
+SELECT COUNT(*) FROM agents
+WHERE root_id = ?
+`
+
+func (q *Queries) CountAgentsByRootID(ctx context.Context, rootID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countAgentsByRootID, rootID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countProjectsByRootID = `-- name: CountProjectsByRootID :one
+SELECT COUNT(*) FROM projects
+WHERE root_id = ?
+`
+
+func (q *Queries) CountProjectsByRootID(ctx context.Context, rootID int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countProjectsByRootID, rootID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createRoot = `-- name: CreateRoot :one
-INSERT INTO roots (local_port, external_url)
-VALUES (?, ?)
-RETURNING id, local_port, external_url, created_at, updated_at
+INSERT INTO roots (local_port, external_url, name)
+VALUES (?, ?, ?)
+RETURNING id, local_port, external_url, created_at, updated_at, name
 `
 
 type CreateRootParams struct {
 	LocalPort   string         `db:"local_port" json:"local_port"`
 	ExternalUrl sql.NullString `db:"external_url" json:"external_url"`
+	Name        string         `db:"name" json:"name"`
 }
 
 func (q *Queries) CreateRoot(ctx context.Context, arg CreateRootParams) (Root, error) {
-	row := q.db.QueryRowContext(ctx, createRoot, arg.LocalPort, arg.ExternalUrl)
+	row := q.db.QueryRowContext(ctx, createRoot, arg.LocalPort, arg.ExternalUrl, arg.Name)
 	var i Root
 	err := row.Scan(
 		&i.ID,
@@ -30,6 +55,7 @@ func (q *Queries) CreateRoot(ctx context.Context, arg CreateRootParams) (Root, e
 		&i.ExternalUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Name,
 	)
 	return i, err
 }
@@ -43,8 +69,31 @@ func (q *Queries) DeleteRoot(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteRootSetting = `-- name: DeleteRootSetting :exec
+DELETE FROM root_settings WHERE root_id = ? AND key = ?
+`
+
+type DeleteRootSettingParams struct {
+	RootID int64  `db:"root_id" json:"root_id"`
+	Key    string `db:"key" json:"key"`
+}
+
+func (q *Queries) DeleteRootSetting(ctx context.Context, arg DeleteRootSettingParams) error {
+	_, err := q.db.ExecContext(ctx, deleteRootSetting, arg.RootID, arg.Key)
+	return err
+}
+
+const deleteRootSettings = `-- name: DeleteRootSettings :exec
+DELETE FROM root_settings WHERE root_id = ?
+`
+
+func (q *Queries) DeleteRootSettings(ctx context.Context, rootID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteRootSettings, rootID)
+	return err
+}
+
 const getRoot = `-- name: GetRoot :one
-SELECT id, local_port, external_url, created_at, updated_at FROM roots
+SELECT id, local_port, external_url, created_at, updated_at, name FROM roots
 WHERE id = ?
 `
 
@@ -57,10 +106,45 @@ func (q *Queries) GetRoot(ctx context.Context, id int64) (Root, error) {
 		&i.ExternalUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Name,
 	)
 	return i, err
 }
 
+const getRootSettings = `-- name: GetRootSettings :many
+SELECT root_id, "key", value, updated_at FROM root_settings
+WHERE root_id = ?
+ORDER BY key
+`
+
+func (q *Queries) GetRootSettings(ctx context.Context, rootID int64) ([]RootSetting, error) {
+	rows, err := q.db.QueryContext(ctx, getRootSettings, rootID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RootSetting
+	for rows.Next() {
+		var i RootSetting
+		if err := rows.Scan(
+			&i.RootID,
+			&i.Key,
+			&i.Value,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getRootWithAgentsAndProjects = `-- name: GetRootWithAgentsAndProjects :one
 SELECT 
     r.id,
@@ -72,9 +156,17 @@ FROM roots r
 WHERE r.id = ?
 `
 
-func (q *Queries) GetRootWithAgentsAndProjects(ctx context.Context, id int64) (Root, error) {
+type GetRootWithAgentsAndProjectsRow struct {
+	ID          int64          `db:"id" json:"id"`
+	LocalPort   string         `db:"local_port" json:"local_port"`
+	ExternalUrl sql.NullString `db:"external_url" json:"external_url"`
+	CreatedAt   sql.NullTime   `db:"created_at" json:"created_at"`
+	UpdatedAt   sql.NullTime   `db:"updated_at" json:"updated_at"`
+}
+
+func (q *Queries) GetRootWithAgentsAndProjects(ctx context.Context, id int64) (GetRootWithAgentsAndProjectsRow, error) {
 	row := q.db.QueryRowContext(ctx, getRootWithAgentsAndProjects, id)
-	var i Root
+	var i GetRootWithAgentsAndProjectsRow
 	err := row.Scan(
 		&i.ID,
 		&i.LocalPort,
@@ -86,8 +178,8 @@ func (q *Queries) GetRootWithAgentsAndProjects(ctx context.Context, id int64) (R
 }
 
 const listRoots = `-- name: ListRoots :many
-SELECT id, local_port, external_url, created_at, updated_at FROM roots
-ORDER BY created_at DESC
+SELECT id, local_port, external_url, created_at, updated_at, name FROM roots
+ORDER BY id
 `
 
 func (q *Queries) ListRoots(ctx context.Context) ([]Root, error) {
@@ -105,6 +197,7 @@ func (q *Queries) ListRoots(ctx context.Context) ([]Root, error) {
 			&i.ExternalUrl,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Name,
 		); err != nil {
 			return nil, err
 		}
@@ -119,21 +212,44 @@ func (q *Queries) ListRoots(ctx context.Context) ([]Root, error) {
 	return items, nil
 }
 
+const setRootSetting = `-- name: SetRootSetting :exec
+INSERT INTO root_settings (root_id, key, value)
+VALUES (?, ?, ?)
+ON CONFLICT (root_id, key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+`
+
+type SetRootSettingParams struct {
+	RootID int64  `db:"root_id" json:"root_id"`
+	Key    string `db:"key" json:"key"`
+	Value  string `db:"value" json:"value"`
+}
+
+func (q *Queries) SetRootSetting(ctx context.Context, arg SetRootSettingParams) error {
+	_, err := q.db.ExecContext(ctx, setRootSetting, arg.RootID, arg.Key, arg.Value)
+	return err
+}
+
 const updateRoot = `-- name: UpdateRoot :one
 UPDATE roots
-SET local_port = ?, external_url = ?, updated_at = CURRENT_TIMESTAMP
+SET local_port = ?, external_url = ?, name = ?, updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, local_port, external_url, created_at, updated_at
+RETURNING id, local_port, external_url, created_at, updated_at, name
 `
 
 type UpdateRootParams struct {
 	LocalPort   string         `db:"local_port" json:"local_port"`
 	ExternalUrl sql.NullString `db:"external_url" json:"external_url"`
+	Name        string         `db:"name" json:"name"`
 	ID          int64          `db:"id" json:"id"`
 }
 
 func (q *Queries) UpdateRoot(ctx context.Context, arg UpdateRootParams) (Root, error) {
-	row := q.db.QueryRowContext(ctx, updateRoot, arg.LocalPort, arg.ExternalUrl, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateRoot,
+		arg.LocalPort,
+		arg.ExternalUrl,
+		arg.Name,
+		arg.ID,
+	)
 	var i Root
 	err := row.Scan(
 		&i.ID,
@@ -141,6 +257,7 @@ func (q *Queries) UpdateRoot(ctx context.Context, arg UpdateRootParams) (Root, e
 		&i.ExternalUrl,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Name,
 	)
 	return i, err
 }
@@ -0,0 +1,171 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: sandbox_policies.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createSandboxPolicy = `-- name: CreateSandboxPolicy :one
+INSERT INTO sandbox_policies (
+    project_id,
+    agent_id,
+    enabled,
+    allow_network,
+    readonly_paths,
+    writable_paths
+)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, project_id, agent_id, enabled, allow_network, readonly_paths, writable_paths, created_at, updated_at
+`
+
+type CreateSandboxPolicyParams struct {
+	ProjectID     sql.NullInt64 `db:"project_id" json:"project_id"`
+	AgentID       sql.NullInt64 `db:"agent_id" json:"agent_id"`
+	Enabled       bool          `db:"enabled" json:"enabled"`
+	AllowNetwork  bool          `db:"allow_network" json:"allow_network"`
+	ReadonlyPaths string        `db:"readonly_paths" json:"readonly_paths"`
+	WritablePaths string        `db:"writable_paths" json:"writable_paths"`
+}
+
+func (q *Queries) CreateSandboxPolicy(ctx context.Context, arg CreateSandboxPolicyParams) (SandboxPolicy, error) {
+	row := q.db.QueryRowContext(ctx, createSandboxPolicy,
+		arg.ProjectID,
+		arg.AgentID,
+		arg.Enabled,
+		arg.AllowNetwork,
+		arg.ReadonlyPaths,
+		arg.WritablePaths,
+	)
+	var i SandboxPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.AgentID,
+		&i.Enabled,
+		&i.AllowNetwork,
+		&i.ReadonlyPaths,
+		&i.WritablePaths,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteSandboxPolicy = `-- name: DeleteSandboxPolicy :exec
+DELETE FROM sandbox_policies WHERE id = ?
+`
+
+func (q *Queries) DeleteSandboxPolicy(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteSandboxPolicy, id)
+	return err
+}
+
+const deleteSandboxPolicyByAgentID = `-- name: DeleteSandboxPolicyByAgentID :exec
+DELETE FROM sandbox_policies WHERE agent_id = ?
+`
+
+func (q *Queries) DeleteSandboxPolicyByAgentID(ctx context.Context, agentID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteSandboxPolicyByAgentID, agentID)
+	return err
+}
+
+const deleteSandboxPolicyByProjectID = `-- name: DeleteSandboxPolicyByProjectID :exec
+DELETE FROM sandbox_policies WHERE project_id = ?
+`
+
+func (q *Queries) DeleteSandboxPolicyByProjectID(ctx context.Context, projectID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, deleteSandboxPolicyByProjectID, projectID)
+	return err
+}
+
+const getSandboxPolicyByAgentID = `-- name: GetSandboxPolicyByAgentID :one
+SELECT id, project_id, agent_id, enabled, allow_network, readonly_paths, writable_paths, created_at, updated_at FROM sandbox_policies
+WHERE agent_id = ?
+`
+
+func (q *Queries) GetSandboxPolicyByAgentID(ctx context.Context, agentID sql.NullInt64) (SandboxPolicy, error) {
+	row := q.db.QueryRowContext(ctx, getSandboxPolicyByAgentID, agentID)
+	var i SandboxPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.AgentID,
+		&i.Enabled,
+		&i.AllowNetwork,
+		&i.ReadonlyPaths,
+		&i.WritablePaths,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getSandboxPolicyByProjectID = `-- name: GetSandboxPolicyByProjectID :one
+SELECT id, project_id, agent_id, enabled, allow_network, readonly_paths, writable_paths, created_at, updated_at FROM sandbox_policies
+WHERE project_id = ?
+`
+
+func (q *Queries) GetSandboxPolicyByProjectID(ctx context.Context, projectID sql.NullInt64) (SandboxPolicy, error) {
+	row := q.db.QueryRowContext(ctx, getSandboxPolicyByProjectID, projectID)
+	var i SandboxPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.AgentID,
+		&i.Enabled,
+		&i.AllowNetwork,
+		&i.ReadonlyPaths,
+		&i.WritablePaths,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateSandboxPolicy = `-- name: UpdateSandboxPolicy :one
+UPDATE sandbox_policies
+SET
+    enabled = ?,
+    allow_network = ?,
+    readonly_paths = ?,
+    writable_paths = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, agent_id, enabled, allow_network, readonly_paths, writable_paths, created_at, updated_at
+`
+
+type UpdateSandboxPolicyParams struct {
+	Enabled       bool   `db:"enabled" json:"enabled"`
+	AllowNetwork  bool   `db:"allow_network" json:"allow_network"`
+	ReadonlyPaths string `db:"readonly_paths" json:"readonly_paths"`
+	WritablePaths string `db:"writable_paths" json:"writable_paths"`
+	ID            int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateSandboxPolicy(ctx context.Context, arg UpdateSandboxPolicyParams) (SandboxPolicy, error) {
+	row := q.db.QueryRowContext(ctx, updateSandboxPolicy,
+		arg.Enabled,
+		arg.AllowNetwork,
+		arg.ReadonlyPaths,
+		arg.WritablePaths,
+		arg.ID,
+	)
+	var i SandboxPolicy
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.AgentID,
+		&i.Enabled,
+		&i.AllowNetwork,
+		&i.ReadonlyPaths,
+		&i.WritablePaths,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
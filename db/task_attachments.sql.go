@@ -0,0 +1,120 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: task_attachments.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createTaskAttachment = `-- name: CreateTaskAttachment :one
+INSERT INTO task_attachments (task_id, filename, content_type, size, storage_path)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, task_id, filename, content_type, size, storage_path, created_at
+`
+
+type CreateTaskAttachmentParams struct {
+	TaskID      int64  `db:"task_id" json:"task_id"`
+	Filename    string `db:"filename" json:"filename"`
+	ContentType string `db:"content_type" json:"content_type"`
+	Size        int64  `db:"size" json:"size"`
+	StoragePath string `db:"storage_path" json:"storage_path"`
+}
+
+func (q *Queries) CreateTaskAttachment(ctx context.Context, arg CreateTaskAttachmentParams) (TaskAttachment, error) {
+	row := q.db.QueryRowContext(ctx, createTaskAttachment,
+		arg.TaskID,
+		arg.Filename,
+		arg.ContentType,
+		arg.Size,
+		arg.StoragePath,
+	)
+	var i TaskAttachment
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.Filename,
+		&i.ContentType,
+		&i.Size,
+		&i.StoragePath,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteTaskAttachment = `-- name: DeleteTaskAttachment :exec
+DELETE FROM task_attachments WHERE id = ?
+`
+
+func (q *Queries) DeleteTaskAttachment(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskAttachment, id)
+	return err
+}
+
+const deleteTaskAttachmentsByTaskID = `-- name: DeleteTaskAttachmentsByTaskID :exec
+DELETE FROM task_attachments WHERE task_id = ?
+`
+
+func (q *Queries) DeleteTaskAttachmentsByTaskID(ctx context.Context, taskID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskAttachmentsByTaskID, taskID)
+	return err
+}
+
+const getTaskAttachment = `-- name: GetTaskAttachment :one
+SELECT id, task_id, filename, content_type, size, storage_path, created_at FROM task_attachments
+WHERE id = ?
+`
+
+func (q *Queries) GetTaskAttachment(ctx context.Context, id int64) (TaskAttachment, error) {
+	row := q.db.QueryRowContext(ctx, getTaskAttachment, id)
+	var i TaskAttachment
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.Filename,
+		&i.ContentType,
+		&i.Size,
+		&i.StoragePath,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getTaskAttachmentsByTaskID = `-- name: GetTaskAttachmentsByTaskID :many
+SELECT id, task_id, filename, content_type, size, storage_path, created_at FROM task_attachments
+WHERE task_id = ?
+ORDER BY id
+`
+
+func (q *Queries) GetTaskAttachmentsByTaskID(ctx context.Context, taskID int64) ([]TaskAttachment, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskAttachmentsByTaskID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskAttachment
+	for rows.Next() {
+		var i TaskAttachment
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.Filename,
+			&i.ContentType,
+			&i.Size,
+			&i.StoragePath,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,199 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: task_comments.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const createTaskComment = `-- name: CreateTaskComment :one
+INSERT INTO task_comments (task_id, task_execution_id, author_type, author, kind, body)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, task_id, task_execution_id, author_type, author, kind, body, created_at, updated_at
+`
+
+type CreateTaskCommentParams struct {
+	TaskID          int64         `db:"task_id" json:"task_id"`
+	TaskExecutionID sql.NullInt64 `db:"task_execution_id" json:"task_execution_id"`
+	AuthorType      string        `db:"author_type" json:"author_type"`
+	Author          string        `db:"author" json:"author"`
+	Kind            string        `db:"kind" json:"kind"`
+	Body            string        `db:"body" json:"body"`
+}
+
+func (q *Queries) CreateTaskComment(ctx context.Context, arg CreateTaskCommentParams) (TaskComment, error) {
+	row := q.db.QueryRowContext(ctx, createTaskComment,
+		arg.TaskID,
+		arg.TaskExecutionID,
+		arg.AuthorType,
+		arg.Author,
+		arg.Kind,
+		arg.Body,
+	)
+	var i TaskComment
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.TaskExecutionID,
+		&i.AuthorType,
+		&i.Author,
+		&i.Kind,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const deleteTaskComment = `-- name: DeleteTaskComment :exec
+DELETE FROM task_comments WHERE id = ?
+`
+
+func (q *Queries) DeleteTaskComment(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskComment, id)
+	return err
+}
+
+const deleteTaskCommentsByTaskID = `-- name: DeleteTaskCommentsByTaskID :exec
+DELETE FROM task_comments WHERE task_id = ?
+`
+
+func (q *Queries) DeleteTaskCommentsByTaskID(ctx context.Context, taskID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskCommentsByTaskID, taskID)
+	return err
+}
+
+const getTaskComment = `-- name: GetTaskComment :one
+SELECT id, task_id, task_execution_id, author_type, author, kind, body, created_at, updated_at FROM task_comments
+WHERE id = ?
+`
+
+func (q *Queries) GetTaskComment(ctx context.Context, id int64) (TaskComment, error) {
+	row := q.db.QueryRowContext(ctx, getTaskComment, id)
+	var i TaskComment
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.TaskExecutionID,
+		&i.AuthorType,
+		&i.Author,
+		&i.Kind,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getTaskCommentsByExecutionID = `-- name: GetTaskCommentsByExecutionID :many
+SELECT id, task_id, task_execution_id, author_type, author, kind, body, created_at, updated_at FROM task_comments
+WHERE task_execution_id = ?
+ORDER BY created_at, id
+`
+
+func (q *Queries) GetTaskCommentsByExecutionID(ctx context.Context, taskExecutionID sql.NullInt64) ([]TaskComment, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskCommentsByExecutionID, taskExecutionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskComment
+	for rows.Next() {
+		var i TaskComment
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.TaskExecutionID,
+			&i.AuthorType,
+			&i.Author,
+			&i.Kind,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTaskCommentsByTaskID = `-- name: GetTaskCommentsByTaskID :many
+SELECT id, task_id, task_execution_id, author_type, author, kind, body, created_at, updated_at FROM task_comments
+WHERE task_id = ?
+ORDER BY created_at, id
+`
+
+func (q *Queries) GetTaskCommentsByTaskID(ctx context.Context, taskID int64) ([]TaskComment, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskCommentsByTaskID, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskComment
+	for rows.Next() {
+		var i TaskComment
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.TaskExecutionID,
+			&i.AuthorType,
+			&i.Author,
+			&i.Kind,
+			&i.Body,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateTaskComment = `-- name: UpdateTaskComment :one
+UPDATE task_comments
+SET
+    body = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, task_id, task_execution_id, author_type, author, kind, body, created_at, updated_at
+`
+
+type UpdateTaskCommentParams struct {
+	Body string `db:"body" json:"body"`
+	ID   int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateTaskComment(ctx context.Context, arg UpdateTaskCommentParams) (TaskComment, error) {
+	row := q.db.QueryRowContext(ctx, updateTaskComment, arg.Body, arg.ID)
+	var i TaskComment
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.TaskExecutionID,
+		&i.AuthorType,
+		&i.Author,
+		&i.Kind,
+		&i.Body,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
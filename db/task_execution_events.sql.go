@@ -0,0 +1,109 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: task_execution_events.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const countTaskExecutionEventsByType = `-- name: CountTaskExecutionEventsByType :one
+SELECT COUNT(*) FROM task_execution_events
+WHERE task_execution_id = ? AND event_type = ?
+`
+
+type CountTaskExecutionEventsByTypeParams struct {
+	TaskExecutionID int64  `db:"task_execution_id" json:"task_execution_id"`
+	EventType       string `db:"event_type" json:"event_type"`
+}
+
+func (q *Queries) CountTaskExecutionEventsByType(ctx context.Context, arg CountTaskExecutionEventsByTypeParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTaskExecutionEventsByType, arg.TaskExecutionID, arg.EventType)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createTaskExecutionEvent = `-- name: CreateTaskExecutionEvent :one
+INSERT INTO task_execution_events (task_execution_id, event_type, message, detail, rule_id)
+VALUES (?, ?, ?, ?, ?)
+RETURNING id, task_execution_id, event_type, message, detail, rule_id, created_at
+`
+
+type CreateTaskExecutionEventParams struct {
+	TaskExecutionID int64         `db:"task_execution_id" json:"task_execution_id"`
+	EventType       string        `db:"event_type" json:"event_type"`
+	Message         string        `db:"message" json:"message"`
+	Detail          string        `db:"detail" json:"detail"`
+	RuleID          sql.NullInt64 `db:"rule_id" json:"rule_id"`
+}
+
+func (q *Queries) CreateTaskExecutionEvent(ctx context.Context, arg CreateTaskExecutionEventParams) (TaskExecutionEvent, error) {
+	row := q.db.QueryRowContext(ctx, createTaskExecutionEvent,
+		arg.TaskExecutionID,
+		arg.EventType,
+		arg.Message,
+		arg.Detail,
+		arg.RuleID,
+	)
+	var i TaskExecutionEvent
+	err := row.Scan(
+		&i.ID,
+		&i.TaskExecutionID,
+		&i.EventType,
+		&i.Message,
+		&i.Detail,
+		&i.RuleID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteTaskExecutionEventsByExecutionID = `-- name: DeleteTaskExecutionEventsByExecutionID :exec
+DELETE FROM task_execution_events WHERE task_execution_id = ?
+`
+
+func (q *Queries) DeleteTaskExecutionEventsByExecutionID(ctx context.Context, taskExecutionID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskExecutionEventsByExecutionID, taskExecutionID)
+	return err
+}
+
+const getTaskExecutionEvents = `-- name: GetTaskExecutionEvents :many
+SELECT id, task_execution_id, event_type, message, detail, rule_id, created_at FROM task_execution_events
+WHERE task_execution_id = ?
+ORDER BY created_at, id
+`
+
+func (q *Queries) GetTaskExecutionEvents(ctx context.Context, taskExecutionID int64) ([]TaskExecutionEvent, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskExecutionEvents, taskExecutionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskExecutionEvent
+	for rows.Next() {
+		var i TaskExecutionEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskExecutionID,
+			&i.EventType,
+			&i.Message,
+			&i.Detail,
+			&i.RuleID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
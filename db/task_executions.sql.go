@@ -11,9 +11,9 @@ import (
 )
 
 const createTaskExecution = `-- name: CreateTaskExecution :one
-INSERT INTO task_executions (task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id)
-VALUES (?, ?, ?, ?, ?)
-RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at
+INSERT INTO task_executions (task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, started_by_user_id)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id
 `
 
 type CreateTaskExecutionParams struct {
@@ -22,6 +22,7 @@ type CreateTaskExecutionParams struct {
 	Status          string         `db:"status" json:"status"`
 	AgentTmuxID     sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
 	DevServerTmuxID sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
+	StartedByUserID sql.NullInt64  `db:"started_by_user_id" json:"started_by_user_id"`
 }
 
 func (q *Queries) CreateTaskExecution(ctx context.Context, arg CreateTaskExecutionParams) (TaskExecution, error) {
@@ -31,6 +32,7 @@ func (q *Queries) CreateTaskExecution(ctx context.Context, arg CreateTaskExecuti
 		arg.Status,
 		arg.AgentTmuxID,
 		arg.DevServerTmuxID,
+		arg.StartedByUserID,
 	)
 	var i TaskExecution
 	err := row.Scan(
@@ -42,6 +44,10 @@ func (q *Queries) CreateTaskExecution(ctx context.Context, arg CreateTaskExecuti
 		&i.DevServerTmuxID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
 	)
 	return i, err
 }
@@ -56,7 +62,7 @@ func (q *Queries) DeleteTaskExecution(ctx context.Context, id int64) error {
 }
 
 const getTaskExecution = `-- name: GetTaskExecution :one
-SELECT id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at FROM task_executions
+SELECT id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id FROM task_executions
 WHERE id = ?
 `
 
@@ -72,13 +78,17 @@ func (q *Queries) GetTaskExecution(ctx context.Context, id int64) (TaskExecution
 		&i.DevServerTmuxID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
 	)
 	return i, err
 }
 
 const getTaskExecutionWithDetails = `-- name: GetTaskExecutionWithDetails :one
 SELECT
-    te.id, te.task_id, te.agent_id, te.status, te.agent_tmux_id, te.dev_server_tmux_id, te.created_at, te.updated_at,
+    te.id, te.task_id, te.agent_id, te.status, te.agent_tmux_id, te.dev_server_tmux_id, te.created_at, te.updated_at, te.sandbox, te.checkpoint_interval_minutes, te.attachments_dir, te.started_by_user_id,
     t.title as task_title,
     t.description as task_description,
     t.base_directory_id,
@@ -96,22 +106,26 @@ WHERE te.id = ?
 `
 
 type GetTaskExecutionWithDetailsRow struct {
-	ID                int64          `db:"id" json:"id"`
-	TaskID            int64          `db:"task_id" json:"task_id"`
-	AgentID           int64          `db:"agent_id" json:"agent_id"`
-	Status            string         `db:"status" json:"status"`
-	AgentTmuxID       sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
-	DevServerTmuxID   sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
-	CreatedAt         sql.NullTime   `db:"created_at" json:"created_at"`
-	UpdatedAt         sql.NullTime   `db:"updated_at" json:"updated_at"`
-	TaskTitle         string         `db:"task_title" json:"task_title"`
-	TaskDescription   string         `db:"task_description" json:"task_description"`
-	BaseDirectoryID   string         `db:"base_directory_id" json:"base_directory_id"`
-	AgentName         string         `db:"agent_name" json:"agent_name"`
-	AgentCommand      string         `db:"agent_command" json:"agent_command"`
-	BaseDirectoryPath string         `db:"base_directory_path" json:"base_directory_path"`
-	ProjectID         int64          `db:"project_id" json:"project_id"`
-	ProjectName       string         `db:"project_name" json:"project_name"`
+	ID                        int64          `db:"id" json:"id"`
+	TaskID                    int64          `db:"task_id" json:"task_id"`
+	AgentID                   int64          `db:"agent_id" json:"agent_id"`
+	Status                    string         `db:"status" json:"status"`
+	AgentTmuxID               sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
+	DevServerTmuxID           sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
+	CreatedAt                 sql.NullTime   `db:"created_at" json:"created_at"`
+	UpdatedAt                 sql.NullTime   `db:"updated_at" json:"updated_at"`
+	Sandbox                   string         `db:"sandbox" json:"sandbox"`
+	CheckpointIntervalMinutes int64          `db:"checkpoint_interval_minutes" json:"checkpoint_interval_minutes"`
+	AttachmentsDir            string         `db:"attachments_dir" json:"attachments_dir"`
+	StartedByUserID           sql.NullInt64  `db:"started_by_user_id" json:"started_by_user_id"`
+	TaskTitle                 string         `db:"task_title" json:"task_title"`
+	TaskDescription           string         `db:"task_description" json:"task_description"`
+	BaseDirectoryID           string         `db:"base_directory_id" json:"base_directory_id"`
+	AgentName                 string         `db:"agent_name" json:"agent_name"`
+	AgentCommand              string         `db:"agent_command" json:"agent_command"`
+	BaseDirectoryPath         string         `db:"base_directory_path" json:"base_directory_path"`
+	ProjectID                 int64          `db:"project_id" json:"project_id"`
+	ProjectName               string         `db:"project_name" json:"project_name"`
 }
 
 func (q *Queries) GetTaskExecutionWithDetails(ctx context.Context, id int64) (GetTaskExecutionWithDetailsRow, error) {
@@ -126,6 +140,10 @@ func (q *Queries) GetTaskExecutionWithDetails(ctx context.Context, id int64) (Ge
 		&i.DevServerTmuxID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
 		&i.TaskTitle,
 		&i.TaskDescription,
 		&i.BaseDirectoryID,
@@ -139,7 +157,7 @@ func (q *Queries) GetTaskExecutionWithDetails(ctx context.Context, id int64) (Ge
 }
 
 const getTaskExecutionsByAgentID = `-- name: GetTaskExecutionsByAgentID :many
-SELECT id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at FROM task_executions
+SELECT id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id FROM task_executions
 WHERE agent_id = ?
 ORDER BY created_at DESC
 `
@@ -162,6 +180,10 @@ func (q *Queries) GetTaskExecutionsByAgentID(ctx context.Context, agentID int64)
 			&i.DevServerTmuxID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Sandbox,
+			&i.CheckpointIntervalMinutes,
+			&i.AttachmentsDir,
+			&i.StartedByUserID,
 		); err != nil {
 			return nil, err
 		}
@@ -178,7 +200,7 @@ func (q *Queries) GetTaskExecutionsByAgentID(ctx context.Context, agentID int64)
 
 const getTaskExecutionsByTaskID = `-- name: GetTaskExecutionsByTaskID :many
 SELECT
-    te.id, te.task_id, te.agent_id, te.status, te.agent_tmux_id, te.dev_server_tmux_id, te.created_at, te.updated_at,
+    te.id, te.task_id, te.agent_id, te.status, te.agent_tmux_id, te.dev_server_tmux_id, te.created_at, te.updated_at, te.sandbox, te.checkpoint_interval_minutes, te.attachments_dir, te.started_by_user_id,
     a.name as agent_name
 FROM task_executions te
 JOIN agents a ON te.agent_id = a.id
@@ -187,15 +209,19 @@ ORDER BY te.created_at
 `
 
 type GetTaskExecutionsByTaskIDRow struct {
-	ID              int64          `db:"id" json:"id"`
-	TaskID          int64          `db:"task_id" json:"task_id"`
-	AgentID         int64          `db:"agent_id" json:"agent_id"`
-	Status          string         `db:"status" json:"status"`
-	AgentTmuxID     sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
-	DevServerTmuxID sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
-	CreatedAt       sql.NullTime   `db:"created_at" json:"created_at"`
-	UpdatedAt       sql.NullTime   `db:"updated_at" json:"updated_at"`
-	AgentName       string         `db:"agent_name" json:"agent_name"`
+	ID                        int64          `db:"id" json:"id"`
+	TaskID                    int64          `db:"task_id" json:"task_id"`
+	AgentID                   int64          `db:"agent_id" json:"agent_id"`
+	Status                    string         `db:"status" json:"status"`
+	AgentTmuxID               sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
+	DevServerTmuxID           sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
+	CreatedAt                 sql.NullTime   `db:"created_at" json:"created_at"`
+	UpdatedAt                 sql.NullTime   `db:"updated_at" json:"updated_at"`
+	Sandbox                   string         `db:"sandbox" json:"sandbox"`
+	CheckpointIntervalMinutes int64          `db:"checkpoint_interval_minutes" json:"checkpoint_interval_minutes"`
+	AttachmentsDir            string         `db:"attachments_dir" json:"attachments_dir"`
+	StartedByUserID           sql.NullInt64  `db:"started_by_user_id" json:"started_by_user_id"`
+	AgentName                 string         `db:"agent_name" json:"agent_name"`
 }
 
 func (q *Queries) GetTaskExecutionsByTaskID(ctx context.Context, taskID int64) ([]GetTaskExecutionsByTaskIDRow, error) {
@@ -216,6 +242,10 @@ func (q *Queries) GetTaskExecutionsByTaskID(ctx context.Context, taskID int64) (
 			&i.DevServerTmuxID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Sandbox,
+			&i.CheckpointIntervalMinutes,
+			&i.AttachmentsDir,
+			&i.StartedByUserID,
 			&i.AgentName,
 		); err != nil {
 			return nil, err
@@ -233,31 +263,38 @@ func (q *Queries) GetTaskExecutionsByTaskID(ctx context.Context, taskID int64) (
 
 const listTaskExecutions = `-- name: ListTaskExecutions :many
 SELECT
-    te.id, te.task_id, te.agent_id, te.status, te.agent_tmux_id, te.dev_server_tmux_id, te.created_at, te.updated_at,
+    te.id, te.task_id, te.agent_id, te.status, te.agent_tmux_id, te.dev_server_tmux_id, te.created_at, te.updated_at, te.sandbox, te.checkpoint_interval_minutes, te.attachments_dir, te.started_by_user_id,
     t.title as task_title,
     a.name as agent_name,
     p.id as project_id,
-    p.name as project_name
+    p.name as project_name,
+    u.name as started_by
 FROM task_executions te
 JOIN tasks t ON te.task_id = t.id
 JOIN agents a ON te.agent_id = a.id
 JOIN projects p ON t.project_id = p.id
+LEFT JOIN users u ON te.started_by_user_id = u.id
 ORDER BY te.created_at DESC
 `
 
 type ListTaskExecutionsRow struct {
-	ID              int64          `db:"id" json:"id"`
-	TaskID          int64          `db:"task_id" json:"task_id"`
-	AgentID         int64          `db:"agent_id" json:"agent_id"`
-	Status          string         `db:"status" json:"status"`
-	AgentTmuxID     sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
-	DevServerTmuxID sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
-	CreatedAt       sql.NullTime   `db:"created_at" json:"created_at"`
-	UpdatedAt       sql.NullTime   `db:"updated_at" json:"updated_at"`
-	TaskTitle       string         `db:"task_title" json:"task_title"`
-	AgentName       string         `db:"agent_name" json:"agent_name"`
-	ProjectID       int64          `db:"project_id" json:"project_id"`
-	ProjectName     string         `db:"project_name" json:"project_name"`
+	ID                        int64          `db:"id" json:"id"`
+	TaskID                    int64          `db:"task_id" json:"task_id"`
+	AgentID                   int64          `db:"agent_id" json:"agent_id"`
+	Status                    string         `db:"status" json:"status"`
+	AgentTmuxID               sql.NullString `db:"agent_tmux_id" json:"agent_tmux_id"`
+	DevServerTmuxID           sql.NullString `db:"dev_server_tmux_id" json:"dev_server_tmux_id"`
+	CreatedAt                 sql.NullTime   `db:"created_at" json:"created_at"`
+	UpdatedAt                 sql.NullTime   `db:"updated_at" json:"updated_at"`
+	Sandbox                   string         `db:"sandbox" json:"sandbox"`
+	CheckpointIntervalMinutes int64          `db:"checkpoint_interval_minutes" json:"checkpoint_interval_minutes"`
+	AttachmentsDir            string         `db:"attachments_dir" json:"attachments_dir"`
+	StartedByUserID           sql.NullInt64  `db:"started_by_user_id" json:"started_by_user_id"`
+	TaskTitle                 string         `db:"task_title" json:"task_title"`
+	AgentName                 string         `db:"agent_name" json:"agent_name"`
+	ProjectID                 int64          `db:"project_id" json:"project_id"`
+	ProjectName               string         `db:"project_name" json:"project_name"`
+	StartedBy                 sql.NullString `db:"started_by" json:"started_by"`
 }
 
 func (q *Queries) ListTaskExecutions(ctx context.Context) ([]ListTaskExecutionsRow, error) {
@@ -278,10 +315,15 @@ func (q *Queries) ListTaskExecutions(ctx context.Context) ([]ListTaskExecutionsR
 			&i.DevServerTmuxID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Sandbox,
+			&i.CheckpointIntervalMinutes,
+			&i.AttachmentsDir,
+			&i.StartedByUserID,
 			&i.TaskTitle,
 			&i.AgentName,
 			&i.ProjectID,
 			&i.ProjectName,
+			&i.StartedBy,
 		); err != nil {
 			return nil, err
 		}
@@ -297,7 +339,7 @@ func (q *Queries) ListTaskExecutions(ctx context.Context) ([]ListTaskExecutionsR
 }
 
 const listTaskExecutionsByTaskID = `-- name: ListTaskExecutionsByTaskID :many
-SELECT id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at FROM task_executions
+SELECT id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id FROM task_executions
 WHERE task_id = ?
 ORDER BY created_at
 `
@@ -320,6 +362,10 @@ func (q *Queries) ListTaskExecutionsByTaskID(ctx context.Context, taskID int64)
 			&i.DevServerTmuxID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Sandbox,
+			&i.CheckpointIntervalMinutes,
+			&i.AttachmentsDir,
+			&i.StartedByUserID,
 		); err != nil {
 			return nil, err
 		}
@@ -334,13 +380,115 @@ func (q *Queries) ListTaskExecutionsByTaskID(ctx context.Context, taskID int64)
 	return items, nil
 }
 
+const updateTaskExecutionAttachmentsDir = `-- name: UpdateTaskExecutionAttachmentsDir :one
+UPDATE task_executions
+SET
+    attachments_dir = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id
+`
+
+type UpdateTaskExecutionAttachmentsDirParams struct {
+	AttachmentsDir string `db:"attachments_dir" json:"attachments_dir"`
+	ID             int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateTaskExecutionAttachmentsDir(ctx context.Context, arg UpdateTaskExecutionAttachmentsDirParams) (TaskExecution, error) {
+	row := q.db.QueryRowContext(ctx, updateTaskExecutionAttachmentsDir, arg.AttachmentsDir, arg.ID)
+	var i TaskExecution
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.AgentID,
+		&i.Status,
+		&i.AgentTmuxID,
+		&i.DevServerTmuxID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
+	)
+	return i, err
+}
+
+const updateTaskExecutionCheckpointInterval = `-- name: UpdateTaskExecutionCheckpointInterval :one
+UPDATE task_executions
+SET
+    checkpoint_interval_minutes = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id
+`
+
+type UpdateTaskExecutionCheckpointIntervalParams struct {
+	CheckpointIntervalMinutes int64 `db:"checkpoint_interval_minutes" json:"checkpoint_interval_minutes"`
+	ID                        int64 `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateTaskExecutionCheckpointInterval(ctx context.Context, arg UpdateTaskExecutionCheckpointIntervalParams) (TaskExecution, error) {
+	row := q.db.QueryRowContext(ctx, updateTaskExecutionCheckpointInterval, arg.CheckpointIntervalMinutes, arg.ID)
+	var i TaskExecution
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.AgentID,
+		&i.Status,
+		&i.AgentTmuxID,
+		&i.DevServerTmuxID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
+	)
+	return i, err
+}
+
+const updateTaskExecutionSandbox = `-- name: UpdateTaskExecutionSandbox :one
+UPDATE task_executions
+SET
+    sandbox = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id
+`
+
+type UpdateTaskExecutionSandboxParams struct {
+	Sandbox string `db:"sandbox" json:"sandbox"`
+	ID      int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateTaskExecutionSandbox(ctx context.Context, arg UpdateTaskExecutionSandboxParams) (TaskExecution, error) {
+	row := q.db.QueryRowContext(ctx, updateTaskExecutionSandbox, arg.Sandbox, arg.ID)
+	var i TaskExecution
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.AgentID,
+		&i.Status,
+		&i.AgentTmuxID,
+		&i.DevServerTmuxID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
+	)
+	return i, err
+}
+
 const updateTaskExecutionStatus = `-- name: UpdateTaskExecutionStatus :one
 UPDATE task_executions
 SET
     status = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at
+RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id
 `
 
 type UpdateTaskExecutionStatusParams struct {
@@ -360,6 +508,10 @@ func (q *Queries) UpdateTaskExecutionStatus(ctx context.Context, arg UpdateTaskE
 		&i.DevServerTmuxID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
 	)
 	return i, err
 }
@@ -371,7 +523,7 @@ SET
     dev_server_tmux_id = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at
+RETURNING id, task_id, agent_id, status, agent_tmux_id, dev_server_tmux_id, created_at, updated_at, sandbox, checkpoint_interval_minutes, attachments_dir, started_by_user_id
 `
 
 type UpdateTaskExecutionTmuxParams struct {
@@ -392,6 +544,10 @@ func (q *Queries) UpdateTaskExecutionTmux(ctx context.Context, arg UpdateTaskExe
 		&i.DevServerTmuxID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Sandbox,
+		&i.CheckpointIntervalMinutes,
+		&i.AttachmentsDir,
+		&i.StartedByUserID,
 	)
 	return i, err
 }
@@ -0,0 +1,121 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: task_labels.sql
+
+package db
+
+import (
+	"context"
+)
+
+const addTaskLabel = `-- name: AddTaskLabel :exec
+INSERT OR IGNORE INTO task_labels (task_id, label)
+VALUES (?, ?)
+`
+
+type AddTaskLabelParams struct {
+	TaskID int64  `db:"task_id" json:"task_id"`
+	Label  string `db:"label" json:"label"`
+}
+
+func (q *Queries) AddTaskLabel(ctx context.Context, arg AddTaskLabelParams) error {
+	_, err := q.db.ExecContext(ctx, addTaskLabel, arg.TaskID, arg.Label)
+	return err
+}
+
+const deleteTaskLabels = `-- name: DeleteTaskLabels :exec
+DELETE FROM task_labels WHERE task_id = ?
+`
+
+func (q *Queries) DeleteTaskLabels(ctx context.Context, taskID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteTaskLabels, taskID)
+	return err
+}
+
+const getAllTaskLabels = `-- name: GetAllTaskLabels :many
+SELECT task_id, label FROM task_labels
+ORDER BY task_id, label
+`
+
+func (q *Queries) GetAllTaskLabels(ctx context.Context) ([]TaskLabel, error) {
+	rows, err := q.db.QueryContext(ctx, getAllTaskLabels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskLabel
+	for rows.Next() {
+		var i TaskLabel
+		if err := rows.Scan(&i.TaskID, &i.Label); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTaskLabels = `-- name: GetTaskLabels :many
+SELECT label FROM task_labels
+WHERE task_id = ?
+ORDER BY label
+`
+
+func (q *Queries) GetTaskLabels(ctx context.Context, taskID int64) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskLabels, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var label string
+		if err := rows.Scan(&label); err != nil {
+			return nil, err
+		}
+		items = append(items, label)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTaskLabelsByProjectID = `-- name: GetTaskLabelsByProjectID :many
+SELECT tl.task_id, tl.label FROM task_labels tl
+JOIN tasks t ON t.id = tl.task_id
+WHERE t.project_id = ?
+ORDER BY tl.task_id, tl.label
+`
+
+func (q *Queries) GetTaskLabelsByProjectID(ctx context.Context, projectID int64) ([]TaskLabel, error) {
+	rows, err := q.db.QueryContext(ctx, getTaskLabelsByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []TaskLabel
+	for rows.Next() {
+		var i TaskLabel
+		if err := rows.Scan(&i.TaskID, &i.Label); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -10,10 +10,36 @@ import (
 	"database/sql"
 )
 
+const clearPreferredAgent = `-- name: ClearPreferredAgent :exec
+UPDATE tasks SET preferred_agent_id = NULL WHERE preferred_agent_id = ?
+`
+
+func (q *Queries) ClearPreferredAgent(ctx context.Context, preferredAgentID sql.NullInt64) error {
+	_, err := q.db.ExecContext(ctx, clearPreferredAgent, preferredAgentID)
+	return err
+}
+
+const countTasksByProjectAndStatus = `-- name: CountTasksByProjectAndStatus :one
+SELECT COUNT(*) FROM tasks
+WHERE project_id = ? AND status = ?
+`
+
+type CountTasksByProjectAndStatusParams struct {
+	ProjectID int64  `db:"project_id" json:"project_id"`
+	Status    string `db:"status" json:"status"`
+}
+
+func (q *Queries) CountTasksByProjectAndStatus(ctx context.Context, arg CountTasksByProjectAndStatusParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countTasksByProjectAndStatus, arg.ProjectID, arg.Status)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createTask = `-- name: CreateTask :one
 INSERT INTO tasks (project_id, base_directory_id, title, description, status)
 VALUES (?, ?, ?, ?, ?)
-RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at
+RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id
 `
 
 type CreateTaskParams struct {
@@ -42,6 +68,11 @@ func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (Task, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
 	)
 	return i, err
 }
@@ -56,7 +87,7 @@ func (q *Queries) DeleteTask(ctx context.Context, id int64) error {
 }
 
 const getTask = `-- name: GetTask :one
-SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at FROM tasks
+SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id FROM tasks
 WHERE id = ?
 `
 
@@ -72,13 +103,49 @@ func (q *Queries) GetTask(ctx context.Context, id int64) (Task, error) {
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const getTaskByExternalID = `-- name: GetTaskByExternalID :one
+SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id FROM tasks
+WHERE project_id = ? AND external_id = ?
+`
+
+type GetTaskByExternalIDParams struct {
+	ProjectID  int64  `db:"project_id" json:"project_id"`
+	ExternalID string `db:"external_id" json:"external_id"`
+}
+
+func (q *Queries) GetTaskByExternalID(ctx context.Context, arg GetTaskByExternalIDParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, getTaskByExternalID, arg.ProjectID, arg.ExternalID)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.Title,
+		&i.Description,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
 	)
 	return i, err
 }
 
 const getTaskWithBaseDirectory = `-- name: GetTaskWithBaseDirectory :one
 SELECT
-    t.id, t.project_id, t.base_directory_id, t.title, t.description, t.status, t.created_at, t.updated_at,
+    t.id, t.project_id, t.base_directory_id, t.title, t.description, t.status, t.created_at, t.updated_at, t.sort_order, t.priority, t.preferred_agent_id, t.due_date, t.external_id,
     bd.path as base_directory_path,
     bd.git_initialized,
     bd.setup_commands,
@@ -91,20 +158,25 @@ WHERE t.id = ?
 `
 
 type GetTaskWithBaseDirectoryRow struct {
-	ID                        int64        `db:"id" json:"id"`
-	ProjectID                 int64        `db:"project_id" json:"project_id"`
-	BaseDirectoryID           string       `db:"base_directory_id" json:"base_directory_id"`
-	Title                     string       `db:"title" json:"title"`
-	Description               string       `db:"description" json:"description"`
-	Status                    string       `db:"status" json:"status"`
-	CreatedAt                 sql.NullTime `db:"created_at" json:"created_at"`
-	UpdatedAt                 sql.NullTime `db:"updated_at" json:"updated_at"`
-	BaseDirectoryPath         string       `db:"base_directory_path" json:"base_directory_path"`
-	GitInitialized            bool         `db:"git_initialized" json:"git_initialized"`
-	SetupCommands             string       `db:"setup_commands" json:"setup_commands"`
-	TeardownCommands          string       `db:"teardown_commands" json:"teardown_commands"`
-	DevServerSetupCommands    string       `db:"dev_server_setup_commands" json:"dev_server_setup_commands"`
-	DevServerTeardownCommands string       `db:"dev_server_teardown_commands" json:"dev_server_teardown_commands"`
+	ID                        int64         `db:"id" json:"id"`
+	ProjectID                 int64         `db:"project_id" json:"project_id"`
+	BaseDirectoryID           string        `db:"base_directory_id" json:"base_directory_id"`
+	Title                     string        `db:"title" json:"title"`
+	Description               string        `db:"description" json:"description"`
+	Status                    string        `db:"status" json:"status"`
+	CreatedAt                 sql.NullTime  `db:"created_at" json:"created_at"`
+	UpdatedAt                 sql.NullTime  `db:"updated_at" json:"updated_at"`
+	SortOrder                 int64         `db:"sort_order" json:"sort_order"`
+	Priority                  int64         `db:"priority" json:"priority"`
+	PreferredAgentID          sql.NullInt64 `db:"preferred_agent_id" json:"preferred_agent_id"`
+	DueDate                   string        `db:"due_date" json:"due_date"`
+	ExternalID                string        `db:"external_id" json:"external_id"`
+	BaseDirectoryPath         string        `db:"base_directory_path" json:"base_directory_path"`
+	GitInitialized            bool          `db:"git_initialized" json:"git_initialized"`
+	SetupCommands             string        `db:"setup_commands" json:"setup_commands"`
+	TeardownCommands          string        `db:"teardown_commands" json:"teardown_commands"`
+	DevServerSetupCommands    string        `db:"dev_server_setup_commands" json:"dev_server_setup_commands"`
+	DevServerTeardownCommands string        `db:"dev_server_teardown_commands" json:"dev_server_teardown_commands"`
 }
 
 func (q *Queries) GetTaskWithBaseDirectory(ctx context.Context, id int64) (GetTaskWithBaseDirectoryRow, error) {
@@ -119,6 +191,11 @@ func (q *Queries) GetTaskWithBaseDirectory(ctx context.Context, id int64) (GetTa
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
 		&i.BaseDirectoryPath,
 		&i.GitInitialized,
 		&i.SetupCommands,
@@ -130,7 +207,7 @@ func (q *Queries) GetTaskWithBaseDirectory(ctx context.Context, id int64) (GetTa
 }
 
 const getTasksByBaseDirectoryID = `-- name: GetTasksByBaseDirectoryID :many
-SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at FROM tasks
+SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id FROM tasks
 WHERE base_directory_id = ?
 ORDER BY created_at DESC
 `
@@ -153,6 +230,59 @@ func (q *Queries) GetTasksByBaseDirectoryID(ctx context.Context, baseDirectoryID
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.SortOrder,
+			&i.Priority,
+			&i.PreferredAgentID,
+			&i.DueDate,
+			&i.ExternalID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getTasksByProjectAndStatus = `-- name: GetTasksByProjectAndStatus :many
+SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id FROM tasks
+WHERE project_id = ? AND status = ?
+ORDER BY sort_order, id
+`
+
+type GetTasksByProjectAndStatusParams struct {
+	ProjectID int64  `db:"project_id" json:"project_id"`
+	Status    string `db:"status" json:"status"`
+}
+
+func (q *Queries) GetTasksByProjectAndStatus(ctx context.Context, arg GetTasksByProjectAndStatusParams) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, getTasksByProjectAndStatus, arg.ProjectID, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.BaseDirectoryID,
+			&i.Title,
+			&i.Description,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SortOrder,
+			&i.Priority,
+			&i.PreferredAgentID,
+			&i.DueDate,
+			&i.ExternalID,
 		); err != nil {
 			return nil, err
 		}
@@ -168,9 +298,9 @@ func (q *Queries) GetTasksByBaseDirectoryID(ctx context.Context, baseDirectoryID
 }
 
 const getTasksByProjectID = `-- name: GetTasksByProjectID :many
-SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at FROM tasks
+SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id FROM tasks
 WHERE project_id = ?
-ORDER BY title
+ORDER BY sort_order, id
 `
 
 func (q *Queries) GetTasksByProjectID(ctx context.Context, projectID int64) ([]Task, error) {
@@ -191,6 +321,11 @@ func (q *Queries) GetTasksByProjectID(ctx context.Context, projectID int64) ([]T
 			&i.Status,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.SortOrder,
+			&i.Priority,
+			&i.PreferredAgentID,
+			&i.DueDate,
+			&i.ExternalID,
 		); err != nil {
 			return nil, err
 		}
@@ -205,6 +340,111 @@ func (q *Queries) GetTasksByProjectID(ctx context.Context, projectID int64) ([]T
 	return items, nil
 }
 
+const searchTasks = `-- name: SearchTasks :many
+SELECT id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id FROM tasks
+WHERE (?1 IS NULL OR project_id = ?1)
+  AND (?2 IS NULL OR project_id IN (SELECT id FROM projects WHERE root_id = ?2))
+  AND (?3 IS NULL OR status = ?3)
+  AND (?4 IS NULL OR base_directory_id = ?4)
+  AND (?5 IS NULL OR priority >= ?5)
+  AND (?6 IS NULL OR preferred_agent_id = ?6)
+  AND (?7 IS NULL OR (due_date != '' AND due_date <= ?7))
+  AND (?8 IS NULL OR (due_date != '' AND due_date >= ?8))
+  AND (?9 IS NULL OR title LIKE '%' || ?9 || '%' OR description LIKE '%' || ?9 || '%')
+ORDER BY id
+`
+
+type SearchTasksParams struct {
+	ProjectID        interface{} `db:"project_id" json:"project_id"`
+	RootID           interface{} `db:"root_id" json:"root_id"`
+	Status           interface{} `db:"status" json:"status"`
+	BaseDirectoryID  interface{} `db:"base_directory_id" json:"base_directory_id"`
+	MinPriority      interface{} `db:"min_priority" json:"min_priority"`
+	PreferredAgentID interface{} `db:"preferred_agent_id" json:"preferred_agent_id"`
+	DueBefore        interface{} `db:"due_before" json:"due_before"`
+	DueAfter         interface{} `db:"due_after" json:"due_after"`
+	Text             interface{} `db:"text" json:"text"`
+}
+
+// Filters left NULL match every task; labels, ordering and paging are applied by the caller
+func (q *Queries) SearchTasks(ctx context.Context, arg SearchTasksParams) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, searchTasks,
+		arg.ProjectID,
+		arg.RootID,
+		arg.Status,
+		arg.BaseDirectoryID,
+		arg.MinPriority,
+		arg.PreferredAgentID,
+		arg.DueBefore,
+		arg.DueAfter,
+		arg.Text,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.BaseDirectoryID,
+			&i.Title,
+			&i.Description,
+			&i.Status,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.SortOrder,
+			&i.Priority,
+			&i.PreferredAgentID,
+			&i.DueDate,
+			&i.ExternalID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setTaskExternalID = `-- name: SetTaskExternalID :one
+UPDATE tasks SET external_id = ? WHERE id = ?
+RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id
+`
+
+type SetTaskExternalIDParams struct {
+	ExternalID string `db:"external_id" json:"external_id"`
+	ID         int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) SetTaskExternalID(ctx context.Context, arg SetTaskExternalIDParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, setTaskExternalID, arg.ExternalID, arg.ID)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.Title,
+		&i.Description,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
 const updateTask = `-- name: UpdateTask :one
 UPDATE tasks
 SET 
@@ -213,7 +453,7 @@ SET
     status = ?,
     updated_at = CURRENT_TIMESTAMP
 WHERE id = ?
-RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at
+RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id
 `
 
 type UpdateTaskParams struct {
@@ -240,6 +480,111 @@ func (q *Queries) UpdateTask(ctx context.Context, arg UpdateTaskParams) (Task, e
 		&i.Status,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const updateTaskMetadata = `-- name: UpdateTaskMetadata :one
+UPDATE tasks
+SET
+    priority = ?,
+    preferred_agent_id = ?,
+    due_date = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id
+`
+
+type UpdateTaskMetadataParams struct {
+	Priority         int64         `db:"priority" json:"priority"`
+	PreferredAgentID sql.NullInt64 `db:"preferred_agent_id" json:"preferred_agent_id"`
+	DueDate          string        `db:"due_date" json:"due_date"`
+	ID               int64         `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateTaskMetadata(ctx context.Context, arg UpdateTaskMetadataParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, updateTaskMetadata,
+		arg.Priority,
+		arg.PreferredAgentID,
+		arg.DueDate,
+		arg.ID,
+	)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.Title,
+		&i.Description,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
 	)
 	return i, err
 }
+
+const updateTaskPosition = `-- name: UpdateTaskPosition :one
+UPDATE tasks
+SET
+    status = ?,
+    sort_order = ?,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, project_id, base_directory_id, title, description, status, created_at, updated_at, sort_order, priority, preferred_agent_id, due_date, external_id
+`
+
+type UpdateTaskPositionParams struct {
+	Status    string `db:"status" json:"status"`
+	SortOrder int64  `db:"sort_order" json:"sort_order"`
+	ID        int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateTaskPosition(ctx context.Context, arg UpdateTaskPositionParams) (Task, error) {
+	row := q.db.QueryRowContext(ctx, updateTaskPosition, arg.Status, arg.SortOrder, arg.ID)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.BaseDirectoryID,
+		&i.Title,
+		&i.Description,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.SortOrder,
+		&i.Priority,
+		&i.PreferredAgentID,
+		&i.DueDate,
+		&i.ExternalID,
+	)
+	return i, err
+}
+
+const updateTaskStatusByProjectAndStatus = `-- name: UpdateTaskStatusByProjectAndStatus :exec
+UPDATE tasks
+SET
+    status = ?1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE project_id = ?2 AND status = ?3
+`
+
+type UpdateTaskStatusByProjectAndStatusParams struct {
+	NewStatus string `db:"new_status" json:"new_status"`
+	ProjectID int64  `db:"project_id" json:"project_id"`
+	OldStatus string `db:"old_status" json:"old_status"`
+}
+
+func (q *Queries) UpdateTaskStatusByProjectAndStatus(ctx context.Context, arg UpdateTaskStatusByProjectAndStatusParams) error {
+	_, err := q.db.ExecContext(ctx, updateTaskStatusByProjectAndStatus, arg.NewStatus, arg.ProjectID, arg.OldStatus)
+	return err
+}
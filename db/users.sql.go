@@ -0,0 +1,372 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: users.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+const clearUserInvite = `-- name: ClearUserInvite :exec
+UPDATE users
+SET invite_token_hash = NULL, invite_expires_at = NULL
+WHERE id = ?
+`
+
+func (q *Queries) ClearUserInvite(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, clearUserInvite, id)
+	return err
+}
+
+const countUsers = `-- name: CountUsers :one
+SELECT COUNT(*) FROM users
+`
+
+func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsers)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUsersByRole = `-- name: CountUsersByRole :one
+SELECT COUNT(*) FROM users
+WHERE role = ?
+`
+
+func (q *Queries) CountUsersByRole(ctx context.Context, role string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersByRole, role)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (name, display_name, role, webauthn_handle)
+VALUES (?, ?, ?, ?)
+RETURNING id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step
+`
+
+type CreateUserParams struct {
+	Name           string `db:"name" json:"name"`
+	DisplayName    string `db:"display_name" json:"display_name"`
+	Role           string `db:"role" json:"role"`
+	WebauthnHandle string `db:"webauthn_handle" json:"webauthn_handle"`
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.Name,
+		arg.DisplayName,
+		arg.Role,
+		arg.WebauthnHandle,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = ?
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
+const disableUserTOTP = `-- name: DisableUserTOTP :exec
+UPDATE users
+SET totp_secret = '', totp_enabled_at = NULL, totp_last_step = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+func (q *Queries) DisableUserTOTP(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, disableUserTOTP, id)
+	return err
+}
+
+const enableUserTOTP = `-- name: EnableUserTOTP :exec
+UPDATE users
+SET totp_enabled_at = CURRENT_TIMESTAMP, totp_last_step = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+type EnableUserTOTPParams struct {
+	TotpLastStep int64 `db:"totp_last_step" json:"totp_last_step"`
+	ID           int64 `db:"id" json:"id"`
+}
+
+func (q *Queries) EnableUserTOTP(ctx context.Context, arg EnableUserTOTPParams) error {
+	_, err := q.db.ExecContext(ctx, enableUserTOTP, arg.TotpLastStep, arg.ID)
+	return err
+}
+
+const getFirstAdmin = `-- name: GetFirstAdmin :one
+SELECT id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step FROM users
+WHERE role = 'admin'
+ORDER BY id
+LIMIT 1
+`
+
+func (q *Queries) GetFirstAdmin(ctx context.Context) (User, error) {
+	row := q.db.QueryRowContext(ctx, getFirstAdmin)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step FROM users
+WHERE id = ?
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUserByInviteTokenHash = `-- name: GetUserByInviteTokenHash :one
+SELECT id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step FROM users
+WHERE invite_token_hash = ? AND invite_expires_at > CURRENT_TIMESTAMP
+`
+
+func (q *Queries) GetUserByInviteTokenHash(ctx context.Context, inviteTokenHash sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByInviteTokenHash, inviteTokenHash)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUserByName = `-- name: GetUserByName :one
+SELECT id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step FROM users
+WHERE name = ?
+`
+
+func (q *Queries) GetUserByName(ctx context.Context, name string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByName, name)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const getUserByWebAuthnHandle = `-- name: GetUserByWebAuthnHandle :one
+SELECT id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step FROM users
+WHERE webauthn_handle = ?
+`
+
+func (q *Queries) GetUserByWebAuthnHandle(ctx context.Context, webauthnHandle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByWebAuthnHandle, webauthnHandle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const listUsers = `-- name: ListUsers :many
+SELECT id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step FROM users
+ORDER BY id
+`
+
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.DisplayName,
+			&i.Role,
+			&i.WebauthnHandle,
+			&i.InviteTokenHash,
+			&i.InviteExpiresAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.TotpSecret,
+			&i.TotpEnabledAt,
+			&i.TotpLastStep,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserInvite = `-- name: SetUserInvite :exec
+UPDATE users
+SET invite_token_hash = ?, invite_expires_at = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+type SetUserInviteParams struct {
+	InviteTokenHash sql.NullString `db:"invite_token_hash" json:"invite_token_hash"`
+	InviteExpiresAt sql.NullTime   `db:"invite_expires_at" json:"invite_expires_at"`
+	ID              int64          `db:"id" json:"id"`
+}
+
+func (q *Queries) SetUserInvite(ctx context.Context, arg SetUserInviteParams) error {
+	_, err := q.db.ExecContext(ctx, setUserInvite, arg.InviteTokenHash, arg.InviteExpiresAt, arg.ID)
+	return err
+}
+
+const setUserTOTPSecret = `-- name: SetUserTOTPSecret :exec
+UPDATE users
+SET totp_secret = ?, totp_enabled_at = NULL, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+`
+
+type SetUserTOTPSecretParams struct {
+	TotpSecret string `db:"totp_secret" json:"totp_secret"`
+	ID         int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) SetUserTOTPSecret(ctx context.Context, arg SetUserTOTPSecretParams) error {
+	_, err := q.db.ExecContext(ctx, setUserTOTPSecret, arg.TotpSecret, arg.ID)
+	return err
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET display_name = ?, role = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING id, name, display_name, role, webauthn_handle, invite_token_hash, invite_expires_at, created_at, updated_at, totp_secret, totp_enabled_at, totp_last_step
+`
+
+type UpdateUserParams struct {
+	DisplayName string `db:"display_name" json:"display_name"`
+	Role        string `db:"role" json:"role"`
+	ID          int64  `db:"id" json:"id"`
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.DisplayName, arg.Role, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.DisplayName,
+		&i.Role,
+		&i.WebauthnHandle,
+		&i.InviteTokenHash,
+		&i.InviteExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.TotpSecret,
+		&i.TotpEnabledAt,
+		&i.TotpLastStep,
+	)
+	return i, err
+}
+
+const useUserTOTPStep = `-- name: UseUserTOTPStep :execrows
+UPDATE users
+SET totp_last_step = ?1
+WHERE id = ?2 AND totp_last_step < ?1
+`
+
+type UseUserTOTPStepParams struct {
+	Step int64 `db:"step" json:"step"`
+	ID   int64 `db:"id" json:"id"`
+}
+
+func (q *Queries) UseUserTOTPStep(ctx context.Context, arg UseUserTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useUserTOTPStep, arg.Step, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
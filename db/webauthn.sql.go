@@ -35,32 +35,54 @@ func (q *Queries) CountWebAuthnCredentialsByRpID(ctx context.Context, rpID strin
 }
 
 const createSession = `-- name: CreateSession :one
-INSERT INTO sessions (token, expires_at)
-VALUES (?, ?)
-RETURNING token, expires_at, created_at
+INSERT INTO sessions (token, user_id, public_id, user_agent, ip_address, expires_at, last_seen_at)
+VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+RETURNING token, expires_at, created_at, user_id, public_id, user_agent, ip_address, last_seen_at
 `
 
 type CreateSessionParams struct {
 	Token     string    `db:"token" json:"token"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	PublicID  string    `db:"public_id" json:"public_id"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	IpAddress string    `db:"ip_address" json:"ip_address"`
 	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
 }
 
 func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (Session, error) {
-	row := q.db.QueryRowContext(ctx, createSession, arg.Token, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createSession,
+		arg.Token,
+		arg.UserID,
+		arg.PublicID,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ExpiresAt,
+	)
 	var i Session
-	err := row.Scan(&i.Token, &i.ExpiresAt, &i.CreatedAt)
+	err := row.Scan(
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.PublicID,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastSeenAt,
+	)
 	return i, err
 }
 
 const createWebAuthnCredential = `-- name: CreateWebAuthnCredential :one
-INSERT INTO webauthn_credentials (id, rp_id, public_key, attestation_type, transport, aaguid, sign_count)
-VALUES (?, ?, ?, ?, ?, ?, ?)
-RETURNING id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at
+INSERT INTO webauthn_credentials (id, rp_id, user_id, name, public_key, attestation_type, transport, aaguid, sign_count)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+RETURNING id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at, user_id, name, last_used_at
 `
 
 type CreateWebAuthnCredentialParams struct {
 	ID              string         `db:"id" json:"id"`
 	RpID            string         `db:"rp_id" json:"rp_id"`
+	UserID          int64          `db:"user_id" json:"user_id"`
+	Name            string         `db:"name" json:"name"`
 	PublicKey       []byte         `db:"public_key" json:"public_key"`
 	AttestationType string         `db:"attestation_type" json:"attestation_type"`
 	Transport       sql.NullString `db:"transport" json:"transport"`
@@ -72,6 +94,8 @@ func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAut
 	row := q.db.QueryRowContext(ctx, createWebAuthnCredential,
 		arg.ID,
 		arg.RpID,
+		arg.UserID,
+		arg.Name,
 		arg.PublicKey,
 		arg.AttestationType,
 		arg.Transport,
@@ -88,16 +112,36 @@ func (q *Queries) CreateWebAuthnCredential(ctx context.Context, arg CreateWebAut
 		&i.Aaguid,
 		&i.SignCount,
 		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
-const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
+const deleteExpiredSessions = `-- name: DeleteExpiredSessions :execrows
 DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP
 `
 
-func (q *Queries) DeleteExpiredSessions(ctx context.Context) error {
-	_, err := q.db.ExecContext(ctx, deleteExpiredSessions)
+func (q *Queries) DeleteExpiredSessions(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredSessions)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteOtherSessions = `-- name: DeleteOtherSessions :exec
+DELETE FROM sessions WHERE user_id = ? AND token != ?
+`
+
+type DeleteOtherSessionsParams struct {
+	UserID int64  `db:"user_id" json:"user_id"`
+	Token  string `db:"token" json:"token"`
+}
+
+func (q *Queries) DeleteOtherSessions(ctx context.Context, arg DeleteOtherSessionsParams) error {
+	_, err := q.db.ExecContext(ctx, deleteOtherSessions, arg.UserID, arg.Token)
 	return err
 }
 
@@ -110,6 +154,29 @@ func (q *Queries) DeleteSession(ctx context.Context, token string) error {
 	return err
 }
 
+const deleteSessionByPublicID = `-- name: DeleteSessionByPublicID :exec
+DELETE FROM sessions WHERE user_id = ? AND public_id = ?
+`
+
+type DeleteSessionByPublicIDParams struct {
+	UserID   int64  `db:"user_id" json:"user_id"`
+	PublicID string `db:"public_id" json:"public_id"`
+}
+
+func (q *Queries) DeleteSessionByPublicID(ctx context.Context, arg DeleteSessionByPublicIDParams) error {
+	_, err := q.db.ExecContext(ctx, deleteSessionByPublicID, arg.UserID, arg.PublicID)
+	return err
+}
+
+const deleteSessionsByUserID = `-- name: DeleteSessionsByUserID :exec
+DELETE FROM sessions WHERE user_id = ?
+`
+
+func (q *Queries) DeleteSessionsByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteSessionsByUserID, userID)
+	return err
+}
+
 const deleteWebAuthnCredential = `-- name: DeleteWebAuthnCredential :exec
 DELETE FROM webauthn_credentials WHERE id = ?
 `
@@ -119,20 +186,38 @@ func (q *Queries) DeleteWebAuthnCredential(ctx context.Context, id string) error
 	return err
 }
 
+const deleteWebAuthnCredentialsByUserID = `-- name: DeleteWebAuthnCredentialsByUserID :exec
+DELETE FROM webauthn_credentials WHERE user_id = ?
+`
+
+func (q *Queries) DeleteWebAuthnCredentialsByUserID(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteWebAuthnCredentialsByUserID, userID)
+	return err
+}
+
 const getSession = `-- name: GetSession :one
-SELECT token, expires_at, created_at FROM sessions
+SELECT token, expires_at, created_at, user_id, public_id, user_agent, ip_address, last_seen_at FROM sessions
 WHERE token = ? AND expires_at > CURRENT_TIMESTAMP
 `
 
 func (q *Queries) GetSession(ctx context.Context, token string) (Session, error) {
 	row := q.db.QueryRowContext(ctx, getSession, token)
 	var i Session
-	err := row.Scan(&i.Token, &i.ExpiresAt, &i.CreatedAt)
+	err := row.Scan(
+		&i.Token,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.PublicID,
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastSeenAt,
+	)
 	return i, err
 }
 
 const getWebAuthnCredential = `-- name: GetWebAuthnCredential :one
-SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at FROM webauthn_credentials
+SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at, user_id, name, last_used_at FROM webauthn_credentials
 WHERE id = ?
 `
 
@@ -148,12 +233,53 @@ func (q *Queries) GetWebAuthnCredential(ctx context.Context, id string) (Webauth
 		&i.Aaguid,
 		&i.SignCount,
 		&i.CreatedAt,
+		&i.UserID,
+		&i.Name,
+		&i.LastUsedAt,
 	)
 	return i, err
 }
 
+const listSessionsByUserID = `-- name: ListSessionsByUserID :many
+SELECT token, expires_at, created_at, user_id, public_id, user_agent, ip_address, last_seen_at FROM sessions
+WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP
+ORDER BY last_seen_at DESC
+`
+
+func (q *Queries) ListSessionsByUserID(ctx context.Context, userID int64) ([]Session, error) {
+	rows, err := q.db.QueryContext(ctx, listSessionsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Session
+	for rows.Next() {
+		var i Session
+		if err := rows.Scan(
+			&i.Token,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.PublicID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listWebAuthnCredentials = `-- name: ListWebAuthnCredentials :many
-SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at FROM webauthn_credentials
+SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at, user_id, name, last_used_at FROM webauthn_credentials
 ORDER BY created_at
 `
 
@@ -175,6 +301,9 @@ func (q *Queries) ListWebAuthnCredentials(ctx context.Context) ([]WebauthnCreden
 			&i.Aaguid,
 			&i.SignCount,
 			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.LastUsedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -190,7 +319,7 @@ func (q *Queries) ListWebAuthnCredentials(ctx context.Context) ([]WebauthnCreden
 }
 
 const listWebAuthnCredentialsByRpID = `-- name: ListWebAuthnCredentialsByRpID :many
-SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at FROM webauthn_credentials
+SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at, user_id, name, last_used_at FROM webauthn_credentials
 WHERE rp_id = ?
 ORDER BY created_at
 `
@@ -213,6 +342,50 @@ func (q *Queries) ListWebAuthnCredentialsByRpID(ctx context.Context, rpID string
 			&i.Aaguid,
 			&i.SignCount,
 			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebAuthnCredentialsByUser = `-- name: ListWebAuthnCredentialsByUser :many
+SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at, user_id, name, last_used_at FROM webauthn_credentials
+WHERE user_id = ?
+ORDER BY rp_id, created_at
+`
+
+func (q *Queries) ListWebAuthnCredentialsByUser(ctx context.Context, userID int64) ([]WebauthnCredential, error) {
+	rows, err := q.db.QueryContext(ctx, listWebAuthnCredentialsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.RpID,
+			&i.PublicKey,
+			&i.AttestationType,
+			&i.Transport,
+			&i.Aaguid,
+			&i.SignCount,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.LastUsedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -227,9 +400,88 @@ func (q *Queries) ListWebAuthnCredentialsByRpID(ctx context.Context, rpID string
 	return items, nil
 }
 
+const listWebAuthnCredentialsByUserID = `-- name: ListWebAuthnCredentialsByUserID :many
+SELECT id, rp_id, public_key, attestation_type, transport, aaguid, sign_count, created_at, user_id, name, last_used_at FROM webauthn_credentials
+WHERE user_id = ? AND rp_id = ?
+ORDER BY created_at
+`
+
+type ListWebAuthnCredentialsByUserIDParams struct {
+	UserID int64  `db:"user_id" json:"user_id"`
+	RpID   string `db:"rp_id" json:"rp_id"`
+}
+
+func (q *Queries) ListWebAuthnCredentialsByUserID(ctx context.Context, arg ListWebAuthnCredentialsByUserIDParams) ([]WebauthnCredential, error) {
+	rows, err := q.db.QueryContext(ctx, listWebAuthnCredentialsByUserID, arg.UserID, arg.RpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebauthnCredential
+	for rows.Next() {
+		var i WebauthnCredential
+		if err := rows.Scan(
+			&i.ID,
+			&i.RpID,
+			&i.PublicKey,
+			&i.AttestationType,
+			&i.Transport,
+			&i.Aaguid,
+			&i.SignCount,
+			&i.CreatedAt,
+			&i.UserID,
+			&i.Name,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const renameWebAuthnCredential = `-- name: RenameWebAuthnCredential :exec
+UPDATE webauthn_credentials
+SET name = ?
+WHERE id = ?
+`
+
+type RenameWebAuthnCredentialParams struct {
+	Name string `db:"name" json:"name"`
+	ID   string `db:"id" json:"id"`
+}
+
+func (q *Queries) RenameWebAuthnCredential(ctx context.Context, arg RenameWebAuthnCredentialParams) error {
+	_, err := q.db.ExecContext(ctx, renameWebAuthnCredential, arg.Name, arg.ID)
+	return err
+}
+
+const touchSession = `-- name: TouchSession :exec
+UPDATE sessions
+SET last_seen_at = CURRENT_TIMESTAMP, ip_address = ?
+WHERE token = ? AND (last_seen_at IS NULL OR last_seen_at < datetime('now', '-1 minute'))
+`
+
+type TouchSessionParams struct {
+	IpAddress string `db:"ip_address" json:"ip_address"`
+	Token     string `db:"token" json:"token"`
+}
+
+// Recorded at most once a minute, so every request doesn't write
+func (q *Queries) TouchSession(ctx context.Context, arg TouchSessionParams) error {
+	_, err := q.db.ExecContext(ctx, touchSession, arg.IpAddress, arg.Token)
+	return err
+}
+
 const updateWebAuthnCredentialSignCount = `-- name: UpdateWebAuthnCredentialSignCount :exec
 UPDATE webauthn_credentials
-SET sign_count = ?
+SET sign_count = ?, last_used_at = CURRENT_TIMESTAMP
 WHERE id = ?
 `
 
@@ -0,0 +1,160 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: workflows.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createWorkflowColumn = `-- name: CreateWorkflowColumn :one
+INSERT INTO workflow_columns (project_id, status_key, name, position, wip_limit, color)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, project_id, status_key, name, position, wip_limit, color
+`
+
+type CreateWorkflowColumnParams struct {
+	ProjectID int64  `db:"project_id" json:"project_id"`
+	StatusKey string `db:"status_key" json:"status_key"`
+	Name      string `db:"name" json:"name"`
+	Position  int64  `db:"position" json:"position"`
+	WipLimit  int64  `db:"wip_limit" json:"wip_limit"`
+	Color     string `db:"color" json:"color"`
+}
+
+func (q *Queries) CreateWorkflowColumn(ctx context.Context, arg CreateWorkflowColumnParams) (WorkflowColumn, error) {
+	row := q.db.QueryRowContext(ctx, createWorkflowColumn,
+		arg.ProjectID,
+		arg.StatusKey,
+		arg.Name,
+		arg.Position,
+		arg.WipLimit,
+		arg.Color,
+	)
+	var i WorkflowColumn
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.StatusKey,
+		&i.Name,
+		&i.Position,
+		&i.WipLimit,
+		&i.Color,
+	)
+	return i, err
+}
+
+const createWorkflowRule = `-- name: CreateWorkflowRule :one
+INSERT INTO workflow_rules (project_id, event, target_status)
+VALUES (?, ?, ?)
+RETURNING id, project_id, event, target_status
+`
+
+type CreateWorkflowRuleParams struct {
+	ProjectID    int64  `db:"project_id" json:"project_id"`
+	Event        string `db:"event" json:"event"`
+	TargetStatus string `db:"target_status" json:"target_status"`
+}
+
+func (q *Queries) CreateWorkflowRule(ctx context.Context, arg CreateWorkflowRuleParams) (WorkflowRule, error) {
+	row := q.db.QueryRowContext(ctx, createWorkflowRule, arg.ProjectID, arg.Event, arg.TargetStatus)
+	var i WorkflowRule
+	err := row.Scan(
+		&i.ID,
+		&i.ProjectID,
+		&i.Event,
+		&i.TargetStatus,
+	)
+	return i, err
+}
+
+const deleteWorkflowColumnsByProjectID = `-- name: DeleteWorkflowColumnsByProjectID :exec
+DELETE FROM workflow_columns WHERE project_id = ?
+`
+
+func (q *Queries) DeleteWorkflowColumnsByProjectID(ctx context.Context, projectID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteWorkflowColumnsByProjectID, projectID)
+	return err
+}
+
+const deleteWorkflowRulesByProjectID = `-- name: DeleteWorkflowRulesByProjectID :exec
+DELETE FROM workflow_rules WHERE project_id = ?
+`
+
+func (q *Queries) DeleteWorkflowRulesByProjectID(ctx context.Context, projectID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteWorkflowRulesByProjectID, projectID)
+	return err
+}
+
+const getWorkflowColumnsByProjectID = `-- name: GetWorkflowColumnsByProjectID :many
+SELECT id, project_id, status_key, name, position, wip_limit, color FROM workflow_columns
+WHERE project_id = ?
+ORDER BY position
+`
+
+func (q *Queries) GetWorkflowColumnsByProjectID(ctx context.Context, projectID int64) ([]WorkflowColumn, error) {
+	rows, err := q.db.QueryContext(ctx, getWorkflowColumnsByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WorkflowColumn
+	for rows.Next() {
+		var i WorkflowColumn
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.StatusKey,
+			&i.Name,
+			&i.Position,
+			&i.WipLimit,
+			&i.Color,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getWorkflowRulesByProjectID = `-- name: GetWorkflowRulesByProjectID :many
+SELECT id, project_id, event, target_status FROM workflow_rules
+WHERE project_id = ?
+ORDER BY id
+`
+
+func (q *Queries) GetWorkflowRulesByProjectID(ctx context.Context, projectID int64) ([]WorkflowRule, error) {
+	rows, err := q.db.QueryContext(ctx, getWorkflowRulesByProjectID, projectID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WorkflowRule
+	for rows.Next() {
+		var i WorkflowRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.ProjectID,
+			&i.Event,
+			&i.TargetStatus,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
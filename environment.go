@@ -0,0 +1,524 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Environment variables & secrets
+// -----------------
+//
+// Variables are stored per project and can be narrowed to a base directory and/or an
+// agent. Values are sealed with AES-GCM before they reach the database. The key comes
+// from REMOTE_CODE_SECRET_KEY or, if unset, from <data dir>/secret.key, generated on first
+// use. The server refuses to start when that file is gone but values sealed with it remain,
+// rather than sealing new ones with a different key. Secret values are masked in everything
+// read back from sessions.
+
+// Shown instead of secret values in API responses and session output
+const secretMask = "********"
+
+// Key file, inside the data directory, used when REMOTE_CODE_SECRET_KEY is not set
+const secretKeyFile = "secret.key"
+
+// Key file earlier versions kept in the working directory, moved to secretKeyFile on startup
+const legacySecretKeyFile = "remote-code.key"
+
+// Secrets shorter than this are not redacted from output, they would match too much
+const minRedactedSecretLength = 4
+
+var envVarNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var secretKey []byte
+var secretKeyMutex sync.Mutex
+
+// Secret values masked in session output, loaded on first use and again after variables change
+var redactedSecretValues []string
+var redactedSecretValuesLoaded bool
+var redactedSecretValuesMutex sync.Mutex
+
+func secretKeyPath() string {
+	return filepath.Join(dataDir, secretKeyFile)
+}
+
+// getSecretKey returns the 32 byte key used to seal environment variable values
+func getSecretKey() ([]byte, error) {
+	secretKeyMutex.Lock()
+	defer secretKeyMutex.Unlock()
+
+	if secretKey != nil {
+		return secretKey, nil
+	}
+
+	// An explicit key (any string) takes precedence over the key file
+	if envKey := os.Getenv("REMOTE_CODE_SECRET_KEY"); envKey != "" {
+		sum := sha256.Sum256([]byte(envKey))
+		secretKey = sum[:]
+		return secretKey, nil
+	}
+
+	keyPath := secretKeyPath()
+	if err := moveLegacySecretKey(keyPath); err != nil {
+		return nil, err
+	}
+
+	if data, err := os.ReadFile(keyPath); err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid secret key file %s", keyPath)
+		}
+		secretKey = key
+		return secretKey, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secret key file: %v", err)
+	}
+
+	// A new key cannot open values sealed with the lost one
+	sealed, err := queries.CountSealedSecrets(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for sealed secrets: %v", err)
+	}
+	if sealed > 0 {
+		absPath, _ := filepath.Abs(keyPath)
+		return nil, fmt.Errorf("secret key file %s is missing but %d environment variables and authenticator secrets are sealed with it; restore it or set REMOTE_CODE_SECRET_KEY", absPath, sealed)
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate secret key: %v", err)
+	}
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %v", err)
+	}
+	if err := os.WriteFile(keyPath, []byte(hex.EncodeToString(key)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secret key file: %v", err)
+	}
+	absPath, _ := filepath.Abs(keyPath)
+	log.Printf("Generated new secret key in %s", absPath)
+
+	secretKey = key
+	return secretKey, nil
+}
+
+// moveLegacySecretKey moves a key file left in the working directory by earlier versions
+// into the data directory, so values sealed with it stay readable
+func moveLegacySecretKey(keyPath string) error {
+	if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(legacySecretKeyFile); err != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("failed to create data directory: %v", err)
+	}
+	if err := os.Rename(legacySecretKeyFile, keyPath); err != nil {
+		return fmt.Errorf("failed to move secret key file to %s: %v", keyPath, err)
+	}
+	log.Printf("Moved secret key file %s to %s", legacySecretKeyFile, keyPath)
+	return nil
+}
+
+func newSecretCipher() (cipher.AEAD, error) {
+	key, err := getSecretKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret seals a value; the nonce is prepended to the ciphertext
+func encryptSecret(plaintext string) (string, error) {
+	gcm, err := newSecretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(encoded string) (string, error) {
+	gcm, err := newSecretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %v", err)
+	}
+	return string(plaintext), nil
+}
+
+// handleProjectEnvironmentAPI handles /api/projects/{id}/environment
+func handleProjectEnvironmentAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	projectID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbVars, err := queries.GetEnvironmentVariablesByProjectID(ctx, projectID)
+		if err != nil {
+			log.Printf("Failed to get environment variables for project %d: %v", projectID, err)
+			http.Error(w, "Failed to get environment variables", http.StatusInternalServerError)
+			return
+		}
+
+		envVars := make([]EnvironmentVariable, 0)
+		for _, dbVar := range dbVars {
+			value := ""
+			if !dbVar.IsSecret {
+				if value, err = decryptSecret(dbVar.EncryptedValue); err != nil {
+					log.Printf("Failed to decrypt environment variable %d: %v", dbVar.ID, err)
+				}
+			}
+			envVars = append(envVars, dbEnvironmentVariableToEnvironmentVariable(dbVar, value))
+		}
+
+		json.NewEncoder(w).Encode(envVars)
+
+	case "POST":
+		if _, err := queries.GetProject(ctx, projectID); err != nil {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+
+		var createReq environmentVariableRequest
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if createReq.Value == nil {
+			http.Error(w, "Value is required", http.StatusBadRequest)
+			return
+		}
+		if err := createReq.validate(ctx, projectID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		encryptedValue, err := encryptSecret(*createReq.Value)
+		if err != nil {
+			log.Printf("Failed to encrypt environment variable: %v", err)
+			http.Error(w, "Failed to encrypt value", http.StatusInternalServerError)
+			return
+		}
+
+		dbVar, err := queries.CreateEnvironmentVariable(ctx, db.CreateEnvironmentVariableParams{
+			ProjectID:       projectID,
+			BaseDirectoryID: int64PtrToNullInt64(createReq.BaseDirectoryID),
+			AgentID:         int64PtrToNullInt64(createReq.AgentID),
+			Name:            createReq.Name,
+			EncryptedValue:  encryptedValue,
+			IsSecret:        createReq.IsSecret == nil || *createReq.IsSecret,
+		})
+		if err != nil {
+			log.Printf("Failed to create environment variable: %v", err)
+			http.Error(w, "Failed to create environment variable", http.StatusInternalServerError)
+			return
+		}
+
+		invalidateRedactedSecrets()
+		json.NewEncoder(w).Encode(dbEnvironmentVariableToEnvironmentVariable(dbVar, *createReq.Value))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleEnvironmentVariablesAPI handles /api/environment-variables/{id}
+func handleEnvironmentVariablesAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) == 0 || pathParts[0] == "" {
+		http.Error(w, "Environment variable ID required", http.StatusBadRequest)
+		return
+	}
+
+	varID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid environment variable ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := queries.GetEnvironmentVariable(ctx, varID)
+	if err != nil {
+		http.Error(w, "Environment variable not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		value := ""
+		if !existing.IsSecret {
+			value, _ = decryptSecret(existing.EncryptedValue)
+		}
+		json.NewEncoder(w).Encode(dbEnvironmentVariableToEnvironmentVariable(existing, value))
+
+	case "PUT":
+		var updateReq environmentVariableRequest
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := updateReq.validate(ctx, existing.ProjectID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Omitting the value (or sending back the mask) keeps the stored one
+		encryptedValue := existing.EncryptedValue
+		if updateReq.Value != nil && *updateReq.Value != secretMask {
+			encryptedValue, err = encryptSecret(*updateReq.Value)
+			if err != nil {
+				log.Printf("Failed to encrypt environment variable: %v", err)
+				http.Error(w, "Failed to encrypt value", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		isSecret := existing.IsSecret
+		if updateReq.IsSecret != nil {
+			isSecret = *updateReq.IsSecret
+		}
+
+		updated, err := queries.UpdateEnvironmentVariable(ctx, db.UpdateEnvironmentVariableParams{
+			ID:              varID,
+			BaseDirectoryID: int64PtrToNullInt64(updateReq.BaseDirectoryID),
+			AgentID:         int64PtrToNullInt64(updateReq.AgentID),
+			Name:            updateReq.Name,
+			EncryptedValue:  encryptedValue,
+			IsSecret:        isSecret,
+		})
+		if err != nil {
+			log.Printf("Failed to update environment variable %d: %v", varID, err)
+			http.Error(w, "Failed to update environment variable", http.StatusInternalServerError)
+			return
+		}
+
+		invalidateRedactedSecrets()
+		value, _ := decryptSecret(updated.EncryptedValue)
+		json.NewEncoder(w).Encode(dbEnvironmentVariableToEnvironmentVariable(updated, value))
+
+	case "DELETE":
+		if err := queries.DeleteEnvironmentVariable(ctx, varID); err != nil {
+			log.Printf("Failed to delete environment variable %d: %v", varID, err)
+			http.Error(w, "Failed to delete environment variable", http.StatusInternalServerError)
+			return
+		}
+		invalidateRedactedSecrets()
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// environmentVariableRequest is the create/update payload for a variable
+type environmentVariableRequest struct {
+	BaseDirectoryID *int64  `json:"base_directory_id"`
+	AgentID         *int64  `json:"agent_id"`
+	Name            string  `json:"name"`
+	Value           *string `json:"value"`
+	IsSecret        *bool   `json:"is_secret"`
+}
+
+// validate checks the name and that the base directory and agent overrides exist
+func (req *environmentVariableRequest) validate(ctx context.Context, projectID int64) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if !envVarNamePattern.MatchString(req.Name) {
+		return fmt.Errorf("Name must contain only letters, digits and underscores and not start with a digit")
+	}
+
+	if req.BaseDirectoryID != nil {
+		baseDir, err := queries.GetBaseDirectory(ctx, *req.BaseDirectoryID)
+		if err != nil || baseDir.ProjectID != projectID {
+			return fmt.Errorf("Base directory not found in this project")
+		}
+	}
+
+	if req.AgentID != nil {
+		if _, err := queries.GetAgent(ctx, *req.AgentID); err != nil {
+			return fmt.Errorf("Agent not found")
+		}
+	}
+	return nil
+}
+
+// resolveSessionEnvironment returns the variables for a session in a project's base directory.
+// agentID is 0 for sessions that don't run an agent (e.g. directory dev servers).
+// When a name is defined more than once the most specific definition wins:
+// base directory + agent, then base directory, then project + agent, then project.
+func resolveSessionEnvironment(ctx context.Context, projectID, baseDirectoryID, agentID int64) (map[string]string, error) {
+	dbVars, err := queries.GetEnvironmentVariablesByProjectID(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	env := make(map[string]string)
+	specificity := make(map[string]int)
+
+	for _, dbVar := range dbVars {
+		score := 0
+		if dbVar.BaseDirectoryID.Valid {
+			if dbVar.BaseDirectoryID.Int64 != baseDirectoryID {
+				continue
+			}
+			score += 2
+		}
+		if dbVar.AgentID.Valid {
+			if dbVar.AgentID.Int64 != agentID {
+				continue
+			}
+			score++
+		}
+
+		if current, exists := specificity[dbVar.Name]; exists && current > score {
+			continue
+		}
+
+		value, err := decryptSecret(dbVar.EncryptedValue)
+		if err != nil {
+			log.Printf("Failed to decrypt environment variable %s (%d): %v", dbVar.Name, dbVar.ID, err)
+			continue
+		}
+		env[dbVar.Name] = value
+		specificity[dbVar.Name] = score
+	}
+
+	return env, nil
+}
+
+// sessionEnvironment resolves a session's variables as NAME=value pairs, sorted by name
+func sessionEnvironment(ctx context.Context, projectID, baseDirectoryID, agentID int64) []string {
+	env, err := resolveSessionEnvironment(ctx, projectID, baseDirectoryID, agentID)
+	if err != nil {
+		log.Printf("Warning: failed to resolve environment variables for project %d: %v", projectID, err)
+		return nil
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+env[name])
+	}
+	return pairs
+}
+
+// loadRedactedSecrets returns the secret values to mask, longest first so a secret
+// containing another is masked as a whole
+func loadRedactedSecrets(ctx context.Context) []string {
+	redactedSecretValuesMutex.Lock()
+	defer redactedSecretValuesMutex.Unlock()
+
+	if redactedSecretValuesLoaded {
+		return redactedSecretValues
+	}
+
+	secrets, err := queries.GetSecretEnvironmentVariables(ctx)
+	if err != nil {
+		log.Printf("Failed to load secret environment variables: %v", err)
+		return nil
+	}
+
+	values := make([]string, 0, len(secrets))
+	for _, dbVar := range secrets {
+		value, err := decryptSecret(dbVar.EncryptedValue)
+		if err != nil || len(value) < minRedactedSecretLength {
+			continue
+		}
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+
+	redactedSecretValues = values
+	redactedSecretValuesLoaded = true
+	return values
+}
+
+// invalidateRedactedSecrets makes the next redaction reload the secret values
+func invalidateRedactedSecrets() {
+	redactedSecretValuesMutex.Lock()
+	defer redactedSecretValuesMutex.Unlock()
+	redactedSecretValues = nil
+	redactedSecretValuesLoaded = false
+}
+
+// redactSecrets replaces every known secret value in session output with the mask
+func redactSecrets(ctx context.Context, text string) string {
+	if text == "" {
+		return text
+	}
+	for _, value := range loadRedactedSecrets(ctx) {
+		text = strings.ReplaceAll(text, value, secretMask)
+	}
+	return text
+}
+
+// partialSecretLength returns how many bytes at the end of text could be the start of a
+// secret, so a stream can hold them back until it knows whether the rest follows
+func partialSecretLength(ctx context.Context, text string) int {
+	longest := 0
+	for _, value := range loadRedactedSecrets(ctx) {
+		for n := min(len(value)-1, len(text)); n > longest; n-- {
+			if strings.HasSuffix(text, value[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+func int64PtrToNullInt64(i *int64) sql.NullInt64 {
+	if i == nil {
+		return sql.NullInt64{Valid: false}
+	}
+	return sql.NullInt64{Int64: *i, Valid: true}
+}
@@ -1,8 +1,17 @@
 import { writable } from 'svelte/store';
 
+export interface AuthUser {
+	id: number;
+	name: string;
+	display_name: string;
+	role: 'admin' | 'operator' | 'viewer';
+}
+
 export interface AuthState {
 	authenticated: boolean;
 	hasCredentials: boolean;
+	setupMode: boolean;
+	user: AuthUser | null;
 	loading: boolean;
 	error: string | null;
 }
@@ -11,6 +20,8 @@ function createAuthStore() {
 	const { subscribe, set, update } = writable<AuthState>({
 		authenticated: false,
 		hasCredentials: false,
+		setupMode: false,
+		user: null,
 		loading: true,
 		error: null
 	});
@@ -29,6 +40,8 @@ function createAuthStore() {
 					set({
 						authenticated: data.authenticated,
 						hasCredentials: data.hasCredentials,
+						setupMode: data.setupMode,
+						user: data.user ?? null,
 						loading: false,
 						error: null
 					});
@@ -46,17 +59,22 @@ function createAuthStore() {
 			}
 		},
 
-		async registerPasskey(): Promise<boolean> {
+		// registerPasskey adds a passkey for the signed in user, an invited user, a device paired
+		// with a pairing code, or the first admin
+		async registerPasskey(grant: { invite?: string; pairing?: string } = {}): Promise<boolean> {
 			update((state) => ({ ...state, loading: true, error: null }));
 			try {
 				// Begin registration
 				const beginRes = await fetch('/api/auth/register/begin', {
 					method: 'POST',
+					headers: { 'Content-Type': 'application/json' },
+					body: JSON.stringify(grant),
 					credentials: 'include'
 				});
 
 				if (!beginRes.ok) {
-					throw new Error('Failed to begin registration');
+					const errorText = await beginRes.text();
+					throw new Error(errorText || 'Failed to begin registration');
 				}
 
 				const options = await beginRes.json();
@@ -109,12 +127,8 @@ function createAuthStore() {
 					throw new Error(errorText || 'Failed to complete registration');
 				}
 
-				set({
-					authenticated: true,
-					hasCredentials: true,
-					loading: false,
-					error: null
-				});
+				// Load who signed in
+				await this.checkStatus();
 
 				return true;
 			} catch (error) {
@@ -193,13 +207,39 @@ function createAuthStore() {
 					throw new Error(errorText || 'Failed to complete login');
 				}
 
-				set({
-					authenticated: true,
-					hasCredentials: true,
+				// Load who signed in
+				await this.checkStatus();
+
+				return true;
+			} catch (error) {
+				update((state) => ({
+					...state,
 					loading: false,
-					error: null
+					error: error instanceof Error ? error.message : 'Login failed'
+				}));
+				return false;
+			}
+		},
+
+		// loginWithCode signs in with an authenticator app code, for domains without a passkey
+		async loginWithCode(name: string, code: string): Promise<boolean> {
+			update((state) => ({ ...state, loading: true, error: null }));
+			try {
+				const response = await fetch('/api/auth/totp/login', {
+					method: 'POST',
+					headers: { 'Content-Type': 'application/json' },
+					body: JSON.stringify({ name, code }),
+					credentials: 'include'
 				});
 
+				if (!response.ok) {
+					const errorText = await response.text();
+					throw new Error(errorText || 'Failed to login');
+				}
+
+				// Load who signed in
+				await this.checkStatus();
+
 				return true;
 			} catch (error) {
 				update((state) => ({
@@ -224,6 +264,7 @@ function createAuthStore() {
 			set({
 				authenticated: false,
 				hasCredentials: true,
+				setupMode: false,
 				loading: false,
 				error: null
 			});
@@ -0,0 +1,52 @@
+import { writable, get } from 'svelte/store';
+import { browser } from '$app/environment';
+
+export interface RootSummary {
+	id: number;
+	name: string;
+	local_port: string;
+	external_url?: string;
+	projects: number;
+	agents: number;
+	is_default: boolean;
+}
+
+const STORAGE_KEY = 'remote-code-root-id';
+const DEFAULT_ROOT_ID = 1;
+
+function createRootStore() {
+	const initial = browser ? Number(localStorage.getItem(STORAGE_KEY)) || DEFAULT_ROOT_ID : DEFAULT_ROOT_ID;
+	const { subscribe, set } = writable<number>(initial);
+
+	return {
+		subscribe,
+
+		select(rootId: number) {
+			if (browser) {
+				localStorage.setItem(STORAGE_KEY, String(rootId));
+			}
+			set(rootId);
+		},
+
+		// Lists the roots, falling back to the default root when the selected one is gone
+		async load(): Promise<RootSummary[]> {
+			const response = await fetch('/api/roots');
+			if (!response.ok) {
+				return [];
+			}
+			const roots: RootSummary[] = await response.json();
+			if (roots.length > 0 && !roots.some((root) => root.id === get({ subscribe }))) {
+				this.select(roots[0].id);
+			}
+			return roots;
+		}
+	};
+}
+
+export const currentRoot = createRootStore();
+
+// withRoot adds the selected root to an API URL
+export function withRoot(url: string): string {
+	const separator = url.includes('?') ? '&' : '?';
+	return `${url}${separator}root_id=${get(currentRoot)}`;
+}
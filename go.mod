@@ -9,6 +9,7 @@ require (
 	github.com/go-webauthn/webauthn v0.15.0
 	github.com/gorilla/websocket v1.5.1
 	github.com/robert-nix/ansihtml v1.0.1
+	gopkg.in/yaml.v3 v3.0.1
 	modernc.org/sqlite v1.38.2
 )
 
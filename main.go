@@ -1,25 +1,22 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 
 	"remote-code/db"
 
-	"github.com/creack/pty"
 	"github.com/gorilla/websocket"
 )
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin: checkWebSocketOrigin,
 }
 
 var database *sql.DB
@@ -30,24 +27,96 @@ func main() {
 	database, queries = initDatabase()
 	defer database.Close()
 
+	// Load the key sealing secrets, before anything needs it
+	if _, err := getSecretKey(); err != nil {
+		log.Fatalf("Failed to load the secret key: %v", err)
+	}
+
+	// Bring agents, projects and base directories in line with remote-code.yaml
+	if result, found, err := applyConfigFile(context.Background()); err != nil {
+		log.Fatalf("Failed to apply configuration: %v", err)
+	} else if found {
+		log.Printf("Applied %s: %d created, %d updated, %d unchanged", configPath(), result.Created, result.Updated, result.Unchanged)
+	}
+
+	// Pick the terminal session backend for this deployment
+	backend, err := newSessionManager(os.Getenv("REMOTE_CODE_SESSION_BACKEND"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sessionManager = backend
+
+	// Answer agent prompts covered by auto-responder rules
+	go runAutoResponder()
+
+	// Record sandbox violations of sandboxed agents
+	go runSandboxMonitor()
+
+	// Sample session cgroups and record throttling and kills
+	go runResourceMonitor()
+
+	// Take periodic and idle git checkpoints of running executions
+	go runCheckpointMonitor()
+
+	// Delete expired login sessions
+	deleteExpiredSessions(context.Background())
+	go runSessionCleanup()
+
+	// Delete audit log entries past the retention period
+	deleteExpiredAuditLogEntries(context.Background())
+	go runAuditLogCleanup()
+
 	// Setup HTTP routes
 	http.HandleFunc("/", serveHome)
-	http.HandleFunc("/ws", authMiddleware(handleWebSocket))
+	http.HandleFunc("/.well-known/webauthn", handleWebAuthnWellKnown)
+	http.HandleFunc("/ca.crt", handleCACertDownload)
+	http.HandleFunc("/ws", handleWebSocketWithAuth)
 	http.HandleFunc("/api/", handleAPIWithAuth)
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	port := listenPort()
+
+	// Serve HTTPS when certificates are configured or generated
+	certFile, keyFile, err := setupTLS()
+	if err != nil {
+		log.Fatalf("Failed to set up TLS: %v", err)
+	}
+	if certFile != "" {
+		log.Printf("Server starting with HTTPS on :%s", port)
+		log.Fatal(http.ListenAndServeTLS(":"+port, certFile, keyFile, nil))
 	}
 
 	log.Printf("Server starting on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
-// handleAPIWithAuth wraps the API handler with authentication where needed
+// listenPort returns the port the server listens on
+func listenPort() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return port
+	}
+	return "8080"
+}
+
+// handleAPIWithAuth wraps the API handler with the audit log, and the origin check and
+// authentication it records refusals of
 func handleAPIWithAuth(w http.ResponseWriter, r *http.Request) {
-	// Auth endpoints don't require authentication
+	auditMiddleware(authorizeAPIRequest)(w, r)
+}
+
+// authorizeAPIRequest refuses forged requests and signs the user in where needed
+func authorizeAPIRequest(w http.ResponseWriter, r *http.Request) {
+	// Refuse changes other sites try to make with the user's cookie
+	if crossSiteRequest(r) {
+		log.Printf("Refused cross-site %s %s from %q", r.Method, r.URL.Path, r.Header.Get("Origin"))
+		http.Error(w, "Cross-site request refused", http.StatusForbidden)
+		return
+	}
+
+	// Auth endpoints don't require authentication; whoever is signed in is still recorded
 	if strings.HasPrefix(r.URL.Path, "/api/auth/") {
+		if user, ok := cookieUser(r.Context(), r); ok {
+			noteAuditUser(r, user)
+		}
 		handleAPI(w, r)
 		return
 	}
@@ -56,6 +125,21 @@ func handleAPIWithAuth(w http.ResponseWriter, r *http.Request) {
 	authMiddleware(handleAPI)(w, r)
 }
 
+// handleWebSocketWithAuth wraps the terminal WebSocket like handleAPIWithAuth
+func handleWebSocketWithAuth(w http.ResponseWriter, r *http.Request) {
+	auditMiddleware(authorizeWebSocket)(w, r)
+}
+
+// authorizeWebSocket refuses terminals opened by other sites before signing the user in
+func authorizeWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !checkWebSocketOrigin(r) {
+		log.Printf("Refused cross-site terminal from %q", r.Header.Get("Origin"))
+		http.Error(w, "Cross-site request refused", http.StatusForbidden)
+		return
+	}
+	authMiddleware(handleWebSocket)(w, r)
+}
+
 func serveHome(w http.ResponseWriter, r *http.Request) {
 	// API routes should be handled by the API handler
 	if strings.HasPrefix(r.URL.Path, "/api/") {
@@ -89,26 +173,17 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 	// Check if a specific session is requested
 	sessionName := r.URL.Query().Get("session")
-	
-	var cmd *exec.Cmd
+
+	var ptmx SessionPTY
 	if sessionName != "" {
-		// Attach to specific tmux session
-		log.Printf("Attaching to tmux session: %s", sessionName)
-		cmd = exec.Command("tmux", "attach-session", "-t", sessionName)
+		// Attach to specific session
+		log.Printf("Attaching to session: %s", sessionName)
+		ptmx, err = sessionManager.AttachPTY(sessionName, false)
 	} else {
 		// Create or attach to global session for general terminal use
 		log.Printf("Creating/attaching to global terminal session")
-		cmd = exec.Command("tmux", "new-session", "-A", "-s", "remote-code")
+		ptmx, err = sessionManager.AttachPTY(defaultTerminalSession, true)
 	}
-
-	// Ensure proper terminal environment for UTF-8 and colors
-	cmd.Env = append(os.Environ(),
-		"LANG=C.UTF-8",
-		"LC_ALL=C.UTF-8",
-		"TERM=xterm-256color",
-	)
- 
- 	ptmx, err := pty.Start(cmd)
 	if err != nil {
 		log.Printf("Failed to start pty: %v", err)
 		return
@@ -120,6 +195,8 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			_, message, err := conn.ReadMessage()
 			if err != nil {
 				log.Printf("WebSocket read error: %v", err)
+				// Detach so the output loop below ends too
+				ptmx.Close()
 				break
 			}
 
@@ -132,7 +209,7 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			var rm resizeMsg
 			if err := json.Unmarshal(message, &rm); err == nil && rm.Type == "resize" {
 				if rm.Cols > 0 && rm.Rows > 0 {
-					_ = pty.Setsize(ptmx, &pty.Winsize{Cols: uint16(rm.Cols), Rows: uint16(rm.Rows)})
+					_ = ptmx.Resize(uint16(rm.Cols), uint16(rm.Rows))
 				}
 				continue
 			}
@@ -141,23 +218,19 @@ func handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	go func() {
-		buf := make([]byte, 4096)
-		for {
-			n, err := ptmx.Read(buf)
-			if err != nil {
-				if err != io.EOF {
-					log.Printf("PTY read error: %v", err)
-				}
-				break
-			}
-			// Send raw bytes as a binary WebSocket frame; the browser will decode UTF-8 progressively
-			if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
-				log.Printf("WebSocket write error: %v", err)
-				break
+	buf := make([]byte, 4096)
+	for {
+		n, err := ptmx.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("PTY read error: %v", err)
 			}
+			break
 		}
-	}()
-
-	cmd.Wait()
+		// Send raw bytes as a binary WebSocket frame; the browser will decode UTF-8 progressively
+		if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+			log.Printf("WebSocket write error: %v", err)
+			break
+		}
+	}
 }
\ No newline at end of file
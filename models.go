@@ -3,27 +3,32 @@ package main
 import (
 	"database/sql"
 	"remote-code/db"
+	"strings"
+	"time"
 )
 
 // Root represents the main configuration structure
 type Root struct {
+	ID              int64     `yaml:"-" json:"id"`
+	Name            string    `yaml:"-" json:"name"`
 	Projects        []Project `yaml:"projects" json:"projects"`
 	AvailableAgents []Agent   `yaml:"available_agents" json:"available_agents"`
-	LocalPort       string    `yaml:"local_port" json:"local_port"`
+	LocalPort       string    `yaml:"local_port,omitempty" json:"local_port"`
 	ExternalUrl     *string   `yaml:"-" json:"external_url,omitempty"`
 }
 
 // Project represents a project configuration
 type Project struct {
-	ID              int64           `json:"id"`
+	ID              int64           `yaml:"-" json:"id"`
 	Name            string          `yaml:"name" json:"name"`
 	BaseDirectories []BaseDirectory `yaml:"base_directories" json:"baseDirectories"`
-	Tasks           []Task          `yaml:"tasks" json:"tasks"`
+	Tasks           []Task          `yaml:"tasks,omitempty" json:"tasks"`
+	Workflow        *Workflow       `yaml:"-" json:"workflow,omitempty"`
 }
 
 // BaseDirectory represents a base directory configuration
 type BaseDirectory struct {
-	ID                        int64  `json:"id"`
+	ID                        int64  `yaml:"-" json:"id"`
 	BaseDirectoryId           string `yaml:"base_directory_id" json:"base_directory_id"`
 	Path                      string `yaml:"path" json:"path"`
 	GitInitialized            bool   `yaml:"git_initialized" json:"git_initialized"`
@@ -34,12 +39,20 @@ type BaseDirectory struct {
 }
 
 // Task represents a task configuration
+
 type Task struct {
-	ID              int64         `json:"id"`
-	Title           string        `yaml:"title" json:"title"`
-	Description     string        `yaml:"description" json:"description"`
-	Status          string        `json:"status"` // For Kanban board (todo, in_progress, done)
-	BaseDirectory   BaseDirectory `json:"baseDirectory"`
+	ID               int64         `json:"id"`
+	Title            string        `yaml:"title" json:"title"`
+	Description      string        `yaml:"description" json:"description"`
+	Status           string        `json:"status"` // Key of the task's column on the project's board
+	SortOrder        int64         `json:"sort_order"`
+	ProjectID        int64         `json:"project_id"`
+	Labels           []string      `json:"labels"`
+	Priority         string        `json:"priority"`                     // none, low, medium, high or urgent
+	PreferredAgentID *int64        `json:"preferred_agent_id,omitempty"` // Agent used when an execution names none
+	DueDate          string        `json:"due_date,omitempty"`           // YYYY-MM-DD
+	ExternalID       string        `json:"external_id,omitempty"`        // Source of imported tasks, e.g. github:owner/repo#12
+	BaseDirectory    BaseDirectory `json:"baseDirectory"`
 }
 
 // TaskExecution represents a task being executed by an agent
@@ -55,12 +68,123 @@ type TaskExecution struct {
 
 // Agent represents an available agent
 type Agent struct {
-	ID      int64  `json:"id"`
+	ID      int64  `yaml:"-" json:"id"`
 	Name    string `yaml:"name" json:"name"`
 	Command string `yaml:"command" json:"command"`
 	Params  string `yaml:"params" json:"params"`
 }
 
+// AutoResponseRule answers a routine agent prompt without a human in the loop
+type AutoResponseRule struct {
+	ID            int64    `json:"id"`
+	ProjectID     int64    `json:"project_id"`
+	Name          string   `json:"name"`
+	PromptPattern string   `json:"prompt_pattern"`
+	SubjectType   string   `json:"subject_type"` // command or path
+	ListMode      string   `json:"list_mode"`    // allow or deny
+	Subjects      []string `json:"subjects"`
+	ResponseKeys  string   `json:"response_keys"`
+	Enabled       bool     `json:"enabled"`
+}
+
+// EnvironmentVariable is injected into agent and dev server sessions.
+// Secret values are never returned by the API.
+type EnvironmentVariable struct {
+	ID              int64  `json:"id"`
+	ProjectID       int64  `json:"project_id"`
+	BaseDirectoryID *int64 `json:"base_directory_id"` // nil applies to every base directory
+	AgentID         *int64 `json:"agent_id"`          // nil applies to every agent
+	Name            string `json:"name"`
+	Value           string `json:"value"`
+	IsSecret        bool   `json:"is_secret"`
+}
+
+// SandboxPolicy restricts what an agent can touch outside its base directory
+type SandboxPolicy struct {
+	ID            int64    `json:"id"`
+	ProjectID     *int64   `json:"project_id"`
+	AgentID       *int64   `json:"agent_id"`
+	Enabled       bool     `json:"enabled"`
+	AllowNetwork  bool     `json:"allow_network"`
+	ReadonlyPaths []string `json:"readonly_paths"`
+	WritablePaths []string `json:"writable_paths"`
+}
+
+// ResourceLimits caps a session's cgroup. Zero means no limit.
+type ResourceLimits struct {
+	CPUPercent int64 `json:"cpu_percent"` // 100 = one full CPU
+	MemoryMB   int64 `json:"memory_mb"`
+	PidsMax    int64 `json:"pids_max"`
+}
+
+// ResourceUsage is a live sample of a session's cgroup
+type ResourceUsage struct {
+	Cgroup      string         `json:"cgroup"`
+	CPUPercent  float64        `json:"cpu_percent"`
+	MemoryBytes int64          `json:"memory_bytes"`
+	Pids        int64          `json:"pids"`
+	Limits      ResourceLimits `json:"limits"`
+}
+
+// ExecutionCheckpoint is a snapshot of an execution's working tree kept under a hidden git ref
+type ExecutionCheckpoint struct {
+	ID              int64     `json:"id"`
+	TaskExecutionID int64     `json:"task_execution_id"`
+	Sequence        int64     `json:"sequence"`
+	Ref             string    `json:"ref"`
+	CommitSHA       string    `json:"commit_sha"`
+	Reason          string    `json:"reason"` // interval, idle, manual or before_restore
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// TaskAttachment is a file handed to the agents working on a task
+type TaskAttachment struct {
+	ID          int64     `json:"id"`
+	TaskID      int64     `json:"task_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TaskComment is a note on a task, optionally about one of its executions
+type TaskComment struct {
+	ID              int64     `json:"id"`
+	TaskID          int64     `json:"task_id"`
+	TaskExecutionID *int64    `json:"task_execution_id"`
+	AuthorType      string    `json:"author_type"` // human or system
+	Author          string    `json:"author"`
+	Kind            string    `json:"kind"` // comment, feedback, accept, rerun or start
+	Body            string    `json:"body"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PullRequest proposes merging a task branch into a target branch of a local repository
+type PullRequest struct {
+	ID              int64      `json:"id"`
+	ProjectID       int64      `json:"project_id"`
+	BaseDirectoryID int64      `json:"base_directory_id"`
+	TaskID          *int64     `json:"task_id"`
+	ExecutionIDs    []int64    `json:"execution_ids"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	SourceBranch    string     `json:"source_branch"`
+	TargetBranch    string     `json:"target_branch"`
+	Status          string     `json:"status"` // open, merged or closed
+	MergeStrategy   string     `json:"merge_strategy,omitempty"`
+	MergeCommitSHA  string     `json:"merge_commit_sha,omitempty"`
+	MergedAt        *time.Time `json:"merged_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+
+	// Live state of the branches, filled in for open pull requests
+	SourceSHA      string `json:"source_sha,omitempty"`
+	TargetSHA      string `json:"target_sha,omitempty"`
+	Ahead          int    `json:"ahead"`  // commits on source not on target
+	Behind         int    `json:"behind"` // commits on target not on source
+	CanFastForward bool   `json:"can_fast_forward"`
+}
+
 // Conversion functions from database models to API models
 
 func dbRootToRoot(dbRoot db.Root, agents []db.Agent, projects []Project) Root {
@@ -79,6 +203,8 @@ func dbRootToRoot(dbRoot db.Root, agents []db.Agent, projects []Project) Root {
 	}
 
 	return Root{
+		ID:              dbRoot.ID,
+		Name:            dbRoot.Name,
 		Projects:        projects,
 		AvailableAgents: availableAgents,
 		LocalPort:       dbRoot.LocalPort,
@@ -99,13 +225,41 @@ func dbBaseDirectoryToBaseDirectory(dbBaseDir db.BaseDirectory) BaseDirectory {
 	}
 }
 
-func dbTaskToTask(dbTask db.Task, baseDirectory BaseDirectory) Task {
+func dbTaskToTask(dbTask db.Task, baseDirectory BaseDirectory, labels []string) Task {
+	if labels == nil {
+		labels = []string{}
+	}
+	var preferredAgentID *int64
+	if dbTask.PreferredAgentID.Valid {
+		preferredAgentID = &dbTask.PreferredAgentID.Int64
+	}
 	return Task{
-		ID:            dbTask.ID,
-		Title:         dbTask.Title,
-		Description:   dbTask.Description,
-		Status:        dbTask.Status,
-		BaseDirectory: baseDirectory,
+		ID:               dbTask.ID,
+		Title:            dbTask.Title,
+		Description:      dbTask.Description,
+		Status:           dbTask.Status,
+		SortOrder:        dbTask.SortOrder,
+		ProjectID:        dbTask.ProjectID,
+		Labels:           labels,
+		Priority:         taskPriorityName(dbTask.Priority),
+		PreferredAgentID: preferredAgentID,
+		DueDate:          dbTask.DueDate,
+		ExternalID:       dbTask.ExternalID,
+		BaseDirectory:    baseDirectory,
+	}
+}
+
+func dbAutoResponseRuleToAutoResponseRule(dbRule db.AutoResponseRule) AutoResponseRule {
+	return AutoResponseRule{
+		ID:            dbRule.ID,
+		ProjectID:     dbRule.ProjectID,
+		Name:          dbRule.Name,
+		PromptPattern: dbRule.PromptPattern,
+		SubjectType:   dbRule.SubjectType,
+		ListMode:      dbRule.ListMode,
+		Subjects:      splitLines(dbRule.Subjects),
+		ResponseKeys:  dbRule.ResponseKeys,
+		Enabled:       dbRule.Enabled,
 	}
 }
 
@@ -122,4 +276,127 @@ func nullStringToString(ns sql.NullString) string {
 		return ns.String
 	}
 	return ""
-}
\ No newline at end of file
+}
+
+func dbEnvironmentVariableToEnvironmentVariable(dbVar db.EnvironmentVariable, value string) EnvironmentVariable {
+	envVar := EnvironmentVariable{
+		ID:        dbVar.ID,
+		ProjectID: dbVar.ProjectID,
+		Name:      dbVar.Name,
+		Value:     value,
+		IsSecret:  dbVar.IsSecret,
+	}
+	if dbVar.BaseDirectoryID.Valid {
+		envVar.BaseDirectoryID = &dbVar.BaseDirectoryID.Int64
+	}
+	if dbVar.AgentID.Valid {
+		envVar.AgentID = &dbVar.AgentID.Int64
+	}
+	if dbVar.IsSecret {
+		envVar.Value = secretMask
+	}
+	return envVar
+}
+
+func dbSandboxPolicyToSandboxPolicy(dbPolicy db.SandboxPolicy) SandboxPolicy {
+	policy := SandboxPolicy{
+		ID:            dbPolicy.ID,
+		Enabled:       dbPolicy.Enabled,
+		AllowNetwork:  dbPolicy.AllowNetwork,
+		ReadonlyPaths: splitLines(dbPolicy.ReadonlyPaths),
+		WritablePaths: splitLines(dbPolicy.WritablePaths),
+	}
+	if dbPolicy.ProjectID.Valid {
+		policy.ProjectID = &dbPolicy.ProjectID.Int64
+	}
+	if dbPolicy.AgentID.Valid {
+		policy.AgentID = &dbPolicy.AgentID.Int64
+	}
+	return policy
+}
+
+// splitLines splits newline separated values, dropping blanks; never returns nil
+func splitLines(s string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func dbResourceLimitToResourceLimits(dbLimit db.ResourceLimit) ResourceLimits {
+	return ResourceLimits{
+		CPUPercent: dbLimit.CpuPercent,
+		MemoryMB:   dbLimit.MemoryMb,
+		PidsMax:    dbLimit.PidsMax,
+	}
+}
+
+func dbExecutionCheckpointToExecutionCheckpoint(dbCheckpoint db.ExecutionCheckpoint) ExecutionCheckpoint {
+	return ExecutionCheckpoint{
+		ID:              dbCheckpoint.ID,
+		TaskExecutionID: dbCheckpoint.TaskExecutionID,
+		Sequence:        dbCheckpoint.Sequence,
+		Ref:             dbCheckpoint.RefName,
+		CommitSHA:       dbCheckpoint.CommitSha,
+		Reason:          dbCheckpoint.Reason,
+		CreatedAt:       dbCheckpoint.CreatedAt.Time,
+	}
+}
+
+func dbTaskAttachmentToTaskAttachment(dbAttachment db.TaskAttachment) TaskAttachment {
+	return TaskAttachment{
+		ID:          dbAttachment.ID,
+		TaskID:      dbAttachment.TaskID,
+		Filename:    dbAttachment.Filename,
+		ContentType: dbAttachment.ContentType,
+		Size:        dbAttachment.Size,
+		CreatedAt:   dbAttachment.CreatedAt.Time,
+	}
+}
+
+func dbTaskCommentToTaskComment(dbComment db.TaskComment) TaskComment {
+	comment := TaskComment{
+		ID:         dbComment.ID,
+		TaskID:     dbComment.TaskID,
+		AuthorType: dbComment.AuthorType,
+		Author:     dbComment.Author,
+		Kind:       dbComment.Kind,
+		Body:       dbComment.Body,
+		CreatedAt:  dbComment.CreatedAt.Time,
+		UpdatedAt:  dbComment.UpdatedAt.Time,
+	}
+	if dbComment.TaskExecutionID.Valid {
+		comment.TaskExecutionID = &dbComment.TaskExecutionID.Int64
+	}
+	return comment
+}
+
+func dbPullRequestToPullRequest(dbPR db.PullRequest, executionIDs []int64) PullRequest {
+	pr := PullRequest{
+		ID:              dbPR.ID,
+		ProjectID:       dbPR.ProjectID,
+		BaseDirectoryID: dbPR.BaseDirectoryID,
+		ExecutionIDs:    executionIDs,
+		Title:           dbPR.Title,
+		Description:     dbPR.Description,
+		SourceBranch:    dbPR.SourceBranch,
+		TargetBranch:    dbPR.TargetBranch,
+		Status:          dbPR.Status,
+		MergeStrategy:   dbPR.MergeStrategy,
+		MergeCommitSHA:  dbPR.MergeCommitSha,
+		CreatedAt:       dbPR.CreatedAt.Time,
+	}
+	if pr.ExecutionIDs == nil {
+		pr.ExecutionIDs = []int64{}
+	}
+	if dbPR.TaskID.Valid {
+		pr.TaskID = &dbPR.TaskID.Int64
+	}
+	if dbPR.MergedAt.Valid {
+		pr.MergedAt = &dbPR.MergedAt.Time
+	}
+	return pr
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// -----------------
+// Allowed origins
+// -----------------
+//
+// Browsers attach the session cookie to requests any site makes, so the API and the terminal
+// WebSocket only answer pages from allowed origins: this server's own origin, the related
+// origins of the canonical RP ID, and REMOTE_CODE_ALLOWED_ORIGINS, a comma separated list of
+// origins such as "https://code.example.com" or "https://*.example.com" for any subdomain.
+// Any local process can serve a page on a loopback port, so development servers such as
+// "http://localhost:5173" are only allowed when listed. The same list decides CORS, WebSocket
+// upgrades and whether a state-changing request is a forgery.
+
+// allowedOriginPatterns returns the configured origins; a "*." host matches any subdomain
+func allowedOriginPatterns() []string {
+	var patterns []string
+	for _, value := range strings.Split(os.Getenv("REMOTE_CODE_ALLOWED_ORIGINS"), ",") {
+		if value = strings.ToLower(strings.TrimRight(strings.TrimSpace(value), "/")); value != "" {
+			patterns = append(patterns, value)
+		}
+	}
+	return patterns
+}
+
+// originAllowed reports whether a page from origin may use the API of the server r reached
+func originAllowed(r *http.Request, origin string) bool {
+	parsed, err := url.Parse(strings.ToLower(origin))
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return false
+	}
+	origin = parsed.Scheme + "://" + parsed.Host
+
+	// Same origin
+	if origin == strings.ToLower(getOriginFromRequest(r)) {
+		return true
+	}
+
+	for _, pattern := range allowedOriginPatterns() {
+		if pattern == origin {
+			return true
+		}
+		scheme, wildcardHost, ok := strings.Cut(pattern, "://*.")
+		if ok && scheme == parsed.Scheme && strings.HasSuffix(parsed.Host, "."+wildcardHost) {
+			return true
+		}
+	}
+	if canonicalRPID() != "" {
+		for _, related := range relatedOrigins(r.Context()) {
+			if related == origin {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkWebSocketOrigin is the WebSocket upgrader's origin check. Clients that send no Origin
+// are not browsers, which are the only ones a forged request could come from.
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || originAllowed(r, origin)
+}
+
+// crossSiteRequest reports whether a state-changing request may have been forged by another
+// site: it comes from an origin that is not allowed or, from browsers that send no Origin,
+// with a Sec-Fetch-Site other than same-origin. Reads, requests with an API token (which
+// browsers never add on their own) and clients sending neither header pass.
+func crossSiteRequest(r *http.Request) bool {
+	if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+		return false
+	}
+	if _, ok := bearerToken(r); ok {
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return !originAllowed(r, origin)
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "", "same-origin", "none":
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Device pairing
+// -----------------
+//
+// A domain without passkeys used to be open to anyone until someone registered one, which left
+// every fresh tunnel URL unprotected. Now only a brand new install (no passkeys anywhere) is in
+// setup mode. To use a new domain or device, a signed in device creates a short-lived one-time
+// pairing code, shown as text and as a link for a QR code, and the new device registers a
+// passkey for the same user with it. REMOTE_CODE_ALLOW_DOMAIN_SETUP=true restores the old
+// per-domain setup mode.
+
+// How long a pairing code stays valid
+const pairingCodeDuration = 10 * time.Minute
+
+// Pairing codes use letters and digits that are hard to mix up when typed from another screen
+const (
+	pairingCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	pairingCodeLength   = 8
+)
+
+// domainSetupAllowed reports whether setup mode applies to every domain without passkeys
+func domainSetupAllowed() bool {
+	return os.Getenv("REMOTE_CODE_ALLOW_DOMAIN_SETUP") == "true"
+}
+
+// setupModeActive reports whether rpID is open for registering the first admin's passkey:
+// nothing is registered yet, or per-domain setup is allowed and this domain has no passkeys.
+func setupModeActive(ctx context.Context, rpID string) (bool, error) {
+	count, err := queries.CountWebAuthnCredentialsByRpID(ctx, rpID)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	if domainSetupAllowed() {
+		return true, nil
+	}
+	total, err := queries.CountWebAuthnCredentials(ctx)
+	if err != nil {
+		return false, err
+	}
+	return total == 0, nil
+}
+
+// newPairingCode returns a random code such as "K7QH-M2XD"
+func newPairingCode() (string, error) {
+	b := make([]byte, pairingCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := make([]byte, 0, pairingCodeLength+1)
+	for i, v := range b {
+		if i == pairingCodeLength/2 {
+			code = append(code, '-')
+		}
+		// 256 is a multiple of the alphabet size, so every character is equally likely
+		code = append(code, pairingCodeAlphabet[int(v)%len(pairingCodeAlphabet)])
+	}
+	return string(code), nil
+}
+
+// normalizePairingCode accepts codes typed in lower case, with or without separators
+func normalizePairingCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// usePairingCode consumes a pairing code and returns the user it pairs a device for. Codes
+// are used up when registration begins, so each can start one registration.
+func usePairingCode(ctx context.Context, code string) (db.User, error) {
+	pairing, err := queries.UsePairingCode(ctx, hashToken(normalizePairingCode(code)))
+	if err != nil {
+		return db.User{}, err
+	}
+	return queries.GetUser(ctx, pairing.UserID)
+}
+
+// PairingCode is a new pairing code with the link a QR code should encode
+type PairingCode struct {
+	Code      string    `json:"code"`
+	PairURL   string    `json:"pair_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// handleAuthPairing handles /api/auth/pairing: a signed in device POSTs, optionally with the
+// "url" the new device will open, and gets a code for the new device to register a passkey.
+func handleAuthPairing(w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := cookieUser(ctx, r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var pairingReq struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&pairingReq); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	baseURL := getOriginFromRequest(r)
+	if pairingReq.URL != "" {
+		parsed, err := url.Parse(strings.TrimSpace(pairingReq.URL))
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			http.Error(w, "URL must be an http or https URL", http.StatusBadRequest)
+			return
+		}
+		baseURL = parsed.Scheme + "://" + parsed.Host
+	}
+
+	code, err := newPairingCode()
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	pairing, err := queries.CreatePairingCode(ctx, db.CreatePairingCodeParams{
+		UserID:    user.ID,
+		CodeHash:  hashToken(normalizePairingCode(code)),
+		ExpiresAt: time.Now().Add(pairingCodeDuration),
+	})
+	if err != nil {
+		log.Printf("Failed to create pairing code for user %d: %v", user.ID, err)
+		http.Error(w, "Failed to create pairing code", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(PairingCode{
+		Code:      code,
+		PairURL:   fmt.Sprintf("%s/login?pair=%s", baseURL, url.QueryEscape(code)),
+		ExpiresAt: pairing.ExpiresAt,
+	})
+}
+
+// deleteExpiredPairingCodes removes used and expired pairing codes
+func deleteExpiredPairingCodes(ctx context.Context) {
+	deleted, err := queries.DeleteExpiredPairingCodes(ctx)
+	if err != nil {
+		log.Printf("Session cleanup: failed to delete expired pairing codes: %v", err)
+		return
+	}
+	if deleted > 0 {
+		log.Printf("Session cleanup: deleted %d expired pairing codes", deleted)
+	}
+}
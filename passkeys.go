@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Passkey management
+// -----------------
+//
+// Users list, rename and delete their passkeys; admins may manage everyone's. Passkeys are
+// identified in URLs by their credential ID, base64url encoded. Deleting the last passkey of
+// an RP ID puts that domain back into setup mode, where anyone reaching it can register, so
+// it has to be confirmed.
+
+// Longest passkey name
+const maxPasskeyNameLength = 64
+
+// knownAuthenticators names common authenticators by AAGUID
+var knownAuthenticators = map[string]string{
+	"ea9b8d66-4d01-1d21-3ce4-b6b48cb575d4": "Google Password Manager",
+	"adce0002-35bc-c60a-648b-0b25f1f05503": "Chrome on Mac",
+	"fbfc3007-154e-4ecc-8c0b-6e020557d7bd": "iCloud Keychain",
+	"08987058-cadc-4b81-b6e1-30de50dcbe96": "Windows Hello",
+	"9ddd1817-af5a-4672-a2b9-3e3dd95000a9": "Windows Hello",
+	"6028b017-b1d4-4c02-b4b3-afcdafc96bb2": "Windows Hello",
+	"bada5566-a7aa-401f-bd96-45619a55120d": "1Password",
+	"d548826e-79b4-db40-a3d8-11116f7e8349": "Bitwarden",
+	"531126d6-e717-415c-9320-3d9aa6981239": "Dashlane",
+	"cb69481e-8ff7-4039-93ec-0a2729a154a8": "YubiKey 5 Series",
+	"ee882879-721c-4913-9775-3dfcce97072a": "YubiKey 5 Series",
+	"fa2b99dc-9e39-4257-8f92-4a30d23c4118": "YubiKey 5 Series with NFC",
+	"2fc0579f-8113-47ea-b116-bb5a8db9202a": "YubiKey 5 Series with NFC",
+}
+
+// formatAAGUID formats an AAGUID as a UUID; authenticators that don't reveal theirs send zeros
+func formatAAGUID(aaguid []byte) string {
+	if len(aaguid) != 16 {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x-%x-%x-%x", aaguid[0:4], aaguid[4:6], aaguid[6:8], aaguid[8:10], aaguid[10:16])
+}
+
+// authenticatorName names the authenticator a passkey lives on
+func authenticatorName(aaguid []byte) string {
+	if name, ok := knownAuthenticators[formatAAGUID(aaguid)]; ok {
+		return name
+	}
+	return "Passkey"
+}
+
+// Passkey is a registered WebAuthn credential as listed
+type Passkey struct {
+	ID            string     `json:"id"`
+	Name          string     `json:"name"`
+	RpID          string     `json:"rp_id"`
+	Authenticator string     `json:"authenticator"`
+	AAGUID        string     `json:"aaguid"`
+	User          string     `json:"user"`
+	CreatedAt     time.Time  `json:"created_at"`
+	LastUsedAt    *time.Time `json:"last_used_at,omitempty"`
+	CurrentDomain bool       `json:"current_domain"`
+}
+
+func dbCredentialToPasskey(credential db.WebauthnCredential, userName, rpID string) Passkey {
+	passkey := Passkey{
+		ID:            base64.RawURLEncoding.EncodeToString([]byte(credential.ID)),
+		Name:          credential.Name,
+		RpID:          credential.RpID,
+		Authenticator: authenticatorName(credential.Aaguid),
+		AAGUID:        formatAAGUID(credential.Aaguid),
+		User:          userName,
+		CurrentDomain: credential.RpID == rpID,
+	}
+	if passkey.Name == "" {
+		passkey.Name = passkey.Authenticator
+	}
+	if credential.CreatedAt.Valid {
+		passkey.CreatedAt = credential.CreatedAt.Time
+	}
+	if credential.LastUsedAt.Valid {
+		passkey.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return passkey
+}
+
+// handleAuthPasskeys handles /api/auth/passkeys: GET lists the signed in user's passkeys
+// (?rp_id= narrows to one domain, admins see everyone's with ?all=true), PUT
+// /api/auth/passkeys/{id} renames one and DELETE /api/auth/passkeys/{id} deletes one, with
+// ?confirm=true when it is the last passkey of its RP ID
+func handleAuthPasskeys(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	user, ok := cookieUser(ctx, r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	rpID := getRPID(r)
+
+	if len(pathParts) > 0 && pathParts[0] != "" {
+		credentialID, err := base64.RawURLEncoding.DecodeString(pathParts[0])
+		if err != nil {
+			http.Error(w, "Invalid passkey ID", http.StatusBadRequest)
+			return
+		}
+		credential, err := queries.GetWebAuthnCredential(ctx, string(credentialID))
+		if err != nil || (credential.UserID != user.ID && user.Role != roleAdmin) {
+			http.Error(w, "Passkey not found", http.StatusNotFound)
+			return
+		}
+		handlePasskey(w, r, ctx, user, credential, rpID)
+		return
+	}
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var credentials []db.WebauthnCredential
+	var err error
+	if r.URL.Query().Get("all") == "true" && user.Role == roleAdmin {
+		credentials, err = queries.ListWebAuthnCredentials(ctx)
+	} else {
+		credentials, err = queries.ListWebAuthnCredentialsByUser(ctx, user.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to list passkeys: %v", err)
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		return
+	}
+
+	userNames := map[int64]string{}
+	filter := r.URL.Query().Get("rp_id")
+	passkeys := make([]Passkey, 0, len(credentials))
+	for _, credential := range credentials {
+		if filter != "" && credential.RpID != filter {
+			continue
+		}
+		name, ok := userNames[credential.UserID]
+		if !ok {
+			if owner, err := queries.GetUser(ctx, credential.UserID); err == nil {
+				name = owner.Name
+			}
+			userNames[credential.UserID] = name
+		}
+		passkeys = append(passkeys, dbCredentialToPasskey(credential, name, rpID))
+	}
+	json.NewEncoder(w).Encode(passkeys)
+}
+
+func handlePasskey(w http.ResponseWriter, r *http.Request, ctx context.Context, user db.User, credential db.WebauthnCredential, rpID string) {
+	switch r.Method {
+	case "PUT":
+		var renameReq struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&renameReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		renameReq.Name = strings.TrimSpace(renameReq.Name)
+		if renameReq.Name == "" || len(renameReq.Name) > maxPasskeyNameLength {
+			http.Error(w, fmt.Sprintf("Passkey name must be 1-%d characters", maxPasskeyNameLength), http.StatusBadRequest)
+			return
+		}
+		if err := queries.RenameWebAuthnCredential(ctx, db.RenameWebAuthnCredentialParams{ID: credential.ID, Name: renameReq.Name}); err != nil {
+			log.Printf("Failed to rename passkey: %v", err)
+			http.Error(w, "Failed to rename passkey", http.StatusInternalServerError)
+			return
+		}
+		credential.Name = renameReq.Name
+		owner, _ := queries.GetUser(ctx, credential.UserID)
+		json.NewEncoder(w).Encode(dbCredentialToPasskey(credential, owner.Name, rpID))
+
+	case "DELETE":
+		count, err := queries.CountWebAuthnCredentialsByRpID(ctx, credential.RpID)
+		if err != nil {
+			log.Printf("Failed to count passkeys: %v", err)
+			http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+			return
+		}
+		if count <= 1 && r.URL.Query().Get("confirm") != "true" {
+			http.Error(w, fmt.Sprintf("This is the last passkey for %s; deleting it opens the domain to setup by anyone who reaches it. Repeat with ?confirm=true to delete it.", credential.RpID), http.StatusConflict)
+			return
+		}
+		if err := queries.DeleteWebAuthnCredential(ctx, credential.ID); err != nil {
+			log.Printf("Failed to delete passkey: %v", err)
+			http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %s deleted a passkey for %s", user.Name, credential.RpID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
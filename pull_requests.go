@@ -0,0 +1,695 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Local pull requests
+// -----------------
+//
+// A pull request is a review unit between a task branch and the branch it should land on,
+// in the base directory's own repository; no hosting service is involved. Diffs and commit
+// lists come straight from git. Merges are made in a throwaway worktree and then moved onto
+// the target branch, so the base directory's checkout is only touched when it is the target.
+
+const (
+	pullRequestOpen   = "open"
+	pullRequestMerged = "merged"
+	pullRequestClosed = "closed"
+)
+
+var mergeStrategies = map[string]bool{"ff": true, "squash": true, "merge": true}
+
+// PullRequestCommit is one commit listed on a pull request
+type PullRequestCommit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Email   string `json:"email"`
+	Date    string `json:"date"`
+	Subject string `json:"subject"`
+}
+
+type pullRequestRequest struct {
+	BaseDirectoryID *int64   `json:"base_directory_id"`
+	TaskID          *int64   `json:"task_id"`
+	ExecutionIDs    *[]int64 `json:"execution_ids"`
+	Title           *string  `json:"title"`
+	Description     *string  `json:"description"`
+	SourceBranch    string   `json:"source_branch"`
+	TargetBranch    *string  `json:"target_branch"`
+	Status          *string  `json:"status"`
+}
+
+// repoRoot returns the top level of the repository containing dir
+func repoRoot(dir string) (string, error) {
+	out, _, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("not a git repository: %s", dir)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// resolveBranch returns the commit a local branch points to
+func resolveBranch(dir, branch string) (string, error) {
+	out, _, err := runGit(dir, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("branch %s does not exist", branch)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// pullRequestRepo returns the repository root of a pull request's base directory
+func pullRequestRepo(ctx context.Context, pr db.PullRequest) (string, error) {
+	baseDir, err := queries.GetBaseDirectory(ctx, pr.BaseDirectoryID)
+	if err != nil {
+		return "", fmt.Errorf("base directory not found")
+	}
+	return repoRoot(baseDir.Path)
+}
+
+// loadPullRequest converts a pull request and, while it is open, adds the live branch state
+func loadPullRequest(ctx context.Context, dbPR db.PullRequest) PullRequest {
+	executionIDs, err := queries.GetPullRequestExecutionIDs(ctx, dbPR.ID)
+	if err != nil {
+		log.Printf("Failed to get executions of pull request %d: %v", dbPR.ID, err)
+	}
+	pr := dbPullRequestToPullRequest(dbPR, executionIDs)
+	if pr.Status != pullRequestOpen {
+		return pr
+	}
+
+	root, err := pullRequestRepo(ctx, dbPR)
+	if err != nil {
+		return pr
+	}
+	pr.SourceSHA, _ = resolveBranch(root, pr.SourceBranch)
+	pr.TargetSHA, _ = resolveBranch(root, pr.TargetBranch)
+	if pr.SourceSHA == "" || pr.TargetSHA == "" {
+		return pr
+	}
+	if out, _, err := runGit(root, "rev-list", "--left-right", "--count", pr.TargetSHA+"..."+pr.SourceSHA); err == nil {
+		fmt.Sscanf(strings.TrimSpace(out), "%d %d", &pr.Behind, &pr.Ahead)
+	}
+	_, code, _ := runGit(root, "merge-base", "--is-ancestor", pr.TargetSHA, pr.SourceSHA)
+	pr.CanFastForward = code == 0
+	return pr
+}
+
+// pullRequestRange returns the base and head to diff: the live branches while open, the
+// recorded commits once merged
+func pullRequestRange(root string, pr db.PullRequest) (base, head string, err error) {
+	if pr.Status == pullRequestMerged && pr.MergedHeadSha != "" {
+		return pr.MergedBaseSha, pr.MergedHeadSha, nil
+	}
+	head, err = resolveBranch(root, pr.SourceBranch)
+	if err != nil {
+		return "", "", err
+	}
+	target, err := resolveBranch(root, pr.TargetBranch)
+	if err != nil {
+		return "", "", err
+	}
+	out, _, err := runGit(root, "merge-base", target, head)
+	if err != nil {
+		return "", "", fmt.Errorf("branches %s and %s have no common history", pr.TargetBranch, pr.SourceBranch)
+	}
+	return strings.TrimSpace(out), head, nil
+}
+
+func pullRequestCommits(root, base, head string) ([]PullRequestCommit, error) {
+	out, _, err := runGit(root, "log", "--reverse", "--format=%H%x00%an%x00%ae%x00%aI%x00%s", base+".."+head)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commits: %s", strings.TrimSpace(out))
+	}
+	commits := []PullRequestCommit{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 5 {
+			continue
+		}
+		commits = append(commits, PullRequestCommit{SHA: fields[0], Author: fields[1], Email: fields[2], Date: fields[3], Subject: fields[4]})
+	}
+	return commits, nil
+}
+
+// branchWorktree returns the worktree a branch is checked out in, if any
+func branchWorktree(root, branch string) string {
+	out, _, err := runGit(root, "worktree", "list", "--porcelain")
+	if err != nil {
+		return ""
+	}
+	worktree := ""
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasPrefix(line, "worktree ") {
+			worktree = strings.TrimPrefix(line, "worktree ")
+		} else if line == "branch refs/heads/"+branch {
+			return worktree
+		}
+	}
+	return ""
+}
+
+// mergePullRequest merges the source branch into the target branch with the given strategy
+// and returns the new target commit
+func mergePullRequest(ctx context.Context, root string, pr db.PullRequest, strategy, message string) (string, error) {
+	source, err := resolveBranch(root, pr.SourceBranch)
+	if err != nil {
+		return "", err
+	}
+	target, err := resolveBranch(root, pr.TargetBranch)
+	if err != nil {
+		return "", err
+	}
+
+	// A checked out target has to move together with its working tree
+	targetWorktree := branchWorktree(root, pr.TargetBranch)
+	if targetWorktree != "" {
+		if filepath.Clean(targetWorktree) != filepath.Clean(root) {
+			return "", fmt.Errorf("%s is checked out in another worktree (%s)", pr.TargetBranch, targetWorktree)
+		}
+		if status, _, _ := runGit(root, "status", "--porcelain", "--untracked-files=no"); strings.TrimSpace(status) != "" {
+			return "", fmt.Errorf("%s is checked out with uncommitted changes", pr.TargetBranch)
+		}
+	}
+
+	merged := ""
+	if strategy == "ff" {
+		if _, code, _ := runGit(root, "merge-base", "--is-ancestor", target, source); code != 0 {
+			return "", fmt.Errorf("%s has diverged from %s; fast-forward is not possible", pr.SourceBranch, pr.TargetBranch)
+		}
+		merged = source
+	} else {
+		scratch, err := os.MkdirTemp("", "remote-code-merge-")
+		if err != nil {
+			return "", err
+		}
+		os.Remove(scratch)
+		if out, _, err := runGit(root, "worktree", "add", "--detach", scratch, target); err != nil {
+			return "", fmt.Errorf("failed to prepare merge: %s", strings.TrimSpace(out))
+		}
+		defer func() {
+			runGit(root, "worktree", "remove", "--force", scratch)
+			os.RemoveAll(scratch)
+		}()
+
+		var args []string
+		if strategy == "squash" {
+			args = []string{"merge", "--squash", source}
+		} else {
+			args = []string{"merge", "--no-ff", "--no-edit", "-m", message, source}
+		}
+		if out, _, err := runGit(scratch, args...); err != nil {
+			return "", fmt.Errorf("merge conflict: %s", strings.TrimSpace(out))
+		}
+		if strategy == "squash" {
+			commitArgs := []string{"commit"}
+			for _, paragraph := range strings.Split(message, "\n\n") {
+				commitArgs = append(commitArgs, "-m", paragraph)
+			}
+			if out, _, err := runGit(scratch, commitArgs...); err != nil {
+				return "", fmt.Errorf("failed to commit squashed changes: %s", strings.TrimSpace(out))
+			}
+		}
+		out, _, err := runGit(scratch, "rev-parse", "HEAD")
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve merge: %s", strings.TrimSpace(out))
+		}
+		merged = strings.TrimSpace(out)
+	}
+
+	if targetWorktree != "" {
+		if out, _, err := runGit(root, "merge", "--ff-only", merged); err != nil {
+			return "", fmt.Errorf("failed to update %s: %s", pr.TargetBranch, strings.TrimSpace(out))
+		}
+	} else {
+		// Only moves the branch if nobody else did in the meantime
+		if out, _, err := runGit(root, "update-ref", "-m", fmt.Sprintf("remote-code: merge pull request #%d", pr.ID), "refs/heads/"+pr.TargetBranch, merged, target); err != nil {
+			return "", fmt.Errorf("failed to update %s: %s", pr.TargetBranch, strings.TrimSpace(out))
+		}
+	}
+	return merged, nil
+}
+
+// defaultMergeMessage builds the message of a merge or squash commit
+func defaultMergeMessage(pr db.PullRequest, strategy string) string {
+	if strategy == "squash" {
+		parts := []string{pr.Title}
+		if description := strings.TrimSpace(pr.Description); description != "" {
+			parts = append(parts, description)
+		}
+		parts = append(parts, fmt.Sprintf("Pull-Request: #%d", pr.ID))
+		return strings.Join(parts, "\n\n")
+	}
+	return fmt.Sprintf("Merge pull request #%d from %s\n\n%s", pr.ID, pr.SourceBranch, pr.Title)
+}
+
+// linkPullRequestExecutions replaces the executions linked to a pull request
+func linkPullRequestExecutions(ctx context.Context, pullRequestID int64, executionIDs []int64) error {
+	if err := queries.DeletePullRequestExecutions(ctx, pullRequestID); err != nil {
+		return err
+	}
+	for _, executionID := range executionIDs {
+		if _, err := queries.GetTaskExecution(ctx, executionID); err != nil {
+			return fmt.Errorf("task execution %d not found", executionID)
+		}
+		err := queries.AddPullRequestExecution(ctx, db.AddPullRequestExecutionParams{
+			PullRequestID:   pullRequestID,
+			TaskExecutionID: executionID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createPullRequest opens a pull request after checking both branches exist
+func createPullRequest(ctx context.Context, projectID int64, baseDir db.BaseDirectory, taskID sql.NullInt64, title, description, source, target string, executionIDs []int64) (db.PullRequest, error) {
+	root, err := repoRoot(baseDir.Path)
+	if err != nil {
+		return db.PullRequest{}, err
+	}
+	if source == "" || target == "" {
+		return db.PullRequest{}, fmt.Errorf("source_branch and target_branch are required")
+	}
+	if source == target {
+		return db.PullRequest{}, fmt.Errorf("source and target branch must differ")
+	}
+	if _, err := resolveBranch(root, source); err != nil {
+		return db.PullRequest{}, err
+	}
+	if _, err := resolveBranch(root, target); err != nil {
+		return db.PullRequest{}, err
+	}
+
+	if title == "" {
+		title = source
+	}
+	dbPR, err := queries.CreatePullRequest(ctx, db.CreatePullRequestParams{
+		ProjectID:       projectID,
+		BaseDirectoryID: baseDir.ID,
+		TaskID:          taskID,
+		Title:           title,
+		Description:     description,
+		SourceBranch:    source,
+		TargetBranch:    target,
+	})
+	if err != nil {
+		return db.PullRequest{}, err
+	}
+	if err := linkPullRequestExecutions(ctx, dbPR.ID, executionIDs); err != nil {
+		queries.DeletePullRequest(ctx, dbPR.ID)
+		return db.PullRequest{}, err
+	}
+	return dbPR, nil
+}
+
+// handleProjectPullRequestsAPI handles /api/projects/{id}/pull-requests
+func handleProjectPullRequestsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	projectID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbPRs, err := queries.GetPullRequestsByProjectID(ctx, projectID)
+		if err != nil {
+			log.Printf("Failed to get pull requests for project %d: %v", projectID, err)
+			http.Error(w, "Failed to get pull requests", http.StatusInternalServerError)
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		pullRequests := make([]PullRequest, 0)
+		for _, dbPR := range dbPRs {
+			if status != "" && dbPR.Status != status {
+				continue
+			}
+			pullRequests = append(pullRequests, loadPullRequest(ctx, dbPR))
+		}
+		json.NewEncoder(w).Encode(pullRequests)
+
+	case "POST":
+		if _, err := queries.GetProject(ctx, projectID); err != nil {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+
+		var createReq pullRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		// The repository comes from the base directory, or from the task's base directory
+		var baseDir db.BaseDirectory
+		taskID := int64PtrToNullInt64(createReq.TaskID)
+		if createReq.BaseDirectoryID != nil {
+			baseDir, err = queries.GetBaseDirectory(ctx, *createReq.BaseDirectoryID)
+			if err != nil || baseDir.ProjectID != projectID {
+				http.Error(w, "Base directory not found in project", http.StatusBadRequest)
+				return
+			}
+		}
+		if createReq.TaskID != nil {
+			task, err := queries.GetTask(ctx, *createReq.TaskID)
+			if err != nil || task.ProjectID != projectID {
+				http.Error(w, "Task not found in project", http.StatusBadRequest)
+				return
+			}
+			if createReq.BaseDirectoryID == nil {
+				baseDir, err = queries.GetBaseDirectoryByProjectAndID(ctx, db.GetBaseDirectoryByProjectAndIDParams{
+					ProjectID:       projectID,
+					BaseDirectoryID: task.BaseDirectoryID,
+				})
+				if err != nil {
+					http.Error(w, "Base directory of task not found", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+		if baseDir.ID == 0 {
+			http.Error(w, "base_directory_id or task_id is required", http.StatusBadRequest)
+			return
+		}
+
+		title, description, target := "", "", ""
+		if createReq.Title != nil {
+			title = strings.TrimSpace(*createReq.Title)
+		}
+		if createReq.Description != nil {
+			description = *createReq.Description
+		}
+		if createReq.TargetBranch != nil {
+			target = *createReq.TargetBranch
+		}
+		var executionIDs []int64
+		if createReq.ExecutionIDs != nil {
+			executionIDs = *createReq.ExecutionIDs
+		}
+
+		dbPR, err := createPullRequest(ctx, projectID, baseDir, taskID, title, description, createReq.SourceBranch, target, executionIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(loadPullRequest(ctx, dbPR))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePullRequestsAPI handles /api/pull-requests/{id}[/diff|/commits|/merge]
+func handlePullRequestsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) == 0 || pathParts[0] == "" {
+		http.Error(w, "Pull request ID required", http.StatusBadRequest)
+		return
+	}
+
+	pullRequestID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid pull request ID", http.StatusBadRequest)
+		return
+	}
+
+	existing, err := queries.GetPullRequest(ctx, pullRequestID)
+	if err != nil {
+		http.Error(w, "Pull request not found", http.StatusNotFound)
+		return
+	}
+
+	if len(pathParts) >= 2 {
+		switch pathParts[1] {
+		case "diff":
+			handlePullRequestDiff(w, r, ctx, existing)
+		case "commits":
+			handlePullRequestCommits(w, r, ctx, existing)
+		case "merge":
+			handlePullRequestMerge(w, r, ctx, existing)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(loadPullRequest(ctx, existing))
+
+	case "PUT":
+		var updateReq pullRequestRequest
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		title, description, target, status := existing.Title, existing.Description, existing.TargetBranch, existing.Status
+		if updateReq.Title != nil && strings.TrimSpace(*updateReq.Title) != "" {
+			title = strings.TrimSpace(*updateReq.Title)
+		}
+		if updateReq.Description != nil {
+			description = *updateReq.Description
+		}
+		if updateReq.Status != nil && *updateReq.Status != status {
+			// Merging goes through /merge; merged pull requests are final
+			if existing.Status == pullRequestMerged {
+				http.Error(w, "Pull request is already merged", http.StatusConflict)
+				return
+			}
+			if *updateReq.Status != pullRequestOpen && *updateReq.Status != pullRequestClosed {
+				http.Error(w, "status must be open or closed", http.StatusBadRequest)
+				return
+			}
+			status = *updateReq.Status
+		}
+		if updateReq.TargetBranch != nil && *updateReq.TargetBranch != target {
+			if existing.Status == pullRequestMerged {
+				http.Error(w, "Pull request is already merged", http.StatusConflict)
+				return
+			}
+			root, err := pullRequestRepo(ctx, existing)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if _, err := resolveBranch(root, *updateReq.TargetBranch); err != nil || *updateReq.TargetBranch == existing.SourceBranch {
+				http.Error(w, "Invalid target branch", http.StatusBadRequest)
+				return
+			}
+			target = *updateReq.TargetBranch
+		}
+
+		updated, err := queries.UpdatePullRequest(ctx, db.UpdatePullRequestParams{
+			ID:           pullRequestID,
+			Title:        title,
+			Description:  description,
+			TargetBranch: target,
+			Status:       status,
+		})
+		if err != nil {
+			log.Printf("Failed to update pull request %d: %v", pullRequestID, err)
+			http.Error(w, "Failed to update pull request", http.StatusInternalServerError)
+			return
+		}
+		if updateReq.ExecutionIDs != nil {
+			if err := linkPullRequestExecutions(ctx, pullRequestID, *updateReq.ExecutionIDs); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(loadPullRequest(ctx, updated))
+
+	case "DELETE":
+		if err := queries.DeletePullRequestExecutions(ctx, pullRequestID); err != nil {
+			log.Printf("Warning: failed to delete executions of pull request %d: %v", pullRequestID, err)
+		}
+		if err := queries.DeletePullRequest(ctx, pullRequestID); err != nil {
+			log.Printf("Failed to delete pull request %d: %v", pullRequestID, err)
+			http.Error(w, "Failed to delete pull request", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handlePullRequestDiff(w http.ResponseWriter, r *http.Request, ctx context.Context, pr db.PullRequest) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	root, err := pullRequestRepo(ctx, pr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base, head, err := pullRequestRange(root, pr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	args := []string{"diff", base, head}
+	if file := r.URL.Query().Get("file"); file != "" {
+		args = append(args, "--", file)
+	}
+	diff, _, err := runGit(root, args...)
+	if err != nil {
+		http.Error(w, "Failed to diff pull request: "+diff, http.StatusInternalServerError)
+		return
+	}
+	stat, _, _ := runGit(root, "diff", "--numstat", base, head)
+
+	files := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(stat), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		// Binary files show "-" for both counts
+		additions, _ := strconv.Atoi(fields[0])
+		deletions, _ := strconv.Atoi(fields[1])
+		files = append(files, map[string]interface{}{"path": fields[2], "additions": additions, "deletions": deletions})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"base":  base,
+		"head":  head,
+		"files": files,
+		"diff":  diff,
+	})
+}
+
+func handlePullRequestCommits(w http.ResponseWriter, r *http.Request, ctx context.Context, pr db.PullRequest) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	root, err := pullRequestRepo(ctx, pr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base, head, err := pullRequestRange(root, pr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	commits, err := pullRequestCommits(root, base, head)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(commits)
+}
+
+func handlePullRequestMerge(w http.ResponseWriter, r *http.Request, ctx context.Context, pr db.PullRequest) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if pr.Status != pullRequestOpen {
+		http.Error(w, "Only open pull requests can be merged", http.StatusConflict)
+		return
+	}
+
+	var mergeReq struct {
+		Strategy     string `json:"strategy"` // ff (default), squash or merge
+		Message      string `json:"message"`
+		DeleteBranch bool   `json:"delete_branch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&mergeReq); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if mergeReq.Strategy == "" {
+		mergeReq.Strategy = "ff"
+	}
+	if !mergeStrategies[mergeReq.Strategy] {
+		http.Error(w, "strategy must be ff, squash or merge", http.StatusBadRequest)
+		return
+	}
+	message := strings.TrimSpace(mergeReq.Message)
+	if message == "" {
+		message = defaultMergeMessage(pr, mergeReq.Strategy)
+	}
+
+	root, err := pullRequestRepo(ctx, pr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	base, head, err := pullRequestRange(root, pr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if head == base {
+		http.Error(w, "Nothing to merge", http.StatusConflict)
+		return
+	}
+
+	mergeCommit, err := mergePullRequest(ctx, root, pr, mergeReq.Strategy, message)
+	if err != nil {
+		log.Printf("Failed to merge pull request %d: %v", pr.ID, err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	merged, err := queries.MarkPullRequestMerged(ctx, db.MarkPullRequestMergedParams{
+		ID:             pr.ID,
+		MergeStrategy:  mergeReq.Strategy,
+		MergeCommitSha: mergeCommit,
+		MergedBaseSha:  base,
+		MergedHeadSha:  head,
+	})
+	if err != nil {
+		log.Printf("Failed to mark pull request %d merged: %v", pr.ID, err)
+		http.Error(w, "Merged, but failed to update pull request", http.StatusInternalServerError)
+		return
+	}
+
+	if mergeReq.DeleteBranch && branchWorktree(root, pr.SourceBranch) == "" {
+		if out, _, err := runGit(root, "branch", "-D", pr.SourceBranch); err != nil {
+			log.Printf("Warning: failed to delete branch %s: %s", pr.SourceBranch, strings.TrimSpace(out))
+		}
+	}
+
+	// Like the git merge endpoint, a merged task moves on (to done by default)
+	if pr.TaskID.Valid {
+		if task, err := queries.GetTask(ctx, pr.TaskID.Int64); err == nil {
+			applyWorkflowEvent(ctx, task, workflowEventPullRequestMerged)
+		}
+	}
+
+	json.NewEncoder(w).Encode(loadPullRequest(ctx, merged))
+}
+
+// deletePullRequestsForBaseDirectory removes the pull requests of a base directory being deleted
+func deletePullRequestsForBaseDirectory(ctx context.Context, baseDirectoryID int64) {
+	if err := queries.DeletePullRequestExecutionsByBaseDirectoryID(ctx, baseDirectoryID); err != nil {
+		log.Printf("Warning: failed to delete pull request executions for base directory %d: %v", baseDirectoryID, err)
+	}
+	if err := queries.DeletePullRequestsByBaseDirectoryID(ctx, baseDirectoryID); err != nil {
+		log.Printf("Warning: failed to delete pull requests for base directory %d: %v", baseDirectoryID, err)
+	}
+}
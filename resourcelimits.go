@@ -0,0 +1,569 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Resource limits (cgroup v2)
+// -----------------
+//
+// Each limited session gets its own cgroup below the cgroup root, named
+// "<target_type>-<target_id>" (e.g. "task_execution-12"), and the session's shell is
+// moved into it right after the tmux session is created, or when limits are first set on
+// a running session, so everything it starts is accounted there. CPU is throttled through
+// cpu.max, memory is throttled at memory.high and the whole group is OOM-killed at
+// memory.max, and pids.max makes fork fail.
+// A monitor samples usage and records throttling and kills.
+
+// Resource limit targets
+const (
+	resourceTargetProject            = "project"
+	resourceTargetTaskExecution      = "task_execution"
+	resourceTargetExecutionDevServer = "execution_dev_server"
+	resourceTargetBaseDirectory      = "base_directory"
+)
+
+// Used when REMOTE_CODE_CGROUP_ROOT is not set; the server needs write access to it
+const defaultCgroupRoot = "/sys/fs/cgroup/remote-code"
+
+const cpuPeriodUsec = 100000
+
+// How often cgroups are sampled for usage and limit events
+const resourceMonitorInterval = 5 * time.Second
+
+// cgroupSample keeps the previous counters of a cgroup to detect changes
+type cgroupSample struct {
+	UsageUsec  int64
+	SampledAt  time.Time
+	CPUPercent float64
+	Counters   map[string]int64
+}
+
+var cgroupSamples = make(map[string]*cgroupSample)
+var cgroupSamplesMutex sync.Mutex
+
+func cgroupRoot() string {
+	if root := os.Getenv("REMOTE_CODE_CGROUP_ROOT"); root != "" {
+		return root
+	}
+	return defaultCgroupRoot
+}
+
+func cgroupName(targetType string, targetID int64) string {
+	return fmt.Sprintf("%s-%d", targetType, targetID)
+}
+
+// parseCgroupName is the inverse of cgroupName
+func parseCgroupName(name string) (string, int64, bool) {
+	idx := strings.LastIndex(name, "-")
+	if idx <= 0 {
+		return "", 0, false
+	}
+	targetID, err := strconv.ParseInt(name[idx+1:], 10, 64)
+	if err != nil {
+		return "", 0, false
+	}
+	return name[:idx], targetID, true
+}
+
+// ensureCgroupRoot creates the cgroup root and enables the cpu, memory and pids controllers
+func ensureCgroupRoot() error {
+	root := cgroupRoot()
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "cgroup.controllers")); err != nil {
+		return fmt.Errorf("cgroup v2 is not mounted at %s", filepath.Dir(root))
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup %s: %v", root, err)
+	}
+
+	// Controllers must be enabled in the parent for the root and in the root for the sessions
+	for _, dir := range []string{filepath.Dir(root), root} {
+		enabled, _ := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control"))
+		for _, controller := range []string{"cpu", "memory", "pids"} {
+			if strings.Contains(" "+strings.TrimSpace(string(enabled))+" ", " "+controller+" ") {
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644); err != nil {
+				return fmt.Errorf("failed to enable %s controller in %s: %v", controller, dir, err)
+			}
+		}
+	}
+	return nil
+}
+
+// effectiveResourceLimits overlays a target's own limits on the project defaults
+func effectiveResourceLimits(ctx context.Context, projectID int64, targetType string, targetID int64) ResourceLimits {
+	var limits ResourceLimits
+	if projectLimit, err := queries.GetResourceLimit(ctx, db.GetResourceLimitParams{
+		TargetType: resourceTargetProject,
+		TargetID:   projectID,
+	}); err == nil {
+		limits = dbResourceLimitToResourceLimits(projectLimit)
+	}
+
+	if targetLimit, err := queries.GetResourceLimit(ctx, db.GetResourceLimitParams{
+		TargetType: targetType,
+		TargetID:   targetID,
+	}); err == nil {
+		if targetLimit.CpuPercent > 0 {
+			limits.CPUPercent = targetLimit.CpuPercent
+		}
+		if targetLimit.MemoryMb > 0 {
+			limits.MemoryMB = targetLimit.MemoryMb
+		}
+		if targetLimit.PidsMax > 0 {
+			limits.PidsMax = targetLimit.PidsMax
+		}
+	}
+	return limits
+}
+
+func (limits ResourceLimits) isUnlimited() bool {
+	return limits.CPUPercent == 0 && limits.MemoryMB == 0 && limits.PidsMax == 0
+}
+
+func (limits ResourceLimits) validate() error {
+	if limits.CPUPercent < 0 || limits.MemoryMB < 0 || limits.PidsMax < 0 {
+		return fmt.Errorf("Limits must not be negative")
+	}
+	return nil
+}
+
+// writeCgroupLimits writes limits to an existing cgroup; zero values remove the limit
+func writeCgroupLimits(path string, limits ResourceLimits) error {
+	cpuMax := "max " + strconv.Itoa(cpuPeriodUsec)
+	if limits.CPUPercent > 0 {
+		cpuMax = fmt.Sprintf("%d %d", limits.CPUPercent*cpuPeriodUsec/100, cpuPeriodUsec)
+	}
+
+	memoryMax, memoryHigh := "max", "max"
+	if limits.MemoryMB > 0 {
+		bytes := limits.MemoryMB * 1024 * 1024
+		memoryMax = strconv.FormatInt(bytes, 10)
+		// Reclaim (and thereby throttle) before the OOM killer steps in
+		memoryHigh = strconv.FormatInt(bytes/10*9, 10)
+	}
+
+	pidsMax := "max"
+	if limits.PidsMax > 0 {
+		pidsMax = strconv.FormatInt(limits.PidsMax, 10)
+	}
+
+	files := []struct{ name, value string }{
+		{"cpu.max", cpuMax},
+		{"memory.high", memoryHigh},
+		{"memory.max", memoryMax},
+		{"memory.oom.group", "1"},
+		{"pids.max", pidsMax},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(path, file.name), []byte(file.value), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %v", file.name, err)
+		}
+	}
+	return nil
+}
+
+// applySessionResourceLimits places a freshly created tmux session into its own limited cgroup
+func applySessionResourceLimits(ctx context.Context, sessionName string, projectID int64, targetType string, targetID int64) {
+	limits := effectiveResourceLimits(ctx, projectID, targetType, targetID)
+	if limits.isUnlimited() {
+		return
+	}
+
+	if err := confineSession(sessionName, targetType, targetID, limits); err != nil {
+		log.Printf("Warning: resource limits not applied to session %s: %v", sessionName, err)
+		recordResourceLimitEvent(ctx, targetType, targetID, cgroupName(targetType, targetID), "limits_unavailable", err.Error())
+		return
+	}
+
+	log.Printf("Applied resource limits to session %s: %+v", sessionName, limits)
+}
+
+// confineSession creates a target's cgroup with the given limits and moves the session's
+// shell into it
+func confineSession(sessionName string, targetType string, targetID int64, limits ResourceLimits) error {
+	if err := ensureCgroupRoot(); err != nil {
+		return err
+	}
+
+	path := filepath.Join(cgroupRoot(), cgroupName(targetType, targetID))
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return fmt.Errorf("failed to create cgroup: %v", err)
+	}
+	if err := writeCgroupLimits(path, limits); err != nil {
+		return err
+	}
+
+	// An empty cgroup left behind would look like a confined session to later updates
+	pid, err := sessionManager.PanePID(sessionName)
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to get pane pid: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to move session into cgroup: %v", err)
+	}
+	return nil
+}
+
+// liveSessionName returns the running session a target's limits apply to
+func liveSessionName(ctx context.Context, targetType string, targetID int64) (string, bool) {
+	var sessionName sql.NullString
+	switch targetType {
+	case resourceTargetTaskExecution, resourceTargetExecutionDevServer:
+		execution, err := queries.GetTaskExecution(ctx, targetID)
+		if err != nil {
+			return "", false
+		}
+		sessionName = execution.AgentTmuxID
+		if targetType == resourceTargetExecutionDevServer {
+			sessionName = execution.DevServerTmuxID
+		}
+	case resourceTargetBaseDirectory:
+		devServer, err := queries.GetDirectoryDevServerByDirectoryID(ctx, targetID)
+		if err != nil {
+			return "", false
+		}
+		sessionName = sql.NullString{String: devServer.TmuxSessionID, Valid: true}
+	}
+	if !sessionName.Valid || !sessionExists(sessionName.String) {
+		return "", false
+	}
+	return sessionName.String, true
+}
+
+// updateLiveResourceLimits applies a target's limits to its running session, if any. A
+// session started without limits has no cgroup yet, so one is created and the session
+// moved into it.
+func updateLiveResourceLimits(ctx context.Context, projectID int64, targetType string, targetID int64) error {
+	limits := effectiveResourceLimits(ctx, projectID, targetType, targetID)
+	path := filepath.Join(cgroupRoot(), cgroupName(targetType, targetID))
+	if _, err := os.Stat(path); err == nil {
+		return writeCgroupLimits(path, limits)
+	}
+
+	sessionName, running := liveSessionName(ctx, targetType, targetID)
+	if !running || limits.isUnlimited() {
+		return nil
+	}
+	if err := confineSession(sessionName, targetType, targetID, limits); err != nil {
+		return err
+	}
+	log.Printf("Applied resource limits to running session %s: %+v", sessionName, limits)
+	return nil
+}
+
+// removeSessionCgroup removes a session's cgroup once its processes have exited
+func removeSessionCgroup(targetType string, targetID int64) {
+	path := filepath.Join(cgroupRoot(), cgroupName(targetType, targetID))
+	if _, err := os.Stat(path); err != nil {
+		return
+	}
+
+	go func() {
+		for attempt := 0; attempt < 10; attempt++ {
+			if err := os.Remove(path); err == nil || os.IsNotExist(err) {
+				return
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+		log.Printf("Warning: cgroup %s still has processes, leaving it to the resource monitor", path)
+	}()
+}
+
+// readResourceUsage samples a session's cgroup; nil when the session is not limited
+func readResourceUsage(ctx context.Context, projectID int64, targetType string, targetID int64) *ResourceUsage {
+	name := cgroupName(targetType, targetID)
+	path := filepath.Join(cgroupRoot(), name)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	usage := &ResourceUsage{
+		Cgroup:      name,
+		MemoryBytes: readCgroupInt(path, "memory.current"),
+		Pids:        readCgroupInt(path, "pids.current"),
+		Limits:      effectiveResourceLimits(ctx, projectID, targetType, targetID),
+	}
+
+	cgroupSamplesMutex.Lock()
+	if sample, ok := cgroupSamples[name]; ok {
+		usage.CPUPercent = sample.CPUPercent
+	}
+	cgroupSamplesMutex.Unlock()
+
+	return usage
+}
+
+func readCgroupInt(path, file string) int64 {
+	data, err := os.ReadFile(filepath.Join(path, file))
+	if err != nil {
+		return 0
+	}
+	value, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return value
+}
+
+// readCgroupKeyValues parses flat keyed files such as cpu.stat and memory.events
+func readCgroupKeyValues(path, file string) map[string]int64 {
+	values := make(map[string]int64)
+	data, err := os.ReadFile(filepath.Join(path, file))
+	if err != nil {
+		return values
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = value
+		}
+	}
+	return values
+}
+
+func recordResourceLimitEvent(ctx context.Context, targetType string, targetID int64, cgroup, eventType, detail string) {
+	_, err := queries.CreateResourceLimitEvent(ctx, db.CreateResourceLimitEventParams{
+		TargetType: targetType,
+		TargetID:   targetID,
+		Cgroup:     cgroup,
+		EventType:  eventType,
+		Detail:     detail,
+	})
+	if err != nil {
+		log.Printf("Failed to record resource limit event for %s: %v", cgroup, err)
+	}
+
+	// Executions also keep it in their own history
+	if targetType == resourceTargetTaskExecution || targetType == resourceTargetExecutionDevServer {
+		recordTaskExecutionEvent(ctx, targetID, "resource_limit", fmt.Sprintf("%s: %s", strings.ReplaceAll(targetType, "_", " "), eventType), detail, sql.NullInt64{Valid: false})
+	}
+}
+
+// runResourceMonitor periodically samples session cgroups
+func runResourceMonitor() {
+	ticker := time.NewTicker(resourceMonitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sampleSessionCgroups(context.Background())
+	}
+}
+
+func sampleSessionCgroups(ctx context.Context) {
+	entries, err := os.ReadDir(cgroupRoot())
+	if err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		targetType, targetID, ok := parseCgroupName(entry.Name())
+		if !ok {
+			continue
+		}
+		name := entry.Name()
+		path := filepath.Join(cgroupRoot(), name)
+
+		// Sessions that have exited leave an empty cgroup behind
+		if readCgroupKeyValues(path, "cgroup.events")["populated"] == 0 {
+			if err := os.Remove(path); err == nil {
+				continue
+			}
+		}
+		seen[name] = true
+
+		now := time.Now()
+		cpuStat := readCgroupKeyValues(path, "cpu.stat")
+		memoryEvents := readCgroupKeyValues(path, "memory.events")
+		pidsEvents := readCgroupKeyValues(path, "pids.events")
+		counters := map[string]int64{
+			"cpu_throttled": cpuStat["nr_throttled"],
+			"memory_high":   memoryEvents["high"],
+			"oom_kill":      memoryEvents["oom_kill"],
+			"pids_limit":    pidsEvents["max"],
+		}
+
+		cgroupSamplesMutex.Lock()
+		previous := cgroupSamples[name]
+		sample := &cgroupSample{UsageUsec: cpuStat["usage_usec"], SampledAt: now, Counters: counters}
+		if previous != nil {
+			elapsed := now.Sub(previous.SampledAt).Microseconds()
+			if elapsed > 0 {
+				sample.CPUPercent = float64(sample.UsageUsec-previous.UsageUsec) * 100 / float64(elapsed)
+			}
+		}
+		cgroupSamples[name] = sample
+		cgroupSamplesMutex.Unlock()
+
+		if previous == nil {
+			continue
+		}
+		for eventType, count := range counters {
+			if delta := count - previous.Counters[eventType]; delta > 0 {
+				detail := fmt.Sprintf("%d new %s events (total %d)", delta, eventType, count)
+				log.Printf("Resource limit hit in cgroup %s: %s", name, detail)
+				recordResourceLimitEvent(ctx, targetType, targetID, name, eventType, detail)
+			}
+		}
+	}
+
+	cgroupSamplesMutex.Lock()
+	for name := range cgroupSamples {
+		if !seen[name] {
+			delete(cgroupSamples, name)
+		}
+	}
+	cgroupSamplesMutex.Unlock()
+}
+
+// handleResourceLimitsTarget implements GET/PUT of one target's limits
+func handleResourceLimitsTarget(w http.ResponseWriter, r *http.Request, ctx context.Context, projectID int64, targetType string, targetID int64) {
+	switch r.Method {
+	case "GET":
+		var limits ResourceLimits
+		if dbLimit, err := queries.GetResourceLimit(ctx, db.GetResourceLimitParams{TargetType: targetType, TargetID: targetID}); err == nil {
+			limits = dbResourceLimitToResourceLimits(dbLimit)
+		}
+
+		response := map[string]interface{}{"limits": limits}
+		if targetType != resourceTargetProject {
+			response["effective"] = effectiveResourceLimits(ctx, projectID, targetType, targetID)
+			response["usage"] = readResourceUsage(ctx, projectID, targetType, targetID)
+
+			events, _ := queries.GetRecentResourceLimitEvents(ctx, db.GetRecentResourceLimitEventsParams{
+				TargetType: targetType,
+				TargetID:   targetID,
+				Limit:      20,
+			})
+			if events == nil {
+				events = []db.ResourceLimitEvent{}
+			}
+			response["events"] = events
+		}
+		json.NewEncoder(w).Encode(response)
+
+	case "PUT":
+		var limits ResourceLimits
+		if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := limits.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		dbLimit, err := queries.UpsertResourceLimit(ctx, db.UpsertResourceLimitParams{
+			TargetType: targetType,
+			TargetID:   targetID,
+			CpuPercent: limits.CPUPercent,
+			MemoryMb:   limits.MemoryMB,
+			PidsMax:    limits.PidsMax,
+		})
+		if err != nil {
+			log.Printf("Failed to save resource limits for %s %d: %v", targetType, targetID, err)
+			http.Error(w, "Failed to save resource limits", http.StatusInternalServerError)
+			return
+		}
+
+		// Running sessions pick up the new limits immediately
+		if targetType != resourceTargetProject {
+			if err := updateLiveResourceLimits(ctx, projectID, targetType, targetID); err != nil {
+				log.Printf("Warning: failed to apply resource limits to running %s %d: %v", targetType, targetID, err)
+				http.Error(w, fmt.Sprintf("Limits saved but not applied to the running session: %v", err), http.StatusConflict)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{"limits": dbResourceLimitToResourceLimits(dbLimit)})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleProjectResourceLimitsAPI handles /api/projects/{id}/resource-limits (project defaults)
+func handleProjectResourceLimitsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	projectID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := queries.GetProject(ctx, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	handleResourceLimitsTarget(w, r, ctx, projectID, resourceTargetProject, projectID)
+}
+
+// handleTaskExecutionResourceLimitsAPI handles /api/task-executions/{id}/resource-limits
+// and /api/task-executions/{id}/resource-limits/dev-server
+func handleTaskExecutionResourceLimitsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	executionID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid execution ID", http.StatusBadRequest)
+		return
+	}
+
+	execution, err := queries.GetTaskExecutionWithDetails(ctx, executionID)
+	if err != nil {
+		http.Error(w, "Task execution not found", http.StatusNotFound)
+		return
+	}
+
+	targetType := resourceTargetTaskExecution
+	if len(pathParts) >= 3 && pathParts[2] == "dev-server" {
+		targetType = resourceTargetExecutionDevServer
+	}
+
+	handleResourceLimitsTarget(w, r, ctx, execution.ProjectID, targetType, executionID)
+}
+
+// handleBaseDirectoryResourceLimitsAPI handles /api/base-directories/{id}/resource-limits (directory dev server)
+func handleBaseDirectoryResourceLimitsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	directoryID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid directory ID", http.StatusBadRequest)
+		return
+	}
+
+	dir, err := queries.GetBaseDirectory(ctx, directoryID)
+	if err != nil {
+		http.Error(w, "Base directory not found", http.StatusNotFound)
+		return
+	}
+
+	handleResourceLimitsTarget(w, r, ctx, dir.ProjectID, resourceTargetBaseDirectory, dir.ID)
+}
+
+// deleteResourceLimits removes a target's limits and events
+func deleteResourceLimits(ctx context.Context, targetType string, targetID int64) {
+	if err := queries.DeleteResourceLimit(ctx, db.DeleteResourceLimitParams{TargetType: targetType, TargetID: targetID}); err != nil {
+		log.Printf("Warning: failed to delete resource limits for %s %d: %v", targetType, targetID, err)
+	}
+	if err := queries.DeleteResourceLimitEvents(ctx, db.DeleteResourceLimitEventsParams{TargetType: targetType, TargetID: targetID}); err != nil {
+		log.Printf("Warning: failed to delete resource limit events for %s %d: %v", targetType, targetID, err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Roots
+// -----------------
+//
+// A root is a workspace: it owns agents and projects, has its own settings, local port and
+// external URL, so personal and client work can live side by side on one server. List
+// endpoints take ?root_id= to pick the workspace and fall back to the default root, which
+// holds everything created before roots could be chosen.
+
+const defaultRootID = 1
+
+var rootSettingKey = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// Longest root setting value
+const maxRootSettingLength = 4096
+
+// requestRootID returns the root selected with ?root_id=, or the default root. Errors are
+// written to the response.
+func requestRootID(w http.ResponseWriter, r *http.Request, ctx context.Context) (int64, bool) {
+	value := r.URL.Query().Get("root_id")
+	if value == "" {
+		return defaultRootID, true
+	}
+	rootID, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid root ID", http.StatusBadRequest)
+		return 0, false
+	}
+	if _, err := queries.GetRoot(ctx, rootID); err != nil {
+		http.Error(w, "Root not found", http.StatusNotFound)
+		return 0, false
+	}
+	return rootID, true
+}
+
+// resolveRootID checks the root_id of a create request; 0 means the default root
+func resolveRootID(ctx context.Context, rootID int64) (int64, error) {
+	if rootID == 0 {
+		return defaultRootID, nil
+	}
+	if _, err := queries.GetRoot(ctx, rootID); err != nil {
+		return 0, fmt.Errorf("root %d not found", rootID)
+	}
+	return rootID, nil
+}
+
+// rootProjectIDs returns the IDs of a root's projects, for filtering lists that span projects
+func rootProjectIDs(ctx context.Context, rootID int64) (map[int64]bool, error) {
+	projects, err := queries.GetProjectsByRootID(ctx, rootID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int64]bool, len(projects))
+	for _, project := range projects {
+		ids[project.ID] = true
+	}
+	return ids, nil
+}
+
+// RootSummary is a root as listed, with what it holds
+type RootSummary struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	LocalPort   string  `json:"local_port"`
+	ExternalUrl *string `json:"external_url,omitempty"`
+	Projects    int64   `json:"projects"`
+	Agents      int64   `json:"agents"`
+	IsDefault   bool    `json:"is_default"`
+}
+
+func dbRootToRootSummary(ctx context.Context, root db.Root) RootSummary {
+	summary := RootSummary{
+		ID:        root.ID,
+		Name:      root.Name,
+		LocalPort: root.LocalPort,
+		IsDefault: root.ID == defaultRootID,
+	}
+	if root.ExternalUrl.Valid {
+		summary.ExternalUrl = &root.ExternalUrl.String
+	}
+	summary.Projects, _ = queries.CountProjectsByRootID(ctx, root.ID)
+	summary.Agents, _ = queries.CountAgentsByRootID(ctx, root.ID)
+	return summary
+}
+
+type rootRequest struct {
+	Name        string  `json:"name"`
+	LocalPort   string  `json:"local_port"`
+	ExternalUrl *string `json:"external_url"`
+}
+
+func handleRootsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) > 0 && pathParts[0] != "" {
+		rootID, err := strconv.ParseInt(pathParts[0], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid root ID", http.StatusBadRequest)
+			return
+		}
+		root, err := queries.GetRoot(ctx, rootID)
+		if err != nil {
+			http.Error(w, "Root not found", http.StatusNotFound)
+			return
+		}
+
+		// Handle settings sub-resource: /api/roots/{id}/settings
+		if len(pathParts) >= 2 && pathParts[1] == "settings" {
+			handleRootSettingsAPI(w, r, ctx, root)
+			return
+		}
+		handleRoot(w, r, ctx, root)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbRoots, err := queries.ListRoots(ctx)
+		if err != nil {
+			log.Printf("Failed to list roots: %v", err)
+			http.Error(w, "Failed to list roots", http.StatusInternalServerError)
+			return
+		}
+		roots := make([]RootSummary, 0, len(dbRoots))
+		for _, root := range dbRoots {
+			roots = append(roots, dbRootToRootSummary(ctx, root))
+		}
+		json.NewEncoder(w).Encode(roots)
+
+	case "POST":
+		var createReq rootRequest
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		createReq.Name = strings.TrimSpace(createReq.Name)
+		if createReq.Name == "" {
+			http.Error(w, "Root name is required", http.StatusBadRequest)
+			return
+		}
+
+		root, err := queries.CreateRoot(ctx, db.CreateRootParams{
+			Name:        createReq.Name,
+			LocalPort:   createReq.LocalPort,
+			ExternalUrl: stringToNullString(createReq.ExternalUrl),
+		})
+		if err != nil {
+			log.Printf("Failed to create root: %v", err)
+			http.Error(w, "Failed to create root", http.StatusInternalServerError)
+			return
+		}
+		invalidateRelatedOriginURLs()
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(dbRootToRootSummary(ctx, root))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleRoot(w http.ResponseWriter, r *http.Request, ctx context.Context, root db.Root) {
+	switch r.Method {
+	case "GET":
+		agents, err := queries.GetAgentsByRootID(ctx, root.ID)
+		if err != nil {
+			http.Error(w, "Failed to get agents", http.StatusInternalServerError)
+			return
+		}
+		dbProjects, err := queries.GetProjectsByRootID(ctx, root.ID)
+		if err != nil {
+			http.Error(w, "Failed to get projects", http.StatusInternalServerError)
+			return
+		}
+		projects := make([]Project, 0, len(dbProjects))
+		for _, project := range dbProjects {
+			projects = append(projects, Project{ID: project.ID, Name: project.Name, BaseDirectories: []BaseDirectory{}, Tasks: []Task{}})
+		}
+		json.NewEncoder(w).Encode(dbRootToRoot(root, agents, projects))
+
+	case "PUT":
+		// Fields left out keep their value
+		updateReq := rootRequest{Name: root.Name, LocalPort: root.LocalPort}
+		if root.ExternalUrl.Valid {
+			updateReq.ExternalUrl = &root.ExternalUrl.String
+		}
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		updateReq.Name = strings.TrimSpace(updateReq.Name)
+		if updateReq.Name == "" {
+			http.Error(w, "Root name is required", http.StatusBadRequest)
+			return
+		}
+
+		updated, err := queries.UpdateRoot(ctx, db.UpdateRootParams{
+			ID:          root.ID,
+			Name:        updateReq.Name,
+			LocalPort:   updateReq.LocalPort,
+			ExternalUrl: stringToNullString(updateReq.ExternalUrl),
+		})
+		if err != nil {
+			log.Printf("Failed to update root %d: %v", root.ID, err)
+			http.Error(w, "Failed to update root", http.StatusInternalServerError)
+			return
+		}
+		invalidateRelatedOriginURLs()
+		json.NewEncoder(w).Encode(dbRootToRootSummary(ctx, updated))
+
+	case "DELETE":
+		// Roots are emptied first, so deleting one never takes work with it
+		if root.ID == defaultRootID {
+			http.Error(w, "The default root cannot be deleted", http.StatusBadRequest)
+			return
+		}
+		summary := dbRootToRootSummary(ctx, root)
+		if summary.Projects > 0 || summary.Agents > 0 {
+			http.Error(w, fmt.Sprintf("Root still has %d projects and %d agents", summary.Projects, summary.Agents), http.StatusConflict)
+			return
+		}
+		if err := queries.DeleteRootSettings(ctx, root.ID); err != nil {
+			log.Printf("Warning: failed to delete settings of root %d: %v", root.ID, err)
+		}
+		if err := queries.DeleteRoot(ctx, root.ID); err != nil {
+			log.Printf("Failed to delete root %d: %v", root.ID, err)
+			http.Error(w, "Failed to delete root", http.StatusInternalServerError)
+			return
+		}
+		invalidateRelatedOriginURLs()
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRootSettingsAPI handles /api/roots/{id}/settings, a map of setting names to values.
+// PUT merges the given settings; an empty value removes a setting.
+func handleRootSettingsAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, root db.Root) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var settings map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		for key, value := range settings {
+			if !rootSettingKey.MatchString(key) {
+				http.Error(w, fmt.Sprintf("Invalid setting name %q", key), http.StatusBadRequest)
+				return
+			}
+			if len(value) > maxRootSettingLength {
+				http.Error(w, fmt.Sprintf("Setting %s is too long", key), http.StatusBadRequest)
+				return
+			}
+		}
+		for key, value := range settings {
+			var err error
+			if value == "" {
+				err = queries.DeleteRootSetting(ctx, db.DeleteRootSettingParams{RootID: root.ID, Key: key})
+			} else {
+				err = queries.SetRootSetting(ctx, db.SetRootSettingParams{RootID: root.ID, Key: key, Value: value})
+			}
+			if err != nil {
+				log.Printf("Failed to save setting %s of root %d: %v", key, root.ID, err)
+				http.Error(w, "Failed to save settings", http.StatusInternalServerError)
+				return
+			}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	dbSettings, err := queries.GetRootSettings(ctx, root.ID)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("Failed to get settings of root %d: %v", root.ID, err)
+		http.Error(w, "Failed to get settings", http.StatusInternalServerError)
+		return
+	}
+	settings := make(map[string]string, len(dbSettings))
+	for _, setting := range dbSettings {
+		settings[setting.Key] = setting.Value
+	}
+	json.NewEncoder(w).Encode(settings)
+}
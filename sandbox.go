@@ -0,0 +1,540 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Sandboxed agent execution
+// -----------------
+//
+// A sandbox policy on a project or an agent wraps the agent command in Linux namespaces.
+// bubblewrap is used when installed, otherwise a small unshare(1) wrapper. Inside the
+// sandbox the base directory is read-write, the rest of the filesystem (toolchains) is
+// read-only, /tmp and the home directory are replaced by empty tmpfs mounts, the server's data
+// directory and database are hidden, and network access must be allowed by the policy.
+
+// Toolchain directories under $HOME that stay visible (read-only) inside the sandbox
+var defaultSandboxHomeToolchains = []string{
+	".cargo", ".rustup", "go", ".nvm", ".bun", ".deno", ".pyenv", ".local/bin", ".gitconfig",
+}
+
+// Prefix of the errors the unshare wrapper prints, so they can be told apart from the output
+// of the command it runs
+const sandboxErrorPrefix = "remote-code-sandbox:"
+
+// Prefixes of lines printed by the sandbox wrappers themselves when they refuse to set up
+// or run the command. Errors of programs inside the sandbox ("Permission denied" from a
+// failed git push, say) look the same whether or not the sandbox caused them, so they are
+// not counted.
+var sandboxViolationPrefixes = []string{
+	"bwrap:",
+	sandboxErrorPrefix,
+}
+
+// How often sandboxed sessions are checked for violations
+const sandboxMonitorInterval = 5 * time.Second
+
+// Violation lines already recorded, per tmux session
+var sandboxSeenViolations = make(map[string]map[string]bool)
+var sandboxSeenViolationsMutex sync.Mutex
+
+// sandboxConfig is the effective policy for one execution
+type sandboxConfig struct {
+	AllowNetwork  bool
+	ReadonlyPaths []string
+	WritablePaths []string
+}
+
+// Whether the unshare wrapper can set up its read-only filesystem here, checked once
+var unshareSandboxChecked sync.Once
+var unshareSandboxWorks bool
+
+// detectSandboxBackend returns "bwrap", "unshare" or "" when neither is available
+func detectSandboxBackend() string {
+	if _, err := exec.LookPath("bwrap"); err == nil {
+		return "bwrap"
+	}
+	if _, err := exec.LookPath("unshare"); err == nil && unshareSandboxUsable() {
+		return "unshare"
+	}
+	return ""
+}
+
+// unshareSandboxUsable sets up an empty sandbox with the unshare wrapper to find out whether
+// user namespaces here may remount the filesystem read-only. Without that the wrapper would
+// confine far less than bwrap, so it is not offered at all.
+func unshareSandboxUsable() bool {
+	unshareSandboxChecked.Do(func() {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		command, err := buildSandboxedCommand("unshare", &sandboxConfig{AllowNetwork: true}, os.TempDir(), home, "true")
+		if err != nil {
+			return
+		}
+		if output, err := exec.Command("sh", "-c", command).CombinedOutput(); err != nil {
+			log.Printf("Sandbox: unshare can't set up a read-only filesystem, not using it: %v: %s", err, strings.TrimSpace(string(output)))
+			return
+		}
+		unshareSandboxWorks = true
+	})
+	return unshareSandboxWorks
+}
+
+// handleSandboxAPI reports which sandbox backend is available (/api/sandbox)
+func handleSandboxAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	backend := detectSandboxBackend()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"available": backend != "",
+		"backend":   backend,
+	})
+}
+
+// handleProjectSandboxAPI handles /api/projects/{id}/sandbox
+func handleProjectSandboxAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	projectID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := queries.GetProject(ctx, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	scope := sql.NullInt64{Int64: projectID, Valid: true}
+	existing, err := queries.GetSandboxPolicyByProjectID(ctx, scope)
+	handleSandboxPolicy(w, r, ctx, existing, err == nil, scope, sql.NullInt64{Valid: false})
+}
+
+// handleAgentSandboxAPI handles /api/agents/{id}/sandbox
+func handleAgentSandboxAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, agentID int64) {
+	if _, err := queries.GetAgent(ctx, agentID); err != nil {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
+	scope := sql.NullInt64{Int64: agentID, Valid: true}
+	existing, err := queries.GetSandboxPolicyByAgentID(ctx, scope)
+	handleSandboxPolicy(w, r, ctx, existing, err == nil, sql.NullInt64{Valid: false}, scope)
+}
+
+// handleSandboxPolicy implements GET/PUT/DELETE for a project's or an agent's policy
+func handleSandboxPolicy(w http.ResponseWriter, r *http.Request, ctx context.Context, existing db.SandboxPolicy, exists bool, projectID, agentID sql.NullInt64) {
+	switch r.Method {
+	case "GET":
+		if !exists {
+			// No policy means no sandbox
+			policy := SandboxPolicy{ReadonlyPaths: []string{}, WritablePaths: []string{}}
+			if projectID.Valid {
+				policy.ProjectID = &projectID.Int64
+			}
+			if agentID.Valid {
+				policy.AgentID = &agentID.Int64
+			}
+			json.NewEncoder(w).Encode(policy)
+			return
+		}
+		json.NewEncoder(w).Encode(dbSandboxPolicyToSandboxPolicy(existing))
+
+	case "PUT":
+		var updateReq struct {
+			Enabled       bool     `json:"enabled"`
+			AllowNetwork  *bool    `json:"allow_network"`
+			ReadonlyPaths []string `json:"readonly_paths"`
+			WritablePaths []string `json:"writable_paths"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		for _, path := range append(updateReq.ReadonlyPaths, updateReq.WritablePaths...) {
+			if path = strings.TrimSpace(path); path != "" && !filepath.IsAbs(path) && !strings.HasPrefix(path, "~/") {
+				http.Error(w, fmt.Sprintf("Path must be absolute or start with ~/: %s", path), http.StatusBadRequest)
+				return
+			}
+		}
+
+		if updateReq.Enabled && detectSandboxBackend() == "" {
+			http.Error(w, "No sandbox backend available (install bubblewrap or util-linux unshare)", http.StatusBadRequest)
+			return
+		}
+
+		// Network access is opt-in; left out, it stays as it was
+		allowNetwork := exists && existing.AllowNetwork
+		if updateReq.AllowNetwork != nil {
+			allowNetwork = *updateReq.AllowNetwork
+		}
+		readonlyPaths := strings.Join(splitLines(strings.Join(updateReq.ReadonlyPaths, "\n")), "\n")
+		writablePaths := strings.Join(splitLines(strings.Join(updateReq.WritablePaths, "\n")), "\n")
+
+		var policy db.SandboxPolicy
+		var err error
+		if exists {
+			policy, err = queries.UpdateSandboxPolicy(ctx, db.UpdateSandboxPolicyParams{
+				ID:            existing.ID,
+				Enabled:       updateReq.Enabled,
+				AllowNetwork:  allowNetwork,
+				ReadonlyPaths: readonlyPaths,
+				WritablePaths: writablePaths,
+			})
+		} else {
+			policy, err = queries.CreateSandboxPolicy(ctx, db.CreateSandboxPolicyParams{
+				ProjectID:     projectID,
+				AgentID:       agentID,
+				Enabled:       updateReq.Enabled,
+				AllowNetwork:  allowNetwork,
+				ReadonlyPaths: readonlyPaths,
+				WritablePaths: writablePaths,
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to save sandbox policy: %v", err)
+			http.Error(w, "Failed to save sandbox policy", http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(dbSandboxPolicyToSandboxPolicy(policy))
+
+	case "DELETE":
+		if exists {
+			if err := queries.DeleteSandboxPolicy(ctx, existing.ID); err != nil {
+				log.Printf("Failed to delete sandbox policy %d: %v", existing.ID, err)
+				http.Error(w, "Failed to delete sandbox policy", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// resolveSandboxConfig combines the project's and the agent's policies.
+// The sandbox applies if either policy enables it; network is only allowed if every
+// enabled policy allows it; extra paths are merged.
+func resolveSandboxConfig(ctx context.Context, projectID, agentID int64) (*sandboxConfig, bool) {
+	var policies []db.SandboxPolicy
+	if policy, err := queries.GetSandboxPolicyByProjectID(ctx, sql.NullInt64{Int64: projectID, Valid: true}); err == nil && policy.Enabled {
+		policies = append(policies, policy)
+	}
+	if policy, err := queries.GetSandboxPolicyByAgentID(ctx, sql.NullInt64{Int64: agentID, Valid: true}); err == nil && policy.Enabled {
+		policies = append(policies, policy)
+	}
+	if len(policies) == 0 {
+		return nil, false
+	}
+
+	config := &sandboxConfig{AllowNetwork: true}
+	for _, policy := range policies {
+		config.AllowNetwork = config.AllowNetwork && policy.AllowNetwork
+		config.ReadonlyPaths = append(config.ReadonlyPaths, splitLines(policy.ReadonlyPaths)...)
+		config.WritablePaths = append(config.WritablePaths, splitLines(policy.WritablePaths)...)
+	}
+	return config, true
+}
+
+// sandboxHiddenPaths returns the server's private files that exist: the data directory, covered
+// by an empty tmpfs inside the sandbox, and the database and its journals, replaced by
+// /dev/null. They hold login tokens, the key that decrypts secrets and the local CA key, any
+// of which would let an agent act as a signed in user.
+func sandboxHiddenPaths() (dirs []string, files []string) {
+	dirs, files = []string{}, []string{}
+	if path, err := filepath.Abs(dataDir); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			dirs = append(dirs, path)
+		}
+	}
+	if databasePath != "" {
+		if path, err := filepath.Abs(databasePath); err == nil {
+			for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+				if _, err := os.Stat(path + suffix); err == nil {
+					files = append(files, path+suffix)
+				}
+			}
+		}
+	}
+	return dirs, files
+}
+
+// expandHomePath resolves a leading ~/ against the home directory
+func expandHomePath(path, home string) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+// buildSandboxedCommand wraps a shell command so it runs inside the sandbox.
+// The result is a single shell command line suitable for tmux send-keys.
+func buildSandboxedCommand(backend string, config *sandboxConfig, baseDir, home, command string) (string, error) {
+	readonly := []string{}
+	for _, toolchain := range defaultSandboxHomeToolchains {
+		readonly = append(readonly, filepath.Join(home, toolchain))
+	}
+	for _, path := range config.ReadonlyPaths {
+		readonly = append(readonly, expandHomePath(path, home))
+	}
+	writable := []string{}
+	for _, path := range config.WritablePaths {
+		writable = append(writable, expandHomePath(path, home))
+	}
+	hiddenDirs, hiddenFiles := sandboxHiddenPaths()
+
+	// Paths bound into the sandbox that lie in a hidden directory, such as an execution's
+	// context files in the data directory, are bound again on top of it
+	type boundPath struct {
+		path     string
+		readOnly bool
+	}
+	var rebound []boundPath
+	for _, dir := range hiddenDirs {
+		for _, path := range readonly {
+			if isPathWithinBase(dir, path) {
+				rebound = append(rebound, boundPath{path, true})
+			}
+		}
+		for _, path := range append(writable, baseDir) {
+			if isPathWithinBase(dir, path) {
+				rebound = append(rebound, boundPath{path, false})
+			}
+		}
+	}
+
+	switch backend {
+	case "bwrap":
+		args := []string{"bwrap", "--die-with-parent", "--unshare-all"}
+		if config.AllowNetwork {
+			args = append(args, "--share-net")
+		}
+		// Everything read-only, then a fresh /tmp and an empty home on top
+		args = append(args, "--ro-bind", "/", "/", "--dev", "/dev", "--proc", "/proc", "--tmpfs", "/tmp", "--tmpfs", home)
+		for _, path := range readonly {
+			args = append(args, "--ro-bind-try", path, path)
+		}
+		for _, path := range writable {
+			args = append(args, "--bind-try", path, path)
+		}
+		args = append(args, "--bind", baseDir, baseDir)
+		// The server's private files go last, so no path bound above uncovers them
+		for _, path := range hiddenDirs {
+			args = append(args, "--tmpfs", path)
+		}
+		for _, bound := range rebound {
+			if bound.readOnly {
+				args = append(args, "--ro-bind-try", bound.path, bound.path)
+			} else {
+				args = append(args, "--bind-try", bound.path, bound.path)
+			}
+		}
+		for _, path := range hiddenFiles {
+			args = append(args, "--ro-bind", "/dev/null", path)
+		}
+		args = append(args, "--chdir", baseDir, "--", "sh", "-c", command)
+
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		return strings.Join(quoted, " "), nil
+
+	case "unshare":
+		// Run as root inside a user namespace to set up the mounts, then chroot into them.
+		// The new root is a recursive bind of / with every mount remounted read-only
+		// (keeping the flags a user namespace may not drop), like bwrap's --ro-bind / /.
+		// The original tree stays writable underneath, so it is the source of the paths
+		// bound back on top. Any failed step stops the script before the command runs.
+		var script strings.Builder
+		script.WriteString("set -e; ")
+		fmt.Fprintf(&script, "trap \"echo %s >&2\" EXIT; ", shellQuote(sandboxErrorPrefix+" failed to set up the sandbox, not running the command"))
+		script.WriteString(`readonly_mounts() { printf '%s\n' "$(cat /proc/self/mountinfo)" | while read -r _ _ _ _ mp opts _; do ` +
+			`mp=$(printf '%b' "$mp"); case "$mp" in "$1"|"$1"/*) mount -o "remount,bind,ro${opts#r[ow]}" "$mp";; esac; done; }; `)
+		script.WriteString("root=$(mktemp -d); mount --rbind / \"$root\"; readonly_mounts \"$root\"; ")
+		script.WriteString("mount --rbind /dev \"$root/dev\"; mount --rbind /proc \"$root/proc\"; ")
+		fmt.Fprintf(&script, "mount -t tmpfs tmpfs \"$root\"/tmp; mkdir -p \"$root\"%s; mount -t tmpfs tmpfs \"$root\"%s; ", shellQuote(home), shellQuote(home))
+
+		bindBack := func(path string, readOnly bool) {
+			source, target := shellQuote(path), "\"$root\""+shellQuote(path)
+			fmt.Fprintf(&script, "if [ -e %s ]; then ", source)
+			fmt.Fprintf(&script, "if [ -d %s ]; then mkdir -p %s; else mkdir -p \"$(dirname %s)\" && { [ -e %s ] || touch %s; }; fi; ",
+				source, target, target, target, target)
+			fmt.Fprintf(&script, "mount --bind %s %s; ", source, target)
+			if readOnly {
+				fmt.Fprintf(&script, "readonly_mounts %s; ", target)
+			}
+			script.WriteString("fi; ")
+		}
+		for _, path := range readonly {
+			bindBack(path, true)
+		}
+		for _, path := range writable {
+			bindBack(path, false)
+		}
+		fmt.Fprintf(&script, "mkdir -p \"$root\"%s; mount --bind %s \"$root\"%s; ", shellQuote(baseDir), shellQuote(baseDir), shellQuote(baseDir))
+		for _, path := range hiddenDirs {
+			fmt.Fprintf(&script, "mkdir -p \"$root\"%s; mount -t tmpfs tmpfs \"$root\"%s; ", shellQuote(path), shellQuote(path))
+		}
+		for _, bound := range rebound {
+			bindBack(bound.path, bound.readOnly)
+		}
+		for _, path := range hiddenFiles {
+			target := "\"$root\"" + shellQuote(path)
+			fmt.Fprintf(&script, "if [ -e %s ]; then mount --bind /dev/null %s; fi; ", target, target)
+		}
+
+		// The mount point of the new root is left on the real /tmp; remove it afterwards
+		script.WriteString("trap - EXIT; set +e; ")
+		fmt.Fprintf(&script, "chroot \"$root\" sh -c %s sh %s %s; ",
+			shellQuote(`cd "$1" && exec sh -c "$2"`), shellQuote(baseDir), shellQuote(command))
+		script.WriteString("status=$?; umount -l \"$root\" && rmdir \"$root\"; exit $status")
+
+		args := []string{"unshare", "--user", "--map-root-user", "--mount", "--pid", "--fork", "--mount-proc"}
+		if !config.AllowNetwork {
+			args = append(args, "--net")
+		}
+		args = append(args, "sh", "-c", script.String())
+
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		return strings.Join(quoted, " "), nil
+	}
+
+	return "", fmt.Errorf("no sandbox backend available")
+}
+
+// sandboxAgentCommand wraps the agent command when the project or agent requires a sandbox.
+// extraReadonly paths stay visible to the agent on top of the policy's.
+// It returns the command to run and the backend used ("" when not sandboxed).
+func sandboxAgentCommand(ctx context.Context, projectID, agentID int64, baseDir, command string, extraReadonly ...string) (string, string, error) {
+	config, enabled := resolveSandboxConfig(ctx, projectID, agentID)
+	if !enabled {
+		return command, "", nil
+	}
+	config.ReadonlyPaths = append(config.ReadonlyPaths, extraReadonly...)
+
+	backend := detectSandboxBackend()
+	if backend == "" {
+		return "", "", fmt.Errorf("sandbox required but neither bwrap nor a working unshare is available")
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to determine home directory: %v", err)
+	}
+
+	wrapped, err := buildSandboxedCommand(backend, config, baseDir, home, command)
+	if err != nil {
+		return "", "", err
+	}
+	return wrapped, backend, nil
+}
+
+// shellQuote quotes a string for POSIX sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runSandboxMonitor periodically scans sandboxed agent sessions for violations
+func runSandboxMonitor() {
+	ticker := time.NewTicker(sandboxMonitorInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		checkSandboxViolations(context.Background())
+	}
+}
+
+func checkSandboxViolations(ctx context.Context) {
+	executions, err := queries.ListTaskExecutions(ctx)
+	if err != nil {
+		log.Printf("Sandbox monitor: failed to list task executions: %v", err)
+		return
+	}
+
+	activeSessions := make(map[string]bool)
+	for _, execution := range executions {
+		if execution.Sandbox == "" || !execution.AgentTmuxID.Valid {
+			continue
+		}
+		sessionName := execution.AgentTmuxID.String
+		activeSessions[sessionName] = true
+
+		output, err := sessionManager.Capture(sessionName, CaptureOptions{History: 200})
+		if err != nil {
+			continue
+		}
+
+		for _, line := range findSandboxViolations(output) {
+			sandboxSeenViolationsMutex.Lock()
+			if sandboxSeenViolations[sessionName] == nil {
+				sandboxSeenViolations[sessionName] = make(map[string]bool)
+			}
+			seen := sandboxSeenViolations[sessionName][line]
+			sandboxSeenViolations[sessionName][line] = true
+			sandboxSeenViolationsMutex.Unlock()
+
+			if seen {
+				continue
+			}
+
+			log.Printf("Sandbox violation in task execution %d: %s", execution.ID, line)
+			recordTaskExecutionEvent(ctx, execution.ID, "sandbox_violation", "Blocked by sandbox", line, sql.NullInt64{Valid: false})
+		}
+	}
+
+	// Forget sessions that are gone
+	sandboxSeenViolationsMutex.Lock()
+	for sessionName := range sandboxSeenViolations {
+		if !activeSessions[sessionName] {
+			delete(sandboxSeenViolations, sessionName)
+		}
+	}
+	sandboxSeenViolationsMutex.Unlock()
+}
+
+// findSandboxViolations returns the distinct output lines printed by a sandbox wrapper
+func findSandboxViolations(content string) []string {
+	var violations []string
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		for _, prefix := range sandboxViolationPrefixes {
+			if strings.HasPrefix(line, prefix) {
+				violations = append(violations, line)
+				seen[line] = true
+				break
+			}
+		}
+	}
+	return violations
+}
@@ -0,0 +1,551 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// -----------------
+// Session management
+// -----------------
+//
+// Agents, dev servers, tunnels and web terminals all run in named terminal sessions.
+// Everything goes through the SessionManager interface so the backend can be swapped
+// (and replaced by an in-memory fake in tests).
+
+// SessionManager creates and drives named terminal sessions
+type SessionManager interface {
+	// Create starts a detached session running a shell in opts.Dir
+	Create(name string, opts SessionOptions) error
+	// SendKeys sends tmux-style keys; plain strings are typed, names like "Enter" or "C-c" are pressed
+	SendKeys(name string, keys ...string) error
+	// Paste inserts text literally, without interpreting key names
+	Paste(name string, text string) error
+	// Capture returns the visible pane content (plus opts.History lines of scrollback)
+	Capture(name string, opts CaptureOptions) (string, error)
+	// Cursor returns the cursor position as "x,y"
+	Cursor(name string) (string, error)
+	// PanePID returns the pid of the session's shell
+	PanePID(name string) (int, error)
+	// Kill terminates the session and everything running in it
+	Kill(name string) error
+	// List returns all sessions
+	List() ([]SessionInfo, error)
+	// AttachPTY connects a terminal to the session, creating it first if create is set
+	AttachPTY(name string, create bool) (SessionPTY, error)
+}
+
+// SessionOptions configures a new session
+type SessionOptions struct {
+	Dir string
+	Env []string // NAME=value
+}
+
+// CaptureOptions configures Capture
+type CaptureOptions struct {
+	Escapes bool // keep color escape sequences
+	History int  // lines of scrollback to include above the visible pane
+}
+
+// SessionInfo describes a running session
+type SessionInfo struct {
+	Name    string
+	Created string // unix timestamp
+}
+
+// SessionPTY is a terminal attached to a session
+type SessionPTY interface {
+	io.ReadWriteCloser
+	Resize(cols, rows uint16) error
+}
+
+// Name of the shared terminal used when the web terminal doesn't ask for a session
+const defaultTerminalSession = "remote-code"
+
+// The session backend used by the server
+var sessionManager SessionManager = redactingSessionManager{newTmuxSessionManager()}
+
+// newSessionManager returns the backend selected by REMOTE_CODE_SESSION_BACKEND
+func newSessionManager(backend string) (SessionManager, error) {
+	switch backend {
+	case "", "tmux":
+		return redactingSessionManager{newTmuxSessionManager()}, nil
+	case "pty":
+		return redactingSessionManager{newPTYSessionManager()}, nil
+	default:
+		return nil, fmt.Errorf("unknown session backend %q (expected tmux or pty)", backend)
+	}
+}
+
+// sessionExists reports whether a session with the given name is running
+func sessionExists(name string) bool {
+	sessions, err := sessionManager.List()
+	if err != nil {
+		return false
+	}
+	for _, session := range sessions {
+		if session.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// -----------------
+// Secret redaction
+// -----------------
+
+// How long output that may be the start of a secret is held back waiting for the rest
+const redactionHoldTimeout = 50 * time.Millisecond
+
+// redactingSessionManager masks secret environment values in everything read back from a
+// backend's sessions: captured panes and attached terminals
+type redactingSessionManager struct {
+	SessionManager
+}
+
+func (m redactingSessionManager) Capture(name string, opts CaptureOptions) (string, error) {
+	output, err := m.SessionManager.Capture(name, opts)
+	return redactSecrets(context.Background(), output), err
+}
+
+func (m redactingSessionManager) AttachPTY(name string, create bool) (SessionPTY, error) {
+	session, err := m.SessionManager.AttachPTY(name, create)
+	if err != nil {
+		return nil, err
+	}
+	return newRedactingPTY(session), nil
+}
+
+// redactingPTY masks secrets in a terminal's output. A secret can be split across reads,
+// so output ending in the start of one is held back until the next read shows whether the
+// rest follows, or until nothing more arrives for a moment.
+type redactingPTY struct {
+	SessionPTY
+	chunks    chan []byte
+	err       error // why the terminal stopped, set before chunks is closed
+	done      chan struct{}
+	closeOnce sync.Once
+
+	pending []byte // output that may be the start of a secret
+	ready   []byte // redacted output not yet returned
+}
+
+func newRedactingPTY(session SessionPTY) *redactingPTY {
+	p := &redactingPTY{SessionPTY: session, chunks: make(chan []byte), done: make(chan struct{})}
+	go func() {
+		defer close(p.chunks)
+		buf := make([]byte, 4096)
+		for {
+			n, err := session.Read(buf)
+			if n > 0 {
+				select {
+				case p.chunks <- append([]byte(nil), buf[:n]...):
+				case <-p.done:
+					p.err = io.ErrClosedPipe
+					return
+				}
+			}
+			if err != nil {
+				p.err = err
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *redactingPTY) Read(b []byte) (int, error) {
+	for len(p.ready) == 0 {
+		var timeout <-chan time.Time
+		if len(p.pending) > 0 {
+			timeout = time.After(redactionHoldTimeout)
+		}
+
+		select {
+		case chunk, ok := <-p.chunks:
+			if !ok {
+				if len(p.pending) > 0 {
+					p.ready, p.pending = p.pending, nil
+					break
+				}
+				return 0, p.err
+			}
+			text := redactSecrets(context.Background(), string(append(p.pending, chunk...)))
+			held := partialSecretLength(context.Background(), text)
+			p.ready = []byte(text[:len(text)-held])
+			p.pending = []byte(text[len(text)-held:])
+		case <-timeout:
+			p.ready, p.pending = p.pending, nil
+		}
+	}
+
+	n := copy(b, p.ready)
+	p.ready = p.ready[n:]
+	return n, nil
+}
+
+func (p *redactingPTY) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+	return p.SessionPTY.Close()
+}
+
+// -----------------
+// tmux backend
+// -----------------
+
+type tmuxSessionManager struct{}
+
+func newTmuxSessionManager() *tmuxSessionManager {
+	return &tmuxSessionManager{}
+}
+
+func (t *tmuxSessionManager) Create(name string, opts SessionOptions) error {
+	args := []string{"new-session", "-d", "-s", name}
+	if opts.Dir != "" {
+		args = append(args, "-c", opts.Dir)
+	}
+	if len(opts.Env) == 0 {
+		return exec.Command("tmux", args...).Run()
+	}
+
+	// Values may be secrets, so they go through a private file the shell reads and removes
+	// instead of the command line, where ps would show them
+	envFile, err := writeSessionEnvFile(opts.Env)
+	if err != nil {
+		return err
+	}
+	script := fmt.Sprintf(`. %s; rm -f %s; exec "${SHELL:-/bin/sh}" -l`, shellQuote(envFile), shellQuote(envFile))
+	args = append(args, "/bin/sh -c "+shellQuote(script))
+	if err := exec.Command("tmux", args...).Run(); err != nil {
+		os.Remove(envFile)
+		return err
+	}
+	return nil
+}
+
+// writeSessionEnvFile writes NAME=value pairs as a shell script of exports, readable only
+// by this user
+func writeSessionEnvFile(env []string) (string, error) {
+	file, err := os.CreateTemp("", "remote-code-env-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create session environment file: %v", err)
+	}
+	defer file.Close()
+
+	var script strings.Builder
+	for _, pair := range env {
+		name, value, _ := strings.Cut(pair, "=")
+		fmt.Fprintf(&script, "export %s=%s\n", name, shellQuote(value))
+	}
+	if _, err := file.WriteString(script.String()); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to write session environment file: %v", err)
+	}
+	return file.Name(), nil
+}
+
+func (t *tmuxSessionManager) SendKeys(name string, keys ...string) error {
+	args := append([]string{"send-keys", "-t", name}, keys...)
+	return exec.Command("tmux", args...).Run()
+}
+
+func (t *tmuxSessionManager) Paste(name string, text string) error {
+	buffer := "remote-code-paste-" + name
+	load := exec.Command("tmux", "load-buffer", "-b", buffer, "-")
+	load.Stdin = strings.NewReader(text)
+	if err := load.Run(); err != nil {
+		return err
+	}
+	return exec.Command("tmux", "paste-buffer", "-d", "-b", buffer, "-t", name).Run()
+}
+
+func (t *tmuxSessionManager) Capture(name string, opts CaptureOptions) (string, error) {
+	args := []string{"capture-pane", "-t", name, "-p"}
+	if opts.Escapes {
+		args = append(args, "-e")
+	}
+	if opts.History > 0 {
+		args = append(args, "-S", strconv.Itoa(-opts.History))
+	}
+	output, err := exec.Command("tmux", args...).Output()
+	return string(output), err
+}
+
+func (t *tmuxSessionManager) Cursor(name string) (string, error) {
+	output, err := exec.Command("tmux", "display-message", "-t", name, "-p", "#{cursor_x},#{cursor_y}").Output()
+	return strings.TrimSpace(string(output)), err
+}
+
+func (t *tmuxSessionManager) PanePID(name string) (int, error) {
+	output, err := exec.Command("tmux", "display-message", "-p", "-t", name, "#{pane_pid}").Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(output)))
+}
+
+func (t *tmuxSessionManager) Kill(name string) error {
+	return exec.Command("tmux", "kill-session", "-t", name).Run()
+}
+
+func (t *tmuxSessionManager) List() ([]SessionInfo, error) {
+	output, err := exec.Command("tmux", "list-sessions", "-F", "#{session_name}|#{session_created}").Output()
+	if err != nil {
+		// No tmux server means no sessions
+		return []SessionInfo{}, nil
+	}
+
+	sessions := []SessionInfo{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		parts := strings.SplitN(line, "|", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			continue
+		}
+		sessions = append(sessions, SessionInfo{Name: parts[0], Created: parts[1]})
+	}
+	return sessions, nil
+}
+
+func (t *tmuxSessionManager) AttachPTY(name string, create bool) (SessionPTY, error) {
+	var cmd *exec.Cmd
+	if create {
+		cmd = exec.Command("tmux", "new-session", "-A", "-s", name)
+	} else {
+		cmd = exec.Command("tmux", "attach-session", "-t", name)
+	}
+
+	// Ensure proper terminal environment for UTF-8 and colors
+	cmd.Env = append(os.Environ(),
+		"LANG=C.UTF-8",
+		"LC_ALL=C.UTF-8",
+		"TERM=xterm-256color",
+	)
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &tmuxPTY{File: ptmx, cmd: cmd}, nil
+}
+
+// tmuxPTY is a tmux client running on a local pseudo-terminal
+type tmuxPTY struct {
+	*os.File
+	cmd *exec.Cmd
+}
+
+func (p *tmuxPTY) Resize(cols, rows uint16) error {
+	return pty.Setsize(p.File, &pty.Winsize{Cols: cols, Rows: rows})
+}
+
+func (p *tmuxPTY) Close() error {
+	err := p.File.Close()
+	// Detaching the client leaves the session running
+	if p.cmd.Process != nil {
+		p.cmd.Process.Kill()
+		p.cmd.Wait()
+	}
+	return err
+}
+
+// -----------------
+// In-memory backend
+// -----------------
+
+// memorySessionManager keeps sessions in memory without running anything.
+// Keys sent to a session are appended to its screen, which makes it suitable for tests.
+type memorySessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*memorySession
+}
+
+type memorySession struct {
+	Options SessionOptions
+	Created time.Time
+	Keys    []string
+	Screen  bytes.Buffer
+}
+
+func newMemorySessionManager() *memorySessionManager {
+	return &memorySessionManager{sessions: make(map[string]*memorySession)}
+}
+
+func (m *memorySessionManager) session(name string) (*memorySession, error) {
+	session, ok := m.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("session not found: %s", name)
+	}
+	return session, nil
+}
+
+func (m *memorySessionManager) Create(name string, opts SessionOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sessions[name]; exists {
+		return fmt.Errorf("duplicate session: %s", name)
+	}
+	m.sessions[name] = &memorySession{Options: opts, Created: time.Now()}
+	return nil
+}
+
+func (m *memorySessionManager) SendKeys(name string, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.session(name)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		session.Keys = append(session.Keys, key)
+		switch key {
+		case "Enter":
+			session.Screen.WriteString("\n")
+		case "C-c":
+			session.Screen.WriteString("^C\n")
+		default:
+			session.Screen.WriteString(key)
+		}
+	}
+	return nil
+}
+
+func (m *memorySessionManager) Paste(name string, text string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.session(name)
+	if err != nil {
+		return err
+	}
+	session.Keys = append(session.Keys, text)
+	session.Screen.WriteString(text)
+	return nil
+}
+
+func (m *memorySessionManager) Capture(name string, opts CaptureOptions) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.session(name)
+	if err != nil {
+		return "", err
+	}
+	return session.Screen.String(), nil
+}
+
+func (m *memorySessionManager) Cursor(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, err := m.session(name)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(session.Screen.String(), "\n")
+	return fmt.Sprintf("%d,%d", len(lines[len(lines)-1]), len(lines)-1), nil
+}
+
+func (m *memorySessionManager) PanePID(name string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.session(name); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("in-memory sessions have no processes")
+}
+
+func (m *memorySessionManager) Kill(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.session(name); err != nil {
+		return err
+	}
+	delete(m.sessions, name)
+	return nil
+}
+
+func (m *memorySessionManager) List() ([]SessionInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []SessionInfo{}
+	for name, session := range m.sessions {
+		sessions = append(sessions, SessionInfo{Name: name, Created: strconv.FormatInt(session.Created.Unix(), 10)})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+func (m *memorySessionManager) AttachPTY(name string, create bool) (SessionPTY, error) {
+	m.mu.Lock()
+	_, exists := m.sessions[name]
+	m.mu.Unlock()
+
+	if !exists {
+		if !create {
+			return nil, fmt.Errorf("session not found: %s", name)
+		}
+		if err := m.Create(name, SessionOptions{}); err != nil {
+			return nil, err
+		}
+	}
+
+	reader, writer := io.Pipe()
+	return &memoryPTY{manager: m, name: name, reader: reader, writer: writer}, nil
+}
+
+// SentKeys returns everything sent to a session, in order
+func (m *memorySessionManager) SentKeys(name string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[name]
+	if !ok {
+		return nil
+	}
+	return append([]string{}, session.Keys...)
+}
+
+// memoryPTY feeds terminal input to the session as keys; output is whatever the test writes to it
+type memoryPTY struct {
+	manager *memorySessionManager
+	name    string
+	reader  *io.PipeReader
+	writer  *io.PipeWriter
+}
+
+func (p *memoryPTY) Read(b []byte) (int, error) {
+	return p.reader.Read(b)
+}
+
+func (p *memoryPTY) Write(b []byte) (int, error) {
+	if err := p.manager.Paste(p.name, string(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *memoryPTY) Resize(cols, rows uint16) error {
+	return nil
+}
+
+func (p *memoryPTY) Close() error {
+	p.writer.Close()
+	return p.reader.Close()
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// -----------------
+// Native PTY backend
+// -----------------
+//
+// Runs every session as a shell on a pseudo-terminal owned by the server process, for
+// hosts without tmux. Output goes to a ring buffer that is replayed to new viewers and
+// to a terminalScreen that answers Capture and Cursor. Sessions end with the server.
+
+// Size of the raw output replayed to viewers when they attach
+const ptyScrollbackBytes = 256 * 1024
+
+// Output chunks a viewer may fall behind before it is disconnected
+const ptyViewerBuffer = 256
+
+// Size of new sessions until a viewer resizes them, same as a detached tmux session
+const (
+	ptyDefaultCols = 80
+	ptyDefaultRows = 24
+)
+
+// How long a killed session gets to exit after SIGHUP before it is killed outright
+const ptyKillTimeout = 2 * time.Second
+
+// tmux key names understood by SendKeys
+var ptyKeyNames = map[string]string{
+	"Enter":    "\r",
+	"Escape":   "\x1b",
+	"Tab":      "\t",
+	"BTab":     "\x1b[Z",
+	"BSpace":   "\x7f",
+	"Space":    " ",
+	"Up":       "\x1b[A",
+	"Down":     "\x1b[B",
+	"Right":    "\x1b[C",
+	"Left":     "\x1b[D",
+	"Home":     "\x1b[1~",
+	"End":      "\x1b[4~",
+	"IC":       "\x1b[2~",
+	"Insert":   "\x1b[2~",
+	"DC":       "\x1b[3~",
+	"Delete":   "\x1b[3~",
+	"PPage":    "\x1b[5~",
+	"PageUp":   "\x1b[5~",
+	"NPage":    "\x1b[6~",
+	"PageDown": "\x1b[6~",
+	"F1":       "\x1bOP",
+	"F2":       "\x1bOQ",
+	"F3":       "\x1bOR",
+	"F4":       "\x1bOS",
+	"F5":       "\x1b[15~",
+	"F6":       "\x1b[17~",
+	"F7":       "\x1b[18~",
+	"F8":       "\x1b[19~",
+	"F9":       "\x1b[20~",
+	"F10":      "\x1b[21~",
+	"F11":      "\x1b[23~",
+	"F12":      "\x1b[24~",
+}
+
+// translateKey turns a tmux send-keys argument into the bytes a terminal would send.
+// Like tmux, anything that isn't a key name is typed literally.
+func translateKey(key string) string {
+	if seq, ok := ptyKeyNames[key]; ok {
+		return seq
+	}
+	if strings.HasPrefix(key, "M-") && len(key) > 2 {
+		return "\x1b" + translateKey(key[2:])
+	}
+	if strings.HasPrefix(key, "C-") && len(key) == 3 {
+		c := key[2]
+		switch {
+		case c >= 'a' && c <= 'z':
+			return string(rune(c - 'a' + 1))
+		case c >= '@' && c <= '_':
+			return string(rune(c - '@'))
+		case c == '?':
+			return "\x7f"
+		}
+	}
+	return key
+}
+
+// ringBuffer keeps the last len(data) bytes written to it
+type ringBuffer struct {
+	data []byte
+	pos  int
+	full bool
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, size)}
+}
+
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if n >= len(b.data) {
+		copy(b.data, p[n-len(b.data):])
+		b.pos = 0
+		b.full = true
+		return n, nil
+	}
+	copied := copy(b.data[b.pos:], p)
+	if copied < n {
+		copy(b.data, p[copied:])
+		b.full = true
+	}
+	b.pos = (b.pos + n) % len(b.data)
+	if b.pos == 0 {
+		b.full = true
+	}
+	return n, nil
+}
+
+// Bytes returns the buffered output, oldest first
+func (b *ringBuffer) Bytes() []byte {
+	if !b.full {
+		return append([]byte{}, b.data[:b.pos]...)
+	}
+	return append(append([]byte{}, b.data[b.pos:]...), b.data[:b.pos]...)
+}
+
+type ptySessionManager struct {
+	mu       sync.Mutex
+	sessions map[string]*ptySession
+}
+
+type ptySession struct {
+	name    string
+	created time.Time
+	cmd     *exec.Cmd
+	ptmx    *os.File
+	done    chan struct{} // closed once the shell has exited
+
+	mu         sync.Mutex
+	scrollback *ringBuffer
+	screen     *terminalScreen
+	viewers    map[*ptyViewer]bool
+}
+
+func newPTYSessionManager() *ptySessionManager {
+	return &ptySessionManager{sessions: make(map[string]*ptySession)}
+}
+
+func (m *ptySessionManager) session(name string) (*ptySession, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session, ok := m.sessions[name]
+	if !ok {
+		return nil, fmt.Errorf("can't find session: %s", name)
+	}
+	return session, nil
+}
+
+func (m *ptySessionManager) Create(name string, opts SessionOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.sessions[name]; exists {
+		return fmt.Errorf("duplicate session: %s", name)
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell)
+	cmd.Dir = opts.Dir
+	cmd.Env = append(os.Environ(),
+		"LANG=C.UTF-8",
+		"LC_ALL=C.UTF-8",
+		"TERM=xterm-256color",
+	)
+	cmd.Env = append(cmd.Env, opts.Env...)
+
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{Cols: ptyDefaultCols, Rows: ptyDefaultRows})
+	if err != nil {
+		return err
+	}
+
+	session := &ptySession{
+		name:       name,
+		created:    time.Now(),
+		cmd:        cmd,
+		ptmx:       ptmx,
+		done:       make(chan struct{}),
+		scrollback: newRingBuffer(ptyScrollbackBytes),
+		screen:     newTerminalScreen(ptyDefaultCols, ptyDefaultRows),
+		viewers:    make(map[*ptyViewer]bool),
+	}
+	m.sessions[name] = session
+
+	go m.readOutput(session)
+	return nil
+}
+
+// readOutput records the session's output and fans it out to viewers until the shell exits
+func (m *ptySessionManager) readOutput(session *ptySession) {
+	buf := make([]byte, 4096)
+	for {
+		n, err := session.ptmx.Read(buf)
+		if n > 0 {
+			session.record(buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	session.cmd.Wait()
+	session.ptmx.Close()
+	close(session.done)
+
+	m.mu.Lock()
+	if m.sessions[session.name] == session {
+		delete(m.sessions, session.name)
+	}
+	m.mu.Unlock()
+
+	session.mu.Lock()
+	for viewer := range session.viewers {
+		session.detach(viewer)
+	}
+	session.mu.Unlock()
+
+	log.Printf("Session %s exited", session.name)
+}
+
+func (s *ptySession) record(output []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scrollback.Write(output)
+	s.screen.Write(output)
+
+	for viewer := range s.viewers {
+		select {
+		case viewer.output <- append([]byte{}, output...):
+		default:
+			// A viewer that can't keep up would otherwise hold up the session
+			log.Printf("Disconnecting slow viewer from session %s", s.name)
+			s.detach(viewer)
+		}
+	}
+}
+
+// detach removes a viewer; the caller holds s.mu
+func (s *ptySession) detach(viewer *ptyViewer) {
+	if s.viewers[viewer] {
+		delete(s.viewers, viewer)
+		close(viewer.output)
+	}
+}
+
+func (m *ptySessionManager) SendKeys(name string, keys ...string) error {
+	session, err := m.session(name)
+	if err != nil {
+		return err
+	}
+
+	var input strings.Builder
+	for _, key := range keys {
+		input.WriteString(translateKey(key))
+	}
+	_, err = io.WriteString(session.ptmx, input.String())
+	return err
+}
+
+func (m *ptySessionManager) Paste(name string, text string) error {
+	session, err := m.session(name)
+	if err != nil {
+		return err
+	}
+
+	// Like tmux paste-buffer, line feeds are sent as carriage returns
+	_, err = io.WriteString(session.ptmx, strings.ReplaceAll(text, "\n", "\r"))
+	return err
+}
+
+func (m *ptySessionManager) Capture(name string, opts CaptureOptions) (string, error) {
+	session, err := m.session(name)
+	if err != nil {
+		return "", err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.screen.Capture(opts.Escapes, opts.History), nil
+}
+
+func (m *ptySessionManager) Cursor(name string) (string, error) {
+	session, err := m.session(name)
+	if err != nil {
+		return "", err
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	return session.screen.Cursor(), nil
+}
+
+func (m *ptySessionManager) PanePID(name string) (int, error) {
+	session, err := m.session(name)
+	if err != nil {
+		return 0, err
+	}
+	return session.cmd.Process.Pid, nil
+}
+
+func (m *ptySessionManager) Kill(name string) error {
+	m.mu.Lock()
+	session, ok := m.sessions[name]
+	if ok {
+		delete(m.sessions, name)
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("can't find session: %s", name)
+	}
+
+	// The shell leads its own terminal session, but with job control every job runs in a
+	// process group of its own, so each process of the session is hung up like tmux does,
+	// then killed outright if it is still there after a while
+	pid := session.cmd.Process.Pid
+	signalSessionProcesses(pid, syscall.SIGHUP)
+	go func() {
+		select {
+		case <-session.done:
+		case <-time.After(ptyKillTimeout):
+		}
+		signalSessionProcesses(pid, syscall.SIGKILL)
+	}()
+	return nil
+}
+
+// signalSessionProcesses signals every process in the terminal session led by sid, along
+// with their descendants that started sessions of their own
+func signalSessionProcesses(sid int, sig syscall.Signal) {
+	for _, pid := range sessionProcesses(sid) {
+		syscall.Kill(pid, sig)
+	}
+	// Without /proc at least the shell's own process group is reached
+	syscall.Kill(-sid, sig)
+}
+
+// sessionProcesses returns the pids of the processes in the terminal session sid and of
+// their descendants, read from /proc
+func sessionProcesses(sid int) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	parents := make(map[int]int)
+	members := make(map[int]bool)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := os.ReadFile("/proc/" + entry.Name() + "/stat")
+		if err != nil {
+			continue
+		}
+		// The command name may contain spaces; the fields after it are
+		// state, ppid, pgrp and session
+		fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+		if len(fields) < 4 {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		session, _ := strconv.Atoi(fields[3])
+		parents[pid] = ppid
+		if session == sid {
+			members[pid] = true
+		}
+	}
+
+	for added := true; added; {
+		added = false
+		for pid, ppid := range parents {
+			if !members[pid] && members[ppid] {
+				members[pid] = true
+				added = true
+			}
+		}
+	}
+
+	pids := make([]int, 0, len(members))
+	for pid := range members {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	return pids
+}
+
+func (m *ptySessionManager) List() ([]SessionInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sessions := []SessionInfo{}
+	for name, session := range m.sessions {
+		sessions = append(sessions, SessionInfo{Name: name, Created: strconv.FormatInt(session.created.Unix(), 10)})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+func (m *ptySessionManager) AttachPTY(name string, create bool) (SessionPTY, error) {
+	session, err := m.session(name)
+	if err != nil {
+		if !create {
+			return nil, err
+		}
+		if err := m.Create(name, SessionOptions{}); err != nil {
+			return nil, err
+		}
+		if session, err = m.session(name); err != nil {
+			return nil, err
+		}
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+
+	// Replay the scrollback from the first complete line, the buffer may start mid-sequence
+	replay := session.scrollback.Bytes()
+	if session.scrollback.full {
+		if i := strings.IndexByte(string(replay), '\n'); i >= 0 {
+			replay = replay[i+1:]
+		}
+	}
+
+	viewer := &ptyViewer{
+		session: session,
+		pending: replay,
+		output:  make(chan []byte, ptyViewerBuffer),
+	}
+	session.viewers[viewer] = true
+	return viewer, nil
+}
+
+// ptyViewer is one terminal attached to a native session; any number can share a session
+type ptyViewer struct {
+	session *ptySession
+	pending []byte
+	output  chan []byte
+}
+
+func (v *ptyViewer) Read(b []byte) (int, error) {
+	if len(v.pending) == 0 {
+		chunk, ok := <-v.output
+		if !ok {
+			return 0, io.EOF
+		}
+		v.pending = chunk
+	}
+	n := copy(b, v.pending)
+	v.pending = v.pending[n:]
+	return n, nil
+}
+
+func (v *ptyViewer) Write(b []byte) (int, error) {
+	return v.session.ptmx.Write(b)
+}
+
+// Resize sets the session's size; with several viewers the last resize wins
+func (v *ptyViewer) Resize(cols, rows uint16) error {
+	v.session.mu.Lock()
+	defer v.session.mu.Unlock()
+
+	if err := pty.Setsize(v.session.ptmx, &pty.Winsize{Cols: cols, Rows: rows}); err != nil {
+		return err
+	}
+	v.session.screen.Resize(int(cols), int(rows))
+	return nil
+}
+
+// Close detaches the viewer, the session keeps running
+func (v *ptyViewer) Close() error {
+	v.session.mu.Lock()
+	defer v.session.mu.Unlock()
+
+	v.session.detach(v)
+	return nil
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Task import
+// -----------------
+//
+// Batches of planned work come in as a Markdown document or as an issue export from GitHub
+// or GitLab. Every imported task remembers where it came from in its external ID, so
+// importing the same document again updates those tasks instead of duplicating them.
+// A dry run returns the same report without changing anything.
+
+const (
+	importFormatMarkdown = "markdown"
+	importFormatGitHub   = "github"
+	importFormatGitLab   = "gitlab"
+)
+
+// Largest import accepted, and most tasks one import can create or update
+const (
+	maxImportSize  = 5 * 1024 * 1024
+	maxImportTasks = 1000
+)
+
+// importedTask is a task read from an import, before it is matched against the project
+type importedTask struct {
+	ExternalID  string
+	Title       string
+	Description string
+	Labels      []string
+	Closed      bool // checked off or closed at the source
+}
+
+type taskImportRequest struct {
+	Format          string `json:"format"`  // markdown, github or gitlab; detected when empty
+	Content         string `json:"content"` // the Markdown document or the JSON array of issues
+	BaseDirectoryID string `json:"base_directory_id"`
+	Status          string `json:"status"` // column of new tasks, the first one by default
+	DryRun          bool   `json:"dry_run"`
+}
+
+// TaskImportItem is what an import did, or would do, with one task
+type TaskImportItem struct {
+	ExternalID string   `json:"external_id"`
+	Title      string   `json:"title"`
+	Action     string   `json:"action"` // create, update, unchanged or skip
+	Reason     string   `json:"reason,omitempty"`
+	TaskID     *int64   `json:"task_id,omitempty"`
+	Status     string   `json:"status,omitempty"`
+	Labels     []string `json:"labels"`
+}
+
+// TaskImportResult reports an import
+type TaskImportResult struct {
+	Format    string           `json:"format"`
+	DryRun    bool             `json:"dry_run"`
+	Created   int              `json:"created"`
+	Updated   int              `json:"updated"`
+	Unchanged int              `json:"unchanged"`
+	Skipped   int              `json:"skipped"`
+	Items     []TaskImportItem `json:"items"`
+}
+
+var (
+	markdownChecklistItem = regexp.MustCompile(`^[-*+]\s+\[([ xX])\]\s+(.+)$`)
+	markdownHeading       = regexp.MustCompile(`^#{1,6}\s+(.+?)(?:\s+#+)?\s*$`)
+	markdownFence         = regexp.MustCompile("^\\s*(```|~~~)")
+	importSlugSeparators  = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// parseMarkdownTasks turns each top-level checklist item and each heading into a task. What
+// is nested under a checklist item, or follows a heading up to the next task, becomes the
+// description. Markdown has no IDs, so tasks are keyed on their title.
+func parseMarkdownTasks(content string) []importedTask {
+	var tasks []importedTask
+	var current *importedTask
+	var body []string
+	isItem, collecting, inFence := false, false, false
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		current.Description = dedentMarkdown(body)
+		tasks = append(tasks, *current)
+		current, body = nil, nil
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if !inFence {
+			if match := markdownChecklistItem.FindStringSubmatch(line); match != nil {
+				flush()
+				current = &importedTask{Title: strings.TrimSpace(match[2]), Closed: match[1] != " "}
+				isItem, collecting = true, true
+				continue
+			}
+			if match := markdownHeading.FindStringSubmatch(line); match != nil {
+				flush()
+				current = &importedTask{Title: strings.TrimSpace(match[1])}
+				isItem, collecting = false, true
+				continue
+			}
+			// Only indented lines belong to a checklist item
+			if isItem && strings.TrimSpace(line) != "" && line[0] != ' ' && line[0] != '\t' {
+				collecting = false
+			}
+		}
+		if markdownFence.MatchString(line) {
+			inFence = !inFence
+		}
+		if current != nil && collecting {
+			body = append(body, line)
+		}
+	}
+	flush()
+
+	for i := range tasks {
+		tasks[i].ExternalID = "markdown:" + strings.Trim(importSlugSeparators.ReplaceAllString(strings.ToLower(tasks[i].Title), "-"), "-")
+	}
+	return tasks
+}
+
+// dedentMarkdown strips the indentation nested lines share and surrounding blank lines
+func dedentMarkdown(lines []string) string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		width := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == -1 || width < indent {
+			indent = width
+		}
+	}
+	dedented := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= indent && indent > 0 {
+			line = line[indent:]
+		}
+		dedented[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.Trim(strings.Join(dedented, "\n"), "\n")
+}
+
+// exportedIssue holds the fields of GitHub and GitLab issue exports that imports use
+type exportedIssue struct {
+	Number      int64           `json:"number"` // GitHub
+	IID         int64           `json:"iid"`    // GitLab
+	ProjectID   int64           `json:"project_id"`
+	Title       string          `json:"title"`
+	Body        string          `json:"body"`        // GitHub
+	Description string          `json:"description"` // GitLab
+	State       string          `json:"state"`
+	Labels      json.RawMessage `json:"labels"`
+	HTMLURL     string          `json:"html_url"`
+	WebURL      string          `json:"web_url"`
+	PullRequest json.RawMessage `json:"pull_request"`
+}
+
+// parseIssueExport reads a JSON array of issues from the GitHub or GitLab API. The format
+// is detected from the issues unless given. GitHub lists pull requests as issues too; those
+// are left out.
+func parseIssueExport(content, format string) (string, []importedTask, error) {
+	var issues []exportedIssue
+	if err := json.Unmarshal([]byte(content), &issues); err != nil {
+		return format, nil, fmt.Errorf("invalid issue export: %v", err)
+	}
+	if format == "" {
+		format = importFormatGitHub
+		for _, issue := range issues {
+			if issue.IID != 0 {
+				format = importFormatGitLab
+				break
+			}
+		}
+	}
+
+	var tasks []importedTask
+	for _, issue := range issues {
+		task := importedTask{Title: strings.TrimSpace(issue.Title), Closed: issue.State == "closed"}
+		switch format {
+		case importFormatGitHub:
+			if len(issue.PullRequest) > 0 && string(issue.PullRequest) != "null" {
+				continue
+			}
+			task.ExternalID = fmt.Sprintf("github:%s#%d", issueRepository(issue.HTMLURL, "/issues/"), issue.Number)
+			task.Description = issue.Body
+		case importFormatGitLab:
+			repository := issueRepository(issue.WebURL, "/-/issues/")
+			if repository == "" && issue.ProjectID != 0 {
+				repository = fmt.Sprint(issue.ProjectID)
+			}
+			task.ExternalID = fmt.Sprintf("gitlab:%s#%d", repository, issue.IID)
+			task.Description = issue.Description
+		}
+		task.Description = strings.TrimSpace(task.Description)
+		task.Labels = issueLabels(issue.Labels)
+		tasks = append(tasks, task)
+	}
+	return format, tasks, nil
+}
+
+// issueRepository returns the owner/repo part of an issue URL
+func issueRepository(issueURL, marker string) string {
+	parsed, err := url.Parse(issueURL)
+	if err != nil {
+		return ""
+	}
+	repository, _, found := strings.Cut(parsed.Path, marker)
+	if !found {
+		return ""
+	}
+	return strings.Trim(repository, "/")
+}
+
+// issueLabels reads GitHub's label objects and GitLab's label names
+func issueLabels(raw json.RawMessage) []string {
+	var names []string
+	if json.Unmarshal(raw, &names) == nil {
+		return names
+	}
+	var objects []struct {
+		Name string `json:"name"`
+	}
+	json.Unmarshal(raw, &objects)
+	for _, object := range objects {
+		names = append(names, object.Name)
+	}
+	return names
+}
+
+// handleProjectTaskImportAPI handles POST /api/projects/{id}/tasks/import
+func handleProjectTaskImportAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, projectID int64) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if _, err := queries.GetProject(ctx, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	var importReq taskImportRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&importReq); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Read the tasks
+	var imported []importedTask
+	content := strings.TrimSpace(importReq.Content)
+	switch importReq.Format {
+	case "":
+		if strings.HasPrefix(content, "[") {
+			format, tasks, err := parseIssueExport(content, "")
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			importReq.Format, imported = format, tasks
+		} else {
+			importReq.Format, imported = importFormatMarkdown, parseMarkdownTasks(content)
+		}
+	case importFormatMarkdown:
+		imported = parseMarkdownTasks(content)
+	case importFormatGitHub, importFormatGitLab:
+		_, tasks, err := parseIssueExport(content, importReq.Format)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		imported = tasks
+	default:
+		http.Error(w, "Invalid format, expected markdown, github or gitlab", http.StatusBadRequest)
+		return
+	}
+	if len(imported) == 0 {
+		http.Error(w, "No tasks found to import", http.StatusBadRequest)
+		return
+	}
+	if len(imported) > maxImportTasks {
+		http.Error(w, fmt.Sprintf("An import can hold at most %d tasks", maxImportTasks), http.StatusBadRequest)
+		return
+	}
+
+	// New tasks go to the given base directory, or the project's first one
+	baseDirs, err := queries.GetBaseDirectoriesByProjectID(ctx, projectID)
+	if err != nil || len(baseDirs) == 0 {
+		http.Error(w, "The project has no base directory to import tasks into", http.StatusBadRequest)
+		return
+	}
+	if importReq.BaseDirectoryID == "" {
+		importReq.BaseDirectoryID = baseDirs[0].BaseDirectoryID
+	}
+	if _, err := queries.GetBaseDirectoryByProjectAndID(ctx, db.GetBaseDirectoryByProjectAndIDParams{
+		ProjectID:       projectID,
+		BaseDirectoryID: importReq.BaseDirectoryID,
+	}); err != nil {
+		http.Error(w, "Base directory not found", http.StatusBadRequest)
+		return
+	}
+
+	workflow, err := loadWorkflow(ctx, projectID)
+	if err != nil {
+		log.Printf("Failed to load workflow of project %d: %v", projectID, err)
+		http.Error(w, "Failed to import tasks", http.StatusInternalServerError)
+		return
+	}
+	if importReq.Status == "" {
+		importReq.Status = workflow.Columns[0].Key
+	}
+	if _, ok := workflow.column(importReq.Status); !ok {
+		http.Error(w, fmt.Sprintf("Unknown status %q for this project", importReq.Status), http.StatusBadRequest)
+		return
+	}
+	// Work already finished at the source lands in the last column
+	closedStatus := workflow.Columns[len(workflow.Columns)-1].Key
+
+	// Plan every task before changing anything, so a dry run reports exactly what would happen
+	result := TaskImportResult{Format: importReq.Format, DryRun: importReq.DryRun, Items: []TaskImportItem{}}
+	existing := make([]db.Task, len(imported))
+	seen := make(map[string]bool)
+	creating := make(map[string]int64)
+	for i, task := range imported {
+		item := TaskImportItem{ExternalID: task.ExternalID, Title: task.Title, Labels: []string{}}
+		labels, labelErr := normalizeTaskLabels(task.Labels)
+		switch {
+		case task.Title == "":
+			item.Action, item.Reason = "skip", "missing title"
+		case seen[task.ExternalID]:
+			item.Action, item.Reason = "skip", "duplicate of an earlier task in this import"
+		case labelErr != nil:
+			item.Action, item.Reason = "skip", labelErr.Error()
+		}
+		seen[task.ExternalID] = true
+		if item.Action == "" {
+			imported[i].Labels = labels
+			item.Labels = labels
+			current, err := queries.GetTaskByExternalID(ctx, db.GetTaskByExternalIDParams{ProjectID: projectID, ExternalID: task.ExternalID})
+			if err == nil {
+				existing[i] = current
+				item.TaskID = &current.ID
+				item.Status = current.Status
+				item.Action = "unchanged"
+				if current.Title != task.Title || current.Description != task.Description ||
+					strings.Join(loadTaskLabels(ctx, current.ID), ",") != strings.Join(labels, ",") {
+					item.Action = "update"
+				}
+			} else {
+				item.Action = "create"
+				item.Status = importReq.Status
+				if task.Closed {
+					item.Status = closedStatus
+				}
+				creating[item.Status]++
+			}
+		}
+
+		switch item.Action {
+		case "create":
+			result.Created++
+		case "update":
+			result.Updated++
+		case "unchanged":
+			result.Unchanged++
+		case "skip":
+			result.Skipped++
+		}
+		result.Items = append(result.Items, item)
+	}
+
+	// An import may not overfill a column
+	for status, count := range creating {
+		column, _ := workflow.column(status)
+		if column.WIPLimit == 0 {
+			continue
+		}
+		inColumn, err := queries.CountTasksByProjectAndStatus(ctx, db.CountTasksByProjectAndStatusParams{ProjectID: projectID, Status: status})
+		if err == nil && inColumn+count > column.WIPLimit {
+			http.Error(w, fmt.Sprintf("Importing %d tasks into %s would exceed its WIP limit of %d", count, column.Name, column.WIPLimit), http.StatusConflict)
+			return
+		}
+	}
+
+	if !importReq.DryRun {
+		for i := range result.Items {
+			item := &result.Items[i]
+			if err := applyTaskImport(ctx, projectID, importReq.BaseDirectoryID, imported[i], existing[i], item); err != nil {
+				log.Printf("Failed to import task %s into project %d: %v", item.ExternalID, projectID, err)
+				http.Error(w, fmt.Sprintf("Failed to import %q", item.Title), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// applyTaskImport carries out the planned action for one imported task
+func applyTaskImport(ctx context.Context, projectID int64, baseDirectoryID string, task importedTask, current db.Task, item *TaskImportItem) error {
+	labels := taskMetadataRequest{Labels: &item.Labels}
+	switch item.Action {
+	case "update":
+		updated, err := queries.UpdateTask(ctx, db.UpdateTaskParams{
+			ID:          current.ID,
+			Title:       task.Title,
+			Description: task.Description,
+			Status:      current.Status,
+		})
+		if err != nil {
+			return err
+		}
+		metadata, err := labels.resolve(ctx, updated)
+		if err != nil {
+			return err
+		}
+		_, err = saveTaskMetadata(ctx, updated.ID, metadata)
+		return err
+
+	case "create":
+		created, err := queries.CreateTask(ctx, db.CreateTaskParams{
+			ProjectID:       projectID,
+			BaseDirectoryID: baseDirectoryID,
+			Title:           task.Title,
+			Description:     task.Description,
+			Status:          item.Status,
+		})
+		if err != nil {
+			return err
+		}
+		if created, err = queries.SetTaskExternalID(ctx, db.SetTaskExternalIDParams{ExternalID: task.ExternalID, ID: created.ID}); err != nil {
+			return err
+		}
+		metadata, err := labels.resolve(ctx, created)
+		if err != nil {
+			return err
+		}
+		if created, err = saveTaskMetadata(ctx, created.ID, metadata); err != nil {
+			return err
+		}
+		if _, err := moveTask(ctx, created, created.Status, -1); err != nil {
+			return err
+		}
+		item.TaskID = &created.ID
+	}
+	return nil
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Task metadata
+// -----------------
+//
+// Besides their board status, tasks carry planning metadata: free-form labels, a priority,
+// an optional preferred agent (used when an execution is started without naming one) and
+// a due date. GET /api/tasks filters and sorts across projects on all of it.
+
+// Priorities by stored value
+var taskPriorities = []string{"none", "low", "medium", "high", "urgent"}
+
+const (
+	maxTaskLabels      = 20
+	maxTaskLabelLength = 50
+	defaultTaskLimit   = 50
+	maxTaskLimit       = 500
+	dueDateLayout      = "2006-01-02"
+)
+
+func taskPriorityName(priority int64) string {
+	if priority < 0 || priority >= int64(len(taskPriorities)) {
+		return taskPriorities[0]
+	}
+	return taskPriorities[priority]
+}
+
+// parseTaskPriority accepts a priority name or its number
+func parseTaskPriority(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for i, name := range taskPriorities {
+		if value == name || value == strconv.Itoa(i) {
+			return int64(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid priority %q, expected one of %s", value, strings.Join(taskPriorities, ", "))
+}
+
+// normalizeTaskLabels lowercases, trims, deduplicates and sorts labels
+func normalizeTaskLabels(labels []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, label := range labels {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" || seen[label] {
+			continue
+		}
+		if len(label) > maxTaskLabelLength || strings.Contains(label, ",") {
+			return nil, fmt.Errorf("invalid label %q, labels are at most %d characters without commas", label, maxTaskLabelLength)
+		}
+		seen[label] = true
+		normalized = append(normalized, label)
+	}
+	if len(normalized) > maxTaskLabels {
+		return nil, fmt.Errorf("a task can have at most %d labels", maxTaskLabels)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+// taskMetadataRequest is the metadata part of task create and update requests. Fields left
+// out keep their current value; a preferred_agent_id of 0 and an empty due_date clear them.
+type taskMetadataRequest struct {
+	Labels           *[]string `json:"labels"`
+	Priority         *string   `json:"priority"`
+	PreferredAgentID *int64    `json:"preferred_agent_id"`
+	DueDate          *string   `json:"due_date"`
+}
+
+type taskMetadata struct {
+	params    db.UpdateTaskMetadataParams
+	labels    []string
+	setLabels bool
+}
+
+// resolve validates the request against the task's current metadata, before anything is written
+func (req taskMetadataRequest) resolve(ctx context.Context, task db.Task) (taskMetadata, error) {
+	metadata := taskMetadata{params: db.UpdateTaskMetadataParams{
+		ID:               task.ID,
+		Priority:         task.Priority,
+		PreferredAgentID: task.PreferredAgentID,
+		DueDate:          task.DueDate,
+	}}
+
+	if req.Priority != nil {
+		priority, err := parseTaskPriority(*req.Priority)
+		if err != nil {
+			return metadata, err
+		}
+		metadata.params.Priority = priority
+	}
+	if req.PreferredAgentID != nil {
+		if *req.PreferredAgentID == 0 {
+			metadata.params.PreferredAgentID = sql.NullInt64{}
+		} else {
+			if _, err := queries.GetAgent(ctx, *req.PreferredAgentID); err != nil {
+				return metadata, fmt.Errorf("preferred agent %d not found", *req.PreferredAgentID)
+			}
+			metadata.params.PreferredAgentID = sql.NullInt64{Int64: *req.PreferredAgentID, Valid: true}
+		}
+	}
+	if req.DueDate != nil {
+		dueDate := strings.TrimSpace(*req.DueDate)
+		if dueDate != "" {
+			if _, err := time.Parse(dueDateLayout, dueDate); err != nil {
+				return metadata, fmt.Errorf("invalid due date %q, expected YYYY-MM-DD", dueDate)
+			}
+		}
+		metadata.params.DueDate = dueDate
+	}
+	if req.Labels != nil {
+		labels, err := normalizeTaskLabels(*req.Labels)
+		if err != nil {
+			return metadata, err
+		}
+		metadata.labels = labels
+		metadata.setLabels = true
+	}
+	return metadata, nil
+}
+
+// saveTaskMetadata writes resolved metadata to a task
+func saveTaskMetadata(ctx context.Context, taskID int64, metadata taskMetadata) (db.Task, error) {
+	metadata.params.ID = taskID
+	task, err := queries.UpdateTaskMetadata(ctx, metadata.params)
+	if err != nil {
+		return task, err
+	}
+	if metadata.setLabels {
+		if err := queries.DeleteTaskLabels(ctx, taskID); err != nil {
+			return task, err
+		}
+		for _, label := range metadata.labels {
+			if err := queries.AddTaskLabel(ctx, db.AddTaskLabelParams{TaskID: taskID, Label: label}); err != nil {
+				return task, err
+			}
+		}
+	}
+	return task, nil
+}
+
+func loadTaskLabels(ctx context.Context, taskID int64) []string {
+	labels, err := queries.GetTaskLabels(ctx, taskID)
+	if err != nil {
+		log.Printf("Failed to get labels of task %d: %v", taskID, err)
+	}
+	return labels
+}
+
+// taskLabelsByProject returns the labels of every task of a project, by task ID
+func taskLabelsByProject(ctx context.Context, projectID int64) map[int64][]string {
+	labels := make(map[int64][]string)
+	rows, err := queries.GetTaskLabelsByProjectID(ctx, projectID)
+	if err != nil {
+		log.Printf("Failed to get task labels of project %d: %v", projectID, err)
+		return labels
+	}
+	for _, row := range rows {
+		labels[row.TaskID] = append(labels[row.TaskID], row.Label)
+	}
+	return labels
+}
+
+// Sort keys of GET /api/tasks and whether they sort descending by default
+var taskSortKeys = map[string]bool{
+	"position":   false,
+	"priority":   true,
+	"due_date":   false,
+	"title":      false,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// handleTaskSearch handles GET /api/tasks. Filters: root_id, project_id, status, base_directory_id,
+// label (repeatable or comma separated, a task must carry all), priority (minimum),
+// preferred_agent_id, due_before, due_after and q (text in title or description).
+// Sorting: sort and order; paging: limit and offset, with the total in X-Total-Count.
+func handleTaskSearch(w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	query := r.URL.Query()
+	var params db.SearchTasksParams
+
+	if value := query.Get("project_id"); value != "" {
+		projectID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid project ID", http.StatusBadRequest)
+			return
+		}
+		params.ProjectID = projectID
+	}
+	// A project already names its root; otherwise the search stays in the selected root
+	if query.Get("root_id") != "" || params.ProjectID == nil {
+		rootID, ok := requestRootID(w, r, ctx)
+		if !ok {
+			return
+		}
+		params.RootID = rootID
+	}
+	if value := query.Get("status"); value != "" {
+		params.Status = value
+	}
+	if value := query.Get("base_directory_id"); value != "" {
+		params.BaseDirectoryID = value
+	}
+	if value := query.Get("priority"); value != "" {
+		priority, err := parseTaskPriority(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.MinPriority = priority
+	}
+	if value := query.Get("preferred_agent_id"); value != "" {
+		agentID, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid preferred agent ID", http.StatusBadRequest)
+			return
+		}
+		params.PreferredAgentID = agentID
+	}
+	for _, name := range []string{"due_before", "due_after"} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(dueDateLayout, value); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid %s, expected YYYY-MM-DD", name), http.StatusBadRequest)
+			return
+		}
+		if name == "due_before" {
+			params.DueBefore = value
+		} else {
+			params.DueAfter = value
+		}
+	}
+	if value := strings.TrimSpace(query.Get("q")); value != "" {
+		params.Text = value
+	}
+
+	var wantedLabels []string
+	for _, value := range query["label"] {
+		wantedLabels = append(wantedLabels, strings.Split(value, ",")...)
+	}
+	wantedLabels, err := normalizeTaskLabels(wantedLabels)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sortKey := query.Get("sort")
+	if sortKey == "" {
+		sortKey = "position"
+	}
+	descending, ok := taskSortKeys[sortKey]
+	if !ok {
+		http.Error(w, "Invalid sort, expected position, priority, due_date, title, created_at or updated_at", http.StatusBadRequest)
+		return
+	}
+	switch query.Get("order") {
+	case "":
+	case "asc":
+		descending = false
+	case "desc":
+		descending = true
+	default:
+		http.Error(w, "Invalid order, expected asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	limit, offset := defaultTaskLimit, 0
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxTaskLimit {
+			http.Error(w, fmt.Sprintf("Invalid limit, expected 1 to %d", maxTaskLimit), http.StatusBadRequest)
+			return
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	dbTasks, err := queries.SearchTasks(ctx, params)
+	if err != nil {
+		log.Printf("Failed to search tasks: %v", err)
+		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
+		return
+	}
+	labelRows, err := queries.GetAllTaskLabels(ctx)
+	if err != nil {
+		log.Printf("Failed to get task labels: %v", err)
+		http.Error(w, "Failed to get tasks", http.StatusInternalServerError)
+		return
+	}
+	labels := make(map[int64][]string)
+	for _, row := range labelRows {
+		labels[row.TaskID] = append(labels[row.TaskID], row.Label)
+	}
+
+	matching := dbTasks[:0]
+	for _, task := range dbTasks {
+		if hasAllLabels(labels[task.ID], wantedLabels) {
+			matching = append(matching, task)
+		}
+	}
+	sortTasks(matching, sortKey, descending)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(matching)))
+	if offset > len(matching) {
+		offset = len(matching)
+	}
+	page := matching[offset:]
+	if len(page) > limit {
+		page = page[:limit]
+	}
+
+	// Base directories are looked up once per project
+	baseDirs := make(map[int64]map[string]BaseDirectory)
+	tasks := make([]Task, 0, len(page))
+	for _, dbTask := range page {
+		dirs, loaded := baseDirs[dbTask.ProjectID]
+		if !loaded {
+			dirs = make(map[string]BaseDirectory)
+			if dbDirs, err := queries.GetBaseDirectoriesByProjectID(ctx, dbTask.ProjectID); err == nil {
+				for _, dir := range dbDirs {
+					dirs[dir.BaseDirectoryID] = dbBaseDirectoryToBaseDirectory(dir)
+				}
+			}
+			baseDirs[dbTask.ProjectID] = dirs
+		}
+		baseDir, exists := dirs[dbTask.BaseDirectoryID]
+		if !exists {
+			baseDir = BaseDirectory{BaseDirectoryId: dbTask.BaseDirectoryID}
+		}
+		tasks = append(tasks, dbTaskToTask(dbTask, baseDir, labels[dbTask.ID]))
+	}
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func hasAllLabels(labels, wanted []string) bool {
+	for _, label := range wanted {
+		found := false
+		for _, have := range labels {
+			if have == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// sortTasks orders tasks by a sort key; ties and tasks without a due date come last, by ID
+func sortTasks(tasks []db.Task, key string, descending bool) {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		a, b := tasks[i], tasks[j]
+		var cmp int
+		switch key {
+		case "priority":
+			cmp = compareInt64(a.Priority, b.Priority)
+		case "due_date":
+			if (a.DueDate == "") != (b.DueDate == "") {
+				return b.DueDate == ""
+			}
+			cmp = strings.Compare(a.DueDate, b.DueDate)
+		case "title":
+			cmp = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		case "created_at":
+			cmp = a.CreatedAt.Time.Compare(b.CreatedAt.Time)
+		case "updated_at":
+			cmp = a.UpdatedAt.Time.Compare(b.UpdatedAt.Time)
+		default:
+			// Board position: project, then column, then place in the column
+			if cmp = compareInt64(a.ProjectID, b.ProjectID); cmp == 0 {
+				if cmp = strings.Compare(a.Status, b.Status); cmp == 0 {
+					cmp = compareInt64(a.SortOrder, b.SortOrder)
+				}
+			}
+		}
+		if cmp == 0 {
+			return a.ID < b.ID
+		}
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// taskResponse converts a task for API responses, with its base directory and labels
+func taskResponse(ctx context.Context, dbTask db.Task) Task {
+	baseDir := BaseDirectory{BaseDirectoryId: dbTask.BaseDirectoryID}
+	if dbBaseDir, err := queries.GetBaseDirectoryByProjectAndID(ctx, db.GetBaseDirectoryByProjectAndIDParams{
+		ProjectID:       dbTask.ProjectID,
+		BaseDirectoryID: dbTask.BaseDirectoryID,
+	}); err == nil {
+		baseDir = dbBaseDirectoryToBaseDirectory(dbBaseDir)
+	}
+	return dbTaskToTask(dbTask, baseDir, loadTaskLabels(ctx, dbTask.ID))
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// -----------------
+// Terminal screen emulation
+// -----------------
+//
+// The native PTY backend has no tmux server to ask for pane contents, so it feeds the
+// session output through this small VT100/xterm emulator. It understands the cursor
+// movement, erase, scroll region, alternate screen and SGR sequences agents use, which
+// is enough to capture the pane and its cursor the way tmux capture-pane would.
+
+// Lines kept above the visible screen, same as tmux's default history-limit
+const terminalHistoryLimit = 2000
+
+const (
+	attrBold = 1 << iota
+	attrDim
+	attrItalic
+	attrUnderline
+	attrBlink
+	attrReverse
+	attrHidden
+	attrStrike
+)
+
+// SGR code for each attribute flag, in flag order
+var attrCodes = []int{1, 2, 3, 4, 5, 7, 8, 9}
+
+type cellAttrs struct {
+	flags uint8
+	fg    string // SGR color parameters, e.g. "31" or "38;5;208"
+	bg    string
+}
+
+// sgr returns the escape sequence that switches a terminal from any state to these attributes
+func (a cellAttrs) sgr() string {
+	params := []string{"0"}
+	for i, code := range attrCodes {
+		if a.flags&(1<<i) != 0 {
+			params = append(params, strconv.Itoa(code))
+		}
+	}
+	if a.fg != "" {
+		params = append(params, a.fg)
+	}
+	if a.bg != "" {
+		params = append(params, a.bg)
+	}
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+type screenCell struct {
+	ch    rune // 0 for a cell that was never written
+	attrs cellAttrs
+}
+
+type screenLine []screenCell
+
+// Parser states
+const (
+	stateGround = iota
+	stateEscape
+	stateCharset
+	stateCSI
+	stateString // OSC, DCS, APC, PM and SOS, all ignored
+	stateStringEscape
+)
+
+type terminalScreen struct {
+	cols, rows int
+	lines      []screenLine
+	history    []screenLine
+
+	x, y        int
+	wrapPending bool
+	attrs       cellAttrs
+
+	savedX, savedY int
+	savedAttrs     cellAttrs
+
+	scrollTop, scrollBottom int
+
+	// Main screen while the alternate screen is active
+	mainLines []screenLine
+	mainX     int
+	mainY     int
+
+	state   int
+	params  []byte
+	partial []byte // incomplete UTF-8 sequence from the previous write
+}
+
+func newTerminalScreen(cols, rows int) *terminalScreen {
+	s := &terminalScreen{cols: cols, rows: rows}
+	s.lines = s.blankLines(rows)
+	s.scrollBottom = rows - 1
+	return s
+}
+
+func (s *terminalScreen) blankLines(n int) []screenLine {
+	lines := make([]screenLine, n)
+	for i := range lines {
+		lines[i] = make(screenLine, s.cols)
+	}
+	return lines
+}
+
+// Write feeds terminal output to the screen
+func (s *terminalScreen) Write(p []byte) (int, error) {
+	data := p
+	if len(s.partial) > 0 {
+		data = append(s.partial, p...)
+		s.partial = nil
+	}
+
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 && !utf8.FullRune(data) {
+			s.partial = append([]byte{}, data...)
+			break
+		}
+		s.process(r)
+		data = data[size:]
+	}
+	return len(p), nil
+}
+
+func (s *terminalScreen) process(r rune) {
+	switch s.state {
+	case stateGround:
+		s.ground(r)
+
+	case stateEscape:
+		s.escape(r)
+
+	case stateCharset:
+		// Character set designations are ignored
+		s.state = stateGround
+
+	case stateCSI:
+		switch {
+		case r >= 0x30 && r <= 0x3f:
+			s.params = append(s.params, byte(r))
+		case r >= 0x20 && r <= 0x2f:
+			// Intermediate bytes are ignored
+		case r >= 0x40 && r <= 0x7e:
+			s.csi(r)
+			s.state = stateGround
+		default:
+			s.state = stateGround
+		}
+
+	case stateString:
+		if r == 0x07 {
+			s.state = stateGround
+		} else if r == 0x1b {
+			s.state = stateStringEscape
+		}
+
+	case stateStringEscape:
+		s.state = stateGround
+	}
+}
+
+func (s *terminalScreen) ground(r rune) {
+	switch r {
+	case 0x1b:
+		s.state = stateEscape
+	case '\r':
+		s.x = 0
+		s.wrapPending = false
+	case '\n', 0x0b, 0x0c:
+		s.lineFeed()
+	case '\b':
+		if s.x > 0 {
+			s.x--
+		}
+		s.wrapPending = false
+	case '\t':
+		s.x = min(s.cols-1, (s.x/8+1)*8)
+	default:
+		if r < 0x20 || r == 0x7f {
+			return
+		}
+		s.put(r)
+	}
+}
+
+func (s *terminalScreen) escape(r rune) {
+	s.state = stateGround
+	switch r {
+	case '[':
+		s.params = s.params[:0]
+		s.state = stateCSI
+	case ']', 'P', '_', '^', 'X':
+		s.state = stateString
+	case '(', ')', '*', '+':
+		s.state = stateCharset
+	case '7':
+		s.saveCursor()
+	case '8':
+		s.restoreCursor()
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.x = 0
+		s.lineFeed()
+	case 'M':
+		if s.y == s.scrollTop {
+			s.scrollDown(1)
+		} else if s.y > 0 {
+			s.y--
+		}
+		s.wrapPending = false
+	case 'c':
+		*s = *newTerminalScreen(s.cols, s.rows)
+	}
+}
+
+func (s *terminalScreen) put(r rune) {
+	if s.wrapPending {
+		s.x = 0
+		s.lineFeed()
+	}
+	s.lines[s.y][s.x] = screenCell{ch: r, attrs: s.attrs}
+	if s.x == s.cols-1 {
+		s.wrapPending = true
+	} else {
+		s.x++
+	}
+}
+
+func (s *terminalScreen) lineFeed() {
+	s.wrapPending = false
+	if s.y == s.scrollBottom {
+		s.scrollUp(1)
+	} else if s.y < s.rows-1 {
+		s.y++
+	}
+}
+
+// scrollUp moves the scroll region up; lines leaving the top of the main screen go to history
+func (s *terminalScreen) scrollUp(n int) {
+	s.shiftUp(s.scrollTop, n, s.scrollTop == 0 && s.mainLines == nil)
+}
+
+func (s *terminalScreen) scrollDown(n int) {
+	s.shiftDown(s.scrollTop, n)
+}
+
+// shiftUp moves the lines from top to the bottom of the scroll region up by n
+func (s *terminalScreen) shiftUp(top, n int, keepHistory bool) {
+	for i := 0; i < n; i++ {
+		if keepHistory {
+			s.history = append(s.history, s.lines[top])
+			if len(s.history) > terminalHistoryLimit {
+				s.history = s.history[len(s.history)-terminalHistoryLimit:]
+			}
+		}
+		copy(s.lines[top:s.scrollBottom], s.lines[top+1:s.scrollBottom+1])
+		s.lines[s.scrollBottom] = make(screenLine, s.cols)
+	}
+}
+
+// shiftDown moves the lines from top to the bottom of the scroll region down by n
+func (s *terminalScreen) shiftDown(top, n int) {
+	for i := 0; i < n; i++ {
+		copy(s.lines[top+1:s.scrollBottom+1], s.lines[top:s.scrollBottom])
+		s.lines[top] = make(screenLine, s.cols)
+	}
+}
+
+func (s *terminalScreen) saveCursor() {
+	s.savedX, s.savedY, s.savedAttrs = s.x, s.y, s.attrs
+}
+
+func (s *terminalScreen) restoreCursor() {
+	s.x, s.y, s.attrs = s.savedX, s.savedY, s.savedAttrs
+	s.wrapPending = false
+}
+
+func (s *terminalScreen) moveTo(x, y int) {
+	s.x = max(0, min(s.cols-1, x))
+	s.y = max(0, min(s.rows-1, y))
+	s.wrapPending = false
+}
+
+func (s *terminalScreen) eraseCells(y, from, to int) {
+	line := s.lines[y]
+	for x := max(0, from); x < min(s.cols, to); x++ {
+		line[x] = screenCell{}
+	}
+}
+
+func (s *terminalScreen) csi(final rune) {
+	private := len(s.params) > 0 && (s.params[0] == '?' || s.params[0] == '>' || s.params[0] == '=' || s.params[0] == '<')
+	raw := string(s.params)
+	if private {
+		raw = raw[1:]
+	}
+
+	var args []int
+	if raw != "" {
+		for _, field := range strings.Split(strings.ReplaceAll(raw, ":", ";"), ";") {
+			n, _ := strconv.Atoi(field)
+			args = append(args, n)
+		}
+	}
+	arg := func(i, def int) int {
+		if i < len(args) && args[i] > 0 {
+			return args[i]
+		}
+		return def
+	}
+
+	if private {
+		if final == 'h' || final == 'l' {
+			for _, mode := range args {
+				if mode == 47 || mode == 1047 || mode == 1049 {
+					s.alternateScreen(final == 'h')
+				}
+			}
+		}
+		return
+	}
+
+	switch final {
+	case 'A':
+		s.moveTo(s.x, s.y-arg(0, 1))
+	case 'B', 'e':
+		s.moveTo(s.x, s.y+arg(0, 1))
+	case 'C', 'a':
+		s.moveTo(s.x+arg(0, 1), s.y)
+	case 'D':
+		s.moveTo(s.x-arg(0, 1), s.y)
+	case 'E':
+		s.moveTo(0, s.y+arg(0, 1))
+	case 'F':
+		s.moveTo(0, s.y-arg(0, 1))
+	case 'G', '`':
+		s.moveTo(arg(0, 1)-1, s.y)
+	case 'd':
+		s.moveTo(s.x, arg(0, 1)-1)
+	case 'H', 'f':
+		s.moveTo(arg(1, 1)-1, arg(0, 1)-1)
+	case 'J':
+		switch arg(0, 0) {
+		case 0:
+			s.eraseCells(s.y, s.x, s.cols)
+			for y := s.y + 1; y < s.rows; y++ {
+				s.eraseCells(y, 0, s.cols)
+			}
+		case 1:
+			s.eraseCells(s.y, 0, s.x+1)
+			for y := 0; y < s.y; y++ {
+				s.eraseCells(y, 0, s.cols)
+			}
+		case 2, 3:
+			for y := 0; y < s.rows; y++ {
+				s.eraseCells(y, 0, s.cols)
+			}
+			if arg(0, 0) == 3 {
+				s.history = nil
+			}
+		}
+	case 'K':
+		switch arg(0, 0) {
+		case 0:
+			s.eraseCells(s.y, s.x, s.cols)
+		case 1:
+			s.eraseCells(s.y, 0, s.x+1)
+		case 2:
+			s.eraseCells(s.y, 0, s.cols)
+		}
+	case 'X':
+		s.eraseCells(s.y, s.x, s.x+arg(0, 1))
+	case '@':
+		line := s.lines[s.y]
+		n := min(arg(0, 1), s.cols-s.x)
+		copy(line[s.x+n:], line[s.x:])
+		s.eraseCells(s.y, s.x, s.x+n)
+	case 'P':
+		line := s.lines[s.y]
+		n := min(arg(0, 1), s.cols-s.x)
+		copy(line[s.x:], line[s.x+n:])
+		s.eraseCells(s.y, s.cols-n, s.cols)
+	case 'L', 'M':
+		if s.y < s.scrollTop || s.y > s.scrollBottom {
+			return
+		}
+		if final == 'L' {
+			s.shiftDown(s.y, arg(0, 1))
+		} else {
+			s.shiftUp(s.y, arg(0, 1), false)
+		}
+		s.x = 0
+		s.wrapPending = false
+	case 'S':
+		s.scrollUp(arg(0, 1))
+	case 'T':
+		s.scrollDown(arg(0, 1))
+	case 'r':
+		top, bottom := arg(0, 1)-1, arg(1, s.rows)-1
+		if top < bottom && bottom < s.rows {
+			s.scrollTop, s.scrollBottom = top, bottom
+			s.moveTo(0, 0)
+		}
+	case 's':
+		s.saveCursor()
+	case 'u':
+		s.restoreCursor()
+	case 'm':
+		s.setAttributes(args)
+	}
+}
+
+func (s *terminalScreen) setAttributes(args []int) {
+	if len(args) == 0 {
+		s.attrs = cellAttrs{}
+		return
+	}
+
+	for i := 0; i < len(args); i++ {
+		code := args[i]
+		switch {
+		case code == 0:
+			s.attrs = cellAttrs{}
+		case code == 1:
+			s.attrs.flags |= attrBold
+		case code == 2:
+			s.attrs.flags |= attrDim
+		case code == 3:
+			s.attrs.flags |= attrItalic
+		case code == 4:
+			s.attrs.flags |= attrUnderline
+		case code == 5:
+			s.attrs.flags |= attrBlink
+		case code == 7:
+			s.attrs.flags |= attrReverse
+		case code == 8:
+			s.attrs.flags |= attrHidden
+		case code == 9:
+			s.attrs.flags |= attrStrike
+		case code == 21 || code == 22:
+			s.attrs.flags &^= attrBold | attrDim
+		case code == 23:
+			s.attrs.flags &^= attrItalic
+		case code == 24:
+			s.attrs.flags &^= attrUnderline
+		case code == 25:
+			s.attrs.flags &^= attrBlink
+		case code == 27:
+			s.attrs.flags &^= attrReverse
+		case code == 28:
+			s.attrs.flags &^= attrHidden
+		case code == 29:
+			s.attrs.flags &^= attrStrike
+		case code >= 30 && code <= 37, code >= 90 && code <= 97:
+			s.attrs.fg = strconv.Itoa(code)
+		case code == 39:
+			s.attrs.fg = ""
+		case code >= 40 && code <= 47, code >= 100 && code <= 107:
+			s.attrs.bg = strconv.Itoa(code)
+		case code == 49:
+			s.attrs.bg = ""
+		case code == 38 || code == 48:
+			// Extended colors: 38;5;n or 38;2;r;g;b
+			color := ""
+			if i+2 < len(args) && args[i+1] == 5 {
+				color = fmt.Sprintf("%d;5;%d", code, args[i+2])
+				i += 2
+			} else if i+4 < len(args) && args[i+1] == 2 {
+				color = fmt.Sprintf("%d;2;%d;%d;%d", code, args[i+2], args[i+3], args[i+4])
+				i += 4
+			} else {
+				return
+			}
+			if code == 38 {
+				s.attrs.fg = color
+			} else {
+				s.attrs.bg = color
+			}
+		}
+	}
+}
+
+func (s *terminalScreen) alternateScreen(enable bool) {
+	if enable == (s.mainLines != nil) {
+		return
+	}
+	if enable {
+		s.mainLines, s.mainX, s.mainY = s.lines, s.x, s.y
+		s.lines = s.blankLines(s.rows)
+	} else {
+		s.lines, s.x, s.y = s.mainLines, s.mainX, s.mainY
+		s.mainLines = nil
+	}
+	s.wrapPending = false
+}
+
+// Resize changes the screen size; lines pushed off the top go to history, nothing is reflowed
+func (s *terminalScreen) Resize(cols, rows int) {
+	if cols <= 0 || rows <= 0 {
+		return
+	}
+
+	resizeLines := func(lines []screenLine) []screenLine {
+		for i, line := range lines {
+			resized := make(screenLine, cols)
+			copy(resized, line)
+			lines[i] = resized
+		}
+		return lines
+	}
+
+	// Keep the cursor line on screen when shrinking
+	if rows < s.rows && s.y >= rows {
+		drop := s.y - rows + 1
+		if s.mainLines == nil {
+			s.history = append(s.history, s.lines[:drop]...)
+		}
+		s.lines = s.lines[drop:]
+		s.y -= drop
+	}
+	if len(s.lines) > rows {
+		s.lines = s.lines[:rows]
+	}
+
+	s.cols = cols
+	s.lines = resizeLines(s.lines)
+	for len(s.lines) < rows {
+		s.lines = append(s.lines, make(screenLine, cols))
+	}
+	if s.mainLines != nil {
+		s.mainLines = resizeLines(s.mainLines)
+		for len(s.mainLines) < rows {
+			s.mainLines = append(s.mainLines, make(screenLine, cols))
+		}
+		s.mainLines = s.mainLines[:rows]
+	}
+
+	s.rows = rows
+	s.scrollTop, s.scrollBottom = 0, rows-1
+	s.moveTo(s.x, s.y)
+}
+
+// Capture renders the visible screen plus up to history lines of scrollback like tmux capture-pane
+func (s *terminalScreen) Capture(escapes bool, history int) string {
+	lines := s.lines
+	if history > 0 {
+		start := max(0, len(s.history)-history)
+		lines = append(append([]screenLine{}, s.history[start:]...), s.lines...)
+	}
+
+	var out strings.Builder
+	for _, line := range lines {
+		// Trailing blank cells are dropped
+		end := len(line)
+		for end > 0 && (line[end-1].ch == 0 || line[end-1].ch == ' ') && line[end-1].attrs == (cellAttrs{}) {
+			end--
+		}
+
+		current := cellAttrs{}
+		for _, cell := range line[:end] {
+			if escapes && cell.attrs != current {
+				out.WriteString(cell.attrs.sgr())
+				current = cell.attrs
+			}
+			if cell.ch == 0 {
+				out.WriteByte(' ')
+			} else {
+				out.WriteRune(cell.ch)
+			}
+		}
+		if escapes && current != (cellAttrs{}) {
+			out.WriteString("\x1b[0m")
+		}
+		out.WriteByte('\n')
+	}
+	return out.String()
+}
+
+// Cursor returns the cursor position as "x,y"
+func (s *terminalScreen) Cursor() string {
+	return fmt.Sprintf("%d,%d", s.x, s.y)
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -----------------
+// TLS
+// -----------------
+//
+// Passkeys and secure cookies need HTTPS. Behind a tunnel or proxy that terminates TLS nothing
+// changes; otherwise REMOTE_CODE_TLS_CERT and REMOTE_CODE_TLS_KEY serve HTTPS with the given
+// files, or REMOTE_CODE_TLS=local generates a local CA in <data dir>/tls that signs a server
+// certificate for localhost, this machine's host name and LAN addresses and the extra names in
+// REMOTE_CODE_TLS_HOSTS (comma separated). Devices on the network trust it once the CA,
+// downloadable at /ca.crt, is installed. The server certificate is renewed on startup when
+// names change or it is about to expire.
+//
+// A device that installs the CA trusts whatever its key signs, so the CA carries critical name
+// constraints: it can only sign certificates for the names it was created for. The CA is kept
+// across restarts and replaced, with a new one to install, when the names outgrow it. Its key
+// is in its own directory, <data dir>/tls/ca, readable only by the server's user and hidden
+// from sandboxed agents. Agents running without a sandbox as the same user can still read it;
+// anyone who copies it can impersonate these names to devices that trust the CA.
+
+const tlsModeLocal = "local"
+
+const (
+	localCAValidity         = 10 * 365 * 24 * time.Hour
+	localServerCertValidity = 397 * 24 * time.Hour // the longest lifetime browsers accept
+	localServerCertRenewal  = 30 * 24 * time.Hour
+)
+
+// Files of the local CA and server certificate, inside the TLS directory. The CA key is in a
+// directory of its own.
+const (
+	localCACertFile     = "ca.crt"
+	localCAKeyDir       = "ca"
+	localCAKeyFile      = "ca.key"
+	localServerCertFile = "server.crt"
+	localServerKeyFile  = "server.key"
+)
+
+// TLSStatus describes how the server serves HTTPS
+type TLSStatus struct {
+	Enabled       bool       `json:"enabled"`
+	Mode          string     `json:"mode,omitempty"` // "files" or "local"
+	Names         []string   `json:"names,omitempty"`
+	NotAfter      *time.Time `json:"not_after,omitempty"`
+	CAFingerprint string     `json:"ca_fingerprint,omitempty"` // SHA-256 of the local CA
+	CAURL         string     `json:"ca_url,omitempty"`
+}
+
+var (
+	tlsStatus   TLSStatus
+	localCAPEM  []byte
+	tlsStatusMu sync.RWMutex
+)
+
+func tlsDir() string {
+	return filepath.Join(dataDir, "tls")
+}
+
+// localCAKeyDirPath returns the directory of the local CA key, hidden from sandboxed agents
+func localCAKeyDirPath() string {
+	return filepath.Join(tlsDir(), localCAKeyDir)
+}
+
+// setupTLS returns the certificate and key files to serve HTTPS with, or "" for plain HTTP
+func setupTLS() (string, string, error) {
+	certFile, keyFile := os.Getenv("REMOTE_CODE_TLS_CERT"), os.Getenv("REMOTE_CODE_TLS_KEY")
+	switch {
+	case certFile != "" || keyFile != "":
+		if certFile == "" || keyFile == "" {
+			return "", "", fmt.Errorf("REMOTE_CODE_TLS_CERT and REMOTE_CODE_TLS_KEY must be set together")
+		}
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to load TLS certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse TLS certificate: %v", err)
+		}
+		setTLSStatus(TLSStatus{Enabled: true, Mode: "files", Names: certificateNames(cert), NotAfter: &cert.NotAfter}, nil)
+		return certFile, keyFile, nil
+
+	case os.Getenv("REMOTE_CODE_TLS") == tlsModeLocal:
+		return setupLocalTLS(tlsDir(), localCertificateNames())
+
+	case os.Getenv("REMOTE_CODE_TLS") != "":
+		return "", "", fmt.Errorf("unknown REMOTE_CODE_TLS mode %q, expected %q", os.Getenv("REMOTE_CODE_TLS"), tlsModeLocal)
+	}
+
+	setTLSStatus(TLSStatus{}, nil)
+	return "", "", nil
+}
+
+func setTLSStatus(status TLSStatus, caPEM []byte) {
+	tlsStatusMu.Lock()
+	defer tlsStatusMu.Unlock()
+	tlsStatus = status
+	localCAPEM = caPEM
+}
+
+// setupLocalTLS loads or creates the local CA in dir and a server certificate it signs for names
+func setupLocalTLS(dir string, names []string) (string, string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create TLS directory: %v", err)
+	}
+	caCert, caKey, caPEM, err := loadOrCreateLocalCA(dir, names)
+	if err != nil {
+		return "", "", err
+	}
+
+	certFile := filepath.Join(dir, localServerCertFile)
+	keyFile := filepath.Join(dir, localServerKeyFile)
+	cert, err := loadServerCertificate(certFile, keyFile)
+	if err != nil || !serverCertificateCurrent(cert, caCert, names) {
+		if cert, err = createServerCertificate(certFile, keyFile, caCert, caKey, names); err != nil {
+			return "", "", err
+		}
+		log.Printf("Issued local TLS certificate for %s", strings.Join(names, ", "))
+	}
+
+	sum := sha256.Sum256(caCert.Raw)
+	setTLSStatus(TLSStatus{
+		Enabled:       true,
+		Mode:          tlsModeLocal,
+		Names:         certificateNames(cert),
+		NotAfter:      &cert.NotAfter,
+		CAFingerprint: hex.EncodeToString(sum[:]),
+		CAURL:         "/ca.crt",
+	}, caPEM)
+	return certFile, keyFile, nil
+}
+
+// localCertificateNames returns the names a local server certificate covers: loopback, the host
+// name, LAN addresses and REMOTE_CODE_TLS_HOSTS
+func localCertificateNames() []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		names = append(names, hostname)
+		if !strings.Contains(hostname, ".") {
+			names = append(names, hostname+".local")
+		}
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if ok && ipNet.IP.IsGlobalUnicast() {
+				names = append(names, ipNet.IP.String())
+			}
+		}
+	}
+	for _, host := range strings.Split(os.Getenv("REMOTE_CODE_TLS_HOSTS"), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			names = append(names, host)
+		}
+	}
+	return uniqueSortedNames(names)
+}
+
+func uniqueSortedNames(names []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, name := range names {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// certificateNames returns the host names and addresses a certificate is valid for
+func certificateNames(cert *x509.Certificate) []string {
+	names := append([]string{}, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	return uniqueSortedNames(names)
+}
+
+// loadOrCreateLocalCA loads the local CA in dir, or creates one constrained to names when there
+// is none or the one there cannot sign for all of them
+func loadOrCreateLocalCA(dir string, names []string) (*x509.Certificate, *ecdsa.PrivateKey, []byte, error) {
+	keyDir := filepath.Join(dir, localCAKeyDir)
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create CA key directory: %v", err)
+	}
+	if err := os.Chmod(keyDir, 0700); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to restrict CA key directory: %v", err)
+	}
+	certPath := filepath.Join(dir, localCACertFile)
+	keyPath := filepath.Join(keyDir, localCAKeyFile)
+
+	// Earlier versions kept the key next to the certificate
+	if err := os.Rename(filepath.Join(dir, localCAKeyFile), keyPath); err != nil && !os.IsNotExist(err) {
+		return nil, nil, nil, fmt.Errorf("failed to move local CA key: %v", err)
+	}
+
+	if certPEM, err := os.ReadFile(certPath); err == nil {
+		pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to load local CA: %v", err)
+		}
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to parse local CA: %v", err)
+		}
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, nil, fmt.Errorf("local CA key is not an ECDSA key")
+		}
+		if localCAPermits(cert, names) {
+			return cert, key, certPEM, nil
+		}
+		log.Printf("Local CA %s is not limited to %s; replacing it, devices need the new CA installed", cert.Subject.CommonName, strings.Join(names, ", "))
+	} else if !os.IsNotExist(err) {
+		return nil, nil, nil, fmt.Errorf("failed to read local CA: %v", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:                newCertificateSerial(),
+		Subject:                     pkix.Name{Organization: []string{"Remote-Code"}, CommonName: "Remote-Code local CA " + hostname},
+		NotBefore:                   time.Now().Add(-time.Hour),
+		NotAfter:                    time.Now().Add(localCAValidity),
+		KeyUsage:                    x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid:       true,
+		IsCA:                        true,
+		MaxPathLenZero:              true,
+		PermittedDNSDomainsCritical: true,
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.PermittedIPRanges = append(template.PermittedIPRanges, singleAddressRange(ip))
+		} else {
+			template.PermittedDNSDomains = append(template.PermittedDNSDomains, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create local CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEM, err := writeCertificateFiles(certPath, keyPath, der, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	log.Printf("Created local CA %s for %s; install %s on devices to trust it", template.Subject.CommonName, strings.Join(names, ", "), certPath)
+	return cert, key, certPEM, nil
+}
+
+// singleAddressRange returns the range holding only ip
+func singleAddressRange(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}
+}
+
+// localCAPermits reports whether a local CA has critical name constraints that allow every name
+func localCAPermits(caCert *x509.Certificate, names []string) bool {
+	if !caCert.PermittedDNSDomainsCritical || len(caCert.PermittedDNSDomains) == 0 || len(caCert.PermittedIPRanges) == 0 {
+		return false
+	}
+	for _, name := range names {
+		permitted := false
+		if ip := net.ParseIP(name); ip != nil {
+			for _, ipRange := range caCert.PermittedIPRanges {
+				permitted = permitted || ipRange.Contains(ip)
+			}
+		} else {
+			for _, domain := range caCert.PermittedDNSDomains {
+				permitted = permitted || name == domain || strings.HasSuffix(name, "."+domain)
+			}
+		}
+		if !permitted {
+			return false
+		}
+	}
+	return true
+}
+
+func loadServerCertificate(certFile, keyFile string) (*x509.Certificate, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(pair.Certificate[0])
+}
+
+// serverCertificateCurrent reports whether a server certificate is signed by the CA, covers
+// exactly names and is not about to expire
+func serverCertificateCurrent(cert, caCert *x509.Certificate, names []string) bool {
+	if cert.CheckSignatureFrom(caCert) != nil {
+		return false
+	}
+	if time.Until(cert.NotAfter) < localServerCertRenewal {
+		return false
+	}
+	var dnsNames []string
+	var ips []net.IP
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+
+	// Addresses are compared parsed, since one address has many spellings ("::1", "0:0::1")
+	if len(cert.IPAddresses) != len(ips) {
+		return false
+	}
+	for _, ip := range ips {
+		found := false
+		for _, certIP := range cert.IPAddresses {
+			found = found || certIP.Equal(ip)
+		}
+		if !found {
+			return false
+		}
+	}
+	current := uniqueSortedNames(cert.DNSNames)
+	dnsNames = uniqueSortedNames(dnsNames)
+	if len(current) != len(dnsNames) {
+		return false
+	}
+	for i := range current {
+		if current[i] != dnsNames[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func createServerCertificate(certFile, keyFile string, caCert *x509.Certificate, caKey *ecdsa.PrivateKey, names []string) (*x509.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: newCertificateSerial(),
+		Subject:      pkix.Name{Organization: []string{"Remote-Code"}, CommonName: names[0]},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(localServerCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create server certificate: %v", err)
+	}
+	if _, err := writeCertificateFiles(certFile, keyFile, der, key); err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// writeCertificateFiles writes a certificate and its key as PEM, the key readable only by us
+func writeCertificateFiles(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) ([]byte, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", keyFile, err)
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %v", certFile, err)
+	}
+	return certPEM, nil
+}
+
+func newCertificateSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+// handleCACertDownload serves the local CA certificate at /ca.crt, for installing on devices.
+// It is public: devices fetch it before they can sign in.
+func handleCACertDownload(w http.ResponseWriter, r *http.Request) {
+	tlsStatusMu.RLock()
+	caPEM := localCAPEM
+	tlsStatusMu.RUnlock()
+	if caPEM == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+	w.Header().Set("Content-Disposition", `attachment; filename="remote-code-ca.crt"`)
+	w.Write(caPEM)
+}
+
+// handleTLSAPI handles /api/tls, how the server serves HTTPS
+func handleTLSAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	tlsStatusMu.RLock()
+	status := tlsStatus
+	tlsStatusMu.RUnlock()
+	// Behind a tunnel or proxy the server itself serves plain HTTP
+	if !status.Enabled && r.Header.Get("X-Forwarded-Proto") == "https" {
+		status.Mode = "proxy"
+	}
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Personal API tokens
+// -----------------
+//
+// Scripts and CLIs authenticate with "Authorization: Bearer <token>" instead of a session
+// cookie. A token acts as its owner, capped by its scope, and may expire. Tokens are managed
+// from a passkey session only, so a leaked token can't mint others.
+
+// apiTokenPrefix starts every token, so leaked tokens are easy to recognise
+const apiTokenPrefix = "rc_"
+
+// Longest lifetime of a token, in days
+const maxAPITokenDays = 366
+
+// apiTokenScopes are the roles each scope caps a token to
+var apiTokenScopes = map[string]string{
+	"read":  roleViewer,
+	"write": roleOperator,
+	"admin": roleAdmin,
+}
+
+// tokenRole is the role a token acts with: its owner's, capped by the token's scope
+func tokenRole(userRole, scope string) string {
+	if scopeRole, ok := apiTokenScopes[scope]; ok && !roleAllows(scopeRole, userRole) {
+		return scopeRole
+	}
+	return userRole
+}
+
+type apiTokenContextKey struct{}
+
+// requestAPIToken returns the API token a request was authenticated with
+func requestAPIToken(r *http.Request) (db.ApiToken, bool) {
+	token, ok := r.Context().Value(apiTokenContextKey{}).(db.ApiToken)
+	return token, ok
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
+
+// apiTokenUser returns the user an API token acts as, with the role the token allows, and
+// records that the token was used
+func apiTokenUser(ctx context.Context, value string) (db.User, db.ApiToken, error) {
+	token, err := queries.GetAPITokenByHash(ctx, hashToken(value))
+	if err != nil {
+		return db.User{}, db.ApiToken{}, err
+	}
+	user, err := queries.GetUser(ctx, token.UserID)
+	if err != nil {
+		return db.User{}, db.ApiToken{}, err
+	}
+	if err := queries.TouchAPIToken(ctx, token.ID); err != nil {
+		log.Printf("Warning: failed to record use of API token %d: %v", token.ID, err)
+	}
+	user.Role = tokenRole(user.Role, token.Scope)
+	return user, token, nil
+}
+
+// APIToken is an API token as listed; the token itself is only returned when it is created
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scope      string     `json:"scope"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func dbAPITokenToAPIToken(token db.ApiToken) APIToken {
+	result := APIToken{
+		ID:     token.ID,
+		Name:   token.Name,
+		Prefix: token.TokenPrefix,
+		Scope:  token.Scope,
+	}
+	if token.ExpiresAt.Valid {
+		result.ExpiresAt = &token.ExpiresAt.Time
+	}
+	if token.LastUsedAt.Valid {
+		result.LastUsedAt = &token.LastUsedAt.Time
+	}
+	if token.CreatedAt.Valid {
+		result.CreatedAt = token.CreatedAt.Time
+	}
+	return result
+}
+
+// handleAPITokensAPI handles /api/tokens: the signed in user's tokens
+func handleAPITokensAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	user, ok := requestUser(r)
+	if !ok {
+		http.Error(w, "Sign in with a passkey to manage API tokens", http.StatusUnauthorized)
+		return
+	}
+	if _, viaToken := requestAPIToken(r); viaToken {
+		http.Error(w, "API tokens can't manage API tokens, sign in with a passkey", http.StatusForbidden)
+		return
+	}
+
+	if len(pathParts) > 0 && pathParts[0] != "" {
+		if r.Method != "DELETE" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		tokenID, err := strconv.ParseInt(pathParts[0], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid token ID", http.StatusBadRequest)
+			return
+		}
+		// Admins may revoke anyone's token
+		token, err := queries.GetAPIToken(ctx, tokenID)
+		if err != nil || (token.UserID != user.ID && user.Role != roleAdmin) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		if err := queries.DeleteAPIToken(ctx, token.ID); err != nil {
+			log.Printf("Failed to revoke API token %d: %v", token.ID, err)
+			http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbTokens, err := queries.ListAPITokensByUserID(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to list API tokens: %v", err)
+			http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+			return
+		}
+		tokens := make([]APIToken, 0, len(dbTokens))
+		for _, token := range dbTokens {
+			tokens = append(tokens, dbAPITokenToAPIToken(token))
+		}
+		json.NewEncoder(w).Encode(tokens)
+
+	case "POST":
+		var createReq struct {
+			Name          string `json:"name"`
+			Scope         string `json:"scope"`
+			ExpiresInDays int    `json:"expires_in_days"` // 0 never expires
+		}
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		createReq.Name = strings.TrimSpace(createReq.Name)
+		if createReq.Name == "" {
+			http.Error(w, "Token name is required", http.StatusBadRequest)
+			return
+		}
+		if createReq.Scope != "" {
+			scopeRole, ok := apiTokenScopes[createReq.Scope]
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown scope %q, use read, write or admin", createReq.Scope), http.StatusBadRequest)
+				return
+			}
+			if !roleAllows(user.Role, scopeRole) {
+				http.Error(w, fmt.Sprintf("Your role can't create %s tokens", createReq.Scope), http.StatusForbidden)
+				return
+			}
+		}
+		if createReq.ExpiresInDays < 0 || createReq.ExpiresInDays > maxAPITokenDays {
+			http.Error(w, fmt.Sprintf("expires_in_days must be between 0 and %d", maxAPITokenDays), http.StatusBadRequest)
+			return
+		}
+
+		secret, err := generateSessionToken()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		value := apiTokenPrefix + strings.TrimRight(secret, "=")
+		var expiresAt sql.NullTime
+		if createReq.ExpiresInDays > 0 {
+			expiresAt = sql.NullTime{Time: time.Now().AddDate(0, 0, createReq.ExpiresInDays), Valid: true}
+		}
+
+		token, err := queries.CreateAPIToken(ctx, db.CreateAPITokenParams{
+			UserID:      user.ID,
+			Name:        createReq.Name,
+			TokenHash:   hashToken(value),
+			TokenPrefix: value[:len(apiTokenPrefix)+6],
+			Scope:       createReq.Scope,
+			ExpiresAt:   expiresAt,
+		})
+		if err != nil {
+			log.Printf("Failed to create API token: %v", err)
+			http.Error(w, "Failed to create token", http.StatusInternalServerError)
+			return
+		}
+		result := dbAPITokenToAPIToken(token)
+		result.Token = value
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(result)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Authenticator codes
+// -----------------
+//
+// Users can add an authenticator app (TOTP, RFC 6238) as a fallback. With it they sign in by
+// name and code on a domain where they have no passkey yet, then register one there. Each
+// code works once, and repeated wrong codes lock the user out of code sign-in for a while.
+
+const (
+	totpPeriod = 30 // seconds per code
+	totpDigits = 6
+	totpSkew   = 1 // codes of neighbouring periods are accepted for clock drift
+	totpIssuer = "Remote-Code"
+)
+
+// Wrong codes allowed before code sign-in is locked, and for how long
+const (
+	totpMaxFailures = 5
+	totpLockout     = 15 * time.Minute
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type totpFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+var (
+	totpFailuresByUser   = make(map[int64]*totpFailures)
+	totpFailuresByUserMu sync.Mutex
+)
+
+// newTOTPSecret returns a random base32 secret for an authenticator app
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// totpStep returns the time step a moment falls in
+func totpStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// totpCode returns the code for a secret at a time step
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// matchTOTP returns the time step a code is valid for around now
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := totpCode(secret, step)
+		if err == nil && hmac.Equal([]byte(expected), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// userTOTPSecret unseals a user's authenticator secret
+func userTOTPSecret(user db.User) (string, error) {
+	if user.TotpSecret == "" {
+		return "", fmt.Errorf("no authenticator secret")
+	}
+	return decryptSecret(user.TotpSecret)
+}
+
+// totpLocked reports whether code sign-in is locked for a user
+func totpLocked(userID int64) bool {
+	totpFailuresByUserMu.Lock()
+	defer totpFailuresByUserMu.Unlock()
+	failures, ok := totpFailuresByUser[userID]
+	return ok && time.Now().Before(failures.lockedUntil)
+}
+
+// recordTOTPResult counts a wrong code, locking code sign-in after too many, and forgets
+// earlier failures after a right one
+func recordTOTPResult(userID int64, ok bool) {
+	totpFailuresByUserMu.Lock()
+	defer totpFailuresByUserMu.Unlock()
+	if ok {
+		delete(totpFailuresByUser, userID)
+		return
+	}
+	failures, found := totpFailuresByUser[userID]
+	if !found {
+		failures = &totpFailures{}
+		totpFailuresByUser[userID] = failures
+	}
+	failures.count++
+	if failures.count >= totpMaxFailures {
+		failures.count = 0
+		failures.lockedUntil = time.Now().Add(totpLockout)
+		log.Printf("Authenticator code sign-in locked for user %d after %d wrong codes", userID, totpMaxFailures)
+	}
+}
+
+// TOTPStatus tells whether a user has an authenticator app
+type TOTPStatus struct {
+	Enabled bool `json:"enabled"`
+	Pending bool `json:"pending"`
+}
+
+// TOTPSetup is a new authenticator secret, with the otpauth:// URL apps scan as a QR code
+type TOTPSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// handleAuthTOTP handles /api/auth/totp: GET the status, POST setup for a new secret, POST
+// enable with a code from the app to turn it on, DELETE to turn it off, and POST login to
+// sign in with a user name and code.
+func handleAuthTOTP(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	action := ""
+	if len(pathParts) > 0 {
+		action = pathParts[0]
+	}
+	if action == "login" {
+		handleTOTPLogin(w, r, ctx)
+		return
+	}
+
+	user, ok := cookieUser(ctx, r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == "GET":
+		json.NewEncoder(w).Encode(TOTPStatus{
+			Enabled: user.TotpEnabledAt.Valid,
+			Pending: user.TotpSecret != "" && !user.TotpEnabledAt.Valid,
+		})
+
+	case action == "setup" && r.Method == "POST":
+		if user.TotpEnabledAt.Valid {
+			http.Error(w, "An authenticator app is already set up; remove it first", http.StatusConflict)
+			return
+		}
+		secret, err := newTOTPSecret()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		sealed, err := encryptSecret(secret)
+		if err != nil {
+			log.Printf("Failed to seal authenticator secret: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if err := queries.SetUserTOTPSecret(ctx, db.SetUserTOTPSecretParams{ID: user.ID, TotpSecret: sealed}); err != nil {
+			log.Printf("Failed to save authenticator secret of user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		label := url.PathEscape(totpIssuer + ":" + user.Name)
+		params := url.Values{}
+		params.Set("secret", secret)
+		params.Set("issuer", totpIssuer)
+		params.Set("digits", fmt.Sprint(totpDigits))
+		params.Set("period", fmt.Sprint(totpPeriod))
+		json.NewEncoder(w).Encode(TOTPSetup{
+			Secret:     secret,
+			OTPAuthURL: "otpauth://totp/" + label + "?" + params.Encode(),
+		})
+
+	case action == "enable" && r.Method == "POST":
+		var enableReq struct {
+			Code string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&enableReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if user.TotpEnabledAt.Valid {
+			http.Error(w, "An authenticator app is already set up", http.StatusConflict)
+			return
+		}
+		secret, err := userTOTPSecret(user)
+		if err != nil {
+			http.Error(w, "Set up an authenticator app first", http.StatusBadRequest)
+			return
+		}
+		step, ok := matchTOTP(secret, enableReq.Code, time.Now())
+		if !ok {
+			http.Error(w, "Code does not match; check the app and the time on this device", http.StatusBadRequest)
+			return
+		}
+		if err := queries.EnableUserTOTP(ctx, db.EnableUserTOTPParams{ID: user.ID, TotpLastStep: step}); err != nil {
+			log.Printf("Failed to enable authenticator for user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(TOTPStatus{Enabled: true})
+
+	case action == "" && r.Method == "DELETE":
+		if err := queries.DisableUserTOTP(ctx, user.ID); err != nil {
+			log.Printf("Failed to disable authenticator for user %d: %v", user.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTOTPLogin signs a user in with their name and an authenticator code
+func handleTOTPLogin(w http.ResponseWriter, r *http.Request, ctx context.Context) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var loginReq struct {
+		Name string `json:"name"`
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Unknown users and users without an app get the same answer as a wrong code
+	user, err := queries.GetUserByName(ctx, strings.ToLower(strings.TrimSpace(loginReq.Name)))
+	if err != nil || !user.TotpEnabledAt.Valid {
+		http.Error(w, "Invalid user name or code", http.StatusUnauthorized)
+		return
+	}
+	if totpLocked(user.ID) {
+		http.Error(w, "Too many wrong codes; try again later", http.StatusTooManyRequests)
+		return
+	}
+	secret, err := userTOTPSecret(user)
+	if err != nil {
+		log.Printf("Failed to unseal authenticator secret of user %d: %v", user.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	step, ok := matchTOTP(secret, loginReq.Code, time.Now())
+	if ok {
+		// A code is used up by signing in with it, or with a later one
+		used, err := queries.UseUserTOTPStep(ctx, db.UseUserTOTPStepParams{ID: user.ID, Step: step})
+		ok = err == nil && used > 0
+	}
+	recordTOTPResult(user.ID, ok)
+	if !ok {
+		http.Error(w, "Invalid user name or code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := startSession(w, r, ctx, user.ID); err != nil {
+		log.Printf("Error creating session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %s signed in with an authenticator code on %s", user.Name, getRPID(r))
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Users and roles
+// -----------------
+//
+// Passkeys and sessions belong to users. Admins manage users, agents and configuration,
+// operators run agents and use terminals, viewers read dashboards and transcripts. New users
+// get an invite link to register their first passkey.
+
+const (
+	roleAdmin    = "admin"
+	roleOperator = "operator"
+	roleViewer   = "viewer"
+)
+
+// roleRanks orders roles; a role may do everything the roles below it may
+var roleRanks = map[string]int{
+	roleViewer:   1,
+	roleOperator: 2,
+	roleAdmin:    3,
+}
+
+// How long an invite to register a passkey stays valid
+const inviteDuration = 72 * time.Hour
+
+var userNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+// roleAllows reports whether a user with role may do what required needs
+func roleAllows(role, required string) bool {
+	return roleRanks[role] >= roleRanks[required]
+}
+
+// Resources only admins may touch, and those only admins may change. Sub-resources are
+// written "<resource>/*/<sub-resource>", e.g. a project's environment.
+var (
+	adminResources = map[string]bool{
+		"users": true, "config": true, "environment-variables": true, "sandbox": true, "audit": true,
+		"projects/*/environment": true, "projects/*/sandbox": true, "agents/*/sandbox": true,
+	}
+	adminWriteResources = map[string]bool{
+		"roots": true, "agents": true, "tls": true,
+		"auto-responders": true, "projects/*/auto-responders": true,
+	}
+)
+
+// requiredRole is the role a request needs. Reading and managing one's own API tokens is for
+// viewers, changing anything (and terminals) for operators, and users, configuration,
+// secrets, sandboxing, the audit log, roots, agent commands, auto-responder rules (which
+// approve agent commands unattended) and TLS for admins.
+func requiredRole(r *http.Request) string {
+	if r.URL.Path == "/ws" {
+		return roleOperator
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/"), "/")
+	resource := parts[0]
+	subResource := ""
+	if len(parts) >= 3 {
+		subResource = resource + "/*/" + parts[2]
+	}
+	readOnly := r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS"
+
+	switch {
+	case adminResources[resource], adminResources[subResource]:
+		return roleAdmin
+	case readOnly, resource == "tokens":
+		return roleViewer
+	case adminWriteResources[resource], adminWriteResources[subResource]:
+		return roleAdmin
+	default:
+		return roleOperator
+	}
+}
+
+type userContextKey struct{}
+
+// withUser stores the signed in user in a request context
+func withUser(ctx context.Context, user db.User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// requestUser returns the signed in user of a request. There is none before the first passkey
+// is registered.
+func requestUser(r *http.Request) (db.User, bool) {
+	user, ok := r.Context().Value(userContextKey{}).(db.User)
+	return user, ok
+}
+
+// requestUserID returns the ID of the signed in user, for recording who did something
+func requestUserID(r *http.Request) sql.NullInt64 {
+	if user, ok := requestUser(r); ok {
+		return sql.NullInt64{Int64: user.ID, Valid: true}
+	}
+	return sql.NullInt64{}
+}
+
+// newWebAuthnHandle returns a random WebAuthn user handle
+func newWebAuthnHandle() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how invite and API tokens are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createInvite gives a user a new invite token, replacing any earlier one
+func createInvite(ctx context.Context, userID int64) (string, error) {
+	token, err := generateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	err = queries.SetUserInvite(ctx, db.SetUserInviteParams{
+		ID:              userID,
+		InviteTokenHash: sql.NullString{String: hashToken(token), Valid: true},
+		InviteExpiresAt: sql.NullTime{Time: time.Now().Add(inviteDuration), Valid: true},
+	})
+	return token, err
+}
+
+// User is a user as returned by the API
+type User struct {
+	ID            int64     `json:"id"`
+	Name          string    `json:"name"`
+	DisplayName   string    `json:"display_name"`
+	Role          string    `json:"role"`
+	InvitePending bool      `json:"invite_pending"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+func dbUserToUser(user db.User) User {
+	result := User{
+		ID:            user.ID,
+		Name:          user.Name,
+		DisplayName:   user.DisplayName,
+		Role:          user.Role,
+		InvitePending: user.InviteTokenHash.Valid && user.InviteExpiresAt.Valid && user.InviteExpiresAt.Time.After(time.Now()),
+	}
+	if user.CreatedAt.Valid {
+		result.CreatedAt = user.CreatedAt.Time
+	}
+	return result
+}
+
+// UserInvite is a user with the invite link to register a passkey
+type UserInvite struct {
+	User        User   `json:"user"`
+	InviteToken string `json:"invite_token"`
+	InviteURL   string `json:"invite_url"`
+}
+
+func newUserInvite(user db.User, token string) UserInvite {
+	return UserInvite{User: dbUserToUser(user), InviteToken: token, InviteURL: "/login?invite=" + token}
+}
+
+// handleUsersAPI handles /api/users (admins only)
+func handleUsersAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if len(pathParts) > 0 && pathParts[0] != "" {
+		userID, err := strconv.ParseInt(pathParts[0], 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+		user, err := queries.GetUser(ctx, userID)
+		if err != nil {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+
+		// Handle invite sub-resource: /api/users/{id}/invite
+		if len(pathParts) >= 2 && pathParts[1] == "invite" {
+			if r.Method != "POST" {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			token, err := createInvite(ctx, user.ID)
+			if err != nil {
+				log.Printf("Failed to create invite for user %d: %v", user.ID, err)
+				http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+				return
+			}
+			user, _ = queries.GetUser(ctx, user.ID)
+			json.NewEncoder(w).Encode(newUserInvite(user, token))
+			return
+		}
+		handleUser(w, r, ctx, user)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		dbUsers, err := queries.ListUsers(ctx)
+		if err != nil {
+			log.Printf("Failed to list users: %v", err)
+			http.Error(w, "Failed to list users", http.StatusInternalServerError)
+			return
+		}
+		users := make([]User, 0, len(dbUsers))
+		for _, user := range dbUsers {
+			users = append(users, dbUserToUser(user))
+		}
+		json.NewEncoder(w).Encode(users)
+
+	case "POST":
+		var createReq struct {
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+			Role        string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&createReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		createReq.Name = strings.ToLower(strings.TrimSpace(createReq.Name))
+		if !userNamePattern.MatchString(createReq.Name) {
+			http.Error(w, "User name must be 1-32 lowercase letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+			return
+		}
+		if createReq.Role == "" {
+			createReq.Role = roleViewer
+		}
+		if _, ok := roleRanks[createReq.Role]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown role %q", createReq.Role), http.StatusBadRequest)
+			return
+		}
+		if _, err := queries.GetUserByName(ctx, createReq.Name); err == nil {
+			http.Error(w, "A user with this name already exists", http.StatusConflict)
+			return
+		}
+
+		handle, err := newWebAuthnHandle()
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		user, err := queries.CreateUser(ctx, db.CreateUserParams{
+			Name:           createReq.Name,
+			DisplayName:    strings.TrimSpace(createReq.DisplayName),
+			Role:           createReq.Role,
+			WebauthnHandle: handle,
+		})
+		if err != nil {
+			log.Printf("Failed to create user: %v", err)
+			http.Error(w, "Failed to create user", http.StatusInternalServerError)
+			return
+		}
+		token, err := createInvite(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to create invite for user %d: %v", user.ID, err)
+			http.Error(w, "Failed to create invite", http.StatusInternalServerError)
+			return
+		}
+		user, _ = queries.GetUser(ctx, user.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newUserInvite(user, token))
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleUser(w http.ResponseWriter, r *http.Request, ctx context.Context, user db.User) {
+	switch r.Method {
+	case "GET":
+		json.NewEncoder(w).Encode(dbUserToUser(user))
+
+	case "PUT":
+		updateReq := struct {
+			DisplayName string `json:"display_name"`
+			Role        string `json:"role"`
+		}{DisplayName: user.DisplayName, Role: user.Role}
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if _, ok := roleRanks[updateReq.Role]; !ok {
+			http.Error(w, fmt.Sprintf("Unknown role %q", updateReq.Role), http.StatusBadRequest)
+			return
+		}
+		if user.Role == roleAdmin && updateReq.Role != roleAdmin && isLastAdmin(ctx) {
+			http.Error(w, "The last admin cannot be demoted", http.StatusConflict)
+			return
+		}
+
+		updated, err := queries.UpdateUser(ctx, db.UpdateUserParams{
+			ID:          user.ID,
+			DisplayName: strings.TrimSpace(updateReq.DisplayName),
+			Role:        updateReq.Role,
+		})
+		if err != nil {
+			log.Printf("Failed to update user %d: %v", user.ID, err)
+			http.Error(w, "Failed to update user", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(dbUserToUser(updated))
+
+	case "DELETE":
+		if current, ok := requestUser(r); ok && current.ID == user.ID {
+			http.Error(w, "You cannot delete yourself", http.StatusConflict)
+			return
+		}
+		if user.Role == roleAdmin && isLastAdmin(ctx) {
+			http.Error(w, "The last admin cannot be deleted", http.StatusConflict)
+			return
+		}
+
+		// Passkeys, sessions, API tokens and pairing codes go with the user
+		if err := queries.DeleteSessionsByUserID(ctx, user.ID); err != nil {
+			log.Printf("Warning: failed to delete sessions of user %d: %v", user.ID, err)
+		}
+		if err := queries.DeleteAPITokensByUserID(ctx, user.ID); err != nil {
+			log.Printf("Warning: failed to delete API tokens of user %d: %v", user.ID, err)
+		}
+		if err := queries.DeletePairingCodesByUserID(ctx, user.ID); err != nil {
+			log.Printf("Warning: failed to delete pairing codes of user %d: %v", user.ID, err)
+		}
+		if err := queries.DeleteWebAuthnCredentialsByUserID(ctx, user.ID); err != nil {
+			log.Printf("Warning: failed to delete passkeys of user %d: %v", user.ID, err)
+		}
+		if err := queries.DeleteUser(ctx, user.ID); err != nil {
+			log.Printf("Failed to delete user %d: %v", user.ID, err)
+			http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// isLastAdmin reports whether at most one admin is left
+func isLastAdmin(ctx context.Context) bool {
+	count, err := queries.CountUsersByRole(ctx, roleAdmin)
+	return err == nil && count <= 1
+}
@@ -0,0 +1,501 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"remote-code/db"
+)
+
+// -----------------
+// Kanban workflows
+// -----------------
+//
+// Each project's board is an ordered list of columns; a task's status is the key of the
+// column it sits in. Columns can cap the number of tasks in them (a WIP limit, enforced
+// when people move tasks). Automation rules move a task when something happens to it,
+// such as an execution starting or being accepted. Projects that never customized their
+// board get the original four columns and transitions.
+
+// Events automation rules react to
+const (
+	workflowEventExecutionStarted  = "execution_started"
+	workflowEventExecutionAccepted = "execution_accepted"
+	workflowEventBranchMerged      = "branch_merged"
+	workflowEventPullRequestMerged = "pull_request_merged"
+)
+
+var workflowEvents = map[string]bool{
+	workflowEventExecutionStarted:  true,
+	workflowEventExecutionAccepted: true,
+	workflowEventBranchMerged:      true,
+	workflowEventPullRequestMerged: true,
+}
+
+var workflowStatusKey = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,39}$`)
+
+// The board of projects without a custom workflow
+var defaultWorkflowColumns = []WorkflowColumn{
+	{Key: "todo", Name: "To Do", Color: "bg-slate-400"},
+	{Key: "in_progress", Name: "In Progress", Color: "bg-vanna-magenta"},
+	{Key: "to_verify", Name: "To Verify", Color: "bg-vanna-orange"},
+	{Key: "done", Name: "Done", Color: "bg-vanna-teal"},
+}
+
+var defaultWorkflowRules = []WorkflowRule{
+	{Event: workflowEventExecutionStarted, TargetStatus: "in_progress"},
+	{Event: workflowEventExecutionAccepted, TargetStatus: "to_verify"},
+	{Event: workflowEventBranchMerged, TargetStatus: "done"},
+	{Event: workflowEventPullRequestMerged, TargetStatus: "done"},
+}
+
+// WorkflowColumn is one column of a project's board
+type WorkflowColumn struct {
+	Key      string `json:"key"` // the status of tasks in the column
+	Name     string `json:"name"`
+	WIPLimit int64  `json:"wip_limit"` // 0 means unlimited
+	Color    string `json:"color"`
+}
+
+// WorkflowRule moves a task to a column when an event happens to it
+type WorkflowRule struct {
+	Event        string `json:"event"`
+	TargetStatus string `json:"target_status"`
+}
+
+// Workflow is a project's board and automation
+type Workflow struct {
+	Columns []WorkflowColumn `json:"columns"`
+	Rules   []WorkflowRule   `json:"rules"`
+	Custom  bool             `json:"custom"` // false while the project uses the defaults
+}
+
+// loadWorkflow returns the project's workflow, or the default one
+func loadWorkflow(ctx context.Context, projectID int64) (Workflow, error) {
+	dbColumns, err := queries.GetWorkflowColumnsByProjectID(ctx, projectID)
+	if err != nil {
+		return Workflow{}, err
+	}
+	if len(dbColumns) == 0 {
+		return Workflow{Columns: defaultWorkflowColumns, Rules: defaultWorkflowRules}, nil
+	}
+
+	dbRules, err := queries.GetWorkflowRulesByProjectID(ctx, projectID)
+	if err != nil {
+		return Workflow{}, err
+	}
+
+	workflow := Workflow{Columns: []WorkflowColumn{}, Rules: []WorkflowRule{}, Custom: true}
+	for _, column := range dbColumns {
+		workflow.Columns = append(workflow.Columns, WorkflowColumn{
+			Key:      column.StatusKey,
+			Name:     column.Name,
+			WIPLimit: column.WipLimit,
+			Color:    column.Color,
+		})
+	}
+	for _, rule := range dbRules {
+		workflow.Rules = append(workflow.Rules, WorkflowRule{Event: rule.Event, TargetStatus: rule.TargetStatus})
+	}
+	return workflow, nil
+}
+
+func (wf Workflow) column(key string) (WorkflowColumn, bool) {
+	for _, column := range wf.Columns {
+		if column.Key == key {
+			return column, true
+		}
+	}
+	return WorkflowColumn{}, false
+}
+
+// validate checks columns are unique and well formed and rules point at existing columns
+func (wf Workflow) validate() error {
+	if len(wf.Columns) == 0 {
+		return fmt.Errorf("a workflow needs at least one column")
+	}
+	seen := map[string]bool{}
+	for _, column := range wf.Columns {
+		if !workflowStatusKey.MatchString(column.Key) {
+			return fmt.Errorf("invalid column key %q: use lowercase letters, digits, - and _", column.Key)
+		}
+		if seen[column.Key] {
+			return fmt.Errorf("duplicate column key %q", column.Key)
+		}
+		seen[column.Key] = true
+		if column.Name == "" {
+			return fmt.Errorf("column %q needs a name", column.Key)
+		}
+		if column.WIPLimit < 0 {
+			return fmt.Errorf("column %q has a negative WIP limit", column.Key)
+		}
+	}
+
+	events := map[string]bool{}
+	for _, rule := range wf.Rules {
+		if !workflowEvents[rule.Event] {
+			return fmt.Errorf("unknown event %q", rule.Event)
+		}
+		if events[rule.Event] {
+			return fmt.Errorf("more than one rule for %s", rule.Event)
+		}
+		events[rule.Event] = true
+		if !seen[rule.TargetStatus] {
+			return fmt.Errorf("rule for %s moves to unknown column %q", rule.Event, rule.TargetStatus)
+		}
+	}
+	return nil
+}
+
+// checkWIPLimit fails if moving a task into the column would exceed its limit
+func checkWIPLimit(ctx context.Context, projectID int64, column WorkflowColumn) error {
+	if column.WIPLimit == 0 {
+		return nil
+	}
+	count, err := queries.CountTasksByProjectAndStatus(ctx, db.CountTasksByProjectAndStatusParams{
+		ProjectID: projectID,
+		Status:    column.Key,
+	})
+	if err != nil {
+		return err
+	}
+	if count >= column.WIPLimit {
+		return fmt.Errorf("%s is at its WIP limit of %d", column.Name, column.WIPLimit)
+	}
+	return nil
+}
+
+// moveTask puts a task into a column at the given index (-1 for the end) and renumbers the
+// column so sort orders stay dense
+func moveTask(ctx context.Context, task db.Task, status string, index int) (db.Task, error) {
+	siblings, err := queries.GetTasksByProjectAndStatus(ctx, db.GetTasksByProjectAndStatusParams{
+		ProjectID: task.ProjectID,
+		Status:    status,
+	})
+	if err != nil {
+		return task, err
+	}
+
+	ordered := make([]db.Task, 0, len(siblings)+1)
+	for _, sibling := range siblings {
+		if sibling.ID != task.ID {
+			ordered = append(ordered, sibling)
+		}
+	}
+	if index < 0 || index > len(ordered) {
+		index = len(ordered)
+	}
+	ordered = append(ordered[:index], append([]db.Task{task}, ordered[index:]...)...)
+
+	var moved db.Task
+	for i, sibling := range ordered {
+		if sibling.ID != task.ID && sibling.SortOrder == int64(i+1) {
+			continue
+		}
+		updated, err := queries.UpdateTaskPosition(ctx, db.UpdateTaskPositionParams{
+			ID:        sibling.ID,
+			Status:    status,
+			SortOrder: int64(i + 1),
+		})
+		if err != nil {
+			return task, err
+		}
+		if sibling.ID == task.ID {
+			moved = updated
+		}
+	}
+	return moved, nil
+}
+
+// applyWorkflowEvent runs the project's automation rule for an event on a task. It returns
+// the task as it is afterwards. Automation may overfill a column: the work already happened.
+func applyWorkflowEvent(ctx context.Context, task db.Task, event string) db.Task {
+	workflow, err := loadWorkflow(ctx, task.ProjectID)
+	if err != nil {
+		log.Printf("Failed to load workflow of project %d: %v", task.ProjectID, err)
+		return task
+	}
+
+	for _, rule := range workflow.Rules {
+		if rule.Event != event || rule.TargetStatus == task.Status {
+			continue
+		}
+		if column, ok := workflow.column(rule.TargetStatus); ok {
+			if err := checkWIPLimit(ctx, task.ProjectID, column); err != nil {
+				log.Printf("Moving task %d on %s: %v", task.ID, event, err)
+			}
+		}
+		moved, err := moveTask(ctx, task, rule.TargetStatus, -1)
+		if err != nil {
+			log.Printf("Failed to move task %d to %s on %s: %v", task.ID, rule.TargetStatus, event, err)
+			return task
+		}
+		return moved
+	}
+	return task
+}
+
+// handleProjectWorkflowAPI handles /api/projects/{id}/workflow
+func handleProjectWorkflowAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	projectID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := queries.GetProject(ctx, projectID); err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		workflow, err := loadWorkflow(ctx, projectID)
+		if err != nil {
+			log.Printf("Failed to load workflow of project %d: %v", projectID, err)
+			http.Error(w, "Failed to load workflow", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(workflow)
+
+	case "PUT":
+		// Replaces the whole workflow. Tasks in columns that go away must be moved with
+		// status_map (old key to new key).
+		var updateReq struct {
+			Columns   []WorkflowColumn  `json:"columns"`
+			Rules     []WorkflowRule    `json:"rules"`
+			StatusMap map[string]string `json:"status_map"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&updateReq); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if updateReq.Rules == nil {
+			updateReq.Rules = []WorkflowRule{}
+		}
+
+		updated := Workflow{Columns: updateReq.Columns, Rules: updateReq.Rules, Custom: true}
+		if err := updated.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := saveWorkflow(ctx, projectID, updated, updateReq.StatusMap); err != nil {
+			if _, ok := err.(workflowConflictError); ok {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			log.Printf("Failed to save workflow of project %d: %v", projectID, err)
+			http.Error(w, "Failed to save workflow", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(updated)
+
+	case "DELETE":
+		// Back to the default board; tasks in other columns must be mapped onto it
+		var resetReq struct {
+			StatusMap map[string]string `json:"status_map"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&resetReq); err != nil {
+				http.Error(w, "Invalid JSON", http.StatusBadRequest)
+				return
+			}
+		}
+
+		defaults := Workflow{Columns: defaultWorkflowColumns, Rules: defaultWorkflowRules}
+		if err := remapTaskStatuses(ctx, projectID, defaults, resetReq.StatusMap); err != nil {
+			if _, ok := err.(workflowConflictError); ok {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, "Failed to reset workflow", http.StatusInternalServerError)
+			return
+		}
+		if err := deleteWorkflow(ctx, projectID); err != nil {
+			log.Printf("Failed to reset workflow of project %d: %v", projectID, err)
+			http.Error(w, "Failed to reset workflow", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(defaults)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// workflowConflictError reports tasks left in a column the new workflow doesn't have
+type workflowConflictError struct {
+	status string
+	count  int
+}
+
+func (e workflowConflictError) Error() string {
+	return fmt.Sprintf("%d task(s) are in column %q, which the workflow no longer has; map it in status_map", e.count, e.status)
+}
+
+// remapTaskStatuses moves tasks out of columns the workflow doesn't have, as statusMap says
+func remapTaskStatuses(ctx context.Context, projectID int64, workflow Workflow, statusMap map[string]string) error {
+	tasks, err := queries.GetTasksByProjectID(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	orphans := map[string]int{}
+	for _, task := range tasks {
+		if _, ok := workflow.column(task.Status); !ok {
+			orphans[task.Status]++
+		}
+	}
+	for status, count := range orphans {
+		target, mapped := statusMap[status]
+		if _, ok := workflow.column(target); !mapped || !ok {
+			return workflowConflictError{status: status, count: count}
+		}
+	}
+	for status := range orphans {
+		err := queries.UpdateTaskStatusByProjectAndStatus(ctx, db.UpdateTaskStatusByProjectAndStatusParams{
+			ProjectID: projectID,
+			OldStatus: status,
+			NewStatus: statusMap[status],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func saveWorkflow(ctx context.Context, projectID int64, workflow Workflow, statusMap map[string]string) error {
+	if err := remapTaskStatuses(ctx, projectID, workflow, statusMap); err != nil {
+		return err
+	}
+	if err := deleteWorkflow(ctx, projectID); err != nil {
+		return err
+	}
+	for i, column := range workflow.Columns {
+		_, err := queries.CreateWorkflowColumn(ctx, db.CreateWorkflowColumnParams{
+			ProjectID: projectID,
+			StatusKey: column.Key,
+			Name:      column.Name,
+			Position:  int64(i),
+			WipLimit:  column.WIPLimit,
+			Color:     column.Color,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, rule := range workflow.Rules {
+		_, err := queries.CreateWorkflowRule(ctx, db.CreateWorkflowRuleParams{
+			ProjectID:    projectID,
+			Event:        rule.Event,
+			TargetStatus: rule.TargetStatus,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deleteWorkflow(ctx context.Context, projectID int64) error {
+	if err := queries.DeleteWorkflowRulesByProjectID(ctx, projectID); err != nil {
+		return err
+	}
+	return queries.DeleteWorkflowColumnsByProjectID(ctx, projectID)
+}
+
+// handleTaskMoveAPI handles POST /api/tasks/{id}/move with {status, position}; position is
+// the index within the column, omitted for the end
+func handleTaskMoveAPI(w http.ResponseWriter, r *http.Request, ctx context.Context, pathParts []string) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	taskID, err := strconv.ParseInt(pathParts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		return
+	}
+	task, err := queries.GetTask(ctx, taskID)
+	if err != nil {
+		http.Error(w, "Task not found", http.StatusNotFound)
+		return
+	}
+
+	var moveReq struct {
+		Status   string `json:"status"`
+		Position *int   `json:"position"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&moveReq); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if moveReq.Status == "" {
+		moveReq.Status = task.Status
+	}
+
+	column, err := validateTaskStatus(ctx, task.ProjectID, moveReq.Status, task.Status)
+	if err != nil {
+		writeTaskStatusError(w, err)
+		return
+	}
+
+	index := -1
+	if moveReq.Position != nil {
+		index = *moveReq.Position
+	}
+	moved, err := moveTask(ctx, task, column.Key, index)
+	if err != nil {
+		log.Printf("Failed to move task %d: %v", taskID, err)
+		http.Error(w, "Failed to move task", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(moved)
+}
+
+// taskStatusError is a status a person can't move a task to
+type taskStatusError struct {
+	message  string
+	conflict bool // WIP limit rather than an unknown column
+}
+
+func (e taskStatusError) Error() string { return e.message }
+
+// validateTaskStatus checks a task may be put in a column by hand: the column exists and,
+// unless the task is already there, has room
+func validateTaskStatus(ctx context.Context, projectID int64, status, currentStatus string) (WorkflowColumn, error) {
+	workflow, err := loadWorkflow(ctx, projectID)
+	if err != nil {
+		return WorkflowColumn{}, err
+	}
+	column, ok := workflow.column(status)
+	if !ok {
+		return WorkflowColumn{}, taskStatusError{message: fmt.Sprintf("Unknown status %q for this project", status)}
+	}
+	if status != currentStatus {
+		if err := checkWIPLimit(ctx, projectID, column); err != nil {
+			return WorkflowColumn{}, taskStatusError{message: err.Error(), conflict: true}
+		}
+	}
+	return column, nil
+}
+
+func writeTaskStatusError(w http.ResponseWriter, err error) {
+	if statusErr, ok := err.(taskStatusError); ok {
+		code := http.StatusBadRequest
+		if statusErr.conflict {
+			code = http.StatusConflict
+		}
+		http.Error(w, statusErr.message, code)
+		return
+	}
+	log.Printf("Failed to check task status: %v", err)
+	http.Error(w, "Failed to check task status", http.StatusInternalServerError)
+}